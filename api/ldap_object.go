@@ -19,6 +19,7 @@ package api
 
 import (
 	"context"
+	"time"
 
 	"github.com/gpu-ninja/operator-utils/reference"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -39,6 +40,7 @@ type LDAPObject interface {
 	reference.ObjectWithReferences
 	GetLDAPObjectSpec() *LDAPObjectSpec
 	SetStatus(status SimpleStatus)
+	GetStatus() *SimpleStatus
 	GetPhase() Phase
 }
 
@@ -48,8 +50,34 @@ type LDAPObjectSpec struct {
 	DirectoryRef LocalLDAPDirectoryReference `json:"directoryRef"`
 	// ParentRef is an optional reference to the parent of this object (typically an organizational unit).
 	ParentRef *reference.LocalObjectReference `json:"parentRef,omitempty"`
+	// Database is the name of the directory database (see spec.databases of
+	// the directory) the object is created in. If not specified, the object is
+	// created in the main database of the directory. Objects with a parent
+	// are always created in the database of their parent.
+	Database string `json:"database,omitempty"`
+	// ResyncPeriod is how often the entry is compared with the directory, so
+	// that changes made outside of the operator are detected. If not
+	// specified, the default resync period of the operator is used.
+	ResyncPeriod *metav1.Duration `json:"resyncPeriod,omitempty"`
+	// DriftPolicy is what to do when the entry in the directory has drifted
+	// from the object. Defaults to Correct.
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
 }
 
+// DriftPolicy is what to do when an entry has been changed outside of the operator.
+// +kubebuilder:validation:Enum=Correct;Report
+type DriftPolicy string
+
+const (
+	// DriftPolicyCorrect overwrites any changes made outside of the operator.
+	DriftPolicyCorrect DriftPolicy = "Correct"
+	// DriftPolicyReport only reports changes made outside of the operator.
+	DriftPolicyReport DriftPolicy = "Report"
+)
+
+// MinResyncPeriod is the shortest resync period that can be configured for an object.
+const MinResyncPeriod = 30 * time.Second
+
 // Phase is the current phase of the object.
 type Phase string
 
@@ -63,6 +91,7 @@ const (
 )
 
 // SimpleStatus is a basic status type that can be reused across multiple types.
+// +kubebuilder:object:generate=true
 type SimpleStatus struct {
 	// Phase is the current phase of the object.
 	Phase Phase `json:"phase,omitempty"`
@@ -70,6 +99,57 @@ type SimpleStatus struct {
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// Message is a human readable message indicating details about why the object is in this condition.
 	Message string `json:"message,omitempty"`
+	// DistinguishedName is the distinguished name of the entry in the directory.
+	DistinguishedName string `json:"distinguishedName,omitempty"`
+	// EntryUUID is the entryUUID of the entry in the directory.
+	EntryUUID string `json:"entryUUID,omitempty"`
+	// LastSyncTime is when the entry was last successfully synced with the directory.
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// Conditions represents the latest available observations of the objects current state.
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+const (
+	// ConditionTypeReady is true when the entry has been created or updated to
+	// match the current generation of the object.
+	ConditionTypeReady = "Ready"
+	// ConditionTypeSynced is true when the entry matched the object the last
+	// time it was synced with the directory.
+	ConditionTypeSynced = "Synced"
+	// ConditionTypeReferencesResolved is true when all the references of the
+	// object could be resolved.
+	ConditionTypeReferencesResolved = "ReferencesResolved"
+	// ConditionTypePaused is set when reconciliation of an object has been paused.
+	ConditionTypePaused = "Paused"
+	// ConditionTypeDrifted is set when the entry in the directory was found to
+	// differ from the object.
+	ConditionTypeDrifted = "Drifted"
+)
+
+// PausedAnnotation can be set to "true" on a directory or an object to stop
+// the operator from making any changes to it (eg. for manual recovery).
+// Pausing a directory also pauses every object in it.
+const PausedAnnotation = "ldap.gpu-ninja.com/paused"
+
+// IsPaused returns true if reconciliation of the object has been paused.
+func IsPaused(obj metav1.Object) bool {
+	return obj.GetAnnotations()[PausedAnnotation] == "true"
+}
+
+// DirectoryRefIndexKey is the field index used to look up LDAP objects by the
+// name of the directory they reference.
+const DirectoryRefIndexKey = "spec.directoryRef.name"
+
+// DirectoryRefIndexer extracts the name of the referenced directory for DirectoryRefIndexKey.
+func DirectoryRefIndexer(obj client.Object) []string {
+	ldapObj, ok := obj.(LDAPObject)
+	if !ok {
+		return nil
+	}
+
+	return []string{ldapObj.GetLDAPObjectSpec().DirectoryRef.Name}
 }
 
 // LocalLDAPDirectoryReference is a reference to an LDAPDirectory.
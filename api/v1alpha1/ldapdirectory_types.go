@@ -19,10 +19,14 @@ package v1alpha1
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/gpu-ninja/operator-utils/reference"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -34,6 +38,13 @@ const (
 	LDAPDirectoryPhasePending LDAPDirectoryPhase = "Pending"
 	LDAPDirectoryPhaseReady   LDAPDirectoryPhase = "Ready"
 	LDAPDirectoryPhaseFailed  LDAPDirectoryPhase = "Failed"
+	// LDAPDirectoryPhaseUpgrading means the directory is being migrated to a new image.
+	LDAPDirectoryPhaseUpgrading LDAPDirectoryPhase = "Upgrading"
+	// LDAPDirectoryPhaseMigrating means the directory is a read-only replica of
+	// the migration source, until it is cut over.
+	LDAPDirectoryPhaseMigrating LDAPDirectoryPhase = "Migrating"
+	// LDAPDirectoryPhaseSuspended means the directory has been scaled down to zero replicas.
+	LDAPDirectoryPhaseSuspended LDAPDirectoryPhase = "Suspended"
 )
 
 type LDAPDirectoryConditionType string
@@ -42,21 +53,91 @@ const (
 	LDAPDirectoryConditionTypePending LDAPDirectoryConditionType = "Pending"
 	LDAPDirectoryConditionTypeReady   LDAPDirectoryConditionType = "Ready"
 	LDAPDirectoryConditionTypeFailed  LDAPDirectoryConditionType = "Failed"
+	// LDAPDirectoryConditionTypeLDIFImported records the result of importing the bootstrap LDIF.
+	LDAPDirectoryConditionTypeLDIFImported LDAPDirectoryConditionType = "LDIFImported"
+	// LDAPDirectoryConditionTypeConfigSynced records whether the runtime
+	// configuration (cn=config) of the directory is up to date.
+	LDAPDirectoryConditionTypeConfigSynced LDAPDirectoryConditionType = "ConfigSynced"
+	// LDAPDirectoryConditionTypeOrganizationSynced records whether the root entry
+	// of the directory reflects the current domain and organization.
+	LDAPDirectoryConditionTypeOrganizationSynced LDAPDirectoryConditionType = "OrganizationSynced"
+	// LDAPDirectoryConditionTypePaused is set when reconciliation of the directory
+	// has been paused (using the ldap.gpu-ninja.com/paused annotation).
+	LDAPDirectoryConditionTypePaused LDAPDirectoryConditionType = "Paused"
+	// LDAPDirectoryConditionTypeResizing is set while the persistent volume
+	// claims of the directory are being expanded.
+	LDAPDirectoryConditionTypeResizing LDAPDirectoryConditionType = "Resizing"
+	// LDAPDirectoryConditionTypeUpgraded records the result of the last image upgrade.
+	LDAPDirectoryConditionTypeUpgraded LDAPDirectoryConditionType = "Upgraded"
+	// LDAPDirectoryConditionTypeDeletionBlocked is set while deletion of the
+	// directory is held because objects still reference it.
+	LDAPDirectoryConditionTypeDeletionBlocked LDAPDirectoryConditionType = "DeletionBlocked"
+	// LDAPDirectoryConditionTypeConfigPatched records whether all of the config
+	// patches of the directory have been applied.
+	LDAPDirectoryConditionTypeConfigPatched LDAPDirectoryConditionType = "ConfigPatched"
+	// LDAPDirectoryConditionTypeMigrated records the progress of a migration
+	// from an existing OpenLDAP server. It is true once the directory has been cut over.
+	LDAPDirectoryConditionTypeMigrated LDAPDirectoryConditionType = "Migrated"
+	// LDAPDirectoryConditionTypeCloned records the result of cloning the
+	// contents of another directory.
+	LDAPDirectoryConditionTypeCloned LDAPDirectoryConditionType = "Cloned"
+	// LDAPDirectoryConditionTypeSuspended is set while the directory is suspended.
+	LDAPDirectoryConditionTypeSuspended LDAPDirectoryConditionType = "Suspended"
 )
 
+// LDAPDirectoryDeletionPolicy determines what happens to the LDAP objects
+// (users, groups, and organizational units) of a directory when it is deleted.
+// +kubebuilder:validation:Enum=Block;Cascade;Orphan
+type LDAPDirectoryDeletionPolicy string
+
+const (
+	// LDAPDirectoryDeletionPolicyBlock holds deletion of the directory until
+	// all of its objects have been deleted.
+	LDAPDirectoryDeletionPolicyBlock LDAPDirectoryDeletionPolicy = "Block"
+	// LDAPDirectoryDeletionPolicyCascade deletes the objects of the directory
+	// (and their entries) before the directory is deleted.
+	LDAPDirectoryDeletionPolicyCascade LDAPDirectoryDeletionPolicy = "Cascade"
+	// LDAPDirectoryDeletionPolicyOrphan removes the finalizers of the objects
+	// of the directory, so they can be deleted without the directory.
+	LDAPDirectoryDeletionPolicyOrphan LDAPDirectoryDeletionPolicy = "Orphan"
+)
+
+// LogLevel is a symbolic OpenLDAP log level.
+// See: https://www.openldap.org/doc/admin26/slapdconfig.html#olcLogLevel:%20%3Clevel%3E
+// +kubebuilder:validation:Enum=any;trace;packets;args;conns;ber;filter;config;acl;stats;stats2;shell;parse;sync;none
+type LogLevel string
+
 // LDAPDirectorySpec defines the desired state of the LDAP directory.
+// +kubebuilder:validation:XValidation:rule="has(self.external) || (has(self.image) && has(self.domain) && has(self.certificateSecretRef))",message="image, domain and certificateSecretRef are required unless external is set"
 type LDAPDirectorySpec struct {
 	// Image is the container image that will be used to run the LDAP directory.
-	Image string `json:"image"`
+	// When changed, the contents of the directory are exported with the current
+	// image and imported with the new image (the directory is unavailable while
+	// upgrading). If the import fails, the directory is rolled back to the current image.
+	Image string `json:"image,omitempty"`
 	// Domain is the domain of the organization that owns the LDAP directory.
-	Domain string `json:"domain"`
+	// The domain determines the distinguished name of every entry in the
+	// directory and so cannot be changed once set.
+	//+kubebuilder:validation:XValidation:rule="self == oldSelf",message="domain is immutable"
+	Domain string `json:"domain,omitempty"`
 	// Organization is the name of the organization that owns the LDAP directory.
-	Organization string `json:"organization"`
+	// Changes are applied to the root entry of the directory without a restart.
+	Organization string `json:"organization,omitempty"`
 	// CertificateSecretRef is a reference to a secret that contains the
 	// TLS certificate and key that will be used to secure the LDAP directory.
-	CertificateSecretRef reference.LocalSecretReference `json:"certificateSecretRef"`
+	CertificateSecretRef *reference.LocalSecretReference `json:"certificateSecretRef,omitempty"`
+	// External configures the directory to target an existing, externally
+	// managed LDAP server. When set, no statefulset, service or admin password
+	// secret will be created for the directory.
+	External *LDAPDirectoryExternal `json:"external,omitempty"`
 	// DebugLevel controls the verbosity of the directory logs.
+	// Changing the debug level requires a restart of the directory,
+	// prefer LogLevel for runtime changes.
 	DebugLevel *int `json:"debugLevel,omitempty"`
+	// LogLevel is a list of OpenLDAP log levels (olcLogLevel) that will be
+	// applied to the running directory without a restart.
+	// If not specified, the log level is left unchanged.
+	LogLevel []LogLevel `json:"logLevel,omitempty"`
 	// FileDescriptorLimit controls the maximum number of file
 	// descriptors that the LDAP directory can open.
 	// See: https://github.com/docker/docker/issues/8231
@@ -71,10 +152,270 @@ type LDAPDirectorySpec struct {
 	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
 	// VolumeClaimTemplates are volume claim templates for the LDAP directory pod.
 	// A default "config", and "data" volume claim template will be used if not specified
-	// (but can be overridden).
+	// (but can be overridden). Only storage requests can be changed after creation,
+	// and only increased (requires a storage class that allows volume expansion).
 	VolumeClaimTemplates []corev1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty"`
 	// Resources are resource requirements for the LDAP directory container.
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// Bootstrap is optional configuration used to seed the directory with
+	// initial entries.
+	Bootstrap *LDAPDirectoryBootstrap `json:"bootstrap,omitempty"`
+	// Audit enables an audit trail of every write to the directory.
+	Audit *LDAPDirectoryAudit `json:"audit,omitempty"`
+	// ChangeFeed enables delivery of directory changes to HTTP sinks as CloudEvents.
+	ChangeFeed *LDAPDirectoryChangeFeed `json:"changeFeed,omitempty"`
+	// NetworkPolicy restricts which peers can connect to the directory pods.
+	// If not specified, no network policy will be created.
+	NetworkPolicy *LDAPDirectoryNetworkPolicy `json:"networkPolicy,omitempty"`
+	// LoadBalancer deploys the OpenLDAP load balancer (lloadd) in front of the
+	// directory pods. If not specified, clients connect to the directory directly.
+	LoadBalancer *LDAPDirectoryLoadBalancer `json:"loadBalancer,omitempty"`
+	// DeletionPolicy determines what happens to the objects of the directory
+	// when it is deleted. Defaults to Block.
+	//+kubebuilder:default=Block
+	DeletionPolicy LDAPDirectoryDeletionPolicy `json:"deletionPolicy,omitempty"`
+	// ConfigPatches are LDIF records that will be applied, in order, to the
+	// cn=config database of the directory once it is ready. This is an escape
+	// hatch for settings that are not otherwise exposed by the operator.
+	// Patches are only reapplied when their content changes (removing a
+	// patch does not revert its changes).
+	//+listType=map
+	//+listMapKey=name
+	ConfigPatches []LDAPDirectoryConfigPatch `json:"configPatches,omitempty"`
+	// Databases are additional databases (suffixes) served by the directory,
+	// alongside the main database derived from the domain. Objects are created
+	// in an additional database by setting their spec.database. Adding a
+	// database restarts the directory, databases cannot be removed, and their
+	// suffix cannot be changed.
+	//+listType=map
+	//+listMapKey=name
+	Databases []LDAPDirectoryDatabase `json:"databases,omitempty"`
+	// Migration configures the directory as a temporary syncrepl consumer of an
+	// existing OpenLDAP server, so its contents can be migrated with minimal
+	// downtime. The directory is read-only (writes are referred to the source)
+	// until it is cut over.
+	Migration *LDAPDirectoryMigration `json:"migration,omitempty"`
+	// CloneFrom seeds the directory with the entries of another directory
+	// (eg. to create a staging copy of a production directory). The entries
+	// are taken from a consistent (slapcat) export of the source directory,
+	// and imported once the directory first becomes ready.
+	CloneFrom *LDAPDirectoryClone `json:"cloneFrom,omitempty"`
+	// Suspend scales the directory down to zero replicas, its volumes and
+	// secrets are retained so it can be resumed (by unsetting suspend).
+	// Pending upgrades are deferred until the directory is resumed.
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// CloneNamespacesAnnotation can be set on a directory to allow it to be cloned
+// by directories in other namespaces. It is a comma separated list of
+// namespaces, or "*" for every namespace.
+const CloneNamespacesAnnotation = "ldap.gpu-ninja.com/clone-namespaces"
+
+// AllowsCloneFrom returns true if the directory can be cloned by a directory
+// in the given namespace.
+func (d *LDAPDirectory) AllowsCloneFrom(namespace string) bool {
+	if d.Namespace == namespace {
+		return true
+	}
+
+	for _, allowed := range strings.Split(d.Annotations[CloneNamespacesAnnotation], ",") {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" || allowed == namespace {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LDAPDirectoryClone configures how a directory is cloned.
+type LDAPDirectoryClone struct {
+	// DirectoryRef is a reference to the directory that will be cloned. The
+	// source directory must be managed by the operator (not external), and
+	// have the same domain. Directories in other namespaces must allow the
+	// namespace with the ldap.gpu-ninja.com/clone-namespaces annotation.
+	DirectoryRef LDAPDirectoryCloneReference `json:"directoryRef"`
+	// Scrub are rules that are applied to every entry before it is imported
+	// (eg. to remove passwords, or rewrite email addresses).
+	Scrub []LDAPDirectoryScrubRule `json:"scrub,omitempty"`
+}
+
+// LDAPDirectoryCloneReference is a reference to a directory in any namespace.
+type LDAPDirectoryCloneReference struct {
+	// Name of the referenced LDAPDirectory.
+	Name string `json:"name"`
+	// Namespace of the referenced LDAPDirectory, defaults to the namespace
+	// of the directory being cloned to.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// LDAPDirectoryScrubRule rewrites, or removes, an attribute of cloned entries.
+type LDAPDirectoryScrubRule struct {
+	// Attribute is the name of the attribute (eg. userPassword).
+	Attribute string `json:"attribute"`
+	// Value replaces every value of the attribute, in entries that have it.
+	// References of the form $(attribute) are replaced with the first value
+	// of another attribute of the entry (eg. "$(uid)@staging.example.com").
+	// If not specified, the attribute is removed.
+	Value *string `json:"value,omitempty"`
+}
+
+// LDAPDirectoryMigration configures a migration from an existing OpenLDAP server.
+type LDAPDirectoryMigration struct {
+	// Source is the OpenLDAP server being migrated from. The source must have
+	// the syncprov overlay enabled on the database being migrated.
+	Source LDAPDirectoryMigrationSource `json:"source"`
+	// Cutover removes the syncrepl consumer configuration, making the directory
+	// writable. Once cut over, the directory no longer receives changes from
+	// the source, and the migration cannot be resumed.
+	Cutover bool `json:"cutover,omitempty"`
+}
+
+// LDAPDirectoryMigrationSource describes the OpenLDAP server being migrated from.
+type LDAPDirectoryMigrationSource struct {
+	// URL is the URL of the source server (eg. ldaps://ldap.example.com).
+	URL string `json:"url"`
+	// BindDN is the distinguished name used to bind to the source server, it
+	// must be able to read every entry (and operational attribute) under the search base.
+	BindDN string `json:"bindDN"`
+	// BindPasswordSecretRef is a reference to a secret containing the
+	// bind password (under the "password" key).
+	BindPasswordSecretRef reference.LocalSecretReference `json:"bindPasswordSecretRef"`
+	// SearchBase is the base distinguished name of the entries that will be
+	// replicated. Defaults to the base distinguished name of the directory.
+	SearchBase string `json:"searchBase,omitempty"`
+	// CASecretRef is an optional reference to a secret containing the CA
+	// bundle (under the "ca.crt" key) used to verify the source certificate.
+	// If not specified, the system trust store will be used.
+	CASecretRef *reference.LocalSecretReference `json:"caSecretRef,omitempty"`
+}
+
+// LDAPDirectoryDatabase is an additional mdb database of the directory.
+// Each database has its own root DN (cn=admin,<suffix>), the operator manages
+// the entries of every database as the administrator of the main database.
+type LDAPDirectoryDatabase struct {
+	// Name uniquely identifies the database, it is referenced by the
+	// spec.database field of LDAP objects. The name "accesslog" is reserved.
+	//+kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	//+kubebuilder:validation:MaxLength=63
+	Name string `json:"name"`
+	// Suffix is the base distinguished name of the database (eg. dc=partners).
+	// The first relative distinguished name must be a dc or o attribute.
+	Suffix string `json:"suffix"`
+	// Organization is the name of the organization of the root entry of the
+	// database. Defaults to the value of the first relative distinguished name.
+	Organization string `json:"organization,omitempty"`
+	// RootPasswordSecretRef is an optional reference to a secret containing
+	// the password of the root DN of the database (under the "password" key).
+	// If not specified, a random password is generated and stored in the
+	// "ldap-<directory>.<database>-admin-password" secret.
+	RootPasswordSecretRef *reference.LocalSecretReference `json:"rootPasswordSecretRef,omitempty"`
+}
+
+// LDAPDirectoryConfigPatch is a set of LDIF change records (typically
+// "changetype: modify") for entries in cn=config.
+// Exactly one of LDIF, ConfigMapRef or SecretRef must be specified.
+type LDAPDirectoryConfigPatch struct {
+	// Name uniquely identifies the patch.
+	Name string `json:"name"`
+	// LDIF is the inline LDIF content of the patch.
+	LDIF string `json:"ldif,omitempty"`
+	// LDIFSource is a reference to the LDIF content of the patch.
+	LDIFSource `json:",inline"`
+}
+
+// LDAPDirectoryLoadBalancer configures the lloadd load balancer tier.
+// The load balancer is exposed by the "ldap-<name>-lloadd" service, and uses the
+// same certificate as the directory. The certificate must also be valid for the
+// directory pod hostnames (eg. "*.ldap.<namespace>.svc.cluster.local") as
+// these are used to connect to the backends. Directories are currently served
+// by a single pod, so the load balancer has one backend, and pools (and
+// multiplexes) client connections rather than spreading load.
+type LDAPDirectoryLoadBalancer struct {
+	// Replicas is the number of load balancer replicas. Defaults to 2.
+	//+kubebuilder:validation:Minimum=1
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Resources are resource requirements for the load balancer container.
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// LDAPDirectoryNetworkPolicy configures the network policy of the directory.
+// The operator is always allowed to connect to the directory.
+type LDAPDirectoryNetworkPolicy struct {
+	// From is a list of peers (pod / namespace selectors or CIDRs) that are
+	// allowed to connect to the directory. If empty, only the operator will
+	// be able to connect.
+	From []networkingv1.NetworkPolicyPeer `json:"from,omitempty"`
+}
+
+// LDAPDirectoryChangeFeed configures the change feed of the directory.
+// Changes are recorded by the accesslog overlay (in the cn=accesslog database)
+// and delivered by the operator, in order, at least once.
+type LDAPDirectoryChangeFeed struct {
+	// Sinks are the HTTP endpoints that every change will be delivered to.
+	//+kubebuilder:validation:MinItems=1
+	Sinks []LDAPDirectoryChangeFeedSink `json:"sinks"`
+	// PollInterval is how often the accesslog is checked for new changes.
+	// Defaults to 10s.
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+	// MaxAttempts is the number of delivery attempts made (with exponential
+	// backoff) before delivery is retried from the next poll. Defaults to 5.
+	//+kubebuilder:validation:Minimum=1
+	MaxAttempts *int `json:"maxAttempts,omitempty"`
+}
+
+// LDAPDirectoryChangeFeedSink is a HTTP endpoint that accepts CloudEvents.
+type LDAPDirectoryChangeFeedSink struct {
+	// URL is the URL of the HTTP endpoint.
+	URL string `json:"url"`
+}
+
+// LDAPDirectoryAudit configures the auditlog overlay of the directory.
+// Every change is written to an audit log which a sidecar container streams
+// to stdout as one JSON object per change record.
+type LDAPDirectoryAudit struct {
+	// MaxSize is the size after which the audit log will be rotated.
+	// Defaults to 16Mi.
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+	// Resources are resource requirements for the audit sidecar container.
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// LDAPDirectoryExternal describes an existing, externally managed LDAP server.
+type LDAPDirectoryExternal struct {
+	// URLs is a list of LDAP server URLs (eg. ldaps://ldap.example.com), tried in order.
+	//+kubebuilder:validation:MinItems=1
+	URLs []string `json:"urls"`
+	// BaseDN is the base distinguished name of the directory.
+	BaseDN string `json:"baseDN"`
+	// BindDN is the distinguished name used to bind to the directory.
+	BindDN string `json:"bindDN"`
+	// BindPasswordSecretRef is a reference to a secret containing the
+	// bind password (under the "password" key).
+	BindPasswordSecretRef reference.LocalSecretReference `json:"bindPasswordSecretRef"`
+	// CASecretRef is an optional reference to a secret containing the CA
+	// bundle (under the "ca.crt" key) used to verify the server certificate.
+	// If not specified, the system trust store will be used.
+	CASecretRef *reference.LocalSecretReference `json:"caSecretRef,omitempty"`
+}
+
+// LDAPDirectoryBootstrap configures how a new LDAP directory is seeded.
+type LDAPDirectoryBootstrap struct {
+	// LDIF is a list of LDIF sources whose entries will be imported, in order,
+	// once the directory first becomes ready. Entries that already exist are skipped.
+	LDIF []LDIFSource `json:"ldif,omitempty"`
+}
+
+// LDIFSource is a reference to LDIF content stored in a config map or secret.
+// Exactly one of ConfigMapRef or SecretRef must be specified.
+type LDIFSource struct {
+	// ConfigMapRef is a reference to a config map containing LDIF.
+	ConfigMapRef *reference.LocalConfigMapReference `json:"configMapRef,omitempty"`
+	// SecretRef is a reference to a secret containing LDIF.
+	SecretRef *reference.LocalSecretReference `json:"secretRef,omitempty"`
+	// Key is the key within the config map or secret that contains the LDIF.
+	// If not specified, all keys will be imported in lexical order.
+	Key string `json:"key,omitempty"`
 }
 
 // LDAPDirectoryStatus defines the observed state of the LDAP directory.
@@ -85,6 +426,104 @@ type LDAPDirectoryStatus struct {
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// Conditions represents the latest available observations of the LDAP directories current state.
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// ChangeFeed is the current state of the change feed.
+	ChangeFeed *LDAPDirectoryChangeFeedStatus `json:"changeFeed,omitempty"`
+	// CurrentImage is the image the contents of the directory were last written with.
+	CurrentImage string `json:"currentImage,omitempty"`
+	// Upgrade is the state of the current (or last failed) image upgrade.
+	Upgrade *LDAPDirectoryUpgradeStatus `json:"upgrade,omitempty"`
+	// ConfigPatches is the state of each of the config patches of the directory.
+	//+listType=map
+	//+listMapKey=name
+	ConfigPatches []LDAPDirectoryConfigPatchStatus `json:"configPatches,omitempty"`
+	// Migration is the state of the migration from an existing OpenLDAP server.
+	Migration *LDAPDirectoryMigrationStatus `json:"migration,omitempty"`
+}
+
+// LDAPDirectoryMigrationStatus is the state of a migration.
+type LDAPDirectoryMigrationStatus struct {
+	// SourceEntries is the number of entries under the search base on the source server.
+	SourceEntries *int `json:"sourceEntries,omitempty"`
+	// Entries is the number of entries that have been replicated to the directory.
+	Entries *int `json:"entries,omitempty"`
+	// SourceContextCSN is the most recent change sequence number of the source server.
+	SourceContextCSN string `json:"sourceContextCSN,omitempty"`
+	// ContextCSN is the most recent change sequence number replicated to the directory.
+	ContextCSN string `json:"contextCSN,omitempty"`
+	// Lag is how far the directory is behind the source server, based on the
+	// timestamps of their context change sequence numbers.
+	Lag *metav1.Duration `json:"lag,omitempty"`
+	// LastCheckedTime is when the replication state was last checked.
+	LastCheckedTime *metav1.Time `json:"lastCheckedTime,omitempty"`
+	// CutoverTime is when the directory was cut over.
+	CutoverTime *metav1.Time `json:"cutoverTime,omitempty"`
+	// Message is a human readable message describing why the replication
+	// state could not be checked.
+	Message string `json:"message,omitempty"`
+}
+
+// LDAPDirectoryConfigPatchStatus is the state of a config patch.
+type LDAPDirectoryConfigPatchStatus struct {
+	// Name is the name of the patch.
+	Name string `json:"name"`
+	// Hash is the hash of the content of the patch, as last applied (or attempted).
+	Hash string `json:"hash,omitempty"`
+	// Applied is true if the patch has been successfully applied.
+	Applied bool `json:"applied"`
+	// LastAppliedTime is when the patch was last successfully applied.
+	LastAppliedTime *metav1.Time `json:"lastAppliedTime,omitempty"`
+	// Message is a human readable message describing why the patch could not be applied.
+	Message string `json:"message,omitempty"`
+}
+
+// LDAPDirectoryUpgradeStep is a step of the image upgrade workflow.
+type LDAPDirectoryUpgradeStep string
+
+const (
+	// LDAPDirectoryUpgradeStepExport exports the directory (with slapcat) using the current image.
+	LDAPDirectoryUpgradeStepExport LDAPDirectoryUpgradeStep = "Export"
+	// LDAPDirectoryUpgradeStepImport imports the directory (with slapadd) using the new image.
+	LDAPDirectoryUpgradeStepImport LDAPDirectoryUpgradeStep = "Import"
+	// LDAPDirectoryUpgradeStepVerify waits for the directory to become ready with
+	// the new image. The backup taken during export is kept until then, and the
+	// upgrade is rolled back if the directory does not become ready.
+	LDAPDirectoryUpgradeStepVerify LDAPDirectoryUpgradeStep = "Verify"
+	// LDAPDirectoryUpgradeStepRollback restores the directory from the backup taken during export.
+	LDAPDirectoryUpgradeStepRollback LDAPDirectoryUpgradeStep = "Rollback"
+	// LDAPDirectoryUpgradeStepRolledBack means the upgrade failed and the
+	// directory is running the current image. The upgrade will be retried if the image is changed.
+	LDAPDirectoryUpgradeStepRolledBack LDAPDirectoryUpgradeStep = "RolledBack"
+)
+
+// LDAPDirectoryUpgradeStatus is the state of an image upgrade.
+type LDAPDirectoryUpgradeStatus struct {
+	// FromImage is the image the directory is being upgraded from.
+	FromImage string `json:"fromImage"`
+	// ToImage is the image the directory is being upgraded to.
+	ToImage string `json:"toImage"`
+	// Step is the current step of the upgrade.
+	Step LDAPDirectoryUpgradeStep `json:"step"`
+	// ExportedEntries is the number of entries exported from the directory.
+	ExportedEntries *int `json:"exportedEntries,omitempty"`
+	// ExportedDatabaseEntries is the number of entries exported from each
+	// additional database, keyed by the name of the database.
+	ExportedDatabaseEntries map[string]int `json:"exportedDatabaseEntries,omitempty"`
+	// VerifyStartTime is when the directory was started with the new image.
+	VerifyStartTime *metav1.Time `json:"verifyStartTime,omitempty"`
+	// Message is a human readable message describing why the upgrade failed.
+	Message string `json:"message,omitempty"`
+}
+
+// LDAPDirectoryChangeFeedStatus is the current state of the change feed.
+type LDAPDirectoryChangeFeedStatus struct {
+	// Cursor is the accesslog reqStart timestamp up to which every change has
+	// been delivered to every sink.
+	Cursor string `json:"cursor,omitempty"`
+	// LastDeliveryTime is when a change was last delivered.
+	LastDeliveryTime *metav1.Time `json:"lastDeliveryTime,omitempty"`
+	// FailedAttempts is the number of consecutive failed attempts to deliver
+	// the change after the cursor.
+	FailedAttempts int `json:"failedAttempts,omitempty"`
 }
 
 // LDAPDirectory is a LDAP directory.
@@ -110,18 +549,202 @@ type LDAPDirectoryList struct {
 }
 
 func (s *LDAPDirectory) GetDistinguishedName(_ context.Context, _ client.Reader, _ *runtime.Scheme) (string, error) {
+	if s.Spec.External != nil {
+		return s.Spec.External.BaseDN, nil
+	}
+
 	return "dc=" + strings.Join(strings.Split(s.Spec.Domain, "."), ",dc="), nil
 }
 
+// GetDatabaseDistinguishedName returns the base distinguished name of the
+// named database of the directory, or of the main database if the name is empty.
+func (s *LDAPDirectory) GetDatabaseDistinguishedName(name string) (string, error) {
+	if name == "" {
+		return s.GetDistinguishedName(context.Background(), nil, nil)
+	}
+
+	if s.Spec.External != nil {
+		return "", fmt.Errorf("external directories do not support additional databases")
+	}
+
+	for _, database := range s.Spec.Databases {
+		if database.Name == name {
+			return database.Suffix, nil
+		}
+	}
+
+	return "", fmt.Errorf("database %q not found in directory", name)
+}
+
 func (s *LDAPDirectory) ResolveReferences(ctx context.Context, reader client.Reader, scheme *runtime.Scheme) (bool, error) {
-	_, ok, err := s.Spec.CertificateSecretRef.Resolve(ctx, reader, scheme, s)
-	if !ok || err != nil {
-		return ok, err
+	if s.Spec.CertificateSecretRef != nil {
+		_, ok, err := s.Spec.CertificateSecretRef.Resolve(ctx, reader, scheme, s)
+		if !ok || err != nil {
+			return ok, err
+		}
+	}
+
+	if s.Spec.External != nil {
+		_, ok, err := s.Spec.External.BindPasswordSecretRef.Resolve(ctx, reader, scheme, s)
+		if !ok || err != nil {
+			return ok, err
+		}
+
+		if s.Spec.External.CASecretRef != nil {
+			_, ok, err = s.Spec.External.CASecretRef.Resolve(ctx, reader, scheme, s)
+			if !ok || err != nil {
+				return ok, err
+			}
+		}
+	}
+
+	if s.Spec.Bootstrap != nil {
+		for _, source := range s.Spec.Bootstrap.LDIF {
+			_, ok, err := source.Resolve(ctx, reader, scheme, s)
+			if !ok || err != nil {
+				return ok, err
+			}
+		}
+	}
+
+	if s.Spec.Migration != nil {
+		_, ok, err := s.Spec.Migration.Source.BindPasswordSecretRef.Resolve(ctx, reader, scheme, s)
+		if !ok || err != nil {
+			return ok, err
+		}
+
+		if s.Spec.Migration.Source.CASecretRef != nil {
+			_, ok, err := s.Spec.Migration.Source.CASecretRef.Resolve(ctx, reader, scheme, s)
+			if !ok || err != nil {
+				return ok, err
+			}
+		}
+	}
+
+	for _, database := range s.Spec.Databases {
+		if database.RootPasswordSecretRef != nil {
+			_, ok, err := database.RootPasswordSecretRef.Resolve(ctx, reader, scheme, s)
+			if !ok || err != nil {
+				return ok, err
+			}
+		}
 	}
 
 	return true, nil
 }
 
+// Resolve resolves the referenced config map or secret.
+func (s *LDIFSource) Resolve(ctx context.Context, reader client.Reader, scheme *runtime.Scheme, parent runtime.Object) (runtime.Object, bool, error) {
+	switch {
+	case s.ConfigMapRef != nil:
+		return s.ConfigMapRef.Resolve(ctx, reader, scheme, parent)
+	case s.SecretRef != nil:
+		return s.SecretRef.Resolve(ctx, reader, scheme, parent)
+	default:
+		return nil, false, fmt.Errorf("ldif source must reference a config map or secret")
+	}
+}
+
+// Data returns the LDIF content of the resolved source object.
+func (s *LDIFSource) Data(obj runtime.Object) ([][]byte, error) {
+	data := make(map[string][]byte)
+	switch obj := obj.(type) {
+	case *corev1.ConfigMap:
+		for k, v := range obj.Data {
+			data[k] = []byte(v)
+		}
+		for k, v := range obj.BinaryData {
+			data[k] = v
+		}
+	case *corev1.Secret:
+		for k, v := range obj.Data {
+			data[k] = v
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ldif source type: %T", obj)
+	}
+
+	if s.Key != "" {
+		v, ok := data[s.Key]
+		if !ok {
+			return nil, fmt.Errorf("key %q not found in ldif source", s.Key)
+		}
+
+		return [][]byte{v}, nil
+	}
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var contents [][]byte
+	for _, k := range keys {
+		contents = append(contents, data[k])
+	}
+
+	return contents, nil
+}
+
+// GetVolumeClaimTemplates returns the volume claim templates of the directory pod,
+// the default "config" and "data" templates are replaced by any templates with the same name.
+func (d *LDAPDirectory) GetVolumeClaimTemplates() []corev1.PersistentVolumeClaim {
+	volumeClaimTemplates := defaultVolumeClaimTemplates()
+
+	for _, volumeClaimTemplate := range d.Spec.VolumeClaimTemplates {
+		var found bool
+		for i, existingVolumeClaimTemplate := range volumeClaimTemplates {
+			if existingVolumeClaimTemplate.Name == volumeClaimTemplate.Name {
+				volumeClaimTemplates[i] = volumeClaimTemplate
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			volumeClaimTemplates = append(volumeClaimTemplates, volumeClaimTemplate)
+		}
+	}
+
+	return volumeClaimTemplates
+}
+
+func defaultVolumeClaimTemplates() []corev1.PersistentVolumeClaim {
+	return []corev1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "config",
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{
+					corev1.ReadWriteOnce,
+				},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse("10Mi"),
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "data",
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{
+					corev1.ReadWriteOnce,
+				},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse("100Mi"),
+					},
+				},
+			},
+		},
+	}
+}
+
 func init() {
 	SchemeBuilder.Register(&LDAPDirectory{}, &LDAPDirectoryList{})
 }
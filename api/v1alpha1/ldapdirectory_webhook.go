@@ -0,0 +1,470 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/gpu-ninja/ldap-operator/api"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:webhook:path=/mutate-ldap-gpu-ninja-com-v1alpha1-ldapdirectory,mutating=true,failurePolicy=fail,sideEffects=None,groups=ldap.gpu-ninja.com,resources=ldapdirectories,verbs=create;update,versions=v1alpha1,name=mldapdirectory.ldap.gpu-ninja.com,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-ldap-gpu-ninja-com-v1alpha1-ldapdirectory,mutating=false,failurePolicy=fail,sideEffects=None,groups=ldap.gpu-ninja.com,resources=ldapdirectories,verbs=create;update,versions=v1alpha1,name=vldapdirectory.ldap.gpu-ninja.com,admissionReviewVersions=v1
+
+// DefaultLoadBalancerReplicas is the number of load balancer replicas (if not specified).
+const DefaultLoadBalancerReplicas = 2
+
+// attributeNamePattern matches LDAP attribute descriptions (RFC 4512 keystring).
+var attributeNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*$`)
+
+// LDAPDirectoryWebhook validates and defaults LDAP directories.
+// +kubebuilder:object:generate=false
+type LDAPDirectoryWebhook struct{}
+
+func (d *LDAPDirectory) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(d).
+		WithDefaulter(&LDAPDirectoryWebhook{}).
+		WithValidator(&LDAPDirectoryWebhook{}).
+		Complete()
+}
+
+func (w *LDAPDirectoryWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	directory, ok := obj.(*LDAPDirectory)
+	if !ok {
+		return fmt.Errorf("expected a LDAPDirectory but got a %T", obj)
+	}
+
+	if directory.Spec.External == nil && directory.Spec.Organization == "" {
+		directory.Spec.Organization = directory.Spec.Domain
+	}
+
+	if directory.Spec.LoadBalancer != nil && directory.Spec.LoadBalancer.Replicas == nil {
+		directory.Spec.LoadBalancer.Replicas = ptr.To(int32(DefaultLoadBalancerReplicas))
+	}
+
+	if directory.Spec.DeletionPolicy == "" {
+		directory.Spec.DeletionPolicy = LDAPDirectoryDeletionPolicyBlock
+	}
+
+	return nil
+}
+
+func (w *LDAPDirectoryWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	directory, ok := obj.(*LDAPDirectory)
+	if !ok {
+		return nil, fmt.Errorf("expected a LDAPDirectory but got a %T", obj)
+	}
+
+	return nil, directory.invalid(directory.validate())
+}
+
+func (w *LDAPDirectoryWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldDirectory, ok := oldObj.(*LDAPDirectory)
+	if !ok {
+		return nil, fmt.Errorf("expected a LDAPDirectory but got a %T", oldObj)
+	}
+
+	directory, ok := newObj.(*LDAPDirectory)
+	if !ok {
+		return nil, fmt.Errorf("expected a LDAPDirectory but got a %T", newObj)
+	}
+
+	// Directories that are being deleted, or whose spec is unchanged, aren't
+	// validated. Otherwise stricter validation (added since the directory was
+	// created) would block removing its finalizer, or updating its metadata.
+	if !directory.DeletionTimestamp.IsZero() || equality.Semantic.DeepEqual(directory.Spec, oldDirectory.Spec) {
+		return nil, nil
+	}
+
+	errs := directory.validate()
+
+	specPath := field.NewPath("spec")
+
+	if (directory.Spec.External == nil) != (oldDirectory.Spec.External == nil) {
+		errs = append(errs, field.Forbidden(specPath.Child("external"),
+			"a directory cannot be changed between managed and external"))
+	}
+
+	databasesPath := specPath.Child("databases")
+	for _, oldDatabase := range oldDirectory.Spec.Databases {
+		var found bool
+		for _, database := range directory.Spec.Databases {
+			if database.Name == oldDatabase.Name {
+				found = true
+
+				if !strings.EqualFold(database.Suffix, oldDatabase.Suffix) {
+					errs = append(errs, field.Forbidden(databasesPath.Key(database.Name).Child("suffix"), "suffix is immutable"))
+				}
+			}
+		}
+
+		if !found {
+			errs = append(errs, field.Forbidden(databasesPath.Key(oldDatabase.Name), "databases cannot be removed"))
+		}
+	}
+
+	migrationPath := specPath.Child("migration")
+	if directory.Spec.Migration != nil && oldDirectory.Spec.Migration == nil {
+		errs = append(errs, field.Forbidden(migrationPath, "a migration can only be configured when the directory is created"))
+	} else if directory.Spec.Migration == nil && oldDirectory.Spec.Migration != nil && !oldDirectory.Spec.Migration.Cutover {
+		errs = append(errs, field.Forbidden(migrationPath, "a migration must be cut over before it is removed"))
+	} else if directory.Spec.Migration != nil && oldDirectory.Spec.Migration != nil {
+		if oldDirectory.Spec.Migration.Cutover && !directory.Spec.Migration.Cutover {
+			errs = append(errs, field.Forbidden(migrationPath.Child("cutover"), "a cutover cannot be undone"))
+		}
+
+		if directory.Spec.Migration.Source.SearchBase != oldDirectory.Spec.Migration.Source.SearchBase {
+			errs = append(errs, field.Forbidden(migrationPath.Child("source", "searchBase"), "search base is immutable"))
+		}
+	}
+
+	if directory.Spec.CloneFrom != nil && !equality.Semantic.DeepEqual(directory.Spec.CloneFrom, oldDirectory.Spec.CloneFrom) {
+		errs = append(errs, field.Forbidden(specPath.Child("cloneFrom"), "cloneFrom can only be set when the directory is created"))
+	}
+
+	errs = append(errs, validateVolumeClaimTemplatesUpdate(
+		directory.GetVolumeClaimTemplates(), oldDirectory.GetVolumeClaimTemplates(), specPath.Child("volumeClaimTemplates"))...)
+
+	return nil, directory.invalid(errs)
+}
+
+func (w *LDAPDirectoryWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (d *LDAPDirectory) validate() field.ErrorList {
+	var errs field.ErrorList
+
+	specPath := field.NewPath("spec")
+
+	if d.Spec.External != nil {
+		externalPath := specPath.Child("external")
+
+		for i, rawURL := range d.Spec.External.URLs {
+			u, err := url.Parse(rawURL)
+			if err != nil {
+				errs = append(errs, field.Invalid(externalPath.Child("urls").Index(i), rawURL, err.Error()))
+			} else if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+				errs = append(errs, field.Invalid(externalPath.Child("urls").Index(i), rawURL, "must be a ldap:// or ldaps:// URL"))
+			}
+		}
+
+		errs = append(errs, api.ValidateDN(d.Spec.External.BaseDN, externalPath.Child("baseDN"))...)
+		errs = append(errs, api.ValidateDN(d.Spec.External.BindDN, externalPath.Child("bindDN"))...)
+	} else {
+		if d.Spec.Domain == "" {
+			errs = append(errs, field.Required(specPath.Child("domain"), ""))
+		} else {
+			for _, msg := range validation.IsDNS1123Subdomain(strings.ToLower(d.Spec.Domain)) {
+				errs = append(errs, field.Invalid(specPath.Child("domain"), d.Spec.Domain, msg))
+			}
+		}
+
+		if d.Spec.Image == "" {
+			errs = append(errs, field.Required(specPath.Child("image"), ""))
+		}
+
+		if d.Spec.CertificateSecretRef == nil || d.Spec.CertificateSecretRef.Name == "" {
+			errs = append(errs, field.Required(specPath.Child("certificateSecretRef", "name"), ""))
+		}
+	}
+
+	if d.Spec.Bootstrap != nil {
+		for i, source := range d.Spec.Bootstrap.LDIF {
+			if (source.ConfigMapRef == nil) == (source.SecretRef == nil) {
+				errs = append(errs, field.Invalid(specPath.Child("bootstrap", "ldif").Index(i), source,
+					"exactly one of configMapRef or secretRef must be specified"))
+			}
+		}
+	}
+
+	configPatchNames := make(map[string]bool)
+	for i, patch := range d.Spec.ConfigPatches {
+		patchPath := specPath.Child("configPatches").Index(i)
+
+		if patch.Name == "" {
+			errs = append(errs, field.Required(patchPath.Child("name"), ""))
+		} else if configPatchNames[patch.Name] {
+			errs = append(errs, field.Duplicate(patchPath.Child("name"), patch.Name))
+		}
+		configPatchNames[patch.Name] = true
+
+		sources := 0
+		for _, set := range []bool{patch.LDIF != "", patch.ConfigMapRef != nil, patch.SecretRef != nil} {
+			if set {
+				sources++
+			}
+		}
+
+		if sources != 1 {
+			errs = append(errs, field.Invalid(patchPath, patch.Name,
+				"exactly one of ldif, configMapRef or secretRef must be specified"))
+		} else if patch.LDIF != "" {
+			if _, err := ldif.Parse(strings.NewReader(patch.LDIF)); err != nil {
+				errs = append(errs, field.Invalid(patchPath.Child("ldif"), patch.LDIF, err.Error()))
+			}
+		}
+	}
+
+	if d.Spec.External != nil && len(d.Spec.ConfigPatches) > 0 {
+		errs = append(errs, field.Forbidden(specPath.Child("configPatches"),
+			"config patches are not supported for external directories"))
+	}
+
+	if d.Spec.External != nil && d.Spec.Suspend {
+		errs = append(errs, field.Forbidden(specPath.Child("suspend"),
+			"external directories cannot be suspended"))
+	}
+
+	errs = append(errs, d.validateDatabases(specPath.Child("databases"))...)
+	errs = append(errs, d.validateMigration(specPath.Child("migration"))...)
+	errs = append(errs, d.validateCloneFrom(specPath.Child("cloneFrom"))...)
+
+	if d.Spec.ChangeFeed != nil {
+		for i, sink := range d.Spec.ChangeFeed.Sinks {
+			u, err := url.Parse(sink.URL)
+			if err != nil {
+				errs = append(errs, field.Invalid(specPath.Child("changeFeed", "sinks").Index(i).Child("url"), sink.URL, err.Error()))
+			} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, field.Invalid(specPath.Child("changeFeed", "sinks").Index(i).Child("url"), sink.URL, "must be an absolute http:// or https:// URL"))
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateCloneFrom checks that the clone source is another directory, and
+// that the scrub rules reference valid attributes.
+func (d *LDAPDirectory) validateCloneFrom(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if d.Spec.CloneFrom == nil {
+		return errs
+	}
+
+	if d.Spec.External != nil {
+		return append(errs, field.Forbidden(fldPath, "external directories cannot be cloned to"))
+	}
+
+	if d.Spec.Migration != nil {
+		return append(errs, field.Forbidden(fldPath, "a directory cannot be both cloned and migrated"))
+	}
+
+	ref := d.Spec.CloneFrom.DirectoryRef
+	if ref.Name == "" {
+		errs = append(errs, field.Required(fldPath.Child("directoryRef", "name"), ""))
+	} else if ref.Name == d.Name && (ref.Namespace == "" || ref.Namespace == d.Namespace) {
+		errs = append(errs, field.Invalid(fldPath.Child("directoryRef"), ref, "a directory cannot be cloned from itself"))
+	}
+
+	for i, rule := range d.Spec.CloneFrom.Scrub {
+		attributePath := fldPath.Child("scrub").Index(i).Child("attribute")
+
+		if !attributeNamePattern.MatchString(rule.Attribute) {
+			errs = append(errs, field.Invalid(attributePath, rule.Attribute, "must be a valid attribute name"))
+		} else if strings.EqualFold(rule.Attribute, "objectClass") {
+			errs = append(errs, field.Forbidden(attributePath, "objectClass cannot be scrubbed"))
+		}
+	}
+
+	return errs
+}
+
+// validateMigration checks that the migration source is a LDAP server, and
+// that the replicated entries are within the directory.
+func (d *LDAPDirectory) validateMigration(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if d.Spec.Migration == nil {
+		return errs
+	}
+
+	if d.Spec.External != nil {
+		return append(errs, field.Forbidden(fldPath, "migrations are not supported for external directories"))
+	}
+
+	sourcePath := fldPath.Child("source")
+	source := d.Spec.Migration.Source
+
+	u, err := url.Parse(source.URL)
+	if err != nil {
+		errs = append(errs, field.Invalid(sourcePath.Child("url"), source.URL, err.Error()))
+	} else if (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		errs = append(errs, field.Invalid(sourcePath.Child("url"), source.URL, "must be a ldap:// or ldaps:// URL"))
+	}
+
+	errs = append(errs, api.ValidateDN(source.BindDN, sourcePath.Child("bindDN"))...)
+
+	if source.BindPasswordSecretRef.Name == "" {
+		errs = append(errs, field.Required(sourcePath.Child("bindPasswordSecretRef", "name"), ""))
+	}
+
+	if source.CASecretRef != nil && source.CASecretRef.Name == "" {
+		errs = append(errs, field.Required(sourcePath.Child("caSecretRef", "name"), ""))
+	}
+
+	if source.SearchBase != "" {
+		searchBaseErrs := api.ValidateDN(source.SearchBase, sourcePath.Child("searchBase"))
+		errs = append(errs, searchBaseErrs...)
+
+		if len(searchBaseErrs) == 0 && d.Spec.Domain != "" {
+			baseDN, _ := d.GetDistinguishedName(context.Background(), nil, nil)
+
+			searchBase := strings.ToLower(source.SearchBase)
+			if searchBase != strings.ToLower(baseDN) && !strings.HasSuffix(searchBase, ","+strings.ToLower(baseDN)) {
+				errs = append(errs, field.Invalid(sourcePath.Child("searchBase"), source.SearchBase,
+					fmt.Sprintf("must be within the base distinguished name of the directory (%s)", baseDN)))
+			}
+		}
+	}
+
+	return errs
+}
+
+// reservedDatabaseName can't be used for an additional database, as the
+// accesslog database is stored in the same place.
+const reservedDatabaseName = "accesslog"
+
+// validateDatabases checks that the additional databases have unique names,
+// and suffixes that don't overlap with each other or the main database.
+func (d *LDAPDirectory) validateDatabases(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(d.Spec.Databases) == 0 {
+		return errs
+	}
+
+	if d.Spec.External != nil {
+		return append(errs, field.Forbidden(fldPath, "additional databases are not supported for external directories"))
+	}
+
+	suffixes := []string{"cn=config", "cn=accesslog"}
+	if d.Spec.Domain != "" {
+		baseDN, _ := d.GetDistinguishedName(context.Background(), nil, nil)
+		suffixes = append(suffixes, baseDN)
+	}
+
+	names := make(map[string]bool)
+	for i, database := range d.Spec.Databases {
+		databasePath := fldPath.Index(i)
+
+		if database.Name == "" {
+			errs = append(errs, field.Required(databasePath.Child("name"), ""))
+		} else if names[database.Name] {
+			errs = append(errs, field.Duplicate(databasePath.Child("name"), database.Name))
+		} else if database.Name == reservedDatabaseName {
+			// It would share the directory of the accesslog database.
+			errs = append(errs, field.Invalid(databasePath.Child("name"), database.Name, "name is reserved"))
+		} else {
+			for _, msg := range validation.IsDNS1123Label(database.Name) {
+				errs = append(errs, field.Invalid(databasePath.Child("name"), database.Name, msg))
+			}
+		}
+		names[database.Name] = true
+
+		suffixErrs := api.ValidateDN(database.Suffix, databasePath.Child("suffix"))
+		if len(suffixErrs) > 0 {
+			errs = append(errs, suffixErrs...)
+			continue
+		}
+
+		dn, _ := ldap.ParseDN(database.Suffix)
+		attrType := strings.ToLower(dn.RDNs[0].Attributes[0].Type)
+		if attrType != "dc" && attrType != "o" {
+			errs = append(errs, field.Invalid(databasePath.Child("suffix"), database.Suffix,
+				"the first relative distinguished name must be a dc or o attribute"))
+		}
+
+		suffix := strings.ToLower(database.Suffix)
+		for _, existing := range suffixes {
+			existing = strings.ToLower(existing)
+			if suffix == existing || strings.HasSuffix(suffix, ","+existing) || strings.HasSuffix(existing, ","+suffix) {
+				errs = append(errs, field.Invalid(databasePath.Child("suffix"), database.Suffix,
+					fmt.Sprintf("overlaps with the suffix %q", existing)))
+			}
+		}
+		suffixes = append(suffixes, database.Suffix)
+
+		if database.RootPasswordSecretRef != nil && database.RootPasswordSecretRef.Name == "" {
+			errs = append(errs, field.Required(databasePath.Child("rootPasswordSecretRef", "name"), ""))
+		}
+	}
+
+	return errs
+}
+
+// validateVolumeClaimTemplatesUpdate checks that the only change to the volume
+// claim templates is an increase of their storage requests (volume expansion),
+// as statefulset volume claim templates are otherwise immutable.
+func validateVolumeClaimTemplatesUpdate(volumeClaimTemplates, oldVolumeClaimTemplates []corev1.PersistentVolumeClaim, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if len(volumeClaimTemplates) != len(oldVolumeClaimTemplates) {
+		return append(errs, field.Forbidden(fldPath, "volume claim templates cannot be added or removed"))
+	}
+
+	for i := range volumeClaimTemplates {
+		volumeClaimTemplate := volumeClaimTemplates[i].DeepCopy()
+		oldVolumeClaimTemplate := &oldVolumeClaimTemplates[i]
+
+		storage := volumeClaimTemplate.Spec.Resources.Requests[corev1.ResourceStorage]
+		oldStorage := oldVolumeClaimTemplate.Spec.Resources.Requests[corev1.ResourceStorage]
+
+		if storage.Cmp(oldStorage) < 0 {
+			errs = append(errs, field.Forbidden(fldPath.Key(volumeClaimTemplate.Name),
+				"storage requests cannot be decreased"))
+			continue
+		}
+
+		if _, ok := oldVolumeClaimTemplate.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+			volumeClaimTemplate.Spec.Resources.Requests[corev1.ResourceStorage] = oldStorage
+		}
+
+		if !equality.Semantic.DeepEqual(volumeClaimTemplate, oldVolumeClaimTemplate) {
+			errs = append(errs, field.Forbidden(fldPath.Key(volumeClaimTemplate.Name),
+				"only the storage requests of a volume claim template can be changed"))
+		}
+	}
+
+	return errs
+}
+
+func (d *LDAPDirectory) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("LDAPDirectory").GroupKind(), d.Name, errs)
+}
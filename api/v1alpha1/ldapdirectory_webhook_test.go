@@ -0,0 +1,313 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package v1alpha1_test
+
+import (
+	"context"
+	"testing"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/operator-utils/reference"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLDAPDirectoryWebhook(t *testing.T) {
+	ctx := context.Background()
+	w := &ldapv1alpha1.LDAPDirectoryWebhook{}
+
+	directory := &ldapv1alpha1.LDAPDirectory{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+		},
+		Spec: ldapv1alpha1.LDAPDirectorySpec{
+			Image:  "ghcr.io/gpu-ninja/ldap-operator/openldap:latest",
+			Domain: "example.com",
+			CertificateSecretRef: &reference.LocalSecretReference{
+				Name: "test-tls",
+			},
+		},
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		defaultedDirectory := directory.DeepCopy()
+		defaultedDirectory.Spec.LoadBalancer = &ldapv1alpha1.LDAPDirectoryLoadBalancer{}
+
+		err := w.Default(ctx, defaultedDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, "example.com", defaultedDirectory.Spec.Organization)
+		require.NotNil(t, defaultedDirectory.Spec.LoadBalancer.Replicas)
+		assert.Equal(t, int32(2), *defaultedDirectory.Spec.LoadBalancer.Replicas)
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryDeletionPolicyBlock, defaultedDirectory.Spec.DeletionPolicy)
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		_, err := w.ValidateCreate(ctx, directory)
+		require.NoError(t, err)
+	})
+
+	t.Run("Invalid Domain", func(t *testing.T) {
+		for _, domain := range []string{"", "example..com", "exa_mple.com"} {
+			invalidDirectory := directory.DeepCopy()
+			invalidDirectory.Spec.Domain = domain
+
+			_, err := w.ValidateCreate(ctx, invalidDirectory)
+			assert.ErrorContains(t, err, "spec.domain", domain)
+		}
+	})
+
+	t.Run("Invalid LDIF Source", func(t *testing.T) {
+		invalidDirectory := directory.DeepCopy()
+		invalidDirectory.Spec.Bootstrap = &ldapv1alpha1.LDAPDirectoryBootstrap{
+			LDIF: []ldapv1alpha1.LDIFSource{{}},
+		}
+
+		_, err := w.ValidateCreate(ctx, invalidDirectory)
+		assert.ErrorContains(t, err, "spec.bootstrap.ldif[0]")
+	})
+
+	t.Run("Invalid Config Patch", func(t *testing.T) {
+		invalidDirectory := directory.DeepCopy()
+		invalidDirectory.Spec.ConfigPatches = []ldapv1alpha1.LDAPDirectoryConfigPatch{
+			{Name: "empty"},
+			{Name: "empty", LDIF: "dn: cn=config\nchangetype: modify\nreplace: olcIdleTimeout\nolcIdleTimeout: 60\n"},
+		}
+
+		_, err := w.ValidateCreate(ctx, invalidDirectory)
+		assert.ErrorContains(t, err, "spec.configPatches[0]")
+		assert.ErrorContains(t, err, "spec.configPatches[1].name")
+	})
+
+	t.Run("Invalid Change Feed Sink", func(t *testing.T) {
+		invalidDirectory := directory.DeepCopy()
+		invalidDirectory.Spec.ChangeFeed = &ldapv1alpha1.LDAPDirectoryChangeFeed{
+			Sinks: []ldapv1alpha1.LDAPDirectoryChangeFeedSink{{URL: "/events"}},
+		}
+
+		_, err := w.ValidateCreate(ctx, invalidDirectory)
+		assert.ErrorContains(t, err, "spec.changeFeed.sinks[0].url")
+	})
+
+	t.Run("Databases", func(t *testing.T) {
+		databasesDirectory := directory.DeepCopy()
+		databasesDirectory.Spec.Databases = []ldapv1alpha1.LDAPDirectoryDatabase{
+			{Name: "partners", Suffix: "dc=partners"},
+		}
+
+		_, err := w.ValidateCreate(ctx, databasesDirectory)
+		require.NoError(t, err)
+
+		invalidDirectory := databasesDirectory.DeepCopy()
+		invalidDirectory.Spec.Databases = append(invalidDirectory.Spec.Databases,
+			ldapv1alpha1.LDAPDirectoryDatabase{Name: "partners", Suffix: "dc=other"},
+			ldapv1alpha1.LDAPDirectoryDatabase{Name: "people", Suffix: "ou=people,dc=partners"},
+			ldapv1alpha1.LDAPDirectoryDatabase{Name: "example", Suffix: "dc=com"},
+			ldapv1alpha1.LDAPDirectoryDatabase{Name: "Invalid", Suffix: "dc"},
+			ldapv1alpha1.LDAPDirectoryDatabase{Name: "accesslog", Suffix: "dc=log"})
+
+		_, err = w.ValidateCreate(ctx, invalidDirectory)
+		assert.ErrorContains(t, err, "spec.databases[1].name")
+		assert.ErrorContains(t, err, "spec.databases[2].suffix")
+		assert.ErrorContains(t, err, "spec.databases[3].suffix")
+		assert.ErrorContains(t, err, "spec.databases[4].name")
+		assert.ErrorContains(t, err, "spec.databases[4].suffix")
+		assert.ErrorContains(t, err, "spec.databases[5].name")
+
+		updatedDirectory := databasesDirectory.DeepCopy()
+		updatedDirectory.Spec.Databases[0].Suffix = "dc=other"
+
+		_, err = w.ValidateUpdate(ctx, databasesDirectory, updatedDirectory)
+		assert.ErrorContains(t, err, "suffix is immutable")
+
+		_, err = w.ValidateUpdate(ctx, databasesDirectory, directory)
+		assert.ErrorContains(t, err, "databases cannot be removed")
+	})
+
+	t.Run("Migration", func(t *testing.T) {
+		migratingDirectory := directory.DeepCopy()
+		migratingDirectory.Spec.Migration = &ldapv1alpha1.LDAPDirectoryMigration{
+			Source: ldapv1alpha1.LDAPDirectoryMigrationSource{
+				URL:        "ldaps://legacy.example.com",
+				BindDN:     "cn=replicator,dc=example,dc=com",
+				SearchBase: "ou=people,dc=example,dc=com",
+				BindPasswordSecretRef: reference.LocalSecretReference{
+					Name: "legacy-password",
+				},
+			},
+		}
+
+		_, err := w.ValidateCreate(ctx, migratingDirectory)
+		require.NoError(t, err)
+
+		invalidDirectory := migratingDirectory.DeepCopy()
+		invalidDirectory.Spec.Migration.Source.URL = "https://legacy.example.com"
+		invalidDirectory.Spec.Migration.Source.SearchBase = "dc=example,dc=org"
+
+		_, err = w.ValidateCreate(ctx, invalidDirectory)
+		assert.ErrorContains(t, err, "spec.migration.source.url")
+		assert.ErrorContains(t, err, "spec.migration.source.searchBase")
+
+		_, err = w.ValidateUpdate(ctx, directory, migratingDirectory)
+		assert.ErrorContains(t, err, "a migration can only be configured when the directory is created")
+
+		_, err = w.ValidateUpdate(ctx, migratingDirectory, directory)
+		assert.ErrorContains(t, err, "a migration must be cut over before it is removed")
+
+		cutoverDirectory := migratingDirectory.DeepCopy()
+		cutoverDirectory.Spec.Migration.Cutover = true
+
+		_, err = w.ValidateUpdate(ctx, migratingDirectory, cutoverDirectory)
+		require.NoError(t, err)
+
+		_, err = w.ValidateUpdate(ctx, cutoverDirectory, migratingDirectory)
+		assert.ErrorContains(t, err, "a cutover cannot be undone")
+
+		_, err = w.ValidateUpdate(ctx, cutoverDirectory, directory)
+		require.NoError(t, err)
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		clonedDirectory := directory.DeepCopy()
+		clonedDirectory.Spec.CloneFrom = &ldapv1alpha1.LDAPDirectoryClone{
+			DirectoryRef: ldapv1alpha1.LDAPDirectoryCloneReference{
+				Name:      directory.Name,
+				Namespace: "production",
+			},
+			Scrub: []ldapv1alpha1.LDAPDirectoryScrubRule{
+				{Attribute: "userPassword"},
+			},
+		}
+
+		_, err := w.ValidateCreate(ctx, clonedDirectory)
+		require.NoError(t, err)
+
+		invalidDirectory := clonedDirectory.DeepCopy()
+		invalidDirectory.Spec.CloneFrom.DirectoryRef.Namespace = ""
+		invalidDirectory.Spec.CloneFrom.Scrub = append(invalidDirectory.Spec.CloneFrom.Scrub,
+			ldapv1alpha1.LDAPDirectoryScrubRule{Attribute: "objectClass"},
+			ldapv1alpha1.LDAPDirectoryScrubRule{Attribute: "not valid"})
+
+		_, err = w.ValidateCreate(ctx, invalidDirectory)
+		assert.ErrorContains(t, err, "a directory cannot be cloned from itself")
+		assert.ErrorContains(t, err, "spec.cloneFrom.scrub[1].attribute")
+		assert.ErrorContains(t, err, "spec.cloneFrom.scrub[2].attribute")
+
+		_, err = w.ValidateUpdate(ctx, directory, clonedDirectory)
+		assert.ErrorContains(t, err, "cloneFrom can only be set when the directory is created")
+
+		_, err = w.ValidateUpdate(ctx, clonedDirectory, directory)
+		require.NoError(t, err)
+	})
+
+	t.Run("External", func(t *testing.T) {
+		externalDirectory := &ldapv1alpha1.LDAPDirectory{
+			ObjectMeta: directory.ObjectMeta,
+			Spec: ldapv1alpha1.LDAPDirectorySpec{
+				External: &ldapv1alpha1.LDAPDirectoryExternal{
+					URLs:   []string{"ldaps://ldap.example.com"},
+					BaseDN: "dc=example,dc=com",
+					BindDN: "cn=admin,dc=example,dc=com",
+				},
+			},
+		}
+
+		_, err := w.ValidateCreate(ctx, externalDirectory)
+		require.NoError(t, err)
+
+		externalDirectory.Spec.External.URLs = []string{"https://ldap.example.com"}
+		externalDirectory.Spec.External.BindDN = "admin"
+		externalDirectory.Spec.Suspend = true
+
+		_, err = w.ValidateCreate(ctx, externalDirectory)
+		assert.ErrorContains(t, err, "spec.external.urls[0]")
+		assert.ErrorContains(t, err, "spec.external.bindDN")
+		assert.ErrorContains(t, err, "spec.suspend")
+
+		_, err = w.ValidateUpdate(ctx, directory, externalDirectory)
+		assert.ErrorContains(t, err, "spec.external: Forbidden")
+	})
+
+	t.Run("Unchanged Or Deleting", func(t *testing.T) {
+		invalidDirectory := directory.DeepCopy()
+		invalidDirectory.Spec.Databases = []ldapv1alpha1.LDAPDirectoryDatabase{
+			{Name: "accesslog", Suffix: "dc=accesslog,dc=example,dc=com"},
+		}
+
+		updatedDirectory := invalidDirectory.DeepCopy()
+		updatedDirectory.Annotations = map[string]string{"team": "platform"}
+
+		_, err := w.ValidateUpdate(ctx, invalidDirectory, updatedDirectory)
+		require.NoError(t, err)
+
+		updatedDirectory.Spec.LogLevel = []ldapv1alpha1.LogLevel{"stats"}
+
+		_, err = w.ValidateUpdate(ctx, invalidDirectory, updatedDirectory)
+		assert.ErrorContains(t, err, "spec.databases")
+
+		now := metav1.Now()
+		updatedDirectory.DeletionTimestamp = &now
+
+		_, err = w.ValidateUpdate(ctx, invalidDirectory, updatedDirectory)
+		require.NoError(t, err)
+	})
+
+	t.Run("Volume Claim Templates", func(t *testing.T) {
+		expandedDirectory := directory.DeepCopy()
+		expandedDirectory.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "data",
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{
+						corev1.ReadWriteOnce,
+					},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceStorage: resource.MustParse("10Gi"),
+						},
+					},
+				},
+			},
+		}
+
+		_, err := w.ValidateUpdate(ctx, directory, expandedDirectory)
+		require.NoError(t, err)
+
+		_, err = w.ValidateUpdate(ctx, expandedDirectory, directory)
+		assert.ErrorContains(t, err, "spec.volumeClaimTemplates[data]: Forbidden: storage requests cannot be decreased")
+
+		changedDirectory := expandedDirectory.DeepCopy()
+		changedDirectory.Spec.VolumeClaimTemplates[0].Spec.AccessModes = []corev1.PersistentVolumeAccessMode{
+			corev1.ReadWriteMany,
+		}
+
+		_, err = w.ValidateUpdate(ctx, expandedDirectory, changedDirectory)
+		assert.ErrorContains(t, err, "spec.volumeClaimTemplates[data]: Forbidden")
+
+		addedDirectory := expandedDirectory.DeepCopy()
+		addedDirectory.Spec.VolumeClaimTemplates[0].Name = "logs"
+
+		_, err = w.ValidateUpdate(ctx, expandedDirectory, addedDirectory)
+		assert.ErrorContains(t, err, "spec.volumeClaimTemplates: Forbidden")
+	})
+}
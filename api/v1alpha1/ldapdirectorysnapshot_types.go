@@ -0,0 +1,127 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	"context"
+
+	"github.com/gpu-ninja/ldap-operator/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type LDAPDirectorySnapshotPhase string
+
+const (
+	LDAPDirectorySnapshotPhasePending LDAPDirectorySnapshotPhase = "Pending"
+	// LDAPDirectorySnapshotPhaseInProgress means the volumes of the directory
+	// are being snapshotted.
+	LDAPDirectorySnapshotPhaseInProgress LDAPDirectorySnapshotPhase = "InProgress"
+	// LDAPDirectorySnapshotPhaseReady means every volume snapshot is ready to
+	// be restored from.
+	LDAPDirectorySnapshotPhaseReady  LDAPDirectorySnapshotPhase = "Ready"
+	LDAPDirectorySnapshotPhaseFailed LDAPDirectorySnapshotPhase = "Failed"
+)
+
+type LDAPDirectorySnapshotConditionType string
+
+const (
+	// LDAPDirectorySnapshotConditionTypeFrozen is set while writes to the
+	// directory are quiesced (olcReadOnly) for the volumes to be snapshotted.
+	LDAPDirectorySnapshotConditionTypeFrozen LDAPDirectorySnapshotConditionType = "Frozen"
+)
+
+// LDAPDirectorySnapshotSpec defines the desired state of the snapshot.
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable"
+type LDAPDirectorySnapshotSpec struct {
+	// DirectoryRef is a reference to the directory that will be snapshotted.
+	DirectoryRef api.LocalLDAPDirectoryReference `json:"directoryRef"`
+	// VolumeSnapshotClassName is the name of the VolumeSnapshotClass used to
+	// snapshot the volumes of the directory (the default class if not specified).
+	VolumeSnapshotClassName *string `json:"volumeSnapshotClassName,omitempty"`
+}
+
+// LDAPDirectorySnapshotStatus defines the observed state of the snapshot.
+type LDAPDirectorySnapshotStatus struct {
+	// Phase is the current state of the snapshot.
+	Phase LDAPDirectorySnapshotPhase `json:"phase,omitempty"`
+	// Conditions represents the latest available observations of the snapshots current state.
+	//+listType=map
+	//+listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// VolumeSnapshots are the CSI volume snapshots of each of the volumes of the directory.
+	//+listType=map
+	//+listMapKey=volume
+	VolumeSnapshots []LDAPDirectoryVolumeSnapshotStatus `json:"volumeSnapshots,omitempty"`
+	// StartTime is when the directory was frozen for the volumes to be snapshotted.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when every volume snapshot became ready to use.
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message is a human readable message describing why the snapshot failed.
+	Message string `json:"message,omitempty"`
+}
+
+// LDAPDirectoryVolumeSnapshotStatus is the state of the snapshot of one
+// of the volumes of the directory.
+type LDAPDirectoryVolumeSnapshotStatus struct {
+	// Volume is the name of the volume claim template of the snapshotted
+	// volume (ie. config or data).
+	Volume string `json:"volume"`
+	// Name is the name of the VolumeSnapshot, it can be used as the
+	// dataSource of the volume claim templates of a new directory.
+	Name string `json:"name"`
+	// ReadyToUse is true once the snapshot can be restored from.
+	ReadyToUse bool `json:"readyToUse"`
+}
+
+// LDAPDirectorySnapshot is a crash-consistent snapshot of the volumes of a LDAP directory.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=ldapdirectorysnapshots,scope=Namespaced
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Directory",type=string,JSONPath=`.spec.directoryRef.name`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type LDAPDirectorySnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LDAPDirectorySnapshotSpec   `json:"spec,omitempty"`
+	Status LDAPDirectorySnapshotStatus `json:"status,omitempty"`
+}
+
+// LDAPDirectorySnapshotList contains a list of LDAPDirectorySnapshot.
+// +kubebuilder:object:root=true
+type LDAPDirectorySnapshotList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LDAPDirectorySnapshot `json:"items"`
+}
+
+func (s *LDAPDirectorySnapshot) ResolveReferences(ctx context.Context, reader client.Reader, scheme *runtime.Scheme) (bool, error) {
+	_, ok, err := s.Spec.DirectoryRef.Resolve(ctx, reader, scheme, s)
+	if !ok || err != nil {
+		return ok, err
+	}
+
+	return true, nil
+}
+
+func init() {
+	SchemeBuilder.Register(&LDAPDirectorySnapshot{}, &LDAPDirectorySnapshotList{})
+}
@@ -0,0 +1,157 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	"context"
+
+	"github.com/gpu-ninja/ldap-operator/api"
+	"github.com/gpu-ninja/operator-utils/reference"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type LDAPExportPhase string
+
+const (
+	LDAPExportPhasePending LDAPExportPhase = "Pending"
+	// LDAPExportPhaseRunning means the entries are being exported (by a job,
+	// for exports to a persistent volume claim).
+	LDAPExportPhaseRunning LDAPExportPhase = "Running"
+	// LDAPExportPhaseComplete means the export has been written to its output.
+	LDAPExportPhaseComplete LDAPExportPhase = "Complete"
+	LDAPExportPhaseFailed   LDAPExportPhase = "Failed"
+)
+
+// LDAPExportSpec defines the desired state of the export.
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable"
+// +kubebuilder:validation:XValidation:rule="!(has(self.baseDN) && has(self.objectRef))",message="baseDN and objectRef are mutually exclusive"
+// +kubebuilder:validation:XValidation:rule="!has(self.output.configMap) || (has(self.scrub) && self.scrub.exists(r, r.attribute.lowerAscii() == 'userpassword')) || (has(self.attributes) && size(self.attributes) > 0 && !self.attributes.exists(a, a == '*' || a.lowerAscii() == 'userpassword'))",message="exports to a config map must exclude (or scrub) the userPassword attribute"
+type LDAPExportSpec struct {
+	// DirectoryRef is a reference to the directory that will be exported.
+	DirectoryRef api.LocalLDAPDirectoryReference `json:"directoryRef"`
+	// BaseDN is the root of the exported subtree. If neither baseDN or
+	// objectRef are specified, the whole directory is exported.
+	BaseDN string `json:"baseDN,omitempty"`
+	// ObjectRef is a reference to an LDAP object (eg. an LDAPOrganizationalUnit)
+	// whose subtree is exported.
+	ObjectRef *reference.LocalObjectReference `json:"objectRef,omitempty"`
+	// Filter selects the exported entries, defaults to "(objectClass=*)".
+	Filter string `json:"filter,omitempty"`
+	// Attributes are the names of the exported attributes, if not specified
+	// every user attribute is exported.
+	Attributes []string `json:"attributes,omitempty"`
+	// Scrub are rules that are applied to every exported entry (eg. to remove
+	// passwords).
+	Scrub []LDAPDirectoryScrubRule `json:"scrub,omitempty"`
+	// Output is where the LDIF is written.
+	Output LDAPExportOutput `json:"output"`
+}
+
+// LDAPExportOutput is where an export is written, exactly one of the outputs
+// must be specified.
+// +kubebuilder:validation:XValidation:rule="(has(self.configMap) ? 1 : 0) + (has(self.secret) ? 1 : 0) + (has(self.persistentVolumeClaim) ? 1 : 0) == 1",message="exactly one of configMap, secret, or persistentVolumeClaim must be specified"
+type LDAPExportOutput struct {
+	// ConfigMap writes the LDIF to a new config map (created by the export).
+	// Suitable for small exports (less than 1MiB) that exclude (or scrub) the
+	// userPassword attribute.
+	ConfigMap *LDAPExportObjectOutput `json:"configMap,omitempty"`
+	// Secret writes the LDIF to a new secret (created by the export).
+	// Suitable for small exports (less than 1MiB) that contain sensitive attributes.
+	Secret *LDAPExportObjectOutput `json:"secret,omitempty"`
+	// PersistentVolumeClaim writes the LDIF to an existing persistent volume
+	// claim, using a job. Suitable for large exports (of managed directories only).
+	PersistentVolumeClaim *LDAPExportVolumeOutput `json:"persistentVolumeClaim,omitempty"`
+}
+
+// LDAPExportObjectOutput writes an export to a key of a config map or secret.
+type LDAPExportObjectOutput struct {
+	// Name of the config map (or secret).
+	Name string `json:"name"`
+	// Key the LDIF is stored under, defaults to "export.ldif".
+	Key string `json:"key,omitempty"`
+}
+
+// LDAPExportVolumeOutput writes an export to a file on a persistent volume claim.
+type LDAPExportVolumeOutput struct {
+	// ClaimName is the name of the persistent volume claim.
+	ClaimName string `json:"claimName"`
+	// Path of the LDIF file, relative to the root of the volume. Defaults to
+	// the name of the export, with a .ldif extension.
+	// +kubebuilder:validation:XValidation:rule="!self.startsWith('/') && !self.contains('..')",message="path must be relative to the root of the volume"
+	Path string `json:"path,omitempty"`
+}
+
+// LDAPExportStatus defines the observed state of the export.
+type LDAPExportStatus struct {
+	// Phase is the current state of the export.
+	Phase LDAPExportPhase `json:"phase,omitempty"`
+	// Entries is the number of exported entries.
+	Entries int `json:"entries,omitempty"`
+	// StartTime is when the export was started.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when the export was written to its output.
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Message is a human readable message describing why the export failed.
+	Message string `json:"message,omitempty"`
+}
+
+// LDAPExport is a point-in-time LDIF export of (a subtree of) a LDAP directory.
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=ldapexports,scope=Namespaced
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Directory",type=string,JSONPath=`.spec.directoryRef.name`
+// +kubebuilder:printcolumn:name="Entries",type=integer,JSONPath=`.status.entries`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type LDAPExport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LDAPExportSpec   `json:"spec,omitempty"`
+	Status LDAPExportStatus `json:"status,omitempty"`
+}
+
+// LDAPExportList contains a list of LDAPExport.
+// +kubebuilder:object:root=true
+type LDAPExportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LDAPExport `json:"items"`
+}
+
+func (e *LDAPExport) ResolveReferences(ctx context.Context, reader client.Reader, scheme *runtime.Scheme) (bool, error) {
+	_, ok, err := e.Spec.DirectoryRef.Resolve(ctx, reader, scheme, e)
+	if !ok || err != nil {
+		return ok, err
+	}
+
+	if e.Spec.ObjectRef != nil {
+		_, ok, err = e.Spec.ObjectRef.Resolve(ctx, reader, scheme, e)
+		if !ok || err != nil {
+			return ok, err
+		}
+	}
+
+	return true, nil
+}
+
+func init() {
+	SchemeBuilder.Register(&LDAPExport{}, &LDAPExportList{})
+}
@@ -88,12 +88,12 @@ func (g *LDAPGroup) GetDistinguishedName(ctx context.Context, reader client.Read
 		return "", err
 	}
 
-	directoryObj, ok := directory.(api.NamedLDAPObject)
+	directoryObj, ok := directory.(*LDAPDirectory)
 	if !ok {
-		return "", fmt.Errorf("directory is not a named ldap object")
+		return "", fmt.Errorf("directory is not a LDAPDirectory")
 	}
 
-	directoryDN, err := directoryObj.GetDistinguishedName(ctx, reader, scheme)
+	directoryDN, err := directoryObj.GetDatabaseDistinguishedName(g.Spec.Database)
 	if err != nil {
 		return "", err
 	}
@@ -125,6 +125,10 @@ func (g *LDAPGroup) SetStatus(status api.SimpleStatus) {
 	g.Status = status
 }
 
+func (g *LDAPGroup) GetStatus() *api.SimpleStatus {
+	return &g.Status
+}
+
 func (g *LDAPGroup) GetPhase() api.Phase {
 	return g.Status.Phase
 }
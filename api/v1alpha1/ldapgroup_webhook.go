@@ -0,0 +1,121 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gpu-ninja/ldap-operator/api"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:webhook:path=/mutate-ldap-gpu-ninja-com-v1alpha1-ldapgroup,mutating=true,failurePolicy=fail,sideEffects=None,groups=ldap.gpu-ninja.com,resources=ldapgroups,verbs=create;update,versions=v1alpha1,name=mldapgroup.ldap.gpu-ninja.com,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-ldap-gpu-ninja-com-v1alpha1-ldapgroup,mutating=false,failurePolicy=fail,sideEffects=None,groups=ldap.gpu-ninja.com,resources=ldapgroups,verbs=create;update,versions=v1alpha1,name=vldapgroup.ldap.gpu-ninja.com,admissionReviewVersions=v1
+
+// LDAPGroupWebhook validates and defaults LDAP groups.
+// +kubebuilder:object:generate=false
+type LDAPGroupWebhook struct{}
+
+func (g *LDAPGroup) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(g).
+		WithDefaulter(&LDAPGroupWebhook{}).
+		WithValidator(&LDAPGroupWebhook{}).
+		Complete()
+}
+
+func (w *LDAPGroupWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	g, ok := obj.(*LDAPGroup)
+	if !ok {
+		return fmt.Errorf("expected a LDAPGroup but got a %T", obj)
+	}
+
+	g.Spec.LDAPObjectSpec.Default()
+
+	return nil
+}
+
+func (w *LDAPGroupWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	g, ok := obj.(*LDAPGroup)
+	if !ok {
+		return nil, fmt.Errorf("expected a LDAPGroup but got a %T", obj)
+	}
+
+	return nil, g.invalid(g.validate())
+}
+
+func (w *LDAPGroupWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldGroup, ok := oldObj.(*LDAPGroup)
+	if !ok {
+		return nil, fmt.Errorf("expected a LDAPGroup but got a %T", oldObj)
+	}
+
+	g, ok := newObj.(*LDAPGroup)
+	if !ok {
+		return nil, fmt.Errorf("expected a LDAPGroup but got a %T", newObj)
+	}
+
+	// Never block deletion, or metadata only updates.
+	if !g.DeletionTimestamp.IsZero() || equality.Semantic.DeepEqual(g.Spec, oldGroup.Spec) {
+		return nil, nil
+	}
+
+	errs := g.validate()
+
+	specPath := field.NewPath("spec")
+
+	errs = append(errs, g.Spec.LDAPObjectSpec.ValidateUpdate(&oldGroup.Spec.LDAPObjectSpec, specPath)...)
+
+	// The name determines the distinguished name of the entry.
+	if g.Spec.Name != oldGroup.Spec.Name {
+		errs = append(errs, field.Forbidden(specPath.Child("name"), "name is immutable"))
+	}
+
+	return nil, g.invalid(errs)
+}
+
+func (w *LDAPGroupWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (g *LDAPGroup) validate() field.ErrorList {
+	specPath := field.NewPath("spec")
+
+	errs := g.Spec.LDAPObjectSpec.Validate(specPath)
+	errs = append(errs, api.ValidateRDNValue(g.Spec.Name, specPath.Child("name"))...)
+
+	for i, member := range g.Spec.Members {
+		errs = append(errs, api.ValidateDN(member, specPath.Child("members").Index(i))...)
+	}
+
+	return errs
+}
+
+func (g *LDAPGroup) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("LDAPGroup").GroupKind(), g.Name, errs)
+}
@@ -85,12 +85,12 @@ func (ou *LDAPOrganizationalUnit) GetDistinguishedName(ctx context.Context, read
 		return "", err
 	}
 
-	directoryObj, ok := directory.(api.NamedLDAPObject)
+	directoryObj, ok := directory.(*LDAPDirectory)
 	if !ok {
-		return "", fmt.Errorf("directory is not a named ldap object")
+		return "", fmt.Errorf("directory is not a LDAPDirectory")
 	}
 
-	directoryDN, err := directoryObj.GetDistinguishedName(ctx, reader, scheme)
+	directoryDN, err := directoryObj.GetDatabaseDistinguishedName(ou.Spec.Database)
 	if err != nil {
 		return "", err
 	}
@@ -122,6 +122,10 @@ func (ou *LDAPOrganizationalUnit) SetStatus(status api.SimpleStatus) {
 	ou.Status = status
 }
 
+func (ou *LDAPOrganizationalUnit) GetStatus() *api.SimpleStatus {
+	return &ou.Status
+}
+
 func (ou *LDAPOrganizationalUnit) GetPhase() api.Phase {
 	return ou.Status.Phase
 }
@@ -0,0 +1,117 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gpu-ninja/ldap-operator/api"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:webhook:path=/mutate-ldap-gpu-ninja-com-v1alpha1-ldaporganizationalunit,mutating=true,failurePolicy=fail,sideEffects=None,groups=ldap.gpu-ninja.com,resources=ldaporganizationalunits,verbs=create;update,versions=v1alpha1,name=mldaporganizationalunit.ldap.gpu-ninja.com,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-ldap-gpu-ninja-com-v1alpha1-ldaporganizationalunit,mutating=false,failurePolicy=fail,sideEffects=None,groups=ldap.gpu-ninja.com,resources=ldaporganizationalunits,verbs=create;update,versions=v1alpha1,name=vldaporganizationalunit.ldap.gpu-ninja.com,admissionReviewVersions=v1
+
+// LDAPOrganizationalUnitWebhook validates and defaults LDAP organizational units.
+// +kubebuilder:object:generate=false
+type LDAPOrganizationalUnitWebhook struct{}
+
+func (ou *LDAPOrganizationalUnit) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(ou).
+		WithDefaulter(&LDAPOrganizationalUnitWebhook{}).
+		WithValidator(&LDAPOrganizationalUnitWebhook{}).
+		Complete()
+}
+
+func (w *LDAPOrganizationalUnitWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	ou, ok := obj.(*LDAPOrganizationalUnit)
+	if !ok {
+		return fmt.Errorf("expected a LDAPOrganizationalUnit but got a %T", obj)
+	}
+
+	ou.Spec.LDAPObjectSpec.Default()
+
+	return nil
+}
+
+func (w *LDAPOrganizationalUnitWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	ou, ok := obj.(*LDAPOrganizationalUnit)
+	if !ok {
+		return nil, fmt.Errorf("expected a LDAPOrganizationalUnit but got a %T", obj)
+	}
+
+	return nil, ou.invalid(ou.validate())
+}
+
+func (w *LDAPOrganizationalUnitWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldOU, ok := oldObj.(*LDAPOrganizationalUnit)
+	if !ok {
+		return nil, fmt.Errorf("expected a LDAPOrganizationalUnit but got a %T", oldObj)
+	}
+
+	ou, ok := newObj.(*LDAPOrganizationalUnit)
+	if !ok {
+		return nil, fmt.Errorf("expected a LDAPOrganizationalUnit but got a %T", newObj)
+	}
+
+	// Never block deletion, or metadata only updates.
+	if !ou.DeletionTimestamp.IsZero() || equality.Semantic.DeepEqual(ou.Spec, oldOU.Spec) {
+		return nil, nil
+	}
+
+	errs := ou.validate()
+
+	specPath := field.NewPath("spec")
+
+	errs = append(errs, ou.Spec.LDAPObjectSpec.ValidateUpdate(&oldOU.Spec.LDAPObjectSpec, specPath)...)
+
+	// The name determines the distinguished name of the entry.
+	if ou.Spec.Name != oldOU.Spec.Name {
+		errs = append(errs, field.Forbidden(specPath.Child("name"), "name is immutable"))
+	}
+
+	return nil, ou.invalid(errs)
+}
+
+func (w *LDAPOrganizationalUnitWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (ou *LDAPOrganizationalUnit) validate() field.ErrorList {
+	specPath := field.NewPath("spec")
+
+	errs := ou.Spec.LDAPObjectSpec.Validate(specPath)
+	errs = append(errs, api.ValidateRDNValue(ou.Spec.Name, specPath.Child("name"))...)
+
+	return errs
+}
+
+func (ou *LDAPOrganizationalUnit) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("LDAPOrganizationalUnit").GroupKind(), ou.Name, errs)
+}
@@ -92,12 +92,12 @@ func (u *LDAPUser) GetDistinguishedName(ctx context.Context, reader client.Reade
 		return "", err
 	}
 
-	directoryObj, ok := directory.(api.NamedLDAPObject)
+	directoryObj, ok := directory.(*LDAPDirectory)
 	if !ok {
-		return "", fmt.Errorf("directory is not a named ldap object")
+		return "", fmt.Errorf("directory is not a LDAPDirectory")
 	}
 
-	directoryDN, err := directoryObj.GetDistinguishedName(ctx, reader, scheme)
+	directoryDN, err := directoryObj.GetDatabaseDistinguishedName(u.Spec.Database)
 	if err != nil {
 		return "", err
 	}
@@ -136,6 +136,10 @@ func (u *LDAPUser) SetStatus(status api.SimpleStatus) {
 	u.Status = status
 }
 
+func (u *LDAPUser) GetStatus() *api.SimpleStatus {
+	return &u.Status
+}
+
 func (u *LDAPUser) GetPhase() api.Phase {
 	return u.Status.Phase
 }
@@ -0,0 +1,124 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+
+	"github.com/gpu-ninja/ldap-operator/api"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+//+kubebuilder:webhook:path=/mutate-ldap-gpu-ninja-com-v1alpha1-ldapuser,mutating=true,failurePolicy=fail,sideEffects=None,groups=ldap.gpu-ninja.com,resources=ldapusers,verbs=create;update,versions=v1alpha1,name=mldapuser.ldap.gpu-ninja.com,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-ldap-gpu-ninja-com-v1alpha1-ldapuser,mutating=false,failurePolicy=fail,sideEffects=None,groups=ldap.gpu-ninja.com,resources=ldapusers,verbs=create;update,versions=v1alpha1,name=vldapuser.ldap.gpu-ninja.com,admissionReviewVersions=v1
+
+// LDAPUserWebhook validates and defaults LDAP users.
+// +kubebuilder:object:generate=false
+type LDAPUserWebhook struct{}
+
+func (u *LDAPUser) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(u).
+		WithDefaulter(&LDAPUserWebhook{}).
+		WithValidator(&LDAPUserWebhook{}).
+		Complete()
+}
+
+func (w *LDAPUserWebhook) Default(ctx context.Context, obj runtime.Object) error {
+	u, ok := obj.(*LDAPUser)
+	if !ok {
+		return fmt.Errorf("expected a LDAPUser but got a %T", obj)
+	}
+
+	u.Spec.LDAPObjectSpec.Default()
+
+	return nil
+}
+
+func (w *LDAPUserWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	u, ok := obj.(*LDAPUser)
+	if !ok {
+		return nil, fmt.Errorf("expected a LDAPUser but got a %T", obj)
+	}
+
+	return nil, u.invalid(u.validate())
+}
+
+func (w *LDAPUserWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldUser, ok := oldObj.(*LDAPUser)
+	if !ok {
+		return nil, fmt.Errorf("expected a LDAPUser but got a %T", oldObj)
+	}
+
+	u, ok := newObj.(*LDAPUser)
+	if !ok {
+		return nil, fmt.Errorf("expected a LDAPUser but got a %T", newObj)
+	}
+
+	// Never block deletion, or metadata only updates.
+	if !u.DeletionTimestamp.IsZero() || equality.Semantic.DeepEqual(u.Spec, oldUser.Spec) {
+		return nil, nil
+	}
+
+	errs := u.validate()
+
+	specPath := field.NewPath("spec")
+
+	errs = append(errs, u.Spec.LDAPObjectSpec.ValidateUpdate(&oldUser.Spec.LDAPObjectSpec, specPath)...)
+
+	// The username determines the distinguished name of the entry.
+	if u.Spec.Username != oldUser.Spec.Username {
+		errs = append(errs, field.Forbidden(specPath.Child("username"), "username is immutable"))
+	}
+
+	return nil, u.invalid(errs)
+}
+
+func (w *LDAPUserWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (u *LDAPUser) validate() field.ErrorList {
+	specPath := field.NewPath("spec")
+
+	errs := u.Spec.LDAPObjectSpec.Validate(specPath)
+	errs = append(errs, api.ValidateRDNValue(u.Spec.Username, specPath.Child("username"))...)
+
+	if u.Spec.Email != "" {
+		if _, err := mail.ParseAddress(u.Spec.Email); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("email"), u.Spec.Email, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+func (u *LDAPUser) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(GroupVersion.WithKind("LDAPUser").GroupKind(), u.Name, errs)
+}
@@ -0,0 +1,173 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package v1alpha1_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gpu-ninja/ldap-operator/api"
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/operator-utils/reference"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLDAPUserWebhook(t *testing.T) {
+	ctx := context.Background()
+	w := &ldapv1alpha1.LDAPUserWebhook{}
+
+	user := &ldapv1alpha1.LDAPUser{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+		},
+		Spec: ldapv1alpha1.LDAPUserSpec{
+			LDAPObjectSpec: api.LDAPObjectSpec{
+				DirectoryRef: api.LocalLDAPDirectoryReference{
+					Name: "test-directory",
+				},
+				ParentRef: &reference.LocalObjectReference{
+					Name: "test-ou",
+				},
+			},
+			Username: "test-user",
+			Name:     "Test User",
+			Surname:  "User",
+			Email:    "test-user@example.com",
+		},
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		defaultedUser := user.DeepCopy()
+
+		err := w.Default(ctx, defaultedUser)
+		require.NoError(t, err)
+
+		assert.Equal(t, "LDAPOrganizationalUnit", defaultedUser.Spec.ParentRef.Kind)
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		validUser := user.DeepCopy()
+		validUser.Spec.ParentRef.Kind = "LDAPOrganizationalUnit"
+
+		_, err := w.ValidateCreate(ctx, validUser)
+		require.NoError(t, err)
+	})
+
+	t.Run("Invalid Username", func(t *testing.T) {
+		for _, username := range []string{"", "test,user", "test=user", " test"} {
+			invalidUser := user.DeepCopy()
+			invalidUser.Spec.ParentRef.Kind = "LDAPOrganizationalUnit"
+			invalidUser.Spec.Username = username
+
+			_, err := w.ValidateCreate(ctx, invalidUser)
+			assert.ErrorContains(t, err, "spec.username", username)
+		}
+	})
+
+	t.Run("Invalid Parent", func(t *testing.T) {
+		invalidUser := user.DeepCopy()
+		invalidUser.Spec.ParentRef.Kind = "ConfigMap"
+		invalidUser.Spec.ParentRef.APIVersion = "v1"
+
+		_, err := w.ValidateCreate(ctx, invalidUser)
+		assert.ErrorContains(t, err, "spec.parentRef.kind")
+		assert.ErrorContains(t, err, "spec.parentRef.apiVersion")
+	})
+
+	t.Run("Invalid Database", func(t *testing.T) {
+		invalidUser := user.DeepCopy()
+		invalidUser.Spec.ParentRef.Kind = "LDAPOrganizationalUnit"
+		invalidUser.Spec.Database = "partners"
+
+		_, err := w.ValidateCreate(ctx, invalidUser)
+		assert.ErrorContains(t, err, "spec.database")
+
+		invalidUser.Spec.ParentRef = nil
+
+		_, err = w.ValidateCreate(ctx, invalidUser)
+		require.NoError(t, err)
+	})
+
+	t.Run("Invalid Resync Period", func(t *testing.T) {
+		invalidUser := user.DeepCopy()
+		invalidUser.Spec.ParentRef.Kind = "LDAPOrganizationalUnit"
+		invalidUser.Spec.ResyncPeriod = &metav1.Duration{Duration: time.Second}
+
+		_, err := w.ValidateCreate(ctx, invalidUser)
+		assert.ErrorContains(t, err, "spec.resyncPeriod")
+
+		invalidUser.Spec.ResyncPeriod = &metav1.Duration{Duration: time.Minute}
+
+		_, err = w.ValidateCreate(ctx, invalidUser)
+		require.NoError(t, err)
+	})
+
+	t.Run("Invalid Email", func(t *testing.T) {
+		invalidUser := user.DeepCopy()
+		invalidUser.Spec.ParentRef.Kind = "LDAPOrganizationalUnit"
+		invalidUser.Spec.Email = "test-user"
+
+		_, err := w.ValidateCreate(ctx, invalidUser)
+		assert.ErrorContains(t, err, "spec.email")
+	})
+
+	t.Run("Immutable", func(t *testing.T) {
+		oldUser := user.DeepCopy()
+		oldUser.Spec.ParentRef.Kind = "LDAPOrganizationalUnit"
+
+		updatedUser := oldUser.DeepCopy()
+		updatedUser.Spec.Surname = "Updated"
+
+		_, err := w.ValidateUpdate(ctx, oldUser, updatedUser)
+		require.NoError(t, err)
+
+		updatedUser.Spec.Username = "renamed-user"
+		updatedUser.Spec.DirectoryRef.Name = "other-directory"
+
+		_, err = w.ValidateUpdate(ctx, oldUser, updatedUser)
+		assert.ErrorContains(t, err, "spec.username: Forbidden")
+		assert.ErrorContains(t, err, "spec.directoryRef: Forbidden")
+	})
+
+	t.Run("Unchanged Or Deleting", func(t *testing.T) {
+		// Eg. created before the validation rule was added.
+		invalidUser := user.DeepCopy()
+		invalidUser.Spec.ParentRef.Kind = "LDAPOrganizationalUnit"
+		invalidUser.Spec.Email = "test-user"
+
+		updatedUser := invalidUser.DeepCopy()
+		updatedUser.Labels = map[string]string{"team": "platform"}
+
+		_, err := w.ValidateUpdate(ctx, invalidUser, updatedUser)
+		require.NoError(t, err)
+
+		updatedUser.Spec.Surname = "Updated"
+
+		_, err = w.ValidateUpdate(ctx, invalidUser, updatedUser)
+		assert.ErrorContains(t, err, "spec.email")
+
+		updatedUser.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		updatedUser.Finalizers = nil
+
+		_, err = w.ValidateUpdate(ctx, invalidUser, updatedUser)
+		require.NoError(t, err)
+	})
+}
@@ -25,6 +25,7 @@ package v1alpha1
 import (
 	"github.com/gpu-ninja/operator-utils/reference"
 	"k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -56,6 +57,232 @@ func (in *LDAPDirectory) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryAudit) DeepCopyInto(out *LDAPDirectoryAudit) {
+	*out = *in
+	if in.MaxSize != nil {
+		in, out := &in.MaxSize, &out.MaxSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryAudit.
+func (in *LDAPDirectoryAudit) DeepCopy() *LDAPDirectoryAudit {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryAudit)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryBootstrap) DeepCopyInto(out *LDAPDirectoryBootstrap) {
+	*out = *in
+	if in.LDIF != nil {
+		in, out := &in.LDIF, &out.LDIF
+		*out = make([]LDIFSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryBootstrap.
+func (in *LDAPDirectoryBootstrap) DeepCopy() *LDAPDirectoryBootstrap {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryBootstrap)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryChangeFeed) DeepCopyInto(out *LDAPDirectoryChangeFeed) {
+	*out = *in
+	if in.Sinks != nil {
+		in, out := &in.Sinks, &out.Sinks
+		*out = make([]LDAPDirectoryChangeFeedSink, len(*in))
+		copy(*out, *in)
+	}
+	if in.PollInterval != nil {
+		in, out := &in.PollInterval, &out.PollInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.MaxAttempts != nil {
+		in, out := &in.MaxAttempts, &out.MaxAttempts
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryChangeFeed.
+func (in *LDAPDirectoryChangeFeed) DeepCopy() *LDAPDirectoryChangeFeed {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryChangeFeed)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryChangeFeedSink) DeepCopyInto(out *LDAPDirectoryChangeFeedSink) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryChangeFeedSink.
+func (in *LDAPDirectoryChangeFeedSink) DeepCopy() *LDAPDirectoryChangeFeedSink {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryChangeFeedSink)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryChangeFeedStatus) DeepCopyInto(out *LDAPDirectoryChangeFeedStatus) {
+	*out = *in
+	if in.LastDeliveryTime != nil {
+		in, out := &in.LastDeliveryTime, &out.LastDeliveryTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryChangeFeedStatus.
+func (in *LDAPDirectoryChangeFeedStatus) DeepCopy() *LDAPDirectoryChangeFeedStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryChangeFeedStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryClone) DeepCopyInto(out *LDAPDirectoryClone) {
+	*out = *in
+	out.DirectoryRef = in.DirectoryRef
+	if in.Scrub != nil {
+		in, out := &in.Scrub, &out.Scrub
+		*out = make([]LDAPDirectoryScrubRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryClone.
+func (in *LDAPDirectoryClone) DeepCopy() *LDAPDirectoryClone {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryClone)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryCloneReference) DeepCopyInto(out *LDAPDirectoryCloneReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryCloneReference.
+func (in *LDAPDirectoryCloneReference) DeepCopy() *LDAPDirectoryCloneReference {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryCloneReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryConfigPatch) DeepCopyInto(out *LDAPDirectoryConfigPatch) {
+	*out = *in
+	in.LDIFSource.DeepCopyInto(&out.LDIFSource)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryConfigPatch.
+func (in *LDAPDirectoryConfigPatch) DeepCopy() *LDAPDirectoryConfigPatch {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryConfigPatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryConfigPatchStatus) DeepCopyInto(out *LDAPDirectoryConfigPatchStatus) {
+	*out = *in
+	if in.LastAppliedTime != nil {
+		in, out := &in.LastAppliedTime, &out.LastAppliedTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryConfigPatchStatus.
+func (in *LDAPDirectoryConfigPatchStatus) DeepCopy() *LDAPDirectoryConfigPatchStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryConfigPatchStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryDatabase) DeepCopyInto(out *LDAPDirectoryDatabase) {
+	*out = *in
+	if in.RootPasswordSecretRef != nil {
+		in, out := &in.RootPasswordSecretRef, &out.RootPasswordSecretRef
+		*out = new(reference.LocalSecretReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryDatabase.
+func (in *LDAPDirectoryDatabase) DeepCopy() *LDAPDirectoryDatabase {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryDatabase)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryExternal) DeepCopyInto(out *LDAPDirectoryExternal) {
+	*out = *in
+	if in.URLs != nil {
+		in, out := &in.URLs, &out.URLs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	out.BindPasswordSecretRef = in.BindPasswordSecretRef
+	if in.CASecretRef != nil {
+		in, out := &in.CASecretRef, &out.CASecretRef
+		*out = new(reference.LocalSecretReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryExternal.
+func (in *LDAPDirectoryExternal) DeepCopy() *LDAPDirectoryExternal {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryExternal)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LDAPDirectoryList) DeepCopyInto(out *LDAPDirectoryList) {
 	*out = *in
@@ -63,40 +290,307 @@ func (in *LDAPDirectoryList) DeepCopyInto(out *LDAPDirectoryList) {
 	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
-		*out = make([]LDAPDirectory, len(*in))
+		*out = make([]LDAPDirectory, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryList.
+func (in *LDAPDirectoryList) DeepCopy() *LDAPDirectoryList {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LDAPDirectoryList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryLoadBalancer) DeepCopyInto(out *LDAPDirectoryLoadBalancer) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryLoadBalancer.
+func (in *LDAPDirectoryLoadBalancer) DeepCopy() *LDAPDirectoryLoadBalancer {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryLoadBalancer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryMigration) DeepCopyInto(out *LDAPDirectoryMigration) {
+	*out = *in
+	in.Source.DeepCopyInto(&out.Source)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryMigration.
+func (in *LDAPDirectoryMigration) DeepCopy() *LDAPDirectoryMigration {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryMigration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryMigrationSource) DeepCopyInto(out *LDAPDirectoryMigrationSource) {
+	*out = *in
+	out.BindPasswordSecretRef = in.BindPasswordSecretRef
+	if in.CASecretRef != nil {
+		in, out := &in.CASecretRef, &out.CASecretRef
+		*out = new(reference.LocalSecretReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryMigrationSource.
+func (in *LDAPDirectoryMigrationSource) DeepCopy() *LDAPDirectoryMigrationSource {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryMigrationSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryMigrationStatus) DeepCopyInto(out *LDAPDirectoryMigrationStatus) {
+	*out = *in
+	if in.SourceEntries != nil {
+		in, out := &in.SourceEntries, &out.SourceEntries
+		*out = new(int)
+		**out = **in
+	}
+	if in.Entries != nil {
+		in, out := &in.Entries, &out.Entries
+		*out = new(int)
+		**out = **in
+	}
+	if in.Lag != nil {
+		in, out := &in.Lag, &out.Lag
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.LastCheckedTime != nil {
+		in, out := &in.LastCheckedTime, &out.LastCheckedTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CutoverTime != nil {
+		in, out := &in.CutoverTime, &out.CutoverTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryMigrationStatus.
+func (in *LDAPDirectoryMigrationStatus) DeepCopy() *LDAPDirectoryMigrationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryMigrationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryNetworkPolicy) DeepCopyInto(out *LDAPDirectoryNetworkPolicy) {
+	*out = *in
+	if in.From != nil {
+		in, out := &in.From, &out.From
+		*out = make([]networkingv1.NetworkPolicyPeer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryNetworkPolicy.
+func (in *LDAPDirectoryNetworkPolicy) DeepCopy() *LDAPDirectoryNetworkPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryNetworkPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryScrubRule) DeepCopyInto(out *LDAPDirectoryScrubRule) {
+	*out = *in
+	if in.Value != nil {
+		in, out := &in.Value, &out.Value
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryScrubRule.
+func (in *LDAPDirectoryScrubRule) DeepCopy() *LDAPDirectoryScrubRule {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryScrubRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectorySnapshot) DeepCopyInto(out *LDAPDirectorySnapshot) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectorySnapshot.
+func (in *LDAPDirectorySnapshot) DeepCopy() *LDAPDirectorySnapshot {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectorySnapshot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LDAPDirectorySnapshot) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectorySnapshotList) DeepCopyInto(out *LDAPDirectorySnapshotList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]LDAPDirectorySnapshot, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryList.
-func (in *LDAPDirectoryList) DeepCopy() *LDAPDirectoryList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectorySnapshotList.
+func (in *LDAPDirectorySnapshotList) DeepCopy() *LDAPDirectorySnapshotList {
 	if in == nil {
 		return nil
 	}
-	out := new(LDAPDirectoryList)
+	out := new(LDAPDirectorySnapshotList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *LDAPDirectoryList) DeepCopyObject() runtime.Object {
+func (in *LDAPDirectorySnapshotList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectorySnapshotSpec) DeepCopyInto(out *LDAPDirectorySnapshotSpec) {
+	*out = *in
+	out.DirectoryRef = in.DirectoryRef
+	if in.VolumeSnapshotClassName != nil {
+		in, out := &in.VolumeSnapshotClassName, &out.VolumeSnapshotClassName
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectorySnapshotSpec.
+func (in *LDAPDirectorySnapshotSpec) DeepCopy() *LDAPDirectorySnapshotSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectorySnapshotSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectorySnapshotStatus) DeepCopyInto(out *LDAPDirectorySnapshotStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VolumeSnapshots != nil {
+		in, out := &in.VolumeSnapshots, &out.VolumeSnapshots
+		*out = make([]LDAPDirectoryVolumeSnapshotStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectorySnapshotStatus.
+func (in *LDAPDirectorySnapshotStatus) DeepCopy() *LDAPDirectorySnapshotStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectorySnapshotStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LDAPDirectorySpec) DeepCopyInto(out *LDAPDirectorySpec) {
 	*out = *in
-	out.CertificateSecretRef = in.CertificateSecretRef
+	if in.CertificateSecretRef != nil {
+		in, out := &in.CertificateSecretRef, &out.CertificateSecretRef
+		*out = new(reference.LocalSecretReference)
+		**out = **in
+	}
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(LDAPDirectoryExternal)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.DebugLevel != nil {
 		in, out := &in.DebugLevel, &out.DebugLevel
 		*out = new(int)
 		**out = **in
 	}
+	if in.LogLevel != nil {
+		in, out := &in.LogLevel, &out.LogLevel
+		*out = make([]LogLevel, len(*in))
+		copy(*out, *in)
+	}
 	if in.FileDescriptorLimit != nil {
 		in, out := &in.FileDescriptorLimit, &out.FileDescriptorLimit
 		*out = new(int)
@@ -117,6 +611,55 @@ func (in *LDAPDirectorySpec) DeepCopyInto(out *LDAPDirectorySpec) {
 		}
 	}
 	in.Resources.DeepCopyInto(&out.Resources)
+	if in.Bootstrap != nil {
+		in, out := &in.Bootstrap, &out.Bootstrap
+		*out = new(LDAPDirectoryBootstrap)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Audit != nil {
+		in, out := &in.Audit, &out.Audit
+		*out = new(LDAPDirectoryAudit)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ChangeFeed != nil {
+		in, out := &in.ChangeFeed, &out.ChangeFeed
+		*out = new(LDAPDirectoryChangeFeed)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NetworkPolicy != nil {
+		in, out := &in.NetworkPolicy, &out.NetworkPolicy
+		*out = new(LDAPDirectoryNetworkPolicy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LoadBalancer != nil {
+		in, out := &in.LoadBalancer, &out.LoadBalancer
+		*out = new(LDAPDirectoryLoadBalancer)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigPatches != nil {
+		in, out := &in.ConfigPatches, &out.ConfigPatches
+		*out = make([]LDAPDirectoryConfigPatch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Databases != nil {
+		in, out := &in.Databases, &out.Databases
+		*out = make([]LDAPDirectoryDatabase, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Migration != nil {
+		in, out := &in.Migration, &out.Migration
+		*out = new(LDAPDirectoryMigration)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CloneFrom != nil {
+		in, out := &in.CloneFrom, &out.CloneFrom
+		*out = new(LDAPDirectoryClone)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectorySpec.
@@ -139,6 +682,28 @@ func (in *LDAPDirectoryStatus) DeepCopyInto(out *LDAPDirectoryStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ChangeFeed != nil {
+		in, out := &in.ChangeFeed, &out.ChangeFeed
+		*out = new(LDAPDirectoryChangeFeedStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(LDAPDirectoryUpgradeStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigPatches != nil {
+		in, out := &in.ConfigPatches, &out.ConfigPatches
+		*out = make([]LDAPDirectoryConfigPatchStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Migration != nil {
+		in, out := &in.Migration, &out.Migration
+		*out = new(LDAPDirectoryMigrationStatus)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryStatus.
@@ -151,13 +716,235 @@ func (in *LDAPDirectoryStatus) DeepCopy() *LDAPDirectoryStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryUpgradeStatus) DeepCopyInto(out *LDAPDirectoryUpgradeStatus) {
+	*out = *in
+	if in.ExportedEntries != nil {
+		in, out := &in.ExportedEntries, &out.ExportedEntries
+		*out = new(int)
+		**out = **in
+	}
+	if in.ExportedDatabaseEntries != nil {
+		in, out := &in.ExportedDatabaseEntries, &out.ExportedDatabaseEntries
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.VerifyStartTime != nil {
+		in, out := &in.VerifyStartTime, &out.VerifyStartTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryUpgradeStatus.
+func (in *LDAPDirectoryUpgradeStatus) DeepCopy() *LDAPDirectoryUpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryUpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPDirectoryVolumeSnapshotStatus) DeepCopyInto(out *LDAPDirectoryVolumeSnapshotStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPDirectoryVolumeSnapshotStatus.
+func (in *LDAPDirectoryVolumeSnapshotStatus) DeepCopy() *LDAPDirectoryVolumeSnapshotStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPDirectoryVolumeSnapshotStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPExport) DeepCopyInto(out *LDAPExport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPExport.
+func (in *LDAPExport) DeepCopy() *LDAPExport {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPExport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LDAPExport) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPExportList) DeepCopyInto(out *LDAPExportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]LDAPExport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPExportList.
+func (in *LDAPExportList) DeepCopy() *LDAPExportList {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPExportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *LDAPExportList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPExportObjectOutput) DeepCopyInto(out *LDAPExportObjectOutput) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPExportObjectOutput.
+func (in *LDAPExportObjectOutput) DeepCopy() *LDAPExportObjectOutput {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPExportObjectOutput)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPExportOutput) DeepCopyInto(out *LDAPExportOutput) {
+	*out = *in
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(LDAPExportObjectOutput)
+		**out = **in
+	}
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(LDAPExportObjectOutput)
+		**out = **in
+	}
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(LDAPExportVolumeOutput)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPExportOutput.
+func (in *LDAPExportOutput) DeepCopy() *LDAPExportOutput {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPExportOutput)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPExportSpec) DeepCopyInto(out *LDAPExportSpec) {
+	*out = *in
+	out.DirectoryRef = in.DirectoryRef
+	if in.ObjectRef != nil {
+		in, out := &in.ObjectRef, &out.ObjectRef
+		*out = new(reference.LocalObjectReference)
+		**out = **in
+	}
+	if in.Attributes != nil {
+		in, out := &in.Attributes, &out.Attributes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Scrub != nil {
+		in, out := &in.Scrub, &out.Scrub
+		*out = make([]LDAPDirectoryScrubRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Output.DeepCopyInto(&out.Output)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPExportSpec.
+func (in *LDAPExportSpec) DeepCopy() *LDAPExportSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPExportSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPExportStatus) DeepCopyInto(out *LDAPExportStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPExportStatus.
+func (in *LDAPExportStatus) DeepCopy() *LDAPExportStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPExportStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDAPExportVolumeOutput) DeepCopyInto(out *LDAPExportVolumeOutput) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPExportVolumeOutput.
+func (in *LDAPExportVolumeOutput) DeepCopy() *LDAPExportVolumeOutput {
+	if in == nil {
+		return nil
+	}
+	out := new(LDAPExportVolumeOutput)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LDAPGroup) DeepCopyInto(out *LDAPGroup) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPGroup.
@@ -237,7 +1024,7 @@ func (in *LDAPOrganizationalUnit) DeepCopyInto(out *LDAPOrganizationalUnit) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPOrganizationalUnit.
@@ -312,7 +1099,7 @@ func (in *LDAPUser) DeepCopyInto(out *LDAPUser) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPUser.
@@ -385,3 +1172,28 @@ func (in *LDAPUserSpec) DeepCopy() *LDAPUserSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LDIFSource) DeepCopyInto(out *LDIFSource) {
+	*out = *in
+	if in.ConfigMapRef != nil {
+		in, out := &in.ConfigMapRef, &out.ConfigMapRef
+		*out = new(reference.LocalConfigMapReference)
+		**out = **in
+	}
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(reference.LocalSecretReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDIFSource.
+func (in *LDIFSource) DeepCopy() *LDIFSource {
+	if in == nil {
+		return nil
+	}
+	out := new(LDIFSource)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,61 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1beta1
+
+import (
+	"github.com/gpu-ninja/ldap-operator/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type LDAPGroupSpec struct {
+	api.LDAPObjectSpec `json:",inline"`
+	// Name is the common name for this group.
+	Name string `json:"name"`
+	// Description is an optional description of this group.
+	Description string `json:"description,omitempty"`
+	// Members is a list of distinguished names representing the members of this group.
+	//+kubebuilder:validation:MinItems=1
+	Members []string `json:"members"`
+}
+
+// LDAPGroup is a LDAP group of names.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="DN",type=string,JSONPath=`.status.distinguishedName`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type LDAPGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LDAPGroupSpec    `json:"spec,omitempty"`
+	Status api.SimpleStatus `json:"status,omitempty"`
+}
+
+// LDAPGroupList contains a list of LDAPGroup
+// +kubebuilder:object:root=true
+type LDAPGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LDAPGroup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LDAPGroup{}, &LDAPGroupList{})
+}
@@ -0,0 +1,58 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1beta1
+
+import (
+	"github.com/gpu-ninja/ldap-operator/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type LDAPOrganizationalUnitSpec struct {
+	api.LDAPObjectSpec `json:",inline"`
+	// Name is the common name for this organizational unit.
+	Name string `json:"name"`
+	// Description is an optional description of this organizational unit.
+	Description string `json:"description,omitempty"`
+}
+
+// LDAPOrganizationalUnit is a LDAP organizational unit.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="DN",type=string,JSONPath=`.status.distinguishedName`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type LDAPOrganizationalUnit struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LDAPOrganizationalUnitSpec `json:"spec,omitempty"`
+	Status api.SimpleStatus           `json:"status,omitempty"`
+}
+
+// LDAPOrganizationalUnitList contains a list of LDAPOrganizationalUnit
+// +kubebuilder:object:root=true
+type LDAPOrganizationalUnitList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LDAPOrganizationalUnit `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LDAPOrganizationalUnit{}, &LDAPOrganizationalUnitList{})
+}
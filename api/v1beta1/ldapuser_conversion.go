@@ -0,0 +1,67 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1beta1
+
+import (
+	"fmt"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo converts this LDAPUser to the hub version (v1alpha1).
+func (u *LDAPUser) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*ldapv1alpha1.LDAPUser)
+	if !ok {
+		return fmt.Errorf("unsupported conversion to %T", dstRaw)
+	}
+
+	dst.ObjectMeta = u.ObjectMeta
+	dst.Spec = ldapv1alpha1.LDAPUserSpec{
+		LDAPObjectSpec:   u.Spec.LDAPObjectSpec,
+		Username:         u.Spec.Username,
+		Name:             u.Spec.Name,
+		Surname:          u.Spec.Surname,
+		Email:            u.Spec.Email,
+		PaswordSecretRef: u.Spec.PasswordSecretRef,
+	}
+	dst.Status = u.Status
+
+	return nil
+}
+
+// ConvertFrom converts from the hub version (v1alpha1) to this version.
+func (u *LDAPUser) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*ldapv1alpha1.LDAPUser)
+	if !ok {
+		return fmt.Errorf("unsupported conversion from %T", srcRaw)
+	}
+
+	u.ObjectMeta = src.ObjectMeta
+	u.Spec = LDAPUserSpec{
+		LDAPObjectSpec:    src.Spec.LDAPObjectSpec,
+		Username:          src.Spec.Username,
+		Name:              src.Spec.Name,
+		Surname:           src.Spec.Surname,
+		Email:             src.Spec.Email,
+		PasswordSecretRef: src.Spec.PaswordSecretRef,
+	}
+	u.Status = src.Status
+
+	return nil
+}
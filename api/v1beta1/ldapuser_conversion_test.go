@@ -0,0 +1,80 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package v1beta1_test
+
+import (
+	"testing"
+
+	"github.com/gpu-ninja/ldap-operator/api"
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	ldapv1beta1 "github.com/gpu-ninja/ldap-operator/api/v1beta1"
+	"github.com/gpu-ninja/operator-utils/reference"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLDAPUserConversion(t *testing.T) {
+	user := &ldapv1alpha1.LDAPUser{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+		},
+		Spec: ldapv1alpha1.LDAPUserSpec{
+			LDAPObjectSpec: api.LDAPObjectSpec{
+				DirectoryRef: api.LocalLDAPDirectoryReference{
+					Name: "test-directory",
+				},
+				ParentRef: &reference.LocalObjectReference{
+					Name: "test-ou",
+					Kind: "LDAPOrganizationalUnit",
+				},
+			},
+			Username: "test-user",
+			Name:     "Test User",
+			Surname:  "User",
+			Email:    "test-user@example.com",
+			PaswordSecretRef: &reference.LocalSecretReference{
+				Name: "test-user-password",
+			},
+		},
+		Status: api.SimpleStatus{
+			Phase:             api.PhaseReady,
+			DistinguishedName: "uid=test-user,ou=users,dc=example,dc=com",
+			Conditions: []metav1.Condition{
+				{
+					Type:   api.ConditionTypePaused,
+					Status: metav1.ConditionFalse,
+					Reason: "Resumed",
+				},
+			},
+		},
+	}
+
+	var converted ldapv1beta1.LDAPUser
+	err := converted.ConvertFrom(user)
+	require.NoError(t, err)
+
+	assert.Equal(t, user.Spec.PaswordSecretRef, converted.Spec.PasswordSecretRef)
+	assert.Equal(t, user.Status.DistinguishedName, converted.Status.DistinguishedName)
+
+	var roundTripped ldapv1alpha1.LDAPUser
+	err = converted.ConvertTo(&roundTripped)
+	require.NoError(t, err)
+
+	assert.Equal(t, user, &roundTripped)
+}
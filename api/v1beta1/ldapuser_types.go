@@ -0,0 +1,65 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1beta1
+
+import (
+	"github.com/gpu-ninja/ldap-operator/api"
+	"github.com/gpu-ninja/operator-utils/reference"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type LDAPUserSpec struct {
+	api.LDAPObjectSpec `json:",inline"`
+	// Username is the username (uid) for this user.
+	Username string `json:"username"`
+	// Name is the full name of this user (commonName).
+	Name string `json:"name"`
+	// Surname is the surname of this user.
+	Surname string `json:"surname"`
+	// Email is an optional email address of this user.
+	Email string `json:"email,omitempty"`
+	// PasswordSecretRef is an optional reference to a secret containing the password of the user.
+	PasswordSecretRef *reference.LocalSecretReference `json:"passwordSecretRef,omitempty"`
+}
+
+// LDAPUser is a LDAP user.
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="DN",type=string,JSONPath=`.status.distinguishedName`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type LDAPUser struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   LDAPUserSpec     `json:"spec,omitempty"`
+	Status api.SimpleStatus `json:"status,omitempty"`
+}
+
+// LDAPUserList contains a list of LDAPUser
+// +kubebuilder:object:root=true
+type LDAPUserList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []LDAPUser `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&LDAPUser{}, &LDAPUserList{})
+}
@@ -0,0 +1,143 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// Group is the API group of all LDAP objects.
+const Group = "ldap.gpu-ninja.com"
+
+// ParentKinds are the kinds of object that can be referenced as a parent.
+var ParentKinds = []string{"LDAPOrganizationalUnit"}
+
+// rdnSpecialChars are characters that would change the meaning of a
+// relative distinguished name if used unescaped in an attribute value.
+const rdnSpecialChars = `,=+<>#;\"`
+
+// ValidateRDNValue checks that a value can be used, as is, as the value of
+// the relative distinguished name of an entry (eg. a username).
+func ValidateRDNValue(value string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if value == "" {
+		errs = append(errs, field.Required(fldPath, ""))
+	} else if strings.ContainsAny(value, rdnSpecialChars) {
+		errs = append(errs, field.Invalid(fldPath, value, "must not contain any of the characters "+rdnSpecialChars))
+	} else if strings.TrimSpace(value) != value {
+		errs = append(errs, field.Invalid(fldPath, value, "must not start or end with whitespace"))
+	}
+
+	return errs
+}
+
+// ValidateDN checks that a value is a valid distinguished name.
+func ValidateDN(value string, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if value == "" {
+		errs = append(errs, field.Required(fldPath, ""))
+	} else if _, err := ldap.ParseDN(value); err != nil {
+		errs = append(errs, field.Invalid(fldPath, value, err.Error()))
+	}
+
+	return errs
+}
+
+// Validate checks the references of an LDAP object.
+func (s *LDAPObjectSpec) Validate(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if s.DirectoryRef.Name == "" {
+		errs = append(errs, field.Required(fldPath.Child("directoryRef", "name"), ""))
+	}
+
+	if s.ParentRef != nil {
+		parentPath := fldPath.Child("parentRef")
+
+		if s.ParentRef.Name == "" {
+			errs = append(errs, field.Required(parentPath.Child("name"), ""))
+		}
+
+		isParentKind := false
+		for _, kind := range ParentKinds {
+			if s.ParentRef.Kind == kind {
+				isParentKind = true
+				break
+			}
+		}
+
+		if !isParentKind {
+			errs = append(errs, field.NotSupported(parentPath.Child("kind"), s.ParentRef.Kind, ParentKinds))
+		}
+
+		if s.Database != "" {
+			errs = append(errs, field.Forbidden(fldPath.Child("database"),
+				"objects with a parent are created in the database of their parent"))
+		}
+
+		if s.ParentRef.APIVersion != "" {
+			gv, err := schema.ParseGroupVersion(s.ParentRef.APIVersion)
+			if err != nil {
+				errs = append(errs, field.Invalid(parentPath.Child("apiVersion"), s.ParentRef.APIVersion, err.Error()))
+			} else if gv.Group != Group {
+				errs = append(errs, field.Invalid(parentPath.Child("apiVersion"), s.ParentRef.APIVersion, "must be in the "+Group+" group"))
+			}
+		}
+	}
+
+	if s.ResyncPeriod != nil && s.ResyncPeriod.Duration < MinResyncPeriod {
+		errs = append(errs, field.Invalid(fldPath.Child("resyncPeriod"), s.ResyncPeriod.Duration.String(),
+			"must be at least "+MinResyncPeriod.String()))
+	}
+
+	return errs
+}
+
+// ValidateUpdate checks that the references (and database) of an LDAP object have not changed.
+// Changing any of them would move the entry, which is not supported.
+func (s *LDAPObjectSpec) ValidateUpdate(old *LDAPObjectSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if s.DirectoryRef != old.DirectoryRef {
+		errs = append(errs, field.Forbidden(fldPath.Child("directoryRef"), "directoryRef is immutable"))
+	}
+
+	if !equality.Semantic.DeepEqual(s.ParentRef, old.ParentRef) {
+		errs = append(errs, field.Forbidden(fldPath.Child("parentRef"), "parentRef is immutable"))
+	}
+
+	if s.Database != old.Database {
+		errs = append(errs, field.Forbidden(fldPath.Child("database"), "database is immutable"))
+	}
+
+	return errs
+}
+
+// Default sets the default kind of the parent reference.
+func (s *LDAPObjectSpec) Default() {
+	if s.ParentRef != nil && s.ParentRef.Kind == "" {
+		s.ParentRef.Kind = ParentKinds[0]
+	}
+}
@@ -24,6 +24,7 @@ package api
 
 import (
 	"github.com/gpu-ninja/operator-utils/reference"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -35,6 +36,11 @@ func (in *LDAPObjectSpec) DeepCopyInto(out *LDAPObjectSpec) {
 		*out = new(reference.LocalObjectReference)
 		**out = **in
 	}
+	if in.ResyncPeriod != nil {
+		in, out := &in.ResyncPeriod, &out.ResyncPeriod
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LDAPObjectSpec.
@@ -61,3 +67,29 @@ func (in *LocalLDAPDirectoryReference) DeepCopy() *LocalLDAPDirectoryReference {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SimpleStatus) DeepCopyInto(out *SimpleStatus) {
+	*out = *in
+	if in.LastSyncTime != nil {
+		in, out := &in.LastSyncTime, &out.LastSyncTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SimpleStatus.
+func (in *SimpleStatus) DeepCopy() *SimpleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SimpleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,47 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/gpu-ninja/ldap-operator/internal/auditlog"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// auditTail runs the audit log sidecar, which streams the OpenLDAP audit
+// log to stdout as JSON.
+func auditTail(args []string) error {
+	fs := flag.NewFlagSet("audit-tail", flag.ExitOnError)
+
+	tailer := auditlog.Tailer{
+		Out: os.Stdout,
+	}
+
+	fs.StringVar(&tailer.Path, "file", "/var/log/ldap/audit.ldif", "The audit log file to tail.")
+	fs.Int64Var(&tailer.MaxSize, "max-size", 16*1024*1024, "The size in bytes after which the audit log will be rotated.")
+	fs.StringVar(&tailer.StatePath, "state-file", "/var/log/ldap/audit-tail.json", "The file the position in the audit log is recorded in.")
+	fs.DurationVar(&tailer.PollInterval, "poll-interval", time.Second, "How often to check the audit log for new records.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return tailer.Run(ctrl.SetupSignalHandler())
+}
@@ -0,0 +1,86 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/gpu-ninja/ldap-operator/internal/bootstrap"
+	zaplogfmt "github.com/jsternberg/zap-logfmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// bootstrapDirectory runs the directory init container, which creates (or
+// updates) the OpenLDAP configuration from the LDAP_* environment variables.
+func bootstrapDirectory(args []string) error {
+	fs := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+
+	cfg, err := bootstrap.ConfigFromEnv(os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	var owner string
+	fs.StringVar(&cfg.ConfigDir, "config-dir", cfg.ConfigDir, "The directory containing the cn=config database.")
+	fs.StringVar(&cfg.DataDir, "data-dir", cfg.DataDir, "The directory containing the main database.")
+	fs.StringVar(&cfg.SchemaDir, "schema-dir", cfg.SchemaDir, "The directory containing the LDIF schemas.")
+	fs.StringVar(&owner, "owner", "openldap", "The user that will own the databases.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return fmt.Errorf("failed to lookup user: %w", err)
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("invalid uid: %w", err)
+	}
+
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("invalid gid: %w", err)
+	}
+
+	logger := zap.New(zapcore.NewCore(
+		zaplogfmt.NewEncoder(zap.NewProductionEncoderConfig()),
+		os.Stdout,
+		zapcore.InfoLevel,
+	))
+	defer func() {
+		_ = logger.Sync()
+	}()
+
+	b := &bootstrap.Bootstrapper{
+		Logger: logger,
+		Config: cfg,
+		Tools:  &bootstrap.SlapTools{ConfigDir: cfg.ConfigDir},
+		UID:    uid,
+		GID:    gid,
+	}
+
+	return b.Run(ctrl.SetupSignalHandler())
+}
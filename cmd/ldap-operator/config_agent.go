@@ -0,0 +1,144 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gpu-ninja/ldap-operator/internal/bootstrap"
+	"github.com/gpu-ninja/ldap-operator/internal/configagent"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	zaplogfmt "github.com/jsternberg/zap-logfmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// configAgent runs the config agent sidecar, which applies the desired
+// cn=config configuration to the directory, and serves what it has applied.
+func configAgent(args []string) error {
+	fs := flag.NewFlagSet("config-agent", flag.ExitOnError)
+
+	var address, listenAddress, ldapConfigDir, freezeFile, tlsCertFile, tlsKeyFile string
+	agent := configagent.Agent{}
+
+	fs.StringVar(&agent.ConfigDir, "config-dir", "/etc/ldap-operator/config", "The directory the desired configuration is mounted at.")
+	fs.StringVar(&agent.StatePath, "state-file", "/var/lib/ldap/config-agent.json", "The file the applied configuration is recorded in.")
+	fs.StringVar(&address, "address", ldap.DefaultConfigAddress, "The ldapi:/// address of the directory.")
+	fs.StringVar(&listenAddress, "listen-address", fmt.Sprintf(":%d", configagent.DefaultPort), "The address the status, export, and freeze endpoints bind to.")
+	fs.StringVar(&ldapConfigDir, "ldap-config-dir", "/etc/ldap/slapd.d", "The directory containing the cn=config database (used for exports).")
+	fs.StringVar(&freezeFile, "freeze-file", "/var/lib/ldap/"+bootstrap.FreezeFile, "The file the databases frozen by the agent are recorded in.")
+	fs.StringVar(&tlsCertFile, "tls-cert-file", "/etc/ldap/certs/tls.crt", "The certificate the endpoints are served with (the certificate of the directory).")
+	fs.StringVar(&tlsKeyFile, "tls-key-file", "/etc/ldap/certs/tls.key", "The private key of the certificate the endpoints are served with.")
+	fs.DurationVar(&agent.PollInterval, "poll-interval", 10*time.Second, "How often to check the desired configuration for changes.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger := zap.New(zapcore.NewCore(
+		zaplogfmt.NewEncoder(zap.NewProductionEncoderConfig()),
+		os.Stdout,
+		zapcore.InfoLevel,
+	))
+	defer func() {
+		_ = logger.Sync()
+	}()
+
+	agent.Logger = logger
+	agent.Client = ldap.NewConfigClient(address)
+
+	// Exports (and freezing) are disabled unless the agent token is provided.
+	token := os.Getenv("LDAP_AGENT_TOKEN")
+
+	mux := http.NewServeMux()
+	mux.Handle("/status", &agent)
+	mux.Handle("/export", &configagent.ExportHandler{
+		Logger: logger,
+		Token:  token,
+		Export: configagent.SlapcatExport(ldapConfigDir),
+	})
+	mux.Handle("/freeze", &configagent.FreezeHandler{
+		Logger:     logger,
+		Token:      token,
+		Client:     agent.Client,
+		FreezeFile: freezeFile,
+		ReadOnly:   true,
+	})
+	mux.Handle("/unfreeze", &configagent.FreezeHandler{
+		Logger:     logger,
+		Token:      token,
+		Client:     agent.Client,
+		FreezeFile: freezeFile,
+	})
+
+	server := &http.Server{
+		Addr:              listenAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		TLSConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			// Reload the certificate on every handshake, so that renewals are
+			// picked up without restarting the agent.
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				cert, err := tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile)
+				if err != nil {
+					return nil, fmt.Errorf("failed to load certificate: %w", err)
+				}
+
+				return &cert, nil
+			},
+		},
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- fmt.Errorf("failed to serve status: %w", err)
+		}
+		close(serveErr)
+	}()
+
+	ctx, cancel := context.WithCancel(ctrl.SetupSignalHandler())
+	defer cancel()
+
+	go func() {
+		// Stop the agent if the status endpoint fails.
+		if err := <-serveErr; err != nil {
+			logger.Error("Status endpoint failed", zap.Error(err))
+			cancel()
+		}
+	}()
+
+	runErr := agent.Run(ctx)
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil && runErr == nil {
+		runErr = fmt.Errorf("failed to shutdown status endpoint: %w", err)
+	}
+
+	return runErr
+}
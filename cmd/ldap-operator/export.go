@@ -0,0 +1,133 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gpu-ninja/ldap-operator/internal/export"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	zaplogfmt "github.com/jsternberg/zap-logfmt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// exportDirectory runs the LDAPExport job, which exports entries of a
+// directory (selected by the LDAP_EXPORT options) to an LDIF file.
+func exportDirectory(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+
+	var url, bindDN, caFile, output, terminationLog string
+	fs.StringVar(&url, "url", "", "The ldaps:// address of the directory.")
+	fs.StringVar(&bindDN, "bind-dn", "", "The distinguished name to bind as (the password is read from LDAP_BIND_PASSWORD).")
+	fs.StringVar(&caFile, "ca-file", "", "The CA certificate of the directory (defaults to the system trust store).")
+	fs.StringVar(&output, "output", "", "The file the LDIF is written to.")
+	fs.StringVar(&terminationLog, "termination-log", "/dev/termination-log", "The file the number of exported entries is written to.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if url == "" || output == "" {
+		return fmt.Errorf("url and output are required")
+	}
+
+	var opts export.Options
+	if err := json.Unmarshal([]byte(os.Getenv("LDAP_EXPORT")), &opts); err != nil {
+		return fmt.Errorf("invalid export options: %w", err)
+	}
+
+	var caBundle *x509.CertPool
+	if caFile != "" {
+		caCertPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read ca certificate: %w", err)
+		}
+
+		caBundle = x509.NewCertPool()
+		if ok := caBundle.AppendCertsFromPEM(caCertPEM); !ok {
+			return fmt.Errorf("failed to construct ca bundle")
+		}
+	}
+
+	logger := zap.New(zapcore.NewCore(
+		zaplogfmt.NewEncoder(zap.NewProductionEncoderConfig()),
+		os.Stdout,
+		zapcore.InfoLevel,
+	))
+	defer func() {
+		_ = logger.Sync()
+	}()
+
+	client := ldap.NewClient([]string{url}, caBundle, bindDN, os.Getenv("LDAP_BIND_PASSWORD"), opts.BaseDN)
+
+	if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	// Written to a temporary file first, so that an existing export is never
+	// replaced by a partial one.
+	f, err := os.CreateTemp(filepath.Dir(output), ".export-*")
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(0o644); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to set output file permissions: %w", err)
+	}
+
+	w := bufio.NewWriter(f)
+
+	logger.Info("Exporting entries", zap.String("baseDN", opts.BaseDN), zap.String("output", output))
+
+	n, err := export.Export(w, client, &opts)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), output); err != nil {
+		return fmt.Errorf("failed to rename output file: %w", err)
+	}
+
+	logger.Info("Exported entries", zap.Int("entries", n))
+
+	// The operator reads the number of exported entries from the termination message.
+	if err := os.WriteFile(terminationLog, []byte(strconv.Itoa(n)), 0o644); err != nil {
+		return fmt.Errorf("failed to write termination log: %w", err)
+	}
+
+	return nil
+}
@@ -19,7 +19,10 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -29,18 +32,24 @@ import (
 	"go.uber.org/zap/zapcore"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 
 	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	ldapv1beta1 "github.com/gpu-ninja/ldap-operator/api/v1beta1"
+	"github.com/gpu-ninja/ldap-operator/internal/configagent"
 	"github.com/gpu-ninja/ldap-operator/internal/controller"
 	"github.com/gpu-ninja/ldap-operator/internal/ldap"
 	"github.com/gpu-ninja/ldap-operator/internal/mapper"
+	"github.com/gpu-ninja/ldap-operator/internal/migration"
 	"github.com/gpu-ninja/operator-utils/zaplogr"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -51,15 +60,59 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+
 	utilruntime.Must(ldapv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(ldapv1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap" {
+		if err := bootstrapDirectory(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "bootstrap: %s\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "config-agent" {
+		if err := configAgent(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "config-agent: %s\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := exportDirectory(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "export: %s\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "audit-tail" {
+		if err := auditTail(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "audit-tail: %s\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var zapLogLevel string
+	var operatorNamespace string
+	var enableWebhooks bool
+	var webhookPort int
+	var webhookCertDir string
+	var resyncPeriod time.Duration
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -67,6 +120,14 @@ func main() {
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&zapLogLevel, "zap-log-level", "info", "Zap Level to configure the verbosity of logging.")
+	flag.StringVar(&operatorNamespace, "operator-namespace", os.Getenv("POD_NAMESPACE"),
+		"The namespace the operator is running in (used to admit the operator through network policies).")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", true, "Enable the validating and defaulting admission webhooks (the conversion webhook is always served).")
+	flag.IntVar(&webhookPort, "webhook-port", 9443, "The port the webhook server binds to.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs",
+		"The directory containing the webhook server certificate (tls.crt) and key (tls.key).")
+	flag.DurationVar(&resyncPeriod, "resync-period", 10*time.Minute,
+		"How often LDAP entries are compared with the directory to detect drift (0 to disable).")
 	flag.Parse()
 
 	lvl, err := zapcore.ParseLevel(zapLogLevel)
@@ -85,8 +146,12 @@ func main() {
 	setupLog := ctrl.Log.WithName("setup")
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
-		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
+		Scheme:  scheme,
+		Metrics: metricsserver.Options{BindAddress: metricsAddr},
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    webhookPort,
+			CertDir: webhookCertDir,
+		}),
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "49e56cbc.gpu-ninja.com",
@@ -112,14 +177,48 @@ func main() {
 		WithScheme(mgr.GetScheme())
 
 	if err = (&controller.LDAPDirectoryReconciler{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		Recorder: mgr.GetEventRecorderFor("ldapdirectory-controller"),
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		Recorder:          mgr.GetEventRecorderFor("ldapdirectory-controller"),
+		LDAPClientBuilder: ldapClientBuilder,
+		ConfigAgentClient: configagent.NewClient(),
+		OperatorNamespace: operatorNamespace,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LDAPDirectory")
 		os.Exit(1)
 	}
 
+	if err = (&controller.LDAPDirectoryChangeFeedReconciler{
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		Recorder:          mgr.GetEventRecorderFor("ldapdirectory-changefeed-controller"),
+		LDAPClientBuilder: ldapClientBuilder,
+		HTTPClient:        &http.Client{Timeout: 10 * time.Second},
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "LDAPDirectoryChangeFeed")
+		os.Exit(1)
+	}
+
+	if err = (&controller.LDAPDirectorySnapshotReconciler{
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		Recorder:          mgr.GetEventRecorderFor("ldapdirectorysnapshot-controller"),
+		ConfigAgentClient: configagent.NewClient(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "LDAPDirectorySnapshot")
+		os.Exit(1)
+	}
+
+	if err = (&controller.LDAPExportReconciler{
+		Client:            mgr.GetClient(),
+		Scheme:            mgr.GetScheme(),
+		Recorder:          mgr.GetEventRecorderFor("ldapexport-controller"),
+		LDAPClientBuilder: ldapClientBuilder,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "LDAPExport")
+		os.Exit(1)
+	}
+
 	if err = (&controller.LDAPObjectReconciler[
 		*ldapv1alpha1.LDAPGroup, *ldap.Group]{
 		Client:            mgr.GetClient(),
@@ -127,6 +226,7 @@ func main() {
 		Recorder:          mgr.GetEventRecorderFor("ldapgroup-controller"),
 		LDAPClientBuilder: ldapClientBuilder,
 		MapToEntry:        mapper.GroupToEntry,
+		ResyncPeriod:      resyncPeriod,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LDAPGroup")
 		os.Exit(1)
@@ -139,6 +239,7 @@ func main() {
 		Recorder:          mgr.GetEventRecorderFor("ldaporganizationalunit-controller"),
 		LDAPClientBuilder: ldapClientBuilder,
 		MapToEntry:        mapper.OrganizationalUnitToEntry,
+		ResyncPeriod:      resyncPeriod,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LDAPOrganizationalUnit")
 		os.Exit(1)
@@ -151,17 +252,76 @@ func main() {
 		Recorder:          mgr.GetEventRecorderFor("ldapuser-controller"),
 		LDAPClientBuilder: ldapClientBuilder,
 		MapToEntry:        mapper.UserToEntry,
+		ResyncPeriod:      resyncPeriod,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "LDAPUser")
 		os.Exit(1)
 	}
+
+	if enableWebhooks {
+		if err = (&ldapv1alpha1.LDAPDirectory{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "LDAPDirectory")
+			os.Exit(1)
+		}
+
+		if err = (&ldapv1alpha1.LDAPGroup{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "LDAPGroup")
+			os.Exit(1)
+		}
+
+		if err = (&ldapv1alpha1.LDAPOrganizationalUnit{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "LDAPOrganizationalUnit")
+			os.Exit(1)
+		}
+
+		if err = (&ldapv1alpha1.LDAPUser{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "LDAPUser")
+			os.Exit(1)
+		}
+	}
+
+	// v1beta1 is the storage version of LDAP objects, so the conversion webhook
+	// (v1alpha1 is the hub version) is required for any of them to be read.
+	for _, obj := range []client.Object{
+		&ldapv1alpha1.LDAPGroup{},
+		&ldapv1alpha1.LDAPOrganizationalUnit{},
+		&ldapv1alpha1.LDAPUser{},
+	} {
+		if err = ctrl.NewWebhookManagedBy(mgr).For(obj).Complete(); err != nil {
+			setupLog.Error(err, "unable to create conversion webhook", "webhook", fmt.Sprintf("%T", obj))
+			os.Exit(1)
+		}
+	}
+
+	// Objects can only be rewritten in the storage version once the
+	// conversion webhook is being served.
+	if err = mgr.Add(&migration.StorageVersionMigrator{
+		Client: mgr.GetClient(),
+		Resources: []migration.Resource{
+			{
+				CRDName: "ldapgroups.ldap.gpu-ninja.com",
+				NewList: func() client.ObjectList { return &ldapv1alpha1.LDAPGroupList{} },
+			},
+			{
+				CRDName: "ldaporganizationalunits.ldap.gpu-ninja.com",
+				NewList: func() client.ObjectList { return &ldapv1alpha1.LDAPOrganizationalUnitList{} },
+			},
+			{
+				CRDName: "ldapusers.ldap.gpu-ninja.com",
+				NewList: func() client.ObjectList { return &ldapv1alpha1.LDAPUserList{} },
+			},
+		},
+	}); err != nil {
+		setupLog.Error(err, "unable to add storage version migrator")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+	if err := mgr.AddReadyzCheck("readyz", mgr.GetWebhookServer().StartedChecker()); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
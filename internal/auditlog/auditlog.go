@@ -0,0 +1,352 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package auditlog tails the file written by the OpenLDAP auditlog overlay
+// and re-emits each change record as a single line of JSON.
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Record is a single change record written by the auditlog overlay.
+type Record struct {
+	// Time is when the change was made.
+	Time time.Time `json:"time"`
+	// Operation is the LDAP operation (add, modify, delete, modrdn).
+	Operation string `json:"operation"`
+	// Suffix is the suffix of the database that was changed.
+	Suffix string `json:"suffix"`
+	// Modifier is the distinguished name of the client that made the change.
+	Modifier string `json:"modifier"`
+	// ClientAddress is the address of the client that made the change.
+	ClientAddress string `json:"clientAddress,omitempty"`
+	// Connection is the slapd connection number.
+	Connection string `json:"connection,omitempty"`
+	// DN is the distinguished name of the changed entry.
+	DN string `json:"dn"`
+	// ChangeType is the LDIF changetype of the record.
+	ChangeType string `json:"changeType"`
+	// LDIF is the raw LDIF change record.
+	LDIF string `json:"ldif"`
+}
+
+// Tailer follows an audit log file, writing every complete record to an
+// output stream. Once the file grows beyond MaxSize it is rotated.
+type Tailer struct {
+	// Path is the path of the audit log file.
+	Path string
+	// MaxSize is the size in bytes after which the audit log will be rotated.
+	MaxSize int64
+	// PollInterval is how often the audit log is checked for new records.
+	PollInterval time.Duration
+	// Out is where JSON records are written.
+	Out io.Writer
+	// StatePath is where the position of the tailer in the audit log is
+	// persisted (optional), so that a restarted tailer resumes after the last
+	// record it emitted.
+	StatePath string
+
+	file    *os.File
+	inode   uint64
+	offset  int64
+	pending []byte
+	saved   position
+}
+
+// position is the offset just past the last emitted record of an audit log
+// file. The file is identified by its inode, as it is replaced on rotation.
+type position struct {
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// Run tails the audit log until the context is cancelled.
+func (t *Tailer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(t.PollInterval)
+	defer ticker.Stop()
+
+	defer func() {
+		if t.file != nil {
+			_ = t.file.Close()
+		}
+	}()
+
+	for {
+		if err := t.Poll(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll emits any new records and rotates the audit log if required.
+func (t *Tailer) Poll() error {
+	if t.file == nil {
+		f, err := os.Open(t.Path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// Nothing has been written yet.
+				return nil
+			}
+
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+
+		t.file = f
+		t.offset = 0
+		t.pending = nil
+
+		if err := t.resume(); err != nil {
+			return err
+		}
+	}
+
+	if err := t.readRecords(); err != nil {
+		return err
+	}
+
+	if t.MaxSize > 0 && t.offset >= t.MaxSize {
+		return t.rotate()
+	}
+
+	return nil
+}
+
+// rotate moves the audit log out of the way so that slapd will start a new
+// file. slapd reopens the audit log for every write so no records are lost,
+// any write that raced with the rename is drained before the old file is removed.
+func (t *Tailer) rotate() error {
+	rotatedPath := t.Path + ".1"
+	if err := os.Rename(t.Path, rotatedPath); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+
+	if err := t.readRecords(); err != nil {
+		return err
+	}
+
+	if err := t.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	t.file = nil
+
+	// The inode of the rotated audit log may be reused by the next one.
+	if err := t.savePosition(position{}); err != nil {
+		return err
+	}
+
+	if err := os.Remove(rotatedPath); err != nil {
+		return fmt.Errorf("failed to remove rotated audit log: %w", err)
+	}
+
+	return nil
+}
+
+func (t *Tailer) readRecords() error {
+	buf, err := io.ReadAll(t.file)
+	if err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	t.offset += int64(len(buf))
+	t.pending = append(t.pending, buf...)
+
+	for {
+		end := findRecordEnd(t.pending)
+		if end < 0 {
+			return t.savePosition(position{
+				Inode:  t.inode,
+				Offset: t.offset - int64(len(t.pending)),
+			})
+		}
+
+		record, err := parseRecord(t.pending[:end])
+		if err != nil {
+			return err
+		}
+
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit record: %w", err)
+		}
+
+		if _, err := t.Out.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write audit record: %w", err)
+		}
+
+		t.pending = t.pending[end:]
+	}
+}
+
+// resume seeks to the persisted position, if it is in the open audit log.
+func (t *Tailer) resume() error {
+	fi, err := t.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		t.inode = stat.Ino
+	}
+
+	if t.StatePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(t.StatePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &t.saved); err != nil {
+		return fmt.Errorf("failed to parse state: %w", err)
+	}
+
+	// The state is of a previous (or truncated) audit log.
+	if t.saved.Inode != t.inode || t.saved.Offset > fi.Size() {
+		return nil
+	}
+
+	if _, err := t.file.Seek(t.saved.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek audit log: %w", err)
+	}
+	t.offset = t.saved.Offset
+
+	return nil
+}
+
+// savePosition persists the position of the tailer (if it has changed).
+func (t *Tailer) savePosition(pos position) error {
+	if t.StatePath == "" || pos == t.saved {
+		return nil
+	}
+
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	// Write atomically so that a crash cannot leave a truncated state file.
+	tmpPath := t.StatePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, t.StatePath); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	t.saved = pos
+
+	return nil
+}
+
+// findRecordEnd returns the offset just past the "# end" trailer of the first
+// complete record in buf, or -1 if there is no complete record.
+func findRecordEnd(buf []byte) int {
+	var offset int
+	for {
+		idx := bytes.IndexByte(buf[offset:], '\n')
+		if idx < 0 {
+			return -1
+		}
+
+		line := buf[offset : offset+idx]
+		offset += idx + 1
+
+		if bytes.HasPrefix(line, []byte("# end ")) {
+			return offset
+		}
+	}
+}
+
+// parseRecord parses a record in the format written by the auditlog overlay, eg.
+//
+//	# modify 1697000000 dc=example,dc=com cn=admin,dc=example,dc=com IP=10.0.0.1:41234 conn=1001
+//	dn: uid=demo,ou=users,dc=example,dc=com
+//	changetype: modify
+//	...
+//	# end modify 1697000000
+func parseRecord(raw []byte) (*Record, error) {
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("malformed audit record: %q", raw)
+	}
+
+	header := strings.Fields(strings.TrimPrefix(lines[0], "#"))
+	if len(header) < 4 {
+		return nil, fmt.Errorf("malformed audit record header: %q", lines[0])
+	}
+
+	timestamp, err := strconv.ParseInt(header[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed audit record timestamp: %w", err)
+	}
+
+	record := &Record{
+		Time:      time.Unix(timestamp, 0).UTC(),
+		Operation: header[0],
+		Suffix:    header[2],
+		Modifier:  header[3],
+		LDIF:      strings.Join(lines[1:len(lines)-1], "\n") + "\n",
+	}
+
+	for _, field := range header[4:] {
+		if value, ok := strings.CutPrefix(field, "IP="); ok {
+			record.ClientAddress = value
+		} else if value, ok := strings.CutPrefix(field, "conn="); ok {
+			record.Connection = value
+		}
+	}
+
+	for _, line := range lines[1 : len(lines)-1] {
+		if value, ok := strings.CutPrefix(line, "dn: "); ok && record.DN == "" {
+			record.DN = value
+		} else if value, ok := strings.CutPrefix(line, "dn:: "); ok && record.DN == "" {
+			dn, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("malformed audit record dn: %w", err)
+			}
+
+			record.DN = string(dn)
+		} else if value, ok := strings.CutPrefix(line, "changetype: "); ok && record.ChangeType == "" {
+			record.ChangeType = value
+		}
+	}
+
+	return record, nil
+}
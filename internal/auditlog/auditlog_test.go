@@ -0,0 +1,195 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auditlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gpu-ninja/ldap-operator/internal/auditlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const modifyRecord = `# modify 1697000000 dc=example,dc=com cn=admin,dc=example,dc=com IP=10.0.0.1:41234 conn=1001
+dn: uid=demo,ou=users,dc=example,dc=com
+changetype: modify
+replace: mail
+mail: demo@example.com
+-
+# end modify 1697000000
+
+`
+
+const deleteRecord = `# delete 1697000060 dc=example,dc=com cn=admin,dc=example,dc=com IP=10.0.0.1:41234 conn=1002
+dn: uid=demo,ou=users,dc=example,dc=com
+changetype: delete
+# end delete 1697000060
+
+`
+
+func TestTailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ldif")
+
+	var out bytes.Buffer
+	tailer := &auditlog.Tailer{
+		Path:    path,
+		MaxSize: int64(len(modifyRecord) + len(deleteRecord)),
+		Out:     &out,
+	}
+
+	t.Run("No Audit Log", func(t *testing.T) {
+		require.NoError(t, tailer.Poll())
+		assert.Zero(t, out.Len())
+	})
+
+	t.Run("Partial Record", func(t *testing.T) {
+		appendFile(t, path, modifyRecord[:len(modifyRecord)/2])
+
+		require.NoError(t, tailer.Poll())
+		assert.Zero(t, out.Len())
+
+		appendFile(t, path, modifyRecord[len(modifyRecord)/2:])
+
+		require.NoError(t, tailer.Poll())
+
+		records := decodeRecords(t, &out)
+		require.Len(t, records, 1)
+
+		assert.Equal(t, auditlog.Record{
+			Time:          time.Unix(1697000000, 0).UTC(),
+			Operation:     "modify",
+			Suffix:        "dc=example,dc=com",
+			Modifier:      "cn=admin,dc=example,dc=com",
+			ClientAddress: "10.0.0.1:41234",
+			Connection:    "1001",
+			DN:            "uid=demo,ou=users,dc=example,dc=com",
+			ChangeType:    "modify",
+			LDIF:          "dn: uid=demo,ou=users,dc=example,dc=com\nchangetype: modify\nreplace: mail\nmail: demo@example.com\n-\n",
+		}, records[0])
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		appendFile(t, path, deleteRecord)
+
+		require.NoError(t, tailer.Poll())
+
+		records := decodeRecords(t, &out)
+		require.Len(t, records, 1)
+		assert.Equal(t, "delete", records[0].ChangeType)
+
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+
+		_, err = os.Stat(path + ".1")
+		assert.True(t, os.IsNotExist(err))
+
+		// slapd will create a new audit log on the next write.
+		appendFile(t, path, modifyRecord)
+
+		require.NoError(t, tailer.Poll())
+
+		records = decodeRecords(t, &out)
+		require.Len(t, records, 1)
+		assert.Equal(t, "modify", records[0].ChangeType)
+	})
+}
+
+func TestTailerResume(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.ldif")
+	statePath := filepath.Join(dir, "audit-tail.json")
+
+	var out bytes.Buffer
+	newTailer := func() *auditlog.Tailer {
+		return &auditlog.Tailer{
+			Path:      path,
+			Out:       &out,
+			StatePath: statePath,
+		}
+	}
+
+	appendFile(t, path, modifyRecord+deleteRecord[:len(deleteRecord)/2])
+
+	require.NoError(t, newTailer().Poll())
+
+	records := decodeRecords(t, &out)
+	require.Len(t, records, 1)
+	assert.Equal(t, "modify", records[0].ChangeType)
+
+	t.Run("Restart", func(t *testing.T) {
+		appendFile(t, path, deleteRecord[len(deleteRecord)/2:])
+
+		// Only the records after the last emitted one should be emitted.
+		require.NoError(t, newTailer().Poll())
+
+		records := decodeRecords(t, &out)
+		require.Len(t, records, 1)
+		assert.Equal(t, "delete", records[0].ChangeType)
+
+		require.NoError(t, newTailer().Poll())
+		assert.Zero(t, out.Len())
+	})
+
+	t.Run("Replaced Audit Log", func(t *testing.T) {
+		// Keep the old file around, so the new one can't reuse its inode.
+		require.NoError(t, os.Rename(path, path+".old"))
+
+		// The new audit log is longer than the persisted offset.
+		appendFile(t, path, deleteRecord+modifyRecord+deleteRecord)
+
+		require.NoError(t, newTailer().Poll())
+
+		records := decodeRecords(t, &out)
+		require.Len(t, records, 3)
+		assert.Equal(t, "delete", records[0].ChangeType)
+	})
+}
+
+func appendFile(t *testing.T, path, data string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+
+	require.NoError(t, f.Close())
+}
+
+func decodeRecords(t *testing.T, out *bytes.Buffer) []auditlog.Record {
+	defer out.Reset()
+
+	var records []auditlog.Record
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var record auditlog.Record
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+
+		records = append(records, record)
+	}
+
+	return records
+}
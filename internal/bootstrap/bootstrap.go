@@ -0,0 +1,313 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+	"go.uber.org/zap"
+)
+
+// Tools are the OpenLDAP offline database tools (slapadd, slapcat, and slapmodify).
+type Tools interface {
+	// Cat exports the records of the numbered database.
+	Cat(ctx context.Context, database int) ([]ldif.Record, error)
+	// Add adds records to the numbered database.
+	Add(ctx context.Context, database int, records []ldif.Record) error
+	// Modify applies change records to the numbered database.
+	Modify(ctx context.Context, database int, records []ldif.Record) error
+}
+
+// Bootstrapper creates, or updates, the configuration and database of a directory.
+// It is run before slapd is started, on every start of the directory.
+type Bootstrapper struct {
+	Logger *zap.Logger
+	Config *Config
+	Tools  Tools
+	// UID and GID are the owner of the OpenLDAP databases (typically openldap).
+	UID int
+	GID int
+	// Rand is the source of password salts, defaults to crypto/rand.
+	Rand io.Reader
+}
+
+// Run bootstraps the directory.
+func (b *Bootstrapper) Run(ctx context.Context) error {
+	cfg := b.Config
+
+	logger := b.Logger.With(zap.String("baseDN", cfg.BaseDN()))
+
+	salts := b.Rand
+	if salts == nil {
+		salts = rand.Reader
+	}
+
+	configExists, err := exists(filepath.Join(cfg.ConfigDir, "cn=config.ldif"))
+	if err != nil {
+		return err
+	}
+
+	if !configExists {
+		logger.Info("Creating configuration database")
+
+		var schemas []ldif.Record
+		for _, name := range cfg.Schemas {
+			schema, err := loadSchema(filepath.Join(cfg.SchemaDir, name+".ldif"))
+			if err != nil {
+				return err
+			}
+
+			schemas = append(schemas, schema...)
+		}
+
+		if err := b.Tools.Add(ctx, 0, InitialConfigRecords(cfg, schemas)); err != nil {
+			return fmt.Errorf("failed to create configuration database: %w", err)
+		}
+	}
+
+	freezePath := filepath.Join(cfg.DataDir, FreezeFile)
+	cfg.FrozenDatabases, err = ReadFrozenDatabases(freezePath)
+	if err != nil {
+		return err
+	}
+
+	existing, err := b.Tools.Cat(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("failed to export configuration database: %w", err)
+	}
+
+	changes, err := ConfigChanges(cfg, existing, salts)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		logger.Info("Updating configuration",
+			zap.String("dn", change.DN), zap.String("changeType", string(change.ChangeType)))
+	}
+
+	if err := b.apply(ctx, 0, changes); err != nil {
+		return fmt.Errorf("failed to update configuration database: %w", err)
+	}
+
+	if err := RemoveFrozenDatabases(freezePath); err != nil {
+		return err
+	}
+
+	dataExists, err := exists(filepath.Join(cfg.DataDir, "data.mdb"))
+	if err != nil {
+		return err
+	}
+
+	if !dataExists {
+		logger.Info("Creating root entry")
+
+		if err := b.Tools.Add(ctx, 1, SuffixRecords(cfg)); err != nil {
+			return fmt.Errorf("failed to create root entry: %w", err)
+		}
+	}
+
+	if err := b.createDatabases(ctx); err != nil {
+		return err
+	}
+
+	dirs := []string{cfg.ConfigDir, cfg.DataDir}
+	if cfg.AuditLogFile != "" {
+		dirs = append(dirs, filepath.Dir(cfg.AuditLogFile))
+	}
+	if cfg.AccessLogDir != "" {
+		dirs = append(dirs, cfg.AccessLogDir)
+	}
+	for i := range cfg.Databases {
+		dirs = append(dirs, cfg.Databases[i].Dir(cfg))
+	}
+
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return fmt.Errorf("failed to create directory %q: %w", dir, err)
+		}
+
+		if err := chownRecursive(dir, b.UID, b.GID); err != nil {
+			return fmt.Errorf("failed to change owner of %q: %w", dir, err)
+		}
+	}
+
+	logger.Info("Bootstrapped", zap.Int("changes", len(changes)), zap.Bool("created", !configExists))
+
+	return nil
+}
+
+// createDatabases creates the root entries of any new additional databases.
+func (b *Bootstrapper) createDatabases(ctx context.Context) error {
+	cfg := b.Config
+
+	var existing configDatabase
+	for i := range cfg.Databases {
+		database := &cfg.Databases[i]
+
+		dataExists, err := exists(filepath.Join(database.Dir(cfg), "data.mdb"))
+		if err != nil {
+			return err
+		}
+
+		if dataExists {
+			continue
+		}
+
+		// Databases are numbered by cn=config, so it is only exported if needed.
+		if existing == nil {
+			existing, err = b.Tools.Cat(ctx, 0)
+			if err != nil {
+				return fmt.Errorf("failed to export configuration database: %w", err)
+			}
+		}
+
+		index, err := existing.databaseIndex(database.Suffix)
+		if err != nil {
+			return err
+		}
+
+		records, err := DatabaseSuffixRecords(database)
+		if err != nil {
+			return err
+		}
+
+		b.Logger.Info("Creating database root entry", zap.String("suffix", database.Suffix))
+
+		if err := os.MkdirAll(database.Dir(cfg), 0o750); err != nil {
+			return fmt.Errorf("failed to create directory %q: %w", database.Dir(cfg), err)
+		}
+
+		if err := b.Tools.Add(ctx, index, records); err != nil {
+			return fmt.Errorf("failed to create root entry of database %q: %w", database.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// apply applies a mix of add and modify records, in order.
+func (b *Bootstrapper) apply(ctx context.Context, database int, records []ldif.Record) error {
+	for len(records) > 0 {
+		n := 1
+		for n < len(records) && records[n].ChangeType == records[0].ChangeType {
+			n++
+		}
+
+		var err error
+		if records[0].ChangeType == ldif.ChangeTypeModify {
+			err = b.Tools.Modify(ctx, database, records[:n])
+		} else {
+			err = b.Tools.Add(ctx, database, records[:n])
+		}
+		if err != nil {
+			return err
+		}
+
+		records = records[n:]
+	}
+
+	return nil
+}
+
+// SlapTools runs the OpenLDAP offline database tools.
+type SlapTools struct {
+	// ConfigDir is the directory containing the cn=config database.
+	ConfigDir string
+}
+
+func (t *SlapTools) Cat(ctx context.Context, database int) ([]ldif.Record, error) {
+	out, err := t.run(ctx, nil, "slapcat", "-F", t.ConfigDir, "-n", fmt.Sprint(database))
+	if err != nil {
+		return nil, err
+	}
+
+	return ldif.Parse(bytes.NewReader(out))
+}
+
+func (t *SlapTools) Add(ctx context.Context, database int, records []ldif.Record) error {
+	_, err := t.run(ctx, ldif.Marshal(records), "slapadd", "-F", t.ConfigDir, "-n", fmt.Sprint(database))
+	return err
+}
+
+func (t *SlapTools) Modify(ctx context.Context, database int, records []ldif.Record) error {
+	_, err := t.run(ctx, ldif.Marshal(records), "slapmodify", "-F", t.ConfigDir, "-n", fmt.Sprint(database))
+	return err
+}
+
+func (t *SlapTools) run(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func loadSchema(path string) ([]ldif.Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open schema: %w", err)
+	}
+	defer f.Close()
+
+	records, err := ldif.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema %q: %w", path, err)
+	}
+
+	return records, nil
+}
+
+func exists(path string) (bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func chownRecursive(root string, uid, gid int) error {
+	return filepath.WalkDir(root, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		return os.Lchown(path, uid, gid)
+	})
+}
@@ -0,0 +1,164 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package bootstrap initializes the configuration and database of an OpenLDAP
+// directory, it replaces the Debian package configuration scripts.
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Config is the configuration of a directory.
+type Config struct {
+	// Domain is the domain of the directory (eg. example.com).
+	Domain string
+	// Organization is the name of the organization, defaults to the domain.
+	Organization string
+	// AdminPassword is the password of the directory administrator.
+	AdminPassword string
+	// TLSCertFile is the path to the server certificate (optional).
+	TLSCertFile string
+	// TLSKeyFile is the path to the server certificate key.
+	TLSKeyFile string
+	// TLSCACertsFile is the path to the CA bundle.
+	TLSCACertsFile string
+	// AuditLogFile enables the auditlog overlay, writing to the given file (optional).
+	AuditLogFile string
+	// AccessLogDir enables the accesslog overlay, storing the log database
+	// in the given directory (optional).
+	AccessLogDir string
+	// ConfigDir is the directory containing the cn=config database.
+	ConfigDir string
+	// DataDir is the directory containing the main database.
+	DataDir string
+	// ModulePath is the directory containing the OpenLDAP modules.
+	ModulePath string
+	// SchemaDir is the directory containing the OpenLDAP LDIF schemas.
+	SchemaDir string
+	// Schemas are the names of the schemas that will be loaded (in order).
+	Schemas []string
+	// Databases are additional databases, each stored in a subdirectory
+	// (named after the database) of DataDir.
+	Databases []Database
+	// FrozenDatabases are the DNs of the databases the config agent left
+	// read-only (eg. a directory restored from a snapshot), which are made
+	// writable again.
+	FrozenDatabases []string
+}
+
+// Database is an additional database of the directory.
+type Database struct {
+	// Name is the name of the database.
+	Name string `json:"name"`
+	// Suffix is the base distinguished name of the database.
+	Suffix string `json:"suffix"`
+	// Organization is the name of the organization of the root entry.
+	Organization string `json:"organization,omitempty"`
+	// RootPassword is the password of the root DN of the database.
+	RootPassword string `json:"-"`
+}
+
+// ConfigFromEnv loads the configuration from the LDAP_* environment variables.
+func ConfigFromEnv(lookupEnv func(string) (string, bool)) (*Config, error) {
+	getenv := func(key string) string {
+		value, _ := lookupEnv(key)
+		return value
+	}
+
+	cfg := &Config{
+		Domain:         getenv("LDAP_DOMAIN"),
+		Organization:   getenv("LDAP_ORGANIZATION"),
+		AdminPassword:  getenv("LDAP_ADMIN_PASSWORD"),
+		TLSCertFile:    getenv("LDAP_TLS_CERT"),
+		TLSKeyFile:     getenv("LDAP_TLS_KEY"),
+		TLSCACertsFile: getenv("LDAP_TLS_CA_CERTS"),
+		AuditLogFile:   getenv("LDAP_AUDIT_LOG_FILE"),
+		AccessLogDir:   getenv("LDAP_ACCESSLOG_DIR"),
+		ConfigDir:      "/etc/ldap/slapd.d",
+		DataDir:        "/var/lib/ldap",
+		ModulePath:     "/usr/lib/ldap",
+		SchemaDir:      "/etc/ldap/schema",
+		Schemas:        []string{"core", "cosine", "nis", "inetorgperson"},
+	}
+
+	if cfg.Domain == "" {
+		return nil, fmt.Errorf("LDAP_DOMAIN is required")
+	}
+
+	if cfg.AdminPassword == "" {
+		return nil, fmt.Errorf("LDAP_ADMIN_PASSWORD is required")
+	}
+
+	if cfg.Organization == "" {
+		cfg.Organization = cfg.Domain
+	}
+
+	if cfg.TLSCertFile != "" && (cfg.TLSKeyFile == "" || cfg.TLSCACertsFile == "") {
+		return nil, fmt.Errorf("LDAP_TLS_KEY and LDAP_TLS_CA_CERTS are required when LDAP_TLS_CERT is set")
+	}
+
+	if databases := getenv("LDAP_DATABASES"); databases != "" {
+		if err := json.Unmarshal([]byte(databases), &cfg.Databases); err != nil {
+			return nil, fmt.Errorf("invalid LDAP_DATABASES: %w", err)
+		}
+
+		for i := range cfg.Databases {
+			database := &cfg.Databases[i]
+
+			if database.Name == "" || database.Suffix == "" {
+				return nil, fmt.Errorf("invalid LDAP_DATABASES: name and suffix are required")
+			}
+
+			passwordEnv := DatabasePasswordEnv(database.Name)
+			database.RootPassword = getenv(passwordEnv)
+			if database.RootPassword == "" {
+				return nil, fmt.Errorf("%s is required", passwordEnv)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// DatabasePasswordEnv returns the name of the environment variable containing
+// the root password of the named database.
+func DatabasePasswordEnv(name string) string {
+	return "LDAP_DATABASE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_PASSWORD"
+}
+
+// BaseDN returns the base distinguished name of the directory.
+func (c *Config) BaseDN() string {
+	return "dc=" + strings.ReplaceAll(c.Domain, ".", ",dc=")
+}
+
+// AdminDN returns the distinguished name of the directory administrator.
+func (c *Config) AdminDN() string {
+	return "cn=admin," + c.BaseDN()
+}
+
+// Dir returns the directory the database is stored in.
+func (d *Database) Dir(cfg *Config) string {
+	return filepath.Join(cfg.DataDir, d.Name)
+}
+
+// RootDN returns the distinguished name of the root of the database.
+func (d *Database) RootDN() string {
+	return "cn=admin," + d.Suffix
+}
@@ -0,0 +1,86 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// FreezeFile is the name of the file (in the data directory) recording the
+// databases the config agent has made read-only. Only these databases are
+// made writable again when the directory is started, so databases an
+// administrator has made read-only stay that way.
+const FreezeFile = "frozen.json"
+
+// ReadFrozenDatabases returns the DNs of the databases recorded in the freeze
+// file, a missing file means no databases are frozen.
+func ReadFrozenDatabases(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to read freeze file: %w", err)
+	}
+
+	var dns []string
+	if err := json.Unmarshal(data, &dns); err != nil {
+		return nil, fmt.Errorf("failed to parse freeze file: %w", err)
+	}
+
+	return dns, nil
+}
+
+// WriteFrozenDatabases records the DNs of the frozen databases in the freeze
+// file.
+func WriteFrozenDatabases(path string, dns []string) error {
+	dns = append([]string(nil), dns...)
+	sort.Strings(dns)
+
+	data, err := json.Marshal(dns)
+	if err != nil {
+		return fmt.Errorf("failed to marshal frozen databases: %w", err)
+	}
+
+	// Write atomically so that a crash cannot leave a truncated freeze file.
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write freeze file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write freeze file: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveFrozenDatabases removes the freeze file (if it exists).
+func RemoveFrozenDatabases(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove freeze file: %w", err)
+	}
+
+	return nil
+}
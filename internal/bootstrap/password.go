@@ -0,0 +1,97 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package bootstrap
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2Prefix  = "{ARGON2}"
+	argon2Time    = 3
+	argon2Memory  = 4096
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// HashPassword returns an OpenLDAP {ARGON2} (argon2id) password hash, the salt
+// is read from rand.
+func HashPassword(password string, rand io.Reader) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := io.ReadFull(rand, salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("%s$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version,
+		argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword returns true if the password matches an OpenLDAP {ARGON2} password hash.
+func VerifyPassword(hash, password string) bool {
+	if !strings.HasPrefix(hash, argon2Prefix) {
+		return false
+	}
+
+	// $<variant>$v=<version>$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+	parts := strings.Split(strings.TrimPrefix(hash, argon2Prefix), "$")
+	if len(parts) != 6 {
+		return false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+
+	var expectedKey []byte
+	switch parts[1] {
+	case "argon2id":
+		expectedKey = argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	case "argon2i":
+		expectedKey = argon2.Key([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(key, expectedKey) == 1
+}
@@ -0,0 +1,613 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bootstrap
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+)
+
+const (
+	frontendDN       = "olcDatabase={-1}frontend,cn=config"
+	configDatabaseDN = "olcDatabase={0}config,cn=config"
+	mainDatabaseDN   = "olcDatabase={1}mdb,cn=config"
+	moduleListDN     = "cn=module{0},cn=config"
+	accessLogSuffix  = "cn=accesslog"
+
+	// peercredAccess allows root to manage the database over ldapi:///.
+	peercredAccess = "{0}to * by dn.exact=gidNumber=0+uidNumber=0,cn=peercred,cn=external,cn=auth manage by * break"
+)
+
+var (
+	// orderingPrefix matches the "{n}" prefix of ordered values.
+	orderingPrefix = regexp.MustCompile(`^\{-?[0-9]+\}`)
+	// databaseDN matches the distinguished names of databases.
+	databaseDN = regexp.MustCompile(`(?i)^olcDatabase=\{-?[0-9]+\}[a-z]+,cn=config$`)
+)
+
+// InitialConfigRecords returns the records used to create the cn=config
+// database of a new directory, the given schemas are loaded before any of
+// the databases. Passwords and optional features are set by ConfigChanges.
+func InitialConfigRecords(cfg *Config, schemas []ldif.Record) []ldif.Record {
+	records := []ldif.Record{
+		{
+			DN:         "cn=config",
+			ChangeType: ldif.ChangeTypeAdd,
+			Attributes: []ldif.Attribute{
+				{Name: "objectClass", Values: []string{"olcGlobal"}},
+				{Name: "cn", Values: []string{"config"}},
+				{Name: "olcArgsFile", Values: []string{"/var/run/slapd/slapd.args"}},
+				{Name: "olcPidFile", Values: []string{"/var/run/slapd/slapd.pid"}},
+				{Name: "olcLogLevel", Values: []string{"none"}},
+				{Name: "olcToolThreads", Values: []string{"1"}},
+			},
+		},
+		{
+			DN:         moduleListDN,
+			ChangeType: ldif.ChangeTypeAdd,
+			Attributes: []ldif.Attribute{
+				{Name: "objectClass", Values: []string{"olcModuleList"}},
+				{Name: "cn", Values: []string{"module{0}"}},
+				{Name: "olcModulePath", Values: []string{cfg.ModulePath}},
+				{Name: "olcModuleLoad", Values: []string{"{0}back_mdb"}},
+			},
+		},
+		{
+			DN:         "cn=schema,cn=config",
+			ChangeType: ldif.ChangeTypeAdd,
+			Attributes: []ldif.Attribute{
+				{Name: "objectClass", Values: []string{"olcSchemaConfig"}},
+				{Name: "cn", Values: []string{"schema"}},
+			},
+		},
+	}
+
+	records = append(records, schemas...)
+
+	return append(records,
+		ldif.Record{
+			DN:         frontendDN,
+			ChangeType: ldif.ChangeTypeAdd,
+			Attributes: []ldif.Attribute{
+				{Name: "objectClass", Values: []string{"olcDatabaseConfig", "olcFrontendConfig"}},
+				{Name: "olcDatabase", Values: []string{"{-1}frontend"}},
+				{Name: "olcSizeLimit", Values: []string{"500"}},
+				{Name: "olcAccess", Values: []string{
+					peercredAccess,
+					`{1}to dn.exact="" by * read`,
+					`{2}to dn.base="cn=Subschema" by * read`,
+				}},
+			},
+		},
+		ldif.Record{
+			DN:         configDatabaseDN,
+			ChangeType: ldif.ChangeTypeAdd,
+			Attributes: []ldif.Attribute{
+				{Name: "objectClass", Values: []string{"olcDatabaseConfig"}},
+				{Name: "olcDatabase", Values: []string{"{0}config"}},
+				{Name: "olcAccess", Values: []string{peercredAccess}},
+			},
+		},
+		ldif.Record{
+			DN:         mainDatabaseDN,
+			ChangeType: ldif.ChangeTypeAdd,
+			Attributes: []ldif.Attribute{
+				{Name: "objectClass", Values: []string{"olcDatabaseConfig", "olcMdbConfig"}},
+				{Name: "olcDatabase", Values: []string{"{1}mdb"}},
+				{Name: "olcDbDirectory", Values: []string{cfg.DataDir}},
+				{Name: "olcSuffix", Values: []string{cfg.BaseDN()}},
+				{Name: "olcAccess", Values: []string{
+					"{0}to attrs=userPassword by self write by anonymous auth by * none",
+					"{1}to attrs=shadowLastChange by self write by * read",
+					"{2}to * by * read",
+				}},
+				{Name: "olcLastMod", Values: []string{"TRUE"}},
+				{Name: "olcRootDN", Values: []string{cfg.AdminDN()}},
+				{Name: "olcDbCheckpoint", Values: []string{"512 30"}},
+				{Name: "olcDbIndex", Values: []string{
+					"objectClass eq",
+					"cn,uid eq",
+					"uidNumber,gidNumber eq",
+					"member,memberUid eq",
+				}},
+				{Name: "olcDbMaxSize", Values: []string{"1073741824"}},
+			},
+		},
+	)
+}
+
+// SuffixRecords returns the records used to create the root entry of a new directory.
+func SuffixRecords(cfg *Config) []ldif.Record {
+	dc, _, _ := strings.Cut(cfg.Domain, ".")
+
+	return []ldif.Record{
+		{
+			DN:         cfg.BaseDN(),
+			ChangeType: ldif.ChangeTypeAdd,
+			Attributes: []ldif.Attribute{
+				{Name: "objectClass", Values: []string{"top", "dcObject", "organization"}},
+				{Name: "o", Values: []string{cfg.Organization}},
+				{Name: "dc", Values: []string{dc}},
+			},
+		},
+	}
+}
+
+// DatabaseSuffixRecords returns the records used to create the root entry of
+// an additional database.
+func DatabaseSuffixRecords(database *Database) ([]ldif.Record, error) {
+	dn, err := goldap.ParseDN(database.Suffix)
+	if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return nil, fmt.Errorf("invalid suffix %q", database.Suffix)
+	}
+
+	rdn := dn.RDNs[0].Attributes[0]
+
+	organization := database.Organization
+	if organization == "" {
+		organization = rdn.Value
+	}
+
+	record := ldif.Record{
+		DN:         database.Suffix,
+		ChangeType: ldif.ChangeTypeAdd,
+	}
+
+	switch strings.ToLower(rdn.Type) {
+	case "dc":
+		record.Attributes = []ldif.Attribute{
+			{Name: "objectClass", Values: []string{"top", "dcObject", "organization"}},
+			{Name: "o", Values: []string{organization}},
+			{Name: "dc", Values: []string{rdn.Value}},
+		}
+	case "o":
+		record.Attributes = []ldif.Attribute{
+			{Name: "objectClass", Values: []string{"top", "organization"}},
+			{Name: "o", Values: []string{rdn.Value}},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported suffix %q, must start with a dc or o attribute", database.Suffix)
+	}
+
+	return []ldif.Record{record}, nil
+}
+
+// ConfigChanges returns the records required to bring an existing cn=config
+// database up to date with the configuration. Only changed settings are
+// included, so applying the changes is idempotent. Password salts are read
+// from rand.
+func ConfigChanges(cfg *Config, existing []ldif.Record, rand io.Reader) ([]ldif.Record, error) {
+	db := configDatabase(existing)
+
+	mainDB := db.findByAttribute("olcSuffix", cfg.BaseDN())
+	if mainDB == nil {
+		return nil, fmt.Errorf("database for suffix %q not found", cfg.BaseDN())
+	}
+
+	var changes []ldif.Record
+
+	modules := []string{"argon2"}
+	if cfg.AuditLogFile != "" {
+		modules = append(modules, "auditlog")
+	}
+	if cfg.AccessLogDir != "" {
+		modules = append(modules, "accesslog")
+	}
+
+	var missingModules []string
+	for _, module := range modules {
+		if !db.isModuleLoaded(module) {
+			missingModules = append(missingModules, module+".so")
+		}
+	}
+
+	if len(missingModules) > 0 {
+		changes = append(changes, modify(moduleListDN, ldif.Modification{
+			Attribute: ldif.Attribute{Name: "olcModuleLoad", Values: missingModules},
+			Type:      ldif.ModificationTypeAdd,
+		}))
+	}
+
+	if mods := db.replaceIfChanged(frontendDN, "olcPasswordHash", "{ARGON2}"); len(mods) > 0 {
+		changes = append(changes, modify(frontendDN, mods...))
+	}
+
+	mainDBMods, err := db.passwordIfChanged(mainDB.DN, cfg.AdminPassword, rand)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mainDBMods) > 0 {
+		changes = append(changes, modify(mainDB.DN, mainDBMods...))
+	}
+
+	// cn=config is only managed over ldapi:///, drop any root credentials left
+	// behind by earlier versions.
+	if configDBMods := db.deleteIfPresent(configDatabaseDN, "olcRootDN", "olcRootPW"); len(configDBMods) > 0 {
+		changes = append(changes, modify(configDatabaseDN, configDBMods...))
+	}
+
+	if cfg.TLSCertFile != "" {
+		var mods []ldif.Modification
+		mods = append(mods, db.replaceIfChanged("cn=config", "olcTLSCertificateFile", cfg.TLSCertFile)...)
+		mods = append(mods, db.replaceIfChanged("cn=config", "olcTLSCertificateKeyFile", cfg.TLSKeyFile)...)
+		mods = append(mods, db.replaceIfChanged("cn=config", "olcTLSCACertificateFile", cfg.TLSCACertsFile)...)
+
+		if len(mods) > 0 {
+			changes = append(changes, modify("cn=config", mods...))
+		}
+	}
+
+	auditLogOverlay := db.findOverlay(mainDB.DN, "auditlog")
+	if cfg.AuditLogFile != "" {
+		if auditLogOverlay == nil {
+			changes = append(changes, ldif.Record{
+				DN:         "olcOverlay=auditlog," + mainDB.DN,
+				ChangeType: ldif.ChangeTypeAdd,
+				Attributes: []ldif.Attribute{
+					{Name: "objectClass", Values: []string{"olcOverlayConfig", "olcAuditlogConfig"}},
+					{Name: "olcOverlay", Values: []string{"auditlog"}},
+					{Name: "olcAuditlogFile", Values: []string{cfg.AuditLogFile}},
+				},
+			})
+		} else {
+			mods := db.replaceIfChanged(auditLogOverlay.DN, "olcAuditlogFile", cfg.AuditLogFile)
+			mods = append(mods, db.setDisabled(auditLogOverlay, false)...)
+
+			if len(mods) > 0 {
+				changes = append(changes, modify(auditLogOverlay.DN, mods...))
+			}
+		}
+	} else if auditLogOverlay != nil {
+		if mods := db.setDisabled(auditLogOverlay, true); len(mods) > 0 {
+			changes = append(changes, modify(auditLogOverlay.DN, mods...))
+		}
+	}
+
+	// The frontend database is {-1} so the count is the next free index.
+	nextIndex := len(db.databases()) - 1
+
+	accessLogOverlay := db.findOverlay(mainDB.DN, "accesslog")
+	if cfg.AccessLogDir != "" {
+		if db.findByAttribute("olcSuffix", accessLogSuffix) == nil {
+			index := nextIndex
+			nextIndex++
+
+			changes = append(changes, ldif.Record{
+				DN:         fmt.Sprintf("olcDatabase={%d}mdb,cn=config", index),
+				ChangeType: ldif.ChangeTypeAdd,
+				Attributes: []ldif.Attribute{
+					{Name: "objectClass", Values: []string{"olcDatabaseConfig", "olcMdbConfig"}},
+					{Name: "olcDatabase", Values: []string{fmt.Sprintf("{%d}mdb", index)}},
+					{Name: "olcDbDirectory", Values: []string{cfg.AccessLogDir}},
+					{Name: "olcSuffix", Values: []string{accessLogSuffix}},
+					{Name: "olcAccess", Values: []string{
+						fmt.Sprintf(`{0}to * by dn.exact="%s" read by * none`, cfg.AdminDN()),
+					}},
+					{Name: "olcDbIndex", Values: []string{"default eq", "objectClass,reqStart,reqResult"}},
+				},
+			})
+		}
+
+		if accessLogOverlay == nil {
+			changes = append(changes, ldif.Record{
+				DN:         "olcOverlay=accesslog," + mainDB.DN,
+				ChangeType: ldif.ChangeTypeAdd,
+				Attributes: []ldif.Attribute{
+					{Name: "objectClass", Values: []string{"olcOverlayConfig", "olcAccessLogConfig"}},
+					{Name: "olcOverlay", Values: []string{"accesslog"}},
+					{Name: "olcAccessLogDB", Values: []string{accessLogSuffix}},
+					{Name: "olcAccessLogOps", Values: []string{"writes"}},
+					{Name: "olcAccessLogSuccess", Values: []string{"TRUE"}},
+					{Name: "olcAccessLogPurge", Values: []string{"07+00:00 01+00:00"}},
+				},
+			})
+		} else if mods := db.setDisabled(accessLogOverlay, false); len(mods) > 0 {
+			changes = append(changes, modify(accessLogOverlay.DN, mods...))
+		}
+	} else if accessLogOverlay != nil {
+		if mods := db.setDisabled(accessLogOverlay, true); len(mods) > 0 {
+			changes = append(changes, modify(accessLogOverlay.DN, mods...))
+		}
+	}
+
+	for i := range cfg.Databases {
+		database := &cfg.Databases[i]
+
+		existingDB := db.findByAttribute("olcSuffix", database.Suffix)
+		if existingDB == nil {
+			record, err := databaseRecord(cfg, database, nextIndex, rand)
+			if err != nil {
+				return nil, err
+			}
+
+			changes = append(changes, *record)
+			nextIndex++
+			continue
+		}
+
+		mods, err := db.passwordIfChanged(existingDB.DN, database.RootPassword, rand)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(mods) > 0 {
+			changes = append(changes, modify(existingDB.DN, mods...))
+		}
+	}
+
+	// A directory restored from a snapshot (or restarted mid-snapshot) must
+	// not remain frozen.
+	for _, dn := range cfg.FrozenDatabases {
+		database := db.find(dn)
+		if database == nil {
+			continue
+		}
+
+		if mods := db.unfreeze(database); len(mods) > 0 {
+			changes = append(changes, modify(database.DN, mods...))
+		}
+	}
+
+	return changes, nil
+}
+
+// databaseRecord returns the record used to create an additional database.
+// The directory administrator can manage the entries of every database.
+func databaseRecord(cfg *Config, database *Database, index int, rand io.Reader) (*ldif.Record, error) {
+	rootPW, err := HashPassword(database.RootPassword, rand)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ldif.Record{
+		DN:         fmt.Sprintf("olcDatabase={%d}mdb,cn=config", index),
+		ChangeType: ldif.ChangeTypeAdd,
+		Attributes: []ldif.Attribute{
+			{Name: "objectClass", Values: []string{"olcDatabaseConfig", "olcMdbConfig"}},
+			{Name: "olcDatabase", Values: []string{fmt.Sprintf("{%d}mdb", index)}},
+			{Name: "olcDbDirectory", Values: []string{database.Dir(cfg)}},
+			{Name: "olcSuffix", Values: []string{database.Suffix}},
+			{Name: "olcAccess", Values: []string{
+				fmt.Sprintf(`{0}to * by dn.exact="%s" manage by * break`, cfg.AdminDN()),
+				"{1}to attrs=userPassword by self write by anonymous auth by * none",
+				"{2}to attrs=shadowLastChange by self write by * read",
+				"{3}to * by * read",
+			}},
+			{Name: "olcLastMod", Values: []string{"TRUE"}},
+			{Name: "olcRootDN", Values: []string{database.RootDN()}},
+			{Name: "olcRootPW", Values: []string{rootPW}},
+			{Name: "olcDbCheckpoint", Values: []string{"512 30"}},
+			{Name: "olcDbIndex", Values: []string{
+				"objectClass eq",
+				"cn,uid eq",
+				"uidNumber,gidNumber eq",
+				"member,memberUid eq",
+			}},
+			{Name: "olcDbMaxSize", Values: []string{"1073741824"}},
+		},
+	}, nil
+}
+
+// configDatabase is an exported (slapcat) cn=config database.
+type configDatabase []ldif.Record
+
+func (db configDatabase) find(dn string) *ldif.Record {
+	for i := range db {
+		if strings.EqualFold(db[i].DN, dn) {
+			return &db[i]
+		}
+	}
+
+	return nil
+}
+
+func (db configDatabase) findByAttribute(name, value string) *ldif.Record {
+	for i := range db {
+		for _, v := range db[i].GetAttributeValues(name) {
+			if strings.EqualFold(v, value) {
+				return &db[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// findOverlay returns the named overlay of a database.
+func (db configDatabase) findOverlay(databaseDN, overlay string) *ldif.Record {
+	for i := range db {
+		if !strings.HasSuffix(strings.ToLower(db[i].DN), ","+strings.ToLower(databaseDN)) {
+			continue
+		}
+
+		for _, v := range db[i].GetAttributeValues("olcOverlay") {
+			if strings.EqualFold(orderingPrefix.ReplaceAllString(v, ""), overlay) {
+				return &db[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// databaseIndex returns the number of the database with the given suffix.
+func (db configDatabase) databaseIndex(suffix string) (int, error) {
+	record := db.findByAttribute("olcSuffix", suffix)
+	if record == nil || !databaseDN.MatchString(record.DN) {
+		return 0, fmt.Errorf("database for suffix %q not found", suffix)
+	}
+
+	var index int
+	if _, err := fmt.Sscanf(strings.ToLower(record.DN), "olcdatabase={%d}", &index); err != nil {
+		return 0, fmt.Errorf("invalid database %q: %w", record.DN, err)
+	}
+
+	return index, nil
+}
+
+func (db configDatabase) databases() []ldif.Record {
+	var databases []ldif.Record
+	for _, record := range db {
+		if databaseDN.MatchString(record.DN) {
+			databases = append(databases, record)
+		}
+	}
+
+	return databases
+}
+
+// isModuleLoaded checks if the named module (eg. "argon2") is loaded, module
+// load values may include a path and/or file extension.
+func (db configDatabase) isModuleLoaded(module string) bool {
+	for _, record := range db {
+		for _, v := range record.GetAttributeValues("olcModuleLoad") {
+			name := path.Base(orderingPrefix.ReplaceAllString(v, ""))
+			name = strings.TrimSuffix(strings.TrimSuffix(name, ".so"), ".la")
+
+			if name == module {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (db configDatabase) replaceIfChanged(dn, name string, values ...string) []ldif.Modification {
+	var existing []string
+	if record := db.find(dn); record != nil {
+		existing = record.GetAttributeValues(name)
+	}
+
+	if equalValues(existing, values) {
+		return nil
+	}
+
+	return []ldif.Modification{
+		{
+			Attribute: ldif.Attribute{Name: name, Values: values},
+			Type:      ldif.ModificationTypeReplace,
+		},
+	}
+}
+
+// deleteIfPresent removes the named attributes of an entry (if set).
+func (db configDatabase) deleteIfPresent(dn string, names ...string) []ldif.Modification {
+	record := db.find(dn)
+	if record == nil {
+		return nil
+	}
+
+	var mods []ldif.Modification
+	for _, name := range names {
+		if len(record.GetAttributeValues(name)) > 0 {
+			mods = append(mods, ldif.Modification{
+				Attribute: ldif.Attribute{Name: name},
+				Type:      ldif.ModificationTypeDelete,
+			})
+		}
+	}
+
+	return mods
+}
+
+// passwordIfChanged replaces the root password of a database if it doesn't match.
+func (db configDatabase) passwordIfChanged(dn, password string, rand io.Reader) ([]ldif.Modification, error) {
+	if record := db.find(dn); record != nil {
+		existing := record.GetAttributeValues("olcRootPW")
+		if len(existing) == 1 && VerifyPassword(existing[0], password) {
+			return nil, nil
+		}
+	}
+
+	hash, err := HashPassword(password, rand)
+	if err != nil {
+		return nil, err
+	}
+
+	return []ldif.Modification{
+		{
+			Attribute: ldif.Attribute{Name: "olcRootPW", Values: []string{hash}},
+			Type:      ldif.ModificationTypeReplace,
+		},
+	}, nil
+}
+
+func (db configDatabase) setDisabled(record *ldif.Record, disabled bool) []ldif.Modification {
+	existing := record.GetAttributeValues("olcDisabled")
+	isDisabled := len(existing) == 1 && strings.EqualFold(existing[0], "TRUE")
+	if isDisabled == disabled {
+		return nil
+	}
+
+	value := "FALSE"
+	if disabled {
+		value = "TRUE"
+	}
+
+	return []ldif.Modification{
+		{
+			Attribute: ldif.Attribute{Name: "olcDisabled", Values: []string{value}},
+			Type:      ldif.ModificationTypeReplace,
+		},
+	}
+}
+
+// unfreeze removes the read-only flag of a database (if set).
+func (db configDatabase) unfreeze(record *ldif.Record) []ldif.Modification {
+	existing := record.GetAttributeValues("olcReadOnly")
+	if len(existing) != 1 || !strings.EqualFold(existing[0], "TRUE") {
+		return nil
+	}
+
+	return []ldif.Modification{
+		{
+			Attribute: ldif.Attribute{Name: "olcReadOnly", Values: []string{"FALSE"}},
+			Type:      ldif.ModificationTypeReplace,
+		},
+	}
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func modify(dn string, mods ...ldif.Modification) ldif.Record {
+	return ldif.Record{
+		DN:            dn,
+		ChangeType:    ldif.ChangeTypeModify,
+		Modifications: mods,
+	}
+}
@@ -0,0 +1,137 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package changefeed delivers directory changes to HTTP sinks as CloudEvents
+// (using the structured JSON content mode).
+// See: https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/bindings/http-protocol-binding.md
+package changefeed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+)
+
+const (
+	// EventTypePrefix is prepended to the operation to form the event type,
+	// eg. "com.gpu-ninja.ldap.entry.modify".
+	EventTypePrefix = "com.gpu-ninja.ldap.entry."
+	// reqStartLayout is the layout of accesslog reqStart timestamps.
+	reqStartLayout = "20060102150405.999999Z"
+)
+
+// Event is a CloudEvent describing a single directory change.
+type Event struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            EventData `json:"data"`
+}
+
+// EventData is the payload of a change event.
+type EventData struct {
+	// DN is the distinguished name of the changed entry.
+	DN string `json:"dn"`
+	// Modifier is the distinguished name of the client that made the change.
+	Modifier string `json:"modifier,omitempty"`
+	// Mods are the attribute modifications, in the accesslog reqMod format.
+	Mods []string `json:"mods,omitempty"`
+	// NewRDN is the new relative distinguished name (modrdn only).
+	NewRDN string `json:"newRDN,omitempty"`
+	// NewSuperior is the new parent distinguished name (modrdn only).
+	NewSuperior string `json:"newSuperior,omitempty"`
+}
+
+// NewEvent creates a CloudEvent for a change made to the given source directory.
+func NewEvent(source string, change *ldap.Change) (*Event, error) {
+	t, err := time.Parse(reqStartLayout, change.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse change time: %w", err)
+	}
+
+	return &Event{
+		SpecVersion:     "1.0",
+		ID:              change.ID,
+		Source:          source,
+		Type:            EventTypePrefix + change.Type,
+		Subject:         change.DN,
+		Time:            t,
+		DataContentType: "application/json",
+		Data: EventData{
+			DN:          change.DN,
+			Modifier:    change.Modifier,
+			Mods:        change.Mods,
+			NewRDN:      change.NewRDN,
+			NewSuperior: change.NewSuperior,
+		},
+	}, nil
+}
+
+// Publisher delivers events to HTTP sinks. Deliveries are not retried, so
+// that callers can retry without blocking (eg. by requeuing).
+type Publisher struct {
+	// Client is the HTTP client used to deliver events.
+	Client *http.Client
+}
+
+// Publish delivers the event to the given sink URL. Any 2xx response is
+// considered a successful delivery.
+func (p *Publisher) Publish(ctx context.Context, url string, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if err := p.send(ctx, url, body); err != nil {
+		return fmt.Errorf("failed to deliver event %s to %s: %w", event.ID, url, err)
+	}
+
+	return nil
+}
+
+func (p *Publisher) send(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/cloudevents+json; charset=UTF-8")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
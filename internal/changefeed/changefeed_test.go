@@ -0,0 +1,82 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package changefeed_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gpu-ninja/ldap-operator/internal/changefeed"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher(t *testing.T) {
+	event, err := changefeed.NewEvent("/apis/ldap.gpu-ninja.com/v1alpha1/namespaces/default/ldapdirectories/demo", &ldap.Change{
+		ID:       "20231011120000.000001Z",
+		Type:     "modify",
+		DN:       "cn=admins,ou=groups,dc=example,dc=com",
+		Modifier: "cn=admin,dc=example,dc=com",
+		Mods:     []string{"member:+ uid=demo,ou=users,dc=example,dc=com"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "com.gpu-ninja.ldap.entry.modify", event.Type)
+	assert.Equal(t, time.Date(2023, 10, 11, 12, 0, 0, 1000, time.UTC), event.Time)
+
+	var attempts int
+	var received changefeed.Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		assert.Equal(t, "application/cloudevents+json; charset=UTF-8", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+
+	p := &changefeed.Publisher{
+		Client: srv.Client(),
+	}
+
+	t.Run("Failure", func(t *testing.T) {
+		// Failed deliveries are not retried.
+		err := p.Publish(ctx, srv.URL, event)
+		assert.ErrorContains(t, err, "503")
+
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Publish", func(t *testing.T) {
+		require.NoError(t, p.Publish(ctx, srv.URL, event))
+
+		assert.Equal(t, 2, attempts)
+		assert.Equal(t, event.ID, received.ID)
+		assert.Equal(t, event.Data, received.Data)
+	})
+}
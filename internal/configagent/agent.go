@@ -0,0 +1,281 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Agent applies the desired configuration in ConfigDir to the directory. The
+// desired configuration is a mounted secret, so kubelet will update it in
+// place, and changes are applied without restarting the directory.
+type Agent struct {
+	// Logger is used to log progress.
+	Logger *zap.Logger
+	// ConfigDir is the directory the configuration secret is mounted at.
+	ConfigDir string
+	// StatePath is where the status is persisted, so that patches are not
+	// reapplied when the agent restarts.
+	StatePath string
+	// Client is used to apply changes to cn=config.
+	Client ldap.ConfigClient
+	// PollInterval is how often the configuration is checked for changes.
+	PollInterval time.Duration
+
+	mu     sync.Mutex
+	status Status
+}
+
+// Run applies the desired configuration until the context is cancelled.
+func (a *Agent) Run(ctx context.Context) error {
+	if err := a.loadState(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(a.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.Sync(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync applies any changes to the desired configuration. Errors applying the
+// configuration are reported in the status, an error is only returned if the
+// status could not be persisted.
+func (a *Agent) Sync() error {
+	status := a.Status()
+
+	var syncErr error
+	config, err := a.readConfig()
+	if err != nil {
+		syncErr = err
+	} else {
+		syncErr = a.apply(config, &status)
+	}
+
+	status.Message = ""
+	if syncErr != nil {
+		a.Logger.Warn("Failed to apply config", zap.Error(syncErr))
+
+		status.Message = syncErr.Error()
+	} else {
+		status.Generation = config.Generation
+	}
+
+	if reflect.DeepEqual(status, a.Status()) {
+		return nil
+	}
+
+	a.mu.Lock()
+	a.status = status
+	a.mu.Unlock()
+
+	return a.saveState(&status)
+}
+
+// Status returns what has been applied to the directory.
+func (a *Agent) Status() Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	status := a.status
+	status.Patches = append([]ldapv1alpha1.LDAPDirectoryConfigPatchStatus(nil), a.status.Patches...)
+
+	return status
+}
+
+// ServeHTTP serves the status of the agent as JSON.
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(a.Status())
+}
+
+// apply applies the settings (if changed), and then any new or changed
+// patches, in order. Later patches are not applied if an earlier one fails.
+func (a *Agent) apply(config *Config, status *Status) error {
+	settingsHash := Hash(config.Settings)
+	if settingsHash != status.SettingsHash {
+		a.Logger.Info("Applying settings")
+
+		records, err := ParseLDIF(config.Settings)
+		if err != nil {
+			return fmt.Errorf("invalid settings: %w", err)
+		}
+
+		if _, err := a.Client.ApplyConfigLDIF(records); err != nil {
+			return fmt.Errorf("failed to apply settings: %w", err)
+		}
+
+		status.SettingsHash = settingsHash
+	}
+
+	existingStatuses := make(map[string]ldapv1alpha1.LDAPDirectoryConfigPatchStatus)
+	for _, patchStatus := range status.Patches {
+		existingStatuses[patchStatus.Name] = patchStatus
+	}
+
+	// Statuses of removed patches are dropped.
+	statuses := make([]ldapv1alpha1.LDAPDirectoryConfigPatchStatus, 0, len(config.Patches))
+	defer func() {
+		status.Patches = statuses
+	}()
+
+	for _, patch := range config.Patches {
+		hash := Hash(patch.LDIF)
+
+		patchStatus, ok := existingStatuses[patch.Name]
+		if ok && patchStatus.Applied && patchStatus.Hash == hash {
+			statuses = append(statuses, patchStatus)
+			continue
+		}
+
+		a.Logger.Info("Applying config patch", zap.String("patch", patch.Name))
+
+		patchStatus = ldapv1alpha1.LDAPDirectoryConfigPatchStatus{
+			Name: patch.Name,
+			Hash: hash,
+		}
+
+		err := a.applyPatch(&patch)
+		if err != nil {
+			err = fmt.Errorf("failed to apply patch %q: %w", patch.Name, err)
+			patchStatus.Message = err.Error()
+			statuses = append(statuses, patchStatus)
+
+			for _, patch := range config.Patches[len(statuses):] {
+				if patchStatus, ok := existingStatuses[patch.Name]; ok {
+					statuses = append(statuses, patchStatus)
+				}
+			}
+
+			return err
+		}
+
+		now := metav1.Now()
+		patchStatus.Applied = true
+		patchStatus.LastAppliedTime = &now
+		statuses = append(statuses, patchStatus)
+	}
+
+	return nil
+}
+
+func (a *Agent) applyPatch(patch *Patch) error {
+	records, err := ParseLDIF(patch.LDIF)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.Client.ApplyConfigLDIF(records)
+	return err
+}
+
+// readConfig reads the desired configuration, a missing configuration (eg.
+// the secret has not been created yet) is treated as an empty one.
+func (a *Agent) readConfig() (*Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(filepath.Join(a.ConfigDir, ConfigFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &config, nil
+		}
+
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	return &config, nil
+}
+
+func (a *Agent) loadState() error {
+	data, err := os.ReadFile(a.StatePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+
+	var status Status
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("failed to parse state: %w", err)
+	}
+
+	// The generation is only meaningful for the running agent, as the
+	// configuration may have changed while it was stopped.
+	status.Generation = 0
+	status.Message = ""
+
+	a.mu.Lock()
+	a.status = status
+	a.mu.Unlock()
+
+	return nil
+}
+
+func (a *Agent) saveState(status *Status) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	// Write atomically so that a crash cannot leave a truncated state file.
+	tmpPath := a.StatePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, a.StatePath); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configagent_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gpu-ninja/ldap-operator/internal/configagent"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAgent(t *testing.T) {
+	configDir := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	writeConfig := func(config *configagent.Config) {
+		data, err := json.Marshal(config)
+		require.NoError(t, err)
+
+		err = os.WriteFile(filepath.Join(configDir, configagent.ConfigFile), data, 0o644)
+		require.NoError(t, err)
+	}
+
+	client := &fakeConfigClient{}
+
+	newAgent := func() *configagent.Agent {
+		return &configagent.Agent{
+			Logger:       zap.NewNop(),
+			ConfigDir:    configDir,
+			StatePath:    statePath,
+			Client:       client,
+			PollInterval: time.Second,
+		}
+	}
+
+	agent := newAgent()
+
+	t.Run("Missing Config", func(t *testing.T) {
+		err := agent.Sync()
+		require.NoError(t, err)
+
+		status := agent.Status()
+		assert.Empty(t, status.Message)
+		assert.Zero(t, status.Generation)
+	})
+
+	config := &configagent.Config{
+		Generation: 1,
+		Settings:   "dn: cn=config\nchangetype: modify\nreplace: olcLogLevel\nolcLogLevel: stats\n",
+		Patches: []configagent.Patch{
+			{
+				Name: "size-limit",
+				LDIF: "dn: olcDatabase={1}mdb,cn=config\nchangetype: modify\nreplace: olcSizeLimit\nolcSizeLimit: 1000\n",
+			},
+			{
+				Name: "idle-timeout",
+				LDIF: "dn: cn=config\nchangetype: modify\nreplace: olcIdleTimeout\nolcIdleTimeout: 60\n",
+			},
+		},
+	}
+
+	t.Run("Apply", func(t *testing.T) {
+		client.applied = nil
+		writeConfig(config)
+
+		err := agent.Sync()
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"olcLogLevel", "olcSizeLimit", "olcIdleTimeout"}, client.applied)
+
+		status := agent.Status()
+		assert.Equal(t, int64(1), status.Generation)
+		assert.Empty(t, status.Message)
+		require.Len(t, status.Patches, 2)
+		for i, patchStatus := range status.Patches {
+			assert.Equal(t, config.Patches[i].Name, patchStatus.Name)
+			assert.Equal(t, configagent.Hash(config.Patches[i].LDIF), patchStatus.Hash)
+			assert.True(t, patchStatus.Applied)
+			assert.NotNil(t, patchStatus.LastAppliedTime)
+		}
+
+		// Unchanged config should not be reapplied.
+		err = agent.Sync()
+		require.NoError(t, err)
+
+		assert.Len(t, client.applied, 3)
+	})
+
+	t.Run("Changed Patch", func(t *testing.T) {
+		client.applied = nil
+
+		config.Generation = 2
+		config.Patches[1].LDIF = "dn: cn=config\nchangetype: modify\nreplace: olcIdleTimeout\nolcIdleTimeout: 120\n"
+		writeConfig(config)
+
+		err := agent.Sync()
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"olcIdleTimeout"}, client.applied)
+		assert.Equal(t, int64(2), agent.Status().Generation)
+	})
+
+	t.Run("Restart", func(t *testing.T) {
+		client.applied = nil
+
+		agent = newAgent()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := agent.Run(ctx)
+		require.NoError(t, err)
+
+		// Already applied patches should not be reapplied after a restart.
+		assert.Empty(t, client.applied)
+		assert.Equal(t, int64(2), agent.Status().Generation)
+	})
+
+	t.Run("Failed Patch", func(t *testing.T) {
+		client.applied = nil
+
+		config.Generation = 3
+		config.Patches[0].LDIF = "dn: dc=example,dc=com\nchangetype: modify\nreplace: o\no: Evil Corp\n"
+		writeConfig(config)
+
+		err := agent.Sync()
+		require.NoError(t, err)
+
+		assert.Empty(t, client.applied)
+
+		status := agent.Status()
+		assert.Equal(t, int64(2), status.Generation)
+		assert.Contains(t, status.Message, "not within cn=config")
+		require.Len(t, status.Patches, 2)
+		assert.False(t, status.Patches[0].Applied)
+		assert.Contains(t, status.Patches[0].Message, "not within cn=config")
+		assert.True(t, status.Patches[1].Applied)
+	})
+
+	t.Run("Status", func(t *testing.T) {
+		server := httptest.NewTLSServer(agent)
+		defer server.Close()
+
+		status, err := configagent.NewClient().GetStatus(context.Background(), serverEndpoint(server, ""))
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(2), status.Generation)
+		assert.Contains(t, status.Message, "not within cn=config")
+		assert.Len(t, status.Patches, 2)
+	})
+}
+
+// serverEndpoint returns the endpoint of a TLS test server.
+func serverEndpoint(server *httptest.Server, token string) *configagent.Endpoint {
+	return &configagent.Endpoint{
+		Address: server.Listener.Addr().String(),
+		// The certificates of test servers are issued for example.com.
+		ServerName: "example.com",
+		CACertificate: pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: server.Certificate().Raw,
+		}),
+		Token: token,
+	}
+}
+
+type fakeConfigClient struct {
+	applied   []string
+	databases []string
+	readOnly  map[string]bool
+}
+
+func (c *fakeConfigClient) ApplyConfigLDIF(records []ldif.Record) (int, error) {
+	for _, record := range records {
+		if record.ChangeType != ldif.ChangeTypeModify {
+			return 0, fmt.Errorf("unexpected changetype %q", record.ChangeType)
+		}
+
+		for _, mod := range record.Modifications {
+			c.applied = append(c.applied, mod.Name)
+		}
+	}
+
+	return len(records), nil
+}
+
+func (c *fakeConfigClient) WritableDatabases() ([]string, error) {
+	var dns []string
+	for _, dn := range c.databases {
+		if !c.readOnly[dn] {
+			dns = append(dns, dn)
+		}
+	}
+
+	return dns, nil
+}
+
+func (c *fakeConfigClient) SetReadOnly(dns []string, readOnly bool) error {
+	if c.readOnly == nil {
+		c.readOnly = map[string]bool{}
+	}
+
+	for _, dn := range dns {
+		c.readOnly[dn] = readOnly
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configagent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+)
+
+// Endpoint is how the config agent of a directory is reached.
+type Endpoint struct {
+	// Address is the host:port the config agent listens on.
+	Address string
+	// ServerName is the name the certificate of the config agent is verified
+	// against (the agent serves the certificate of the directory).
+	ServerName string
+	// CACertificate is the PEM encoded CA bundle that issued the certificate
+	// of the directory.
+	CACertificate []byte
+	// Token authenticates requests to the export and freeze endpoints.
+	Token string
+}
+
+// Client fetches the status (and exports) of config agents.
+type Client interface {
+	GetStatus(ctx context.Context, endpoint *Endpoint) (*Status, error)
+	// Export returns a consistent export of the main database of the directory.
+	Export(ctx context.Context, endpoint *Endpoint) ([]ldif.Record, error)
+	// SetReadOnly freezes (or unfreezes) the databases of the directory.
+	SetReadOnly(ctx context.Context, endpoint *Endpoint, readOnly bool) error
+}
+
+type clientImpl struct{}
+
+// NewClient returns a client for fetching the status of config agents.
+func NewClient() Client {
+	return &clientImpl{}
+}
+
+// GetStatus returns the status of the config agent at the given endpoint.
+func (c *clientImpl) GetStatus(ctx context.Context, endpoint *Endpoint) (*Status, error) {
+	httpClient, err := newHTTPClient(endpoint, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+endpoint.Address+"/status", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config agent status: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get config agent status: unexpected status %q", resp.Status)
+	}
+
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to decode config agent status: %w", err)
+	}
+
+	return &status, nil
+}
+
+// Export returns an export of the directory whose config agent is at the
+// given endpoint.
+func (c *clientImpl) Export(ctx context.Context, endpoint *Endpoint) ([]ldif.Record, error) {
+	// Exports can be large.
+	httpClient, err := newHTTPClient(endpoint, 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+endpoint.Address+"/export", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+endpoint.Token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export directory: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to export directory: unexpected status %q", resp.Status)
+	}
+
+	records, err := ldif.Parse(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse export: %w", err)
+	}
+
+	return records, nil
+}
+
+// SetReadOnly freezes, or unfreezes, the directory whose config agent is at
+// the given endpoint.
+func (c *clientImpl) SetReadOnly(ctx context.Context, endpoint *Endpoint, readOnly bool) error {
+	httpClient, err := newHTTPClient(endpoint, 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	path := "/unfreeze"
+	if readOnly {
+		path = "/freeze"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+endpoint.Address+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+endpoint.Token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to set read-only mode: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to set read-only mode: unexpected status %q", resp.Status)
+	}
+
+	return nil
+}
+
+// newHTTPClient returns a client that only trusts the certificate of the
+// directory.
+func newHTTPClient(endpoint *Endpoint, timeout time.Duration) (*http.Client, error) {
+	caBundle := x509.NewCertPool()
+	if ok := caBundle.AppendCertsFromPEM(endpoint.CACertificate); !ok {
+		return nil, fmt.Errorf("failed to construct ca bundle")
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				RootCAs:    caBundle,
+				ServerName: endpoint.ServerName,
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,92 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package configagent implements the config agent sidecar, which applies the
+// desired cn=config configuration (rendered by the operator into a secret)
+// to the directory over ldapi:///, and reports back what it has applied.
+package configagent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+)
+
+const (
+	// ConfigFile is the secret key containing the desired configuration.
+	ConfigFile = "config.json"
+	// DefaultPort is the port the config agent serves its status on.
+	DefaultPort = 8082
+)
+
+// Config is the desired cn=config configuration of a directory.
+type Config struct {
+	// Generation is the generation of the directory the configuration was rendered from.
+	Generation int64 `json:"generation"`
+	// Settings is an LDIF document of the runtime settings managed by the operator (eg. log level).
+	Settings string `json:"settings,omitempty"`
+	// Patches are the config patches of the directory, applied in order.
+	Patches []Patch `json:"patches,omitempty"`
+}
+
+// Patch is a named LDIF document of changes to cn=config.
+type Patch struct {
+	// Name is the name of the patch.
+	Name string `json:"name"`
+	// LDIF is the content of the patch.
+	LDIF string `json:"ldif"`
+}
+
+// Status is what the config agent has applied to the directory.
+type Status struct {
+	// Generation is the generation of the last configuration that was completely applied.
+	Generation int64 `json:"generation"`
+	// SettingsHash is the hash of the last applied settings.
+	SettingsHash string `json:"settingsHash,omitempty"`
+	// Patches is the status of each of the config patches.
+	Patches []ldapv1alpha1.LDAPDirectoryConfigPatchStatus `json:"patches,omitempty"`
+	// Message describes why the configuration could not be applied (if it could not).
+	Message string `json:"message,omitempty"`
+}
+
+// Hash returns the hash of an LDIF document, used to detect changes.
+func Hash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseLDIF parses an LDIF document, checking that every record is within cn=config.
+func ParseLDIF(content string) ([]ldif.Record, error) {
+	records, err := ldif.Parse(bytes.NewReader([]byte(content)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ldif: %w", err)
+	}
+
+	for _, record := range records {
+		dn := strings.ToLower(record.DN)
+		if dn != "cn=config" && !strings.HasSuffix(dn, ",cn=config") {
+			return nil, fmt.Errorf("record %q is not within cn=config", record.DN)
+		}
+	}
+
+	return records, nil
+}
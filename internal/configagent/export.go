@@ -0,0 +1,91 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configagent
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ExportFunc writes a consistent export (as LDIF) of the main database of
+// the directory to the given writer.
+type ExportFunc func(ctx context.Context, w io.Writer) error
+
+// SlapcatExport exports the main database with slapcat, which reads a
+// consistent snapshot of a mdb database while slapd is running.
+func SlapcatExport(configDir string) ExportFunc {
+	return func(ctx context.Context, w io.Writer) error {
+		var stderr bytes.Buffer
+
+		cmd := exec.CommandContext(ctx, "slapcat", "-F", configDir, "-n", "1", "-o", "ldif-wrap=no")
+		cmd.Stdout = w
+		cmd.Stderr = &stderr
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("slapcat failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+
+		return nil
+	}
+}
+
+// ExportHandler serves an export of the directory, it is used to clone
+// directories. Requests must be authenticated with the token of the config
+// agent (as a bearer token).
+type ExportHandler struct {
+	Logger *zap.Logger
+	Token  string
+	Export ExportFunc
+}
+
+func (h *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, h.Token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Buffer the export, so that a failure can be reported with a status code.
+	var buf bytes.Buffer
+	if err := h.Export(r.Context(), &buf); err != nil {
+		h.Logger.Error("Failed to export directory", zap.Error(err))
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.Info("Exported directory", zap.Int("bytes", buf.Len()))
+
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = buf.WriteTo(w)
+}
+
+// authorized checks that the request is authenticated with the token of the
+// config agent (as a bearer token). Requests are never authorized if the
+// token is not known.
+func authorized(r *http.Request, token string) bool {
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && ok && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
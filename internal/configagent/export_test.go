@@ -0,0 +1,119 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package configagent_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gpu-ninja/ldap-operator/internal/configagent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestExportHandler(t *testing.T) {
+	export := "dn: dc=example,dc=com\nobjectClass: dcObject\ndc: example\n"
+
+	handler := &configagent.ExportHandler{
+		Logger: zap.NewNop(),
+		Token:  "password",
+		Export: func(_ context.Context, w io.Writer) error {
+			_, err := io.WriteString(w, export)
+			return err
+		},
+	}
+
+	t.Run("Authorized", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/export", nil)
+		req.Header.Set("Authorization", "Bearer password")
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, export, rec.Body.String())
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		for _, authorization := range []string{"", "Bearer wrong", "Basic password"} {
+			req := httptest.NewRequest(http.MethodGet, "/export", nil)
+			req.Header.Set("Authorization", authorization)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, authorization)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		disabledHandler := *handler
+		disabledHandler.Token = ""
+
+		req := httptest.NewRequest(http.MethodGet, "/export", nil)
+		req.Header.Set("Authorization", "Bearer ")
+
+		rec := httptest.NewRecorder()
+		disabledHandler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		failingHandler := *handler
+		failingHandler.Export = func(_ context.Context, w io.Writer) error {
+			_, _ = io.WriteString(w, "dn: partial\n")
+			return fmt.Errorf("slapcat failed")
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/export", nil)
+		req.Header.Set("Authorization", "Bearer password")
+
+		rec := httptest.NewRecorder()
+		failingHandler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "dn: partial")
+	})
+
+	t.Run("Client", func(t *testing.T) {
+		server := httptest.NewTLSServer(handler)
+		t.Cleanup(server.Close)
+
+		client := configagent.NewClient()
+
+		records, err := client.Export(context.Background(), serverEndpoint(server, "password"))
+		require.NoError(t, err)
+
+		require.Len(t, records, 1)
+		assert.Equal(t, "dc=example,dc=com", records[0].DN)
+
+		_, err = client.Export(context.Background(), serverEndpoint(server, "wrong"))
+		assert.ErrorContains(t, err, "401")
+
+		endpoint := serverEndpoint(server, "password")
+		endpoint.ServerName = "example.org"
+
+		_, err = client.Export(context.Background(), endpoint)
+		assert.ErrorContains(t, err, "certificate")
+	})
+}
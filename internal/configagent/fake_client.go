@@ -0,0 +1,50 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configagent
+
+import (
+	"context"
+
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+	"github.com/stretchr/testify/mock"
+)
+
+type fakeClient struct {
+	*mock.Mock
+}
+
+func NewFakeClient(m *mock.Mock) Client {
+	return &fakeClient{
+		Mock: m,
+	}
+}
+
+func (c *fakeClient) GetStatus(_ context.Context, endpoint *Endpoint) (*Status, error) {
+	args := c.Called(endpoint.Address)
+	return args.Get(0).(*Status), args.Error(1)
+}
+
+func (c *fakeClient) Export(_ context.Context, endpoint *Endpoint) ([]ldif.Record, error) {
+	args := c.Called(endpoint.Address, endpoint.Token)
+	return args.Get(0).([]ldif.Record), args.Error(1)
+}
+
+func (c *fakeClient) SetReadOnly(_ context.Context, endpoint *Endpoint, readOnly bool) error {
+	args := c.Called(endpoint.Address, endpoint.Token, readOnly)
+	return args.Error(0)
+}
@@ -0,0 +1,120 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configagent
+
+import (
+	"net/http"
+
+	"github.com/gpu-ninja/ldap-operator/internal/bootstrap"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	"go.uber.org/zap"
+)
+
+// FreezeHandler puts the databases of the directory into (or out of)
+// read-only mode, so that its volumes can be snapshotted consistently.
+// Requests must be authenticated with the token of the config agent (as a
+// bearer token). The frozen databases are recorded in FreezeFile, so that
+// databases made read-only by an administrator are never unfrozen.
+type FreezeHandler struct {
+	Logger *zap.Logger
+	Token  string
+	Client ldap.ConfigClient
+	// FreezeFile records the databases frozen by the agent (see bootstrap.FreezeFile).
+	FreezeFile string
+	// ReadOnly is whether the handler freezes, or unfreezes, the directory.
+	ReadOnly bool
+}
+
+func (h *FreezeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !authorized(r, h.Token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	setReadOnly := h.unfreeze
+	if h.ReadOnly {
+		setReadOnly = h.freeze
+	}
+
+	if err := setReadOnly(); err != nil {
+		h.Logger.Error("Failed to set read-only mode", zap.Bool("readOnly", h.ReadOnly), zap.Error(err))
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.Logger.Info("Set read-only mode", zap.Bool("readOnly", h.ReadOnly))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// freeze records the writable databases in the freeze file, before making
+// them read-only (so that a crash cannot leave a database frozen without a
+// record of it).
+func (h *FreezeHandler) freeze() error {
+	frozen, err := bootstrap.ReadFrozenDatabases(h.FreezeFile)
+	if err != nil {
+		return err
+	}
+
+	writable, err := h.Client.WritableDatabases()
+	if err != nil {
+		return err
+	}
+
+	for _, dn := range writable {
+		if !contains(frozen, dn) {
+			frozen = append(frozen, dn)
+		}
+	}
+
+	if err := bootstrap.WriteFrozenDatabases(h.FreezeFile, frozen); err != nil {
+		return err
+	}
+
+	return h.Client.SetReadOnly(frozen, true)
+}
+
+// unfreeze makes the databases recorded in the freeze file writable again.
+func (h *FreezeHandler) unfreeze() error {
+	frozen, err := bootstrap.ReadFrozenDatabases(h.FreezeFile)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Client.SetReadOnly(frozen, false); err != nil {
+		return err
+	}
+
+	return bootstrap.RemoveFrozenDatabases(h.FreezeFile)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,111 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configagent_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gpu-ninja/ldap-operator/internal/bootstrap"
+	"github.com/gpu-ninja/ldap-operator/internal/configagent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestFreezeHandler(t *testing.T) {
+	const (
+		mainDB     = "olcDatabase={1}mdb,cn=config"
+		archivedDB = "olcDatabase={2}mdb,cn=config"
+	)
+
+	// The archived database has been made read-only by an administrator.
+	client := &fakeConfigClient{
+		databases: []string{mainDB, archivedDB},
+		readOnly:  map[string]bool{archivedDB: true},
+	}
+
+	freezeFile := filepath.Join(t.TempDir(), "frozen.json")
+
+	mux := http.NewServeMux()
+	mux.Handle("/freeze", &configagent.FreezeHandler{
+		Logger:     zap.NewNop(),
+		Token:      "password",
+		Client:     client,
+		FreezeFile: freezeFile,
+		ReadOnly:   true,
+	})
+	mux.Handle("/unfreeze", &configagent.FreezeHandler{
+		Logger:     zap.NewNop(),
+		Token:      "password",
+		Client:     client,
+		FreezeFile: freezeFile,
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/freeze", nil)
+		req.Header.Set("Authorization", "Bearer wrong")
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.False(t, client.readOnly[mainDB])
+	})
+
+	t.Run("Method Not Allowed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/freeze", nil)
+		req.Header.Set("Authorization", "Bearer password")
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+		assert.False(t, client.readOnly[mainDB])
+	})
+
+	t.Run("Client", func(t *testing.T) {
+		server := httptest.NewTLSServer(mux)
+		t.Cleanup(server.Close)
+
+		agentClient := configagent.NewClient()
+
+		err := agentClient.SetReadOnly(context.Background(), serverEndpoint(server, "password"), true)
+		require.NoError(t, err)
+
+		assert.True(t, client.readOnly[mainDB])
+
+		frozen, err := bootstrap.ReadFrozenDatabases(freezeFile)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{mainDB}, frozen)
+
+		err = agentClient.SetReadOnly(context.Background(), serverEndpoint(server, "password"), false)
+		require.NoError(t, err)
+
+		assert.False(t, client.readOnly[mainDB])
+		assert.True(t, client.readOnly[archivedDB])
+		assert.NoFileExists(t, freezeFile)
+
+		err = agentClient.SetReadOnly(context.Background(), serverEndpoint(server, "wrong"), true)
+		assert.ErrorContains(t, err, "401")
+	})
+}
@@ -0,0 +1,266 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/changefeed"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	"github.com/gpu-ninja/operator-utils/updater"
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const (
+	// defaultChangeFeedPollInterval is how often the accesslog is checked for
+	// new changes (if not specified).
+	defaultChangeFeedPollInterval = 10 * time.Second
+	// defaultChangeFeedMaxAttempts is the number of delivery attempts made to
+	// a sink (if not specified).
+	defaultChangeFeedMaxAttempts = 5
+	// changeFeedBatchSize is the maximum number of changes delivered per reconcile.
+	changeFeedBatchSize = 100
+	// changeFeedWindow bounds how far after the cursor the accesslog is
+	// searched for changes.
+	changeFeedWindow = time.Hour
+	// changeFeedSettleTime is how long after a change was made that it is
+	// assumed to have been recorded (and the cursor can be moved past it).
+	changeFeedSettleTime = time.Minute
+	// changeFeedRetryBackoff is the delay before the first delivery retry, it
+	// doubles after each failed attempt.
+	changeFeedRetryBackoff = time.Second
+)
+
+// LDAPDirectoryChangeFeedReconciler delivers the changes recorded in the
+// accesslog of a directory to its change feed sinks.
+type LDAPDirectoryChangeFeedReconciler struct {
+	client.Client
+	Scheme            *runtime.Scheme
+	Recorder          record.EventRecorder
+	LDAPClientBuilder ldap.ClientBuilder
+	HTTPClient        *http.Client
+}
+
+func (r *LDAPDirectoryChangeFeedReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := zaplogr.FromContext(ctx).With(zap.String("name", req.Name), zap.String("namespace", req.Namespace))
+
+	var directory ldapv1alpha1.LDAPDirectory
+	if err := r.Get(ctx, req.NamespacedName, &directory); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	if directory.Spec.ChangeFeed == nil || !directory.GetDeletionTimestamp().IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	pollInterval := defaultChangeFeedPollInterval
+	if directory.Spec.ChangeFeed.PollInterval != nil {
+		pollInterval = directory.Spec.ChangeFeed.PollInterval.Duration
+	}
+
+	if directory.Status.Phase != ldapv1alpha1.LDAPDirectoryPhaseReady {
+		logger.Info("Directory not ready, waiting")
+
+		return ctrl.Result{RequeueAfter: pollInterval}, nil
+	}
+
+	ldapClient, err := r.LDAPClientBuilder.WithDirectory(&directory).Build(ctx)
+	if err != nil {
+		r.Recorder.Eventf(&directory, corev1.EventTypeWarning,
+			"Failed", "Failed to create directory client: %s", err)
+
+		return ctrl.Result{}, fmt.Errorf("failed to create directory client: %w", err)
+	}
+
+	var cursor string
+	var failedAttempts int
+	if directory.Status.ChangeFeed != nil {
+		cursor = directory.Status.ChangeFeed.Cursor
+		failedAttempts = directory.Status.ChangeFeed.FailedAttempts
+	}
+
+	// Only search a window after the cursor, so that the whole accesslog is
+	// never searched.
+	var before string
+	var windowEnd time.Time
+	if cursor != "" {
+		cursorTime, err := time.Parse(ldap.ChangeIDLayout, cursor)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to parse change feed cursor: %w", err)
+		}
+
+		windowEnd = cursorTime.Add(changeFeedWindow)
+		before = windowEnd.Format(ldap.ChangeIDLayout)
+	}
+
+	changes, err := ldapClient.GetChanges(cursor, before, changeFeedBatchSize)
+	if err != nil {
+		r.Recorder.Eventf(&directory, corev1.EventTypeWarning,
+			"Failed", "Failed to get changes: %s", err)
+
+		return ctrl.Result{}, fmt.Errorf("failed to get changes: %w", err)
+	}
+
+	if len(changes) == 0 {
+		// Skip over windows without any changes, once every change in them has
+		// been recorded.
+		if cursor != "" && windowEnd.Before(time.Now().Add(-changeFeedSettleTime)) {
+			if err := r.updateCursor(ctx, &directory, before, 0, false); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			return ctrl.Result{Requeue: true}, nil
+		}
+
+		return ctrl.Result{RequeueAfter: pollInterval}, nil
+	}
+
+	logger.Info("Delivering changes", zap.Int("count", len(changes)))
+
+	publisher := &changefeed.Publisher{
+		Client: r.HTTPClient,
+	}
+
+	source := fmt.Sprintf("/apis/%s/namespaces/%s/ldapdirectories/%s",
+		ldapv1alpha1.GroupVersion.String(), directory.Namespace, directory.Name)
+
+	delivered := cursor
+	var deliveryErr error
+	for i := range changes {
+		if deliveryErr = r.deliver(ctx, publisher, source, &directory, &changes[i]); deliveryErr != nil {
+			break
+		}
+
+		delivered = changes[i].ID
+	}
+
+	if deliveryErr == nil {
+		if err := r.updateCursor(ctx, &directory, delivered, 0, true); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		// There may be more changes waiting.
+		if len(changes) == changeFeedBatchSize {
+			return ctrl.Result{Requeue: true}, nil
+		}
+
+		return ctrl.Result{RequeueAfter: pollInterval}, nil
+	}
+
+	// Delivery is retried by requeuing (rather than blocking the reconcile).
+	if delivered != cursor {
+		failedAttempts = 0
+	}
+	failedAttempts++
+
+	maxAttempts := defaultChangeFeedMaxAttempts
+	if directory.Spec.ChangeFeed.MaxAttempts != nil {
+		maxAttempts = *directory.Spec.ChangeFeed.MaxAttempts
+	}
+
+	retryAfter := changeFeedRetryBackoff * time.Duration(1<<(failedAttempts-1))
+	if failedAttempts >= maxAttempts {
+		// Start over from the next poll.
+		failedAttempts = 0
+		retryAfter = pollInterval
+	}
+
+	// Always persist the cursor so that delivered changes are not redelivered.
+	if delivered != cursor || directory.Status.ChangeFeed == nil || failedAttempts != directory.Status.ChangeFeed.FailedAttempts {
+		if err := r.updateCursor(ctx, &directory, delivered, failedAttempts, delivered != cursor); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	logger.Info("Failed to deliver change, retrying",
+		zap.Error(deliveryErr), zap.Duration("retryAfter", retryAfter))
+
+	r.Recorder.Eventf(&directory, corev1.EventTypeWarning,
+		"Failed", "Failed to deliver change: %s", deliveryErr)
+
+	return ctrl.Result{RequeueAfter: retryAfter}, nil
+}
+
+func (r *LDAPDirectoryChangeFeedReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("ldapdirectory-changefeed").
+		// Status updates (eg. of the cursor) do not need to trigger a reconcile.
+		For(&ldapv1alpha1.LDAPDirectory{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+func (r *LDAPDirectoryChangeFeedReconciler) deliver(ctx context.Context, publisher *changefeed.Publisher, source string, directory *ldapv1alpha1.LDAPDirectory, change *ldap.Change) error {
+	event, err := changefeed.NewEvent(source, change)
+	if err != nil {
+		return err
+	}
+
+	for _, sink := range directory.Spec.ChangeFeed.Sinks {
+		if err := publisher.Publish(ctx, sink.URL, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateCursor records the cursor (and failed delivery attempts) of the
+// change feed, and when a change was last delivered.
+func (r *LDAPDirectoryChangeFeedReconciler) updateCursor(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, cursor string, failedAttempts int, delivered bool) error {
+	key := client.ObjectKeyFromObject(directory)
+	err := updater.UpdateStatus(ctx, r.Client, key, directory, func() error {
+		status := &ldapv1alpha1.LDAPDirectoryChangeFeedStatus{
+			Cursor:         cursor,
+			FailedAttempts: failedAttempts,
+		}
+
+		if delivered {
+			status.LastDeliveryTime = ptr.To(metav1.Now())
+		} else if directory.Status.ChangeFeed != nil {
+			status.LastDeliveryTime = directory.Status.ChangeFeed.LastDeliveryTime
+		}
+
+		directory.Status.ChangeFeed = status
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update change feed cursor: %w", err)
+	}
+
+	return nil
+}
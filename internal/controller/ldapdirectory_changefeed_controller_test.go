@@ -0,0 +1,286 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/changefeed"
+	"github.com/gpu-ninja/ldap-operator/internal/controller"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	"github.com/gpu-ninja/operator-utils/reference"
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestLDAPDirectoryChangeFeedReconciler(t *testing.T) {
+	ctrl.SetLogger(zaplogr.New(zaptest.NewLogger(t)))
+
+	scheme := runtime.NewScheme()
+
+	err := corev1.AddToScheme(scheme)
+	require.NoError(t, err)
+
+	err = ldapv1alpha1.AddToScheme(scheme)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var received []changefeed.Event
+	failing := false
+
+	sink := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var event changefeed.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		received = append(received, event)
+	}))
+	t.Cleanup(sink.Close)
+
+	directory := &ldapv1alpha1.LDAPDirectory{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+		},
+		Spec: ldapv1alpha1.LDAPDirectorySpec{
+			Image:  "ghcr.io/gpu-ninja/ldap-operator/openldap:latest",
+			Domain: "example.com",
+			CertificateSecretRef: &reference.LocalSecretReference{
+				Name: "demo-tls",
+			},
+			ChangeFeed: &ldapv1alpha1.LDAPDirectoryChangeFeed{
+				Sinks: []ldapv1alpha1.LDAPDirectoryChangeFeedSink{
+					{URL: sink.URL},
+				},
+				MaxAttempts: ptr.To(1),
+			},
+		},
+		Status: ldapv1alpha1.LDAPDirectoryStatus{
+			Phase: ldapv1alpha1.LDAPDirectoryPhaseReady,
+		},
+	}
+
+	changes := []ldap.Change{
+		{
+			ID:   "20231011120000.000001Z",
+			Type: "add",
+			DN:   "uid=demo,ou=users,dc=example,dc=com",
+		},
+		{
+			ID:   "20231011120001.000001Z",
+			Type: "modify",
+			DN:   "cn=admins,ou=groups,dc=example,dc=com",
+			Mods: []string{"member:+ uid=demo,ou=users,dc=example,dc=com"},
+		},
+	}
+
+	r := &controller.LDAPDirectoryChangeFeedReconciler{
+		Scheme:     scheme,
+		HTTPClient: sink.Client(),
+	}
+
+	ctx := context.Background()
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      directory.Name,
+			Namespace: directory.Namespace,
+		},
+	}
+
+	t.Run("Deliver", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(directory).
+			WithStatusSubresource(directory).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("GetChanges", "", "", mock.Anything).Return(changes, nil)
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.NotZero(t, resp.RequeueAfter)
+
+		require.Len(t, received, 2)
+		assert.Equal(t, "com.gpu-ninja.ldap.entry.add", received[0].Type)
+		assert.Equal(t, "/apis/ldap.gpu-ninja.com/v1alpha1/namespaces/default/ldapdirectories/test", received[0].Source)
+		assert.Equal(t, changes[1].Mods, received[1].Data.Mods)
+
+		var updatedDirectory ldapv1alpha1.LDAPDirectory
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedDirectory)
+		require.NoError(t, err)
+
+		require.NotNil(t, updatedDirectory.Status.ChangeFeed)
+		assert.Equal(t, changes[1].ID, updatedDirectory.Status.ChangeFeed.Cursor)
+		assert.NotNil(t, updatedDirectory.Status.ChangeFeed.LastDeliveryTime)
+	})
+
+	t.Run("Resume From Cursor", func(t *testing.T) {
+		received = nil
+
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		resumingDirectory := directory.DeepCopy()
+		resumingDirectory.Status.ChangeFeed = &ldapv1alpha1.LDAPDirectoryChangeFeedStatus{
+			Cursor: changes[0].ID,
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(resumingDirectory).
+			WithStatusSubresource(resumingDirectory).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		// Changes are searched for in a window after the cursor.
+		m.On("GetChanges", changes[0].ID, "20231011130000.000001Z", mock.Anything).Return(changes[1:], nil)
+
+		_, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		require.Len(t, received, 1)
+		assert.Equal(t, changes[1].ID, received[0].ID)
+	})
+
+	t.Run("Skip Empty Window", func(t *testing.T) {
+		received = nil
+
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		resumingDirectory := directory.DeepCopy()
+		resumingDirectory.Status.ChangeFeed = &ldapv1alpha1.LDAPDirectoryChangeFeedStatus{
+			Cursor:           changes[1].ID,
+			LastDeliveryTime: ptr.To(metav1.Now()),
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(resumingDirectory).
+			WithStatusSubresource(resumingDirectory).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("GetChanges", changes[1].ID, "20231011130001.000001Z", mock.Anything).Return([]ldap.Change{}, nil)
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.True(t, resp.Requeue)
+
+		assert.Empty(t, received)
+
+		var updatedDirectory ldapv1alpha1.LDAPDirectory
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, "20231011130001.000001Z", updatedDirectory.Status.ChangeFeed.Cursor)
+		assert.NotNil(t, updatedDirectory.Status.ChangeFeed.LastDeliveryTime)
+	})
+
+	t.Run("Delivery Failure", func(t *testing.T) {
+		received = nil
+		failing = true
+		t.Cleanup(func() { failing = false })
+
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		retryingDirectory := directory.DeepCopy()
+		retryingDirectory.Spec.ChangeFeed.MaxAttempts = ptr.To(2)
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(retryingDirectory).
+			WithStatusSubresource(retryingDirectory).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("GetChanges", "", "", mock.Anything).Return(changes, nil)
+
+		// Failed deliveries are retried with a backoff.
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, time.Second, resp.RequeueAfter)
+
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Contains(t, event, "Warning Failed Failed to deliver change")
+
+		var updatedDirectory ldapv1alpha1.LDAPDirectory
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedDirectory)
+		require.NoError(t, err)
+
+		require.NotNil(t, updatedDirectory.Status.ChangeFeed)
+		assert.Empty(t, updatedDirectory.Status.ChangeFeed.Cursor)
+		assert.Nil(t, updatedDirectory.Status.ChangeFeed.LastDeliveryTime)
+		assert.Equal(t, 1, updatedDirectory.Status.ChangeFeed.FailedAttempts)
+
+		// Until the attempts are exhausted, then from the next poll.
+		resp, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, 10*time.Second, resp.RequeueAfter)
+
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedDirectory)
+		require.NoError(t, err)
+
+		assert.Zero(t, updatedDirectory.Status.ChangeFeed.FailedAttempts)
+		assert.Empty(t, received)
+	})
+}
@@ -0,0 +1,237 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/export"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// operationalAttributes are maintained by slapd (and its overlays), so are
+// removed from cloned entries before they are imported.
+var operationalAttributes = []string{
+	"structuralObjectClass", "entryUUID", "entryCSN", "contextCSN",
+	"creatorsName", "createTimestamp", "modifiersName", "modifyTimestamp",
+	"memberOf", "pwdChangedTime", "pwdFailureTime", "pwdHistory", "pwdGraceUseTime",
+}
+
+// reconcileClone imports the entries of the clone source (if any) once the directory is ready.
+func (r *LDAPDirectoryReconciler) reconcileClone(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) (ctrl.Result, error) {
+	logger := zaplogr.FromContext(ctx)
+
+	if directory.Spec.CloneFrom == nil ||
+		meta.IsStatusConditionTrue(directory.Status.Conditions, string(ldapv1alpha1.LDAPDirectoryConditionTypeCloned)) {
+		return ctrl.Result{}, nil
+	}
+
+	source, err := r.cloneSource(ctx, directory)
+	if err != nil {
+		r.Recorder.Eventf(directory, corev1.EventTypeWarning,
+			"Failed", "Failed to clone directory: %s", err)
+
+		if err := r.setCondition(ctx, directory, metav1.Condition{
+			Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeCloned),
+			Status:  metav1.ConditionFalse,
+			Reason:  "Failed",
+			Message: err.Error(),
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, fmt.Errorf("failed to clone directory: %w", err)
+	}
+
+	if source == nil || source.Status.Phase != ldapv1alpha1.LDAPDirectoryPhaseReady {
+		logger.Info("Waiting for clone source directory to become ready")
+
+		if err := r.setCondition(ctx, directory, metav1.Condition{
+			Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeCloned),
+			Status:  metav1.ConditionFalse,
+			Reason:  "Pending",
+			Message: "Waiting for the source directory to become ready",
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+	}
+
+	logger.Info("Cloning directory",
+		zap.String("sourceNamespace", source.Namespace), zap.String("sourceName", source.Name))
+
+	applied, total, err := r.cloneDirectory(ctx, directory, source)
+	if err != nil {
+		r.Recorder.Eventf(directory, corev1.EventTypeWarning,
+			"Failed", "Failed to clone directory: %s", err)
+
+		if err := r.setCondition(ctx, directory, metav1.Condition{
+			Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeCloned),
+			Status:  metav1.ConditionFalse,
+			Reason:  "Failed",
+			Message: err.Error(),
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, fmt.Errorf("failed to clone directory: %w", err)
+	}
+
+	r.Recorder.Eventf(directory, corev1.EventTypeNormal,
+		"Cloned", "Successfully cloned %d entries from %s/%s", applied, source.Namespace, source.Name)
+
+	return ctrl.Result{}, r.setCondition(ctx, directory, metav1.Condition{
+		Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeCloned),
+		Status:  metav1.ConditionTrue,
+		Reason:  "Cloned",
+		Message: fmt.Sprintf("Imported %d of %d entries from %s/%s", applied, total, source.Namespace, source.Name),
+	})
+}
+
+// cloneSource returns the directory being cloned, or nil if it does not exist.
+func (r *LDAPDirectoryReconciler) cloneSource(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) (*ldapv1alpha1.LDAPDirectory, error) {
+	ref := directory.Spec.CloneFrom.DirectoryRef
+
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = directory.Namespace
+	}
+
+	var source ldapv1alpha1.LDAPDirectory
+	if err := r.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: namespace}, &source); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to get source directory: %w", err)
+	}
+
+	// A clone includes every entry (and password hash) of the source, so
+	// other namespaces must be explicitly allowed by the source.
+	if !source.AllowsCloneFrom(directory.Namespace) {
+		return nil, fmt.Errorf("source directory does not allow clones from namespace %q (see the %s annotation)",
+			directory.Namespace, ldapv1alpha1.CloneNamespacesAnnotation)
+	}
+
+	if source.Spec.External != nil {
+		return nil, fmt.Errorf("external directories cannot be cloned")
+	}
+
+	if !strings.EqualFold(source.Spec.Domain, directory.Spec.Domain) {
+		return nil, fmt.Errorf("source directory has a different domain (%s)", source.Spec.Domain)
+	}
+
+	return &source, nil
+}
+
+// cloneDirectory exports the source directory (with slapcat, via its config
+// agent), scrubs the exported entries, and imports them into the directory.
+// Entries that already exist (eg. the root entry) are skipped.
+func (r *LDAPDirectoryReconciler) cloneDirectory(ctx context.Context, directory, source *ldapv1alpha1.LDAPDirectory) (int, int, error) {
+	endpoint, err := configAgentEndpoint(ctx, r.Client, r.Scheme, source)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if endpoint == nil {
+		return 0, 0, fmt.Errorf("source directory pod is not running")
+	}
+
+	records, err := r.ConfigAgentClient.Export(ctx, endpoint)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	records, err = scrubRecords(records, directory.Spec.CloneFrom.Scrub)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ldapClient, err := r.LDAPClientBuilder.WithDirectory(directory).Build(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create directory client: %w", err)
+	}
+
+	applied, err := ldapClient.ApplyLDIF(records)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return applied, len(records), nil
+}
+
+// scrubRecords removes operational attributes from exported entries, applies
+// the scrub rules, and orders the entries so that parents are added before
+// their children.
+func scrubRecords(records []ldif.Record, rules []ldapv1alpha1.LDAPDirectoryScrubRule) ([]ldif.Record, error) {
+	depths := make(map[string]int, len(records))
+
+	scrubbed := make([]ldif.Record, 0, len(records))
+	for _, record := range records {
+		dn, err := goldap.ParseDN(record.DN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid distinguished name %q: %w", record.DN, err)
+		}
+		depths[record.DN] = len(dn.RDNs)
+
+		record = export.Scrub(record, rules)
+
+		var attributes []ldif.Attribute
+		for _, attr := range record.Attributes {
+			if !containsFold(operationalAttributes, attr.Name) {
+				attributes = append(attributes, attr)
+			}
+		}
+
+		scrubbed = append(scrubbed, ldif.Record{
+			DN:         record.DN,
+			ChangeType: ldif.ChangeTypeAdd,
+			Attributes: attributes,
+		})
+	}
+
+	sort.SliceStable(scrubbed, func(i, j int) bool {
+		return depths[scrubbed[i].DN] < depths[scrubbed[j].DN]
+	})
+
+	return scrubbed, nil
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
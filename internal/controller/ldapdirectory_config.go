@@ -0,0 +1,490 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/configagent"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+	"github.com/gpu-ninja/operator-utils/k8sutils"
+	"github.com/gpu-ninja/operator-utils/updater"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// configAgentMountPath is where the desired configuration is mounted in the
+	// config agent sidecar.
+	configAgentMountPath = "/etc/ldap-operator/config"
+	// configAgentTokenKey is the key of the config agent token secret.
+	configAgentTokenKey = "token"
+)
+
+// reconcileConfig renders the desired cn=config configuration of the directory
+// (runtime settings and config patches) into a secret, which is applied by the
+// config agent sidecar. A secret is used as the configuration can contain
+// credentials (eg. patches sourced from secrets). It then records what the
+// agent has applied, and returns whether the directory is running the desired
+// configuration.
+func (r *LDAPDirectoryReconciler) reconcileConfig(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) (bool, error) {
+	records := configRecords(directory)
+	if directory.Spec.Migration != nil {
+		migrationRecords, err := r.migrationConfigRecords(ctx, directory)
+		if err != nil {
+			return false, fmt.Errorf("failed to generate migration config: %w", err)
+		}
+
+		records = append(records, migrationRecords...)
+	}
+
+	config := configagent.Config{
+		Generation: directory.Generation,
+		Settings:   string(ldif.Marshal(records)),
+	}
+
+	// Patches that cannot be rendered are reported straight away, and later
+	// patches are not applied (as they may depend on the earlier ones).
+	var patchErr error
+	var failedPatchStatus *ldapv1alpha1.LDAPDirectoryConfigPatchStatus
+	for i, patch := range directory.Spec.ConfigPatches {
+		content, err := r.configPatchContent(ctx, directory, &directory.Spec.ConfigPatches[i])
+		if err != nil {
+			patchErr = fmt.Errorf("failed to get content of patch %q: %w", patch.Name, err)
+			failedPatchStatus = &ldapv1alpha1.LDAPDirectoryConfigPatchStatus{
+				Name:    patch.Name,
+				Message: patchErr.Error(),
+			}
+			break
+		}
+
+		if _, err := configagent.ParseLDIF(string(content)); err != nil {
+			patchErr = fmt.Errorf("invalid patch %q: %w", patch.Name, err)
+			failedPatchStatus = &ldapv1alpha1.LDAPDirectoryConfigPatchStatus{
+				Name:    patch.Name,
+				Hash:    configagent.Hash(string(content)),
+				Message: patchErr.Error(),
+			}
+			break
+		}
+
+		config.Patches = append(config.Patches, configagent.Patch{
+			Name: patch.Name,
+			LDIF: string(content),
+		})
+	}
+
+	secret, err := r.configAgentSecretTemplate(directory, &config)
+	if err != nil {
+		return false, fmt.Errorf("failed to generate config secret template: %w", err)
+	}
+
+	if _, err := updater.CreateOrUpdateFromTemplate(ctx, r.Client, secret); err != nil {
+		return false, fmt.Errorf("failed to create or update config secret: %w", err)
+	}
+
+	// Nothing for the agent to apply.
+	if config.Settings == "" && len(directory.Spec.ConfigPatches) == 0 && len(directory.Status.ConfigPatches) == 0 {
+		return true, nil
+	}
+
+	agentStatus, err := r.configAgentStatus(ctx, directory)
+	if err != nil {
+		return false, err
+	}
+
+	// Only the statuses of patches that the agent has applied in their
+	// current form are used, statuses of removed patches are dropped.
+	agentPatchStatuses := make(map[string]ldapv1alpha1.LDAPDirectoryConfigPatchStatus)
+	if agentStatus != nil {
+		for _, status := range agentStatus.Patches {
+			agentPatchStatuses[status.Name] = status
+		}
+	}
+
+	allApplied := true
+	statuses := make([]ldapv1alpha1.LDAPDirectoryConfigPatchStatus, 0, len(directory.Spec.ConfigPatches))
+	for _, patch := range config.Patches {
+		hash := configagent.Hash(patch.LDIF)
+
+		status, ok := agentPatchStatuses[patch.Name]
+		if !ok || status.Hash != hash {
+			status = ldapv1alpha1.LDAPDirectoryConfigPatchStatus{
+				Name:            patch.Name,
+				Hash:            hash,
+				LastAppliedTime: status.LastAppliedTime,
+				Message:         "Waiting for the config agent to apply the patch",
+			}
+		}
+
+		allApplied = allApplied && status.Applied
+		statuses = append(statuses, status)
+	}
+
+	if failedPatchStatus != nil {
+		allApplied = false
+		statuses = append(statuses, *failedPatchStatus)
+
+		existingStatuses := make(map[string]ldapv1alpha1.LDAPDirectoryConfigPatchStatus)
+		for _, status := range directory.Status.ConfigPatches {
+			existingStatuses[status.Name] = status
+		}
+
+		for _, patch := range directory.Spec.ConfigPatches[len(statuses):] {
+			if status, ok := existingStatuses[patch.Name]; ok {
+				statuses = append(statuses, status)
+			}
+		}
+	}
+
+	synced := agentStatus != nil && agentStatus.Generation == config.Generation &&
+		agentStatus.Message == "" && allApplied
+
+	syncedCondition := metav1.Condition{
+		Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeConfigSynced),
+		Status:  metav1.ConditionTrue,
+		Reason:  "Synced",
+		Message: "Config is up to date",
+	}
+
+	if agentStatus != nil && agentStatus.Message != "" {
+		syncedCondition.Status = metav1.ConditionFalse
+		syncedCondition.Reason = "Failed"
+		syncedCondition.Message = agentStatus.Message
+	} else if !synced {
+		syncedCondition.Status = metav1.ConditionFalse
+		syncedCondition.Reason = "Pending"
+		syncedCondition.Message = "Waiting for the config agent to apply the config"
+	}
+
+	conditions := []metav1.Condition{syncedCondition}
+
+	if len(directory.Spec.ConfigPatches) > 0 || len(directory.Status.ConfigPatches) > 0 {
+		patchedCondition := metav1.Condition{
+			Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeConfigPatched),
+			Status:  metav1.ConditionTrue,
+			Reason:  "Applied",
+			Message: "All config patches have been applied",
+		}
+
+		if patchErr != nil {
+			patchedCondition.Status = metav1.ConditionFalse
+			patchedCondition.Reason = "Failed"
+			patchedCondition.Message = patchErr.Error()
+		} else if syncedCondition.Reason == "Failed" {
+			patchedCondition.Status = metav1.ConditionFalse
+			patchedCondition.Reason = "Failed"
+			patchedCondition.Message = syncedCondition.Message
+		} else if !allApplied {
+			patchedCondition.Status = metav1.ConditionFalse
+			patchedCondition.Reason = "Pending"
+			patchedCondition.Message = "Waiting for the config agent to apply the config patches"
+		}
+
+		conditions = append(conditions, patchedCondition)
+	}
+
+	if !reflect.DeepEqual(statuses, directory.Status.ConfigPatches) || conditionsChanged(directory.Status.Conditions, conditions) {
+		key := client.ObjectKeyFromObject(directory)
+		err := updater.UpdateStatus(ctx, r.Client, key, directory, func() error {
+			directory.Status.ConfigPatches = statuses
+
+			for _, condition := range conditions {
+				condition.ObservedGeneration = directory.ObjectMeta.Generation
+				meta.SetStatusCondition(&directory.Status.Conditions, condition)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to update config status: %w", err)
+		}
+	}
+
+	return synced, patchErr
+}
+
+// configAgentStatus returns the status of the config agent of the directory,
+// or nil if the directory pod is not running.
+func (r *LDAPDirectoryReconciler) configAgentStatus(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) (*configagent.Status, error) {
+	endpoint, err := configAgentEndpoint(ctx, r.Client, r.Scheme, directory)
+	if err != nil || endpoint == nil {
+		return nil, err
+	}
+
+	status, err := r.ConfigAgentClient.GetStatus(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// configAgentEndpoint returns the endpoint of the config agent of the
+// directory, or nil if the directory pod is not running. The config agent
+// serves the certificate of the directory, and authenticates requests with
+// the token generated for the directory.
+func configAgentEndpoint(ctx context.Context, reader client.Reader, scheme *runtime.Scheme, directory *ldapv1alpha1.LDAPDirectory) (*configagent.Endpoint, error) {
+	var pod corev1.Pod
+	err := reader.Get(ctx, client.ObjectKey{
+		Name:      "ldap-" + directory.Name + "-0",
+		Namespace: directory.Namespace,
+	}, &pod)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to get directory pod: %w", err)
+	}
+
+	if pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+		return nil, nil
+	}
+
+	if directory.Spec.CertificateSecretRef == nil {
+		return nil, fmt.Errorf("certificate secret reference is required")
+	}
+
+	certificateSecret, ok, err := directory.Spec.CertificateSecretRef.Resolve(ctx, reader, scheme, directory)
+	if !ok && err == nil {
+		return nil, fmt.Errorf("referenced certificate secret not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to resolve certificate secret reference: %w", err)
+	}
+
+	var tokenSecret corev1.Secret
+	err = reader.Get(ctx, client.ObjectKey{
+		Name:      configAgentTokenSecretName(directory),
+		Namespace: directory.Namespace,
+	}, &tokenSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config agent token secret: %w", err)
+	}
+
+	return &configagent.Endpoint{
+		Address: net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(configagent.DefaultPort)),
+		// The agent is reached by pod IP, but serves the certificate issued
+		// for the service of the directory.
+		ServerName:    fmt.Sprintf("ldap-%s.%s.svc.%s", directory.Name, directory.Namespace, k8sutils.GetClusterDomain()),
+		CACertificate: certificateSecret.(*corev1.Secret).Data["ca.crt"],
+		Token:         string(tokenSecret.Data[configAgentTokenKey]),
+	}, nil
+}
+
+// configAgentTokenSecretName returns the name of the secret containing the
+// token used to authenticate with the config agent of the directory.
+func configAgentTokenSecretName(directory *ldapv1alpha1.LDAPDirectory) string {
+	return fmt.Sprintf("ldap-%s-agent-token", directory.Name)
+}
+
+func (r *LDAPDirectoryReconciler) configAgentSecretTemplate(directory *ldapv1alpha1.LDAPDirectory, config *configagent.Config) (*corev1.Secret, error) {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ldap-" + directory.Name + "-config",
+			Namespace: directory.Namespace,
+			Labels:    make(map[string]string),
+		},
+		Data: map[string][]byte{
+			configagent.ConfigFile: data,
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(directory, &secret, r.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to set controller reference: %w", err)
+	}
+
+	for k, v := range directory.ObjectMeta.Labels {
+		secret.ObjectMeta.Labels[k] = v
+	}
+
+	secret.ObjectMeta.Labels["app.kubernetes.io/name"] = "directory"
+	secret.ObjectMeta.Labels["app.kubernetes.io/instance"] = directory.Name
+	secret.ObjectMeta.Labels["app.kubernetes.io/managed-by"] = "ldap-operator"
+
+	return &secret, nil
+}
+
+// addConfigAgentSidecar adds the config agent sidecar, which applies the
+// desired configuration over the ldapi:/// socket of slapd.
+func addConfigAgentSidecar(podSpec *corev1.PodSpec, directory *ldapv1alpha1.LDAPDirectory) {
+	runVolumeMount := corev1.VolumeMount{
+		Name:      "run",
+		MountPath: "/var/run/slapd",
+	}
+
+	podSpec.Volumes = append(podSpec.Volumes,
+		corev1.Volume{
+			Name: "run",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+		corev1.Volume{
+			Name: "agent-config",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: "ldap-" + directory.Name + "-config",
+					// The secret is created once the directory is ready.
+					Optional: ptr.To(true),
+				},
+			},
+		},
+	)
+
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == "openldap" {
+			podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, runVolumeMount)
+		}
+	}
+
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{
+		Name:  "config-agent",
+		Image: directoryImage(directory),
+		Command: []string{
+			"/usr/local/bin/ldap-operator",
+			"config-agent",
+			"--config-dir=" + configAgentMountPath,
+		},
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          "config-agent",
+				ContainerPort: configagent.DefaultPort,
+				Protocol:      corev1.ProtocolTCP,
+			},
+		},
+		Env: []corev1.EnvVar{
+			{
+				// Authenticates exports (used for cloning), and freezes (used
+				// for snapshots) of the directory.
+				Name: "LDAP_AGENT_TOKEN",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: configAgentTokenSecretName(directory),
+						},
+						Key: configAgentTokenKey,
+					},
+				},
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			runVolumeMount,
+			{
+				Name:      "agent-config",
+				MountPath: configAgentMountPath,
+				ReadOnly:  true,
+			},
+			{
+				// Exports are made with slapcat, which reads cn=config.
+				Name:      "config",
+				MountPath: "/etc/ldap/slapd.d",
+				ReadOnly:  true,
+			},
+			{
+				// The endpoints are served with the certificate of the directory.
+				Name:      "certs",
+				MountPath: "/etc/ldap/certs",
+				ReadOnly:  true,
+			},
+			{
+				// The applied configuration is recorded alongside the databases.
+				Name:      "data",
+				MountPath: "/var/lib/ldap",
+			},
+		},
+	})
+}
+
+// configRecords returns the cn=config modifications required to apply the
+// runtime configuration of the directory.
+func configRecords(directory *ldapv1alpha1.LDAPDirectory) []ldif.Record {
+	var records []ldif.Record
+
+	if len(directory.Spec.LogLevel) > 0 {
+		logLevels := make([]string, len(directory.Spec.LogLevel))
+		for i, logLevel := range directory.Spec.LogLevel {
+			logLevels[i] = string(logLevel)
+		}
+
+		records = append(records, ldif.Record{
+			DN:         "cn=config",
+			ChangeType: ldif.ChangeTypeModify,
+			Modifications: []ldif.Modification{
+				{
+					Attribute: ldif.Attribute{Name: "olcLogLevel", Values: logLevels},
+					Type:      ldif.ModificationTypeReplace,
+				},
+			},
+		})
+	}
+
+	return records
+}
+
+// configPatchContent returns the LDIF content of a config patch.
+func (r *LDAPDirectoryReconciler) configPatchContent(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, patch *ldapv1alpha1.LDAPDirectoryConfigPatch) ([]byte, error) {
+	if patch.LDIF != "" {
+		return []byte(patch.LDIF), nil
+	}
+
+	obj, ok, err := patch.LDIFSource.Resolve(ctx, r.Client, r.Scheme, directory)
+	if !ok && err == nil {
+		return nil, fmt.Errorf("referenced ldif source not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to resolve ldif source: %w", err)
+	}
+
+	contents, err := patch.LDIFSource.Data(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.Join(contents, []byte("\n")), nil
+}
+
+// conditionsChanged returns whether setting the given conditions would change
+// the status or message of any of the existing conditions.
+func conditionsChanged(existingConditions, conditions []metav1.Condition) bool {
+	for _, condition := range conditions {
+		existing := meta.FindStatusCondition(existingConditions, condition.Type)
+		if existing == nil || existing.Status != condition.Status || existing.Message != condition.Message {
+			return true
+		}
+	}
+
+	return false
+}
@@ -18,28 +18,39 @@
 package controller
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
-	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 
+	"github.com/gpu-ninja/ldap-operator/api"
 	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/bootstrap"
+	"github.com/gpu-ninja/ldap-operator/internal/configagent"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
 	"github.com/gpu-ninja/operator-utils/password"
 	"github.com/gpu-ninja/operator-utils/updater"
 	"github.com/gpu-ninja/operator-utils/zaplogr"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/ptr"
@@ -48,14 +59,28 @@ import (
 // Allow recording of events.
 // +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
 
+// Need to be able to read config maps to get the bootstrap LDIF.
+// Need to be able to manage config maps to store the load balancer configuration.
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+
 // Need to be able to read secrets to get the TLS certificates / passwords, etc.
 // Need to be able to create secrets to store the generated admin password.
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 
-// Need to be able to manage statefulsets and services.
+// Need to be able to manage statefulsets, deployments, and services.
 //+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 
+// Need to be able to run jobs to upgrade the directory (and read their results).
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+
+// Need to be able to manage network policies.
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+
 //+kubebuilder:rbac:groups=ldap.gpu-ninja.com,resources=ldapdirectories,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=ldap.gpu-ninja.com,resources=ldapdirectories/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=ldap.gpu-ninja.com,resources=ldapdirectories/finalizers,verbs=update
@@ -68,12 +93,32 @@ const (
 	// reconcileRetryInterval is the interval at which the controller will retry
 	// to reconcile a resource.
 	reconcileRetryInterval = 5 * time.Second
+	// suspendedRetryInterval is the interval at which objects of a suspended
+	// directory check whether it has been resumed.
+	suspendedRetryInterval = time.Minute
+	// externalHealthCheckInterval is how often the connectivity to an external
+	// directory is checked, once it is ready.
+	externalHealthCheckInterval = time.Minute
+	// auditLogPath is where the auditlog overlay writes changes to.
+	auditLogPath = "/var/log/ldap/audit.ldif"
+	// accessLogDir is where the accesslog database (used by the change feed) is stored.
+	accessLogDir = "/var/lib/ldap/accesslog"
+	// defaultAuditLogMaxSize is the size in bytes after which the audit log
+	// will be rotated (if not specified).
+	defaultAuditLogMaxSize = 16 * 1024 * 1024
 )
 
 type LDAPDirectoryReconciler struct {
 	client.Client
-	Scheme   *runtime.Scheme
-	Recorder record.EventRecorder
+	Scheme            *runtime.Scheme
+	Recorder          record.EventRecorder
+	LDAPClientBuilder ldap.ClientBuilder
+	// ConfigAgentClient is used to fetch what the config agent sidecar of
+	// each directory has applied to cn=config.
+	ConfigAgentClient configagent.Client
+	// OperatorNamespace is the namespace the operator is running in, it is
+	// used to admit the operator through directory network policies.
+	OperatorNamespace string
 }
 
 func (r *LDAPDirectoryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -88,6 +133,16 @@ func (r *LDAPDirectoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
+	if api.IsPaused(&directory) {
+		logger.Info("Reconciliation is paused")
+
+		return ctrl.Result{}, r.setPaused(ctx, &directory, true)
+	}
+
+	if err := r.setPaused(ctx, &directory, false); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if !controllerutil.ContainsFinalizer(&directory, FinalizerName) {
 		logger.Info("Adding Finalizer")
 
@@ -104,8 +159,20 @@ func (r *LDAPDirectoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	if !directory.ObjectMeta.DeletionTimestamp.IsZero() {
 		logger.Info("Deleting")
 
-		// Nothing to do here, as the downstream resources will be garbage collected.
-		// Perhaps a reclaim policy to clean up the pvcs could be added in the future.
+		// The downstream resources will be garbage collected, but the objects
+		// of the directory need the directory to remove their entries.
+		blocked, err := r.reconcileDeletionPolicy(ctx, &directory)
+		if err != nil {
+			// Don't mark as failed, as objects wait for the directory to be ready.
+			r.Recorder.Eventf(&directory, corev1.EventTypeWarning,
+				"Failed", "Failed to apply deletion policy: %s", err)
+
+			return ctrl.Result{}, fmt.Errorf("failed to apply deletion policy: %w", err)
+		}
+
+		if blocked {
+			return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+		}
 
 		if controllerutil.ContainsFinalizer(&directory, FinalizerName) {
 			logger.Info("Removing Finalizer")
@@ -145,38 +212,31 @@ func (r *LDAPDirectoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, fmt.Errorf("failed to resolve references: %w", err)
 	}
 
+	if directory.Spec.External != nil {
+		return r.reconcileExternal(ctx, &directory)
+	}
+
 	logger.Info("Creating or updating")
 
 	logger.Info("Creating or updating admin password secret")
 
-	adminPasswordSecret := corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("ldap-%s-admin-password", directory.Name),
-			Namespace: directory.Namespace,
-		},
+	if err := r.reconcilePasswordSecret(ctx, &directory, fmt.Sprintf("ldap-%s-admin-password", directory.Name), "password"); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile admin password secret: %w", err)
 	}
 
-	// Get the admin password.
-	if err = r.Get(ctx, client.ObjectKeyFromObject(&adminPasswordSecret), &adminPasswordSecret); err != nil {
-		if apierrors.IsNotFound(err) {
-			pw, err := password.Generate(adminPasswordLength)
-			if err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to generate random admin password: %w", err)
-			}
+	logger.Info("Creating or updating config agent token secret")
 
-			adminPasswordSecret.Data = map[string][]byte{
-				"password": []byte(pw),
-			}
+	if err := r.reconcilePasswordSecret(ctx, &directory, configAgentTokenSecretName(&directory), configAgentTokenKey); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile config agent token secret: %w", err)
+	}
 
-			if err := controllerutil.SetControllerReference(&directory, &adminPasswordSecret, r.Scheme); err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to set owner reference on admin password secret: %w", err)
-			}
+	for _, database := range directory.Spec.Databases {
+		if database.RootPasswordSecretRef != nil {
+			continue
+		}
 
-			if err := r.Create(ctx, &adminPasswordSecret); err != nil {
-				return ctrl.Result{}, fmt.Errorf("failed to create admin password secret: %w", err)
-			}
-		} else {
-			return ctrl.Result{}, fmt.Errorf("failed to get admin password secret: %w", err)
+		if err := r.reconcilePasswordSecret(ctx, &directory, databasePasswordSecretName(&directory, &database), "password"); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to reconcile password secret of database %q: %w", database.Name, err)
 		}
 	}
 
@@ -193,6 +253,39 @@ func (r *LDAPDirectoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, fmt.Errorf("failed to generate statefulset template: %w", err)
 	}
 
+	resizing, err := r.reconcileVolumeExpansion(ctx, &directory, sts)
+	if err != nil {
+		r.Recorder.Eventf(&directory, corev1.EventTypeWarning,
+			"Failed", "Failed to reconcile statefulset: %s", err)
+
+		r.markFailed(ctx, &directory,
+			fmt.Errorf("failed to reconcile statefulset: %w", err))
+
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile statefulset: %w", err)
+	}
+
+	if resizing {
+		return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+	}
+
+	// Upgrades are deferred until the directory is resumed.
+	if !directory.Spec.Suspend {
+		upgrading, err := r.reconcileUpgrade(ctx, &directory, sts)
+		if err != nil {
+			r.Recorder.Eventf(&directory, corev1.EventTypeWarning,
+				"Failed", "Failed to upgrade directory: %s", err)
+
+			r.markFailed(ctx, &directory,
+				fmt.Errorf("failed to upgrade directory: %w", err))
+
+			return ctrl.Result{}, fmt.Errorf("failed to upgrade directory: %w", err)
+		}
+
+		if upgrading {
+			return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+		}
+	}
+
 	if _, err := updater.CreateOrUpdateFromTemplate(ctx, r.Client, sts); err != nil {
 		r.Recorder.Eventf(&directory, corev1.EventTypeWarning,
 			"Failed", "Failed to reconcile statefulset: %s", err)
@@ -226,6 +319,40 @@ func (r *LDAPDirectoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, fmt.Errorf("failed to reconcile service: %w", err)
 	}
 
+	logger.Info("Reconciling network policy")
+
+	if err := r.reconcileNetworkPolicy(ctx, &directory, sts); err != nil {
+		r.Recorder.Eventf(&directory, corev1.EventTypeWarning,
+			"Failed", "Failed to reconcile network policy: %s", err)
+
+		r.markFailed(ctx, &directory,
+			fmt.Errorf("failed to reconcile network policy: %w", err))
+
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile network policy: %w", err)
+	}
+
+	logger.Info("Reconciling load balancer")
+
+	if err := r.reconcileLoadBalancer(ctx, &directory, sts); err != nil {
+		r.Recorder.Eventf(&directory, corev1.EventTypeWarning,
+			"Failed", "Failed to reconcile load balancer: %s", err)
+
+		r.markFailed(ctx, &directory,
+			fmt.Errorf("failed to reconcile load balancer: %w", err))
+
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile load balancer: %w", err)
+	}
+
+	if directory.Spec.Suspend {
+		logger.Info("Directory is suspended")
+
+		return ctrl.Result{}, r.setSuspended(ctx, &directory, true)
+	}
+
+	if err := r.setSuspended(ctx, &directory, false); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	ready, err := r.isStatefulSetReady(ctx, &directory)
 	if err != nil {
 		r.Recorder.Eventf(&directory, corev1.EventTypeWarning,
@@ -250,6 +377,10 @@ func (r *LDAPDirectoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
 	}
 
+	if isMigrating(&directory) {
+		return r.reconcileMigration(ctx, &directory)
+	}
+
 	if directory.Status.Phase != ldapv1alpha1.LDAPDirectoryPhaseReady {
 		r.Recorder.Event(&directory, corev1.EventTypeNormal,
 			"Created", "Successfully created")
@@ -259,14 +390,179 @@ func (r *LDAPDirectoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		}
 	}
 
+	if err := r.reconcileOrganization(ctx, &directory); err != nil {
+		r.Recorder.Eventf(&directory, corev1.EventTypeWarning,
+			"Failed", "Failed to reconcile organization: %s", err)
+
+		if err := r.setCondition(ctx, &directory, metav1.Condition{
+			Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeOrganizationSynced),
+			Status:  metav1.ConditionFalse,
+			Reason:  "Failed",
+			Message: err.Error(),
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile organization: %w", err)
+	}
+
+	configSynced, err := r.reconcileConfig(ctx, &directory)
+	if err != nil {
+		r.Recorder.Eventf(&directory, corev1.EventTypeWarning,
+			"Failed", "Failed to reconcile config: %s", err)
+
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile config: %w", err)
+	}
+
+	// Cloned entries are imported before the bootstrap LDIF, so that it can
+	// build upon them.
+	if result, err := r.reconcileClone(ctx, &directory); err != nil || !result.IsZero() {
+		return result, err
+	}
+
+	result, err := r.reconcileBootstrap(ctx, &directory)
+	if err != nil {
+		return result, err
+	}
+
+	if !configSynced {
+		logger.Info("Waiting for config agent to apply config")
+
+		return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+	}
+
+	return result, nil
+}
+
+// reconcileOrganization applies the organization to the root entry of the directory.
+// The organization is not passed to the directory pods, so that changing it does not
+// require a restart. Bootstrap only ever creates the root entry with a placeholder.
+func (r *LDAPDirectoryReconciler) reconcileOrganization(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) error {
+	logger := zaplogr.FromContext(ctx)
+
+	synced := meta.FindStatusCondition(directory.Status.Conditions, string(ldapv1alpha1.LDAPDirectoryConditionTypeOrganizationSynced))
+	if synced != nil && synced.Status == metav1.ConditionTrue && synced.ObservedGeneration == directory.Generation {
+		return nil
+	}
+
+	logger.Info("Reconciling organization")
+
+	baseDN, err := directory.GetDistinguishedName(ctx, r.Client, r.Scheme)
+	if err != nil {
+		return fmt.Errorf("failed to get distinguished name: %w", err)
+	}
+
+	ldapClient, err := r.LDAPClientBuilder.WithDirectory(directory).Build(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create directory client: %w", err)
+	}
+
+	if _, err := ldapClient.CreateOrUpdateEntry(&ldap.Organization{
+		DistinguishedName: baseDN,
+		DomainComponent:   strings.Split(directory.Spec.Domain, ".")[0],
+		Name:              directory.Spec.Organization,
+	}); err != nil {
+		return err
+	}
+
+	return r.setCondition(ctx, directory, metav1.Condition{
+		Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeOrganizationSynced),
+		Status:  metav1.ConditionTrue,
+		Reason:  "Synced",
+		Message: "Root entry is up to date",
+	})
+}
+
+// reconcileExternal validates connectivity to an externally managed directory,
+// and periodically rechecks it (so that an outage is reflected in its status).
+func (r *LDAPDirectoryReconciler) reconcileExternal(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) (ctrl.Result, error) {
+	logger := zaplogr.FromContext(ctx)
+
+	logger.Info("Checking external directory connectivity")
+
+	ldapClient, err := r.LDAPClientBuilder.WithDirectory(directory).Build(ctx)
+	if err != nil {
+		r.Recorder.Eventf(directory, corev1.EventTypeWarning,
+			"Failed", "Failed to create directory client: %s", err)
+
+		r.markFailed(ctx, directory,
+			fmt.Errorf("failed to create directory client: %w", err))
+
+		return ctrl.Result{}, fmt.Errorf("failed to create directory client: %w", err)
+	}
+
+	if err := ldapClient.Ping(); err != nil {
+		r.Recorder.Eventf(directory, corev1.EventTypeWarning,
+			"Failed", "Failed to connect to external directory: %s", err)
+
+		r.markFailed(ctx, directory,
+			fmt.Errorf("failed to connect to external directory: %w", err))
+
+		return ctrl.Result{}, fmt.Errorf("failed to connect to external directory: %w", err)
+	}
+
+	if directory.Status.Phase != ldapv1alpha1.LDAPDirectoryPhaseReady {
+		r.Recorder.Event(directory, corev1.EventTypeNormal,
+			"Connected", "Successfully connected to external directory")
+
+		if err := r.markReady(ctx, directory); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if _, err := r.reconcileBootstrap(ctx, directory); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// External directories aren't watched, so their connectivity is polled.
+	return ctrl.Result{RequeueAfter: externalHealthCheckInterval}, nil
+}
+
+// reconcileBootstrap imports the bootstrap LDIF (if any) once the directory is ready.
+func (r *LDAPDirectoryReconciler) reconcileBootstrap(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) (ctrl.Result, error) {
+	logger := zaplogr.FromContext(ctx)
+
+	if directory.Spec.Bootstrap == nil || len(directory.Spec.Bootstrap.LDIF) == 0 ||
+		meta.IsStatusConditionTrue(directory.Status.Conditions, string(ldapv1alpha1.LDAPDirectoryConditionTypeLDIFImported)) {
+		return ctrl.Result{}, nil
+	}
+
+	logger.Info("Importing bootstrap LDIF")
+
+	if err := r.importBootstrapLDIF(ctx, directory); err != nil {
+		r.Recorder.Eventf(directory, corev1.EventTypeWarning,
+			"Failed", "Failed to import bootstrap ldif: %s", err)
+
+		if err := r.setCondition(ctx, directory, metav1.Condition{
+			Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeLDIFImported),
+			Status:  metav1.ConditionFalse,
+			Reason:  "Failed",
+			Message: err.Error(),
+		}); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, fmt.Errorf("failed to import bootstrap ldif: %w", err)
+	}
+
 	return ctrl.Result{}, nil
 }
 
 func (r *LDAPDirectoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := indexDirectoryObjects(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&ldapv1alpha1.LDAPDirectory{}).
 		Owns(&appsv1.StatefulSet{}).
+		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&batchv1.Job{}).
+		// Persistent volume claims are owned by the statefulset (if anything).
+		Watches(&corev1.PersistentVolumeClaim{}, handler.EnqueueRequestsFromMapFunc(persistentVolumeClaimToDirectory)).
 		Complete(r)
 }
 
@@ -339,16 +635,221 @@ func (r *LDAPDirectoryReconciler) markFailed(ctx context.Context, directory *lda
 	}
 }
 
+func (r *LDAPDirectoryReconciler) setCondition(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, condition metav1.Condition) error {
+	key := client.ObjectKeyFromObject(directory)
+	err := updater.UpdateStatus(ctx, r.Client, key, directory, func() error {
+		condition.ObservedGeneration = directory.ObjectMeta.Generation
+		meta.SetStatusCondition(&directory.Status.Conditions, condition)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set %s condition: %w", condition.Type, err)
+	}
+
+	return nil
+}
+
+// setPaused records whether reconciliation of the directory is paused, the
+// condition is only updated when it changes.
+func (r *LDAPDirectoryReconciler) setPaused(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, paused bool) error {
+	existing := meta.FindStatusCondition(directory.Status.Conditions, string(ldapv1alpha1.LDAPDirectoryConditionTypePaused))
+
+	if paused {
+		if existing != nil && existing.Status == metav1.ConditionTrue {
+			return nil
+		}
+
+		r.Recorder.Event(directory, corev1.EventTypeNormal,
+			"Paused", "Reconciliation is paused")
+
+		return r.setCondition(ctx, directory, metav1.Condition{
+			Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypePaused),
+			Status:  metav1.ConditionTrue,
+			Reason:  "Paused",
+			Message: "Reconciliation is paused",
+		})
+	}
+
+	if existing == nil || existing.Status == metav1.ConditionFalse {
+		return nil
+	}
+
+	r.Recorder.Event(directory, corev1.EventTypeNormal,
+		"Resumed", "Reconciliation has resumed")
+
+	return r.setCondition(ctx, directory, metav1.Condition{
+		Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypePaused),
+		Status:  metav1.ConditionFalse,
+		Reason:  "Resumed",
+		Message: "Reconciliation has resumed",
+	})
+}
+
+// setSuspended records whether the directory is suspended (scaled down to
+// zero replicas), the status is only updated when it changes.
+func (r *LDAPDirectoryReconciler) setSuspended(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, suspended bool) error {
+	existing := meta.FindStatusCondition(directory.Status.Conditions, string(ldapv1alpha1.LDAPDirectoryConditionTypeSuspended))
+
+	if suspended {
+		if existing != nil && existing.Status == metav1.ConditionTrue &&
+			directory.Status.Phase == ldapv1alpha1.LDAPDirectoryPhaseSuspended {
+			return nil
+		}
+
+		r.Recorder.Event(directory, corev1.EventTypeNormal,
+			"Suspended", "Directory has been scaled down")
+	} else {
+		if existing == nil || existing.Status == metav1.ConditionFalse {
+			return nil
+		}
+
+		r.Recorder.Event(directory, corev1.EventTypeNormal,
+			"Resumed", "Directory is being scaled up")
+	}
+
+	key := client.ObjectKeyFromObject(directory)
+	err := updater.UpdateStatus(ctx, r.Client, key, directory, func() error {
+		directory.Status.ObservedGeneration = directory.ObjectMeta.Generation
+
+		condition := metav1.Condition{
+			Type:               string(ldapv1alpha1.LDAPDirectoryConditionTypeSuspended),
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: directory.ObjectMeta.Generation,
+			Reason:             "Suspended",
+			Message:            "LDAP directory is suspended",
+		}
+
+		if suspended {
+			directory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseSuspended
+		} else {
+			directory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhasePending
+
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "Resumed"
+			condition.Message = "LDAP directory has been resumed"
+		}
+
+		meta.SetStatusCondition(&directory.Status.Conditions, condition)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set suspended: %w", err)
+	}
+
+	return nil
+}
+
+func (r *LDAPDirectoryReconciler) importBootstrapLDIF(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) error {
+	var records []ldif.Record
+	for _, source := range directory.Spec.Bootstrap.LDIF {
+		obj, ok, err := source.Resolve(ctx, r.Client, r.Scheme, directory)
+		if !ok && err == nil {
+			return fmt.Errorf("referenced ldif source not found")
+		} else if err != nil {
+			return fmt.Errorf("failed to resolve ldif source: %w", err)
+		}
+
+		contents, err := source.Data(obj)
+		if err != nil {
+			return err
+		}
+
+		for _, content := range contents {
+			sourceRecords, err := ldif.Parse(bytes.NewReader(content))
+			if err != nil {
+				return fmt.Errorf("failed to parse ldif: %w", err)
+			}
+
+			records = append(records, sourceRecords...)
+		}
+	}
+
+	ldapClient, err := r.LDAPClientBuilder.WithDirectory(directory).Build(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create directory client: %w", err)
+	}
+
+	applied, err := ldapClient.ApplyLDIF(records)
+	if err != nil {
+		return err
+	}
+
+	r.Recorder.Eventf(directory, corev1.EventTypeNormal,
+		"Imported", "Successfully imported %d bootstrap ldif records", applied)
+
+	return r.setCondition(ctx, directory, metav1.Condition{
+		Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeLDIFImported),
+		Status:  metav1.ConditionTrue,
+		Reason:  "Imported",
+		Message: fmt.Sprintf("Imported %d of %d ldif records", applied, len(records)),
+	})
+}
+
+// reconcilePasswordSecret creates a secret containing a random password (under
+// the given key), if it does not already exist.
+func (r *LDAPDirectoryReconciler) reconcilePasswordSecret(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, name, key string) error {
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: directory.Namespace,
+		},
+	}
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(&secret), &secret); err == nil {
+		// Never reuse a secret generated for something else.
+		if owner := metav1.GetControllerOf(&secret); owner != nil && owner.UID != directory.UID {
+			return fmt.Errorf("password secret %q is controlled by %s %q", name, owner.Kind, owner.Name)
+		}
+
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get password secret: %w", err)
+	}
+
+	pw, err := password.Generate(adminPasswordLength)
+	if err != nil {
+		return fmt.Errorf("failed to generate random password: %w", err)
+	}
+
+	secret.Data = map[string][]byte{
+		key: []byte(pw),
+	}
+
+	if err := controllerutil.SetControllerReference(directory, &secret, r.Scheme); err != nil {
+		return fmt.Errorf("failed to set owner reference on password secret: %w", err)
+	}
+
+	if err := r.Create(ctx, &secret); err != nil {
+		return fmt.Errorf("failed to create password secret: %w", err)
+	}
+
+	return nil
+}
+
+// databasePasswordSecretName returns the name of the secret containing the
+// root password of an additional database. Database names can't contain a
+// dot (and the service of a directory named with one can't be created), so
+// the name can't collide with the secrets of other directories.
+func databasePasswordSecretName(directory *ldapv1alpha1.LDAPDirectory, database *ldapv1alpha1.LDAPDirectoryDatabase) string {
+	if database.RootPasswordSecretRef != nil {
+		return database.RootPasswordSecretRef.Name
+	}
+
+	return fmt.Sprintf("ldap-%s.%s-admin-password", directory.Name, database.Name)
+}
+
 func (r *LDAPDirectoryReconciler) statefulSetTemplate(directory *ldapv1alpha1.LDAPDirectory) (*appsv1.StatefulSet, error) {
+	if directory.Spec.CertificateSecretRef == nil {
+		return nil, fmt.Errorf("certificate secret reference is required")
+	}
+
 	envVars := []corev1.EnvVar{
 		{
 			Name:  "LDAP_DOMAIN",
 			Value: directory.Spec.Domain,
 		},
-		{
-			Name:  "LDAP_ORGANIZATION",
-			Value: directory.Spec.Organization,
-		},
 		{
 			Name: "LDAP_ADMIN_PASSWORD",
 			ValueFrom: &corev1.EnvVarSource{
@@ -374,24 +875,48 @@ func (r *LDAPDirectoryReconciler) statefulSetTemplate(directory *ldapv1alpha1.LD
 			Value: strconv.Itoa(*directory.Spec.DebugLevel),
 		})
 	}
+	if directory.Spec.ChangeFeed != nil {
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "LDAP_ACCESSLOG_DIR",
+			Value: accessLogDir,
+		})
+	}
 
-	volumeClaimTemplates := defaultVolumeClaimTemplates()
+	if len(directory.Spec.Databases) > 0 {
+		var databases []bootstrap.Database
+		for _, database := range directory.Spec.Databases {
+			databases = append(databases, bootstrap.Database{
+				Name:         database.Name,
+				Suffix:       database.Suffix,
+				Organization: database.Organization,
+			})
 
-	for _, volumeClaimTemplate := range directory.Spec.VolumeClaimTemplates {
-		var found bool
-		for i, existingVolumeClaimTemplate := range volumeClaimTemplates {
-			if existingVolumeClaimTemplate.Name == volumeClaimTemplate.Name {
-				volumeClaimTemplates[i] = volumeClaimTemplate
-				found = true
-				break
-			}
+			envVars = append(envVars, corev1.EnvVar{
+				Name: bootstrap.DatabasePasswordEnv(database.Name),
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: databasePasswordSecretName(directory, &database),
+						},
+						Key: "password",
+					},
+				},
+			})
 		}
 
-		if !found {
-			volumeClaimTemplates = append(volumeClaimTemplates, volumeClaimTemplate)
+		databasesJSON, err := json.Marshal(databases)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal databases: %w", err)
 		}
+
+		envVars = append(envVars, corev1.EnvVar{
+			Name:  "LDAP_DATABASES",
+			Value: string(databasesJSON),
+		})
 	}
 
+	volumeClaimTemplates := directory.GetVolumeClaimTemplates()
+
 	volumeMounts := []corev1.VolumeMount{
 		{
 			Name:      "config",
@@ -454,9 +979,10 @@ func (r *LDAPDirectoryReconciler) statefulSetTemplate(directory *ldapv1alpha1.LD
 					InitContainers: []corev1.Container{
 						{
 							Name:  "openldap-init",
-							Image: directory.Spec.Image,
+							Image: directoryImage(directory),
 							Command: []string{
-								"/bootstrap.sh",
+								"ldap-operator",
+								"bootstrap",
 							},
 							Env:          envVars,
 							VolumeMounts: volumeMounts,
@@ -465,7 +991,7 @@ func (r *LDAPDirectoryReconciler) statefulSetTemplate(directory *ldapv1alpha1.LD
 					Containers: []corev1.Container{
 						{
 							Name:  "openldap",
-							Image: directory.Spec.Image,
+							Image: directoryImage(directory),
 							Env:   envVars,
 							Ports: []corev1.ContainerPort{
 								{
@@ -504,6 +1030,16 @@ func (r *LDAPDirectoryReconciler) statefulSetTemplate(directory *ldapv1alpha1.LD
 		},
 	}
 
+	if directory.Spec.Audit != nil {
+		addAuditSidecar(&sts.Spec.Template.Spec, directory)
+	}
+
+	if directory.Spec.Migration != nil && directory.Spec.Migration.Source.CASecretRef != nil {
+		addMigrationCAVolume(&sts.Spec.Template.Spec, directory)
+	}
+
+	addConfigAgentSidecar(&sts.Spec.Template.Spec, directory)
+
 	if err := controllerutil.SetOwnerReference(directory, &sts, r.Scheme); err != nil {
 		return nil, fmt.Errorf("failed to set owner reference: %w", err)
 	}
@@ -516,9 +1052,192 @@ func (r *LDAPDirectoryReconciler) statefulSetTemplate(directory *ldapv1alpha1.LD
 	sts.ObjectMeta.Labels["app.kubernetes.io/instance"] = directory.Name
 	sts.ObjectMeta.Labels["app.kubernetes.io/managed-by"] = "ldap-operator"
 
+	if directory.Spec.Suspend {
+		sts.Spec.Replicas = ptr.To(int32(0))
+	}
+
 	return &sts, nil
 }
 
+// addAuditSidecar enables the auditlog overlay and adds a sidecar container
+// that streams the audit log to stdout.
+func addAuditSidecar(podSpec *corev1.PodSpec, directory *ldapv1alpha1.LDAPDirectory) {
+	maxSize := int64(defaultAuditLogMaxSize)
+	if directory.Spec.Audit.MaxSize != nil {
+		maxSize = directory.Spec.Audit.MaxSize.Value()
+	}
+
+	auditVolumeMount := corev1.VolumeMount{
+		Name:      "audit",
+		MountPath: filepath.Dir(auditLogPath),
+	}
+
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "audit",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+
+	// The overlay is configured by the init container.
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].Env = append(podSpec.InitContainers[i].Env, corev1.EnvVar{
+			Name:  "LDAP_AUDIT_LOG_FILE",
+			Value: auditLogPath,
+		})
+		podSpec.InitContainers[i].VolumeMounts = append(podSpec.InitContainers[i].VolumeMounts, auditVolumeMount)
+	}
+
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, auditVolumeMount)
+	}
+
+	podSpec.Containers = append(podSpec.Containers, corev1.Container{
+		Name:  "audit",
+		Image: directoryImage(directory),
+		Command: []string{
+			"/usr/local/bin/ldap-operator",
+			"audit-tail",
+			"--file=" + auditLogPath,
+			"--max-size=" + strconv.FormatInt(maxSize, 10),
+		},
+		VolumeMounts: []corev1.VolumeMount{auditVolumeMount},
+		Resources:    directory.Spec.Audit.Resources,
+	})
+}
+
+// reconcileNetworkPolicy creates or updates the network policy of the
+// directory, or removes it if it is no longer required.
+func (r *LDAPDirectoryReconciler) reconcileNetworkPolicy(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, sts *appsv1.StatefulSet) error {
+	if directory.Spec.NetworkPolicy == nil {
+		networkPolicy := networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ldap-" + directory.Name,
+				Namespace: directory.Namespace,
+			},
+		}
+
+		if err := r.deleteControlledObject(ctx, directory, &networkPolicy); err != nil {
+			return fmt.Errorf("failed to delete network policy: %w", err)
+		}
+
+		return nil
+	}
+
+	networkPolicy, err := r.networkPolicyTemplate(directory, sts)
+	if err != nil {
+		return fmt.Errorf("failed to generate network policy template: %w", err)
+	}
+
+	if _, err := updater.CreateOrUpdateFromTemplate(ctx, r.Client, networkPolicy); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// deleteControlledObject deletes an object, if it exists and was created by
+// the directory (objects that happen to share its name are left alone).
+func (r *LDAPDirectoryReconciler) deleteControlledObject(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, obj client.Object) error {
+	if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if !metav1.IsControlledBy(obj, directory) {
+		return nil
+	}
+
+	// Guard against deleting a replacement created since it was read.
+	return client.IgnoreNotFound(r.Delete(ctx, obj, client.Preconditions{UID: ptr.To(obj.GetUID())}))
+}
+
+func (r *LDAPDirectoryReconciler) networkPolicyTemplate(directory *ldapv1alpha1.LDAPDirectory, sts *appsv1.StatefulSet) (*networkingv1.NetworkPolicy, error) {
+	// Admit every port exposed by the directory pods (eg. ldaps, and any
+	// sidecar ports), so that the policy does not need to track them.
+	var ports []networkingv1.NetworkPolicyPort
+	for _, container := range sts.Spec.Template.Spec.Containers {
+		for _, containerPort := range container.Ports {
+			ports = append(ports, networkingv1.NetworkPolicyPort{
+				Protocol: ptr.To(containerPort.Protocol),
+				Port:     ptr.To(intstr.FromInt(int(containerPort.ContainerPort))),
+			})
+		}
+	}
+
+	operatorPeer := networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"app.kubernetes.io/name": "ldap-operator",
+			},
+		},
+	}
+
+	if r.OperatorNamespace != "" {
+		operatorPeer.NamespaceSelector = &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"kubernetes.io/metadata.name": r.OperatorNamespace,
+			},
+		}
+	}
+
+	peers := append([]networkingv1.NetworkPolicyPeer{operatorPeer}, directory.Spec.NetworkPolicy.From...)
+
+	// The jobs of LDAPExports (to persistent volume claims).
+	peers = append(peers, networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"app.kubernetes.io/name":     "ldap-export",
+				"app.kubernetes.io/instance": directory.Name,
+			},
+		},
+	})
+
+	if directory.Spec.LoadBalancer != nil {
+		peers = append(peers, networkingv1.NetworkPolicyPeer{
+			PodSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"app.kubernetes.io/name":     "lloadd",
+					"app.kubernetes.io/instance": directory.Name,
+				},
+			},
+		})
+	}
+
+	networkPolicy := networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ldap-" + directory.Name,
+			Namespace: directory.Namespace,
+			Labels:    make(map[string]string),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: *sts.Spec.Selector,
+			PolicyTypes: []networkingv1.PolicyType{
+				networkingv1.PolicyTypeIngress,
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: ports,
+					From:  peers,
+				},
+			},
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(directory, &networkPolicy, r.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to set controller reference: %w", err)
+	}
+
+	for k, v := range directory.ObjectMeta.Labels {
+		networkPolicy.ObjectMeta.Labels[k] = v
+	}
+
+	networkPolicy.ObjectMeta.Labels["app.kubernetes.io/name"] = "directory"
+	networkPolicy.ObjectMeta.Labels["app.kubernetes.io/instance"] = directory.Name
+	networkPolicy.ObjectMeta.Labels["app.kubernetes.io/managed-by"] = "ldap-operator"
+
+	return &networkPolicy, nil
+}
+
 func (r *LDAPDirectoryReconciler) isStatefulSetReady(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) (bool, error) {
 	sts := appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
@@ -571,38 +1290,3 @@ func (r *LDAPDirectoryReconciler) serviceTemplate(directory *ldapv1alpha1.LDAPDi
 
 	return &svc, nil
 }
-
-func defaultVolumeClaimTemplates() []corev1.PersistentVolumeClaim {
-	return []corev1.PersistentVolumeClaim{
-		{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: "config",
-			},
-			Spec: corev1.PersistentVolumeClaimSpec{
-				AccessModes: []corev1.PersistentVolumeAccessMode{
-					corev1.ReadWriteOnce,
-				},
-				Resources: corev1.ResourceRequirements{
-					Requests: corev1.ResourceList{
-						corev1.ResourceStorage: resource.MustParse("10Mi"),
-					},
-				},
-			},
-		},
-		{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: "data",
-			},
-			Spec: corev1.PersistentVolumeClaimSpec{
-				AccessModes: []corev1.PersistentVolumeAccessMode{
-					corev1.ReadWriteOnce,
-				},
-				Resources: corev1.ResourceRequirements{
-					Requests: corev1.ResourceList{
-						corev1.ResourceStorage: resource.MustParse("100Mi"),
-					},
-				},
-			},
-		},
-	}
-}
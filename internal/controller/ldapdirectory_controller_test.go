@@ -19,25 +19,38 @@ package controller_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gpu-ninja/ldap-operator/api"
 	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/configagent"
 	"github.com/gpu-ninja/ldap-operator/internal/controller"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
 	fakeutils "github.com/gpu-ninja/operator-utils/fake"
 	"github.com/gpu-ninja/operator-utils/reference"
 	"github.com/gpu-ninja/operator-utils/zaplogr"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zaptest"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -56,6 +69,15 @@ func TestLDAPDirectoryReconciler(t *testing.T) {
 	err = appsv1.AddToScheme(scheme)
 	require.NoError(t, err)
 
+	err = networkingv1.AddToScheme(scheme)
+	require.NoError(t, err)
+
+	err = storagev1.AddToScheme(scheme)
+	require.NoError(t, err)
+
+	err = batchv1.AddToScheme(scheme)
+	require.NoError(t, err)
+
 	err = ldapv1alpha1.AddToScheme(scheme)
 	require.NoError(t, err)
 
@@ -68,7 +90,7 @@ func TestLDAPDirectoryReconciler(t *testing.T) {
 			Image:        "ghcr.io/gpu-ninja/ldap-operator/openldap:latest",
 			Domain:       "example.com",
 			Organization: "Acme Widgets Inc.",
-			CertificateSecretRef: reference.LocalSecretReference{
+			CertificateSecretRef: &reference.LocalSecretReference{
 				Name: "demo-tls",
 			},
 			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
@@ -161,6 +183,15 @@ func TestLDAPDirectoryReconciler(t *testing.T) {
 		assert.Equal(t, ldapv1alpha1.LDAPDirectoryPhasePending, updatedDirectory.Status.Phase)
 		assert.Len(t, updatedDirectory.Status.Conditions, 1)
 
+		var agentToken corev1.Secret
+		err = r.Client.Get(ctx, types.NamespacedName{
+			Name:      "ldap-" + directory.Name + "-agent-token",
+			Namespace: directory.Namespace,
+		}, &agentToken)
+		require.NoError(t, err)
+
+		assert.NotEmpty(t, agentToken.Data["token"])
+
 		var svc corev1.Service
 		err = r.Client.Get(ctx, types.NamespacedName{
 			Name:      "ldap-" + directory.Name,
@@ -177,13 +208,19 @@ func TestLDAPDirectoryReconciler(t *testing.T) {
 
 		sts.Status.ReadyReplicas = *sts.Spec.Replicas
 
+		// Multiple status updates are made from here on, so use the native
+		// status subresource support of the fake client.
 		r.Client = fake.NewClientBuilder().
 			WithScheme(scheme).
 			WithObjects(updatedDirectory, directoryCertificate, adminPassword, &sts).
 			WithStatusSubresource(updatedDirectory, &sts).
-			WithInterceptorFuncs(interceptorFuncs).
 			Build()
 
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("CreateOrUpdateEntry", mock.Anything).Return(false, nil)
+
 		resp, err = r.Reconcile(ctx, reconcile.Request{
 			NamespacedName: types.NamespacedName{
 				Name:      directory.Name,
@@ -197,28 +234,75 @@ func TestLDAPDirectoryReconciler(t *testing.T) {
 		event = <-eventRecorder.Events
 		assert.Equal(t, "Normal Created Successfully created", event)
 
-		updatedDirectory = directory.DeepCopy()
-		err = subResourceClient.Get(ctx, directory, updatedDirectory)
+		err = r.Client.Get(ctx, client.ObjectKeyFromObject(directory), updatedDirectory)
 		require.NoError(t, err)
 
 		assert.Equal(t, ldapv1alpha1.LDAPDirectoryPhaseReady, updatedDirectory.Status.Phase)
-		assert.Len(t, updatedDirectory.Status.Conditions, 2)
-	})
+		assert.Len(t, updatedDirectory.Status.Conditions, 3)
+		assert.True(t, meta.IsStatusConditionTrue(updatedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeOrganizationSynced)))
 
-	t.Run("Delete", func(t *testing.T) {
-		deletingDirectory := directory.DeepCopy()
-		deletingDirectory.DeletionTimestamp = &metav1.Time{Time: metav1.Now().Add(-1 * time.Second)}
-		deletingDirectory.Finalizers = []string{controller.FinalizerName}
+		m.AssertCalled(t, "CreateOrUpdateEntry", &ldap.Organization{
+			DistinguishedName: "dc=example,dc=com",
+			DomainComponent:   "example",
+			Name:              "Acme Widgets Inc.",
+		})
+	})
 
+	t.Run("Bootstrap LDIF", func(t *testing.T) {
 		eventRecorder := record.NewFakeRecorder(2)
 		r.Recorder = eventRecorder
 
+		subResourceClient.Reset()
+
+		bootstrapDirectory := directory.DeepCopy()
+		bootstrapDirectory.Spec.Bootstrap = &ldapv1alpha1.LDAPDirectoryBootstrap{
+			LDIF: []ldapv1alpha1.LDIFSource{
+				{
+					ConfigMapRef: &reference.LocalConfigMapReference{
+						Name: "skeleton",
+					},
+				},
+			},
+		}
+		bootstrapDirectory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseReady
+
+		skeleton := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "skeleton",
+				Namespace: "default",
+			},
+			Data: map[string]string{
+				"skeleton.ldif": "dn: ou=users,dc=example,dc=com\nobjectClass: organizationalUnit\nou: users\n",
+			},
+		}
+
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ldap-" + directory.Name,
+				Namespace: directory.Namespace,
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: ptr.To(int32(1)),
+			},
+			Status: appsv1.StatefulSetStatus{
+				ReadyReplicas: 1,
+			},
+		}
+
 		r.Client = fake.NewClientBuilder().
 			WithScheme(scheme).
-			WithObjects(deletingDirectory, directoryCertificate, adminPassword).
-			WithStatusSubresource(deletingDirectory).
+			WithObjects(bootstrapDirectory, directoryCertificate, adminPassword, skeleton, sts).
+			WithStatusSubresource(bootstrapDirectory, sts).
+			WithInterceptorFuncs(interceptorFuncs).
 			Build()
 
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("CreateOrUpdateEntry", mock.Anything).Return(false, nil)
+		m.On("ApplyLDIF", mock.Anything).Return(1, nil)
+
 		resp, err := r.Reconcile(ctx, reconcile.Request{
 			NamespacedName: types.NamespacedName{
 				Name:      directory.Name,
@@ -228,81 +312,1870 @@ func TestLDAPDirectoryReconciler(t *testing.T) {
 		require.NoError(t, err)
 		assert.Zero(t, resp)
 
-		assert.Len(t, eventRecorder.Events, 0)
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Equal(t, "Normal Imported Successfully imported 1 bootstrap ldif records", event)
+
+		m.AssertCalled(t, "ApplyLDIF", mock.MatchedBy(func(records []ldif.Record) bool {
+			return len(records) == 1 && records[0].DN == "ou=users,dc=example,dc=com"
+		}))
+
+		updatedDirectory := bootstrapDirectory.DeepCopy()
+		err = subResourceClient.Get(ctx, bootstrapDirectory, updatedDirectory)
+		require.NoError(t, err)
+
+		assert.True(t, meta.IsStatusConditionTrue(updatedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeLDIFImported)))
 	})
 
-	t.Run("References Not Resolvable", func(t *testing.T) {
+	directoryPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ldap-" + directory.Name + "-0",
+			Namespace: directory.Namespace,
+		},
+		Status: corev1.PodStatus{
+			PodIP: "10.0.0.1",
+		},
+	}
+
+	t.Run("Log Level", func(t *testing.T) {
 		eventRecorder := record.NewFakeRecorder(2)
 		r.Recorder = eventRecorder
 
-		subResourceClient.Reset()
+		logLevelDirectory := directory.DeepCopy()
+		logLevelDirectory.Generation = 1
+		logLevelDirectory.Spec.LogLevel = []ldapv1alpha1.LogLevel{"stats", "acl"}
+		logLevelDirectory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseReady
+
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ldap-" + directory.Name,
+				Namespace: directory.Namespace,
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: ptr.To(int32(1)),
+			},
+			Status: appsv1.StatefulSetStatus{
+				ReadyReplicas: 1,
+			},
+		}
 
 		r.Client = fake.NewClientBuilder().
 			WithScheme(scheme).
-			WithObjects(directory). // note the missing secrets
-			WithStatusSubresource(directory).
-			WithInterceptorFuncs(interceptorFuncs).
+			WithObjects(logLevelDirectory, directoryCertificate, adminPassword, sts, directoryPod).
+			WithStatusSubresource(logLevelDirectory, sts).
 			Build()
 
-		resp, err := r.Reconcile(ctx, reconcile.Request{
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+		r.ConfigAgentClient = configagent.NewFakeClient(&m)
+
+		m.On("CreateOrUpdateEntry", mock.Anything).Return(false, nil)
+		m.On("GetStatus", "10.0.0.1:8082").Return(&configagent.Status{}, nil).Once()
+
+		req := reconcile.Request{
 			NamespacedName: types.NamespacedName{
 				Name:      directory.Name,
 				Namespace: directory.Namespace,
 			},
-		})
+		}
+
+		resp, err := r.Reconcile(ctx, req)
 		require.NoError(t, err)
 		assert.NotZero(t, resp.RequeueAfter)
 
-		require.Len(t, eventRecorder.Events, 1)
-		event := <-eventRecorder.Events
-		assert.Equal(t, "Warning NotReady Not all references are resolvable", event)
+		config := renderedConfig(t, r.Client, logLevelDirectory)
 
-		updatedDirectory := directory.DeepCopy()
-		err = subResourceClient.Get(ctx, directory, updatedDirectory)
+		records, err := ldif.Parse(strings.NewReader(config.Settings))
 		require.NoError(t, err)
 
-		assert.Equal(t, ldapv1alpha1.LDAPDirectoryPhasePending, updatedDirectory.Status.Phase)
-		assert.Len(t, updatedDirectory.Status.Conditions, 1)
+		require.Len(t, records, 1)
+		assert.Equal(t, "cn=config", records[0].DN)
+		assert.Equal(t, ldif.ChangeTypeModify, records[0].ChangeType)
+		require.Len(t, records[0].Modifications, 1)
+		assert.Equal(t, "olcLogLevel", records[0].Modifications[0].Name)
+		assert.Equal(t, []string{"stats", "acl"}, records[0].Modifications[0].Values)
+
+		var updatedDirectory ldapv1alpha1.LDAPDirectory
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedDirectory)
+		require.NoError(t, err)
+
+		assert.True(t, meta.IsStatusConditionFalse(updatedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeConfigSynced)))
+
+		// Once the config agent has applied the config, the directory is synced.
+		m.On("GetStatus", "10.0.0.1:8082").Return(&configagent.Status{
+			Generation: config.Generation,
+		}, nil)
+
+		resp, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedDirectory)
+		require.NoError(t, err)
+
+		assert.True(t, meta.IsStatusConditionTrue(updatedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeConfigSynced)))
 	})
 
-	t.Run("Failure", func(t *testing.T) {
-		eventRecorder := record.NewFakeRecorder(2)
+	t.Run("Config Patches", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(10)
 		r.Recorder = eventRecorder
 
-		failOnStatefulSets := interceptorFuncs
-		failOnStatefulSets.Get = func(ctx context.Context, client client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
-			if _, ok := obj.(*appsv1.StatefulSet); ok {
-				return fmt.Errorf("bang")
-			}
+		patchedDirectory := directory.DeepCopy()
+		patchedDirectory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseReady
+		patchedDirectory.Spec.ConfigPatches = []ldapv1alpha1.LDAPDirectoryConfigPatch{
+			{
+				Name: "size-limit",
+				LDIF: "dn: olcDatabase={1}mdb,cn=config\nchangetype: modify\nreplace: olcSizeLimit\nolcSizeLimit: 1000\n",
+			},
+			{
+				Name: "idle-timeout",
+				LDIFSource: ldapv1alpha1.LDIFSource{
+					ConfigMapRef: &reference.LocalConfigMapReference{
+						Name: "idle-timeout",
+					},
+				},
+			},
+		}
 
-			return client.Get(ctx, key, obj, opts...)
+		idleTimeout := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "idle-timeout",
+				Namespace: directory.Namespace,
+			},
+			Data: map[string]string{
+				"patch.ldif": "dn: cn=config\nchangetype: modify\nreplace: olcIdleTimeout\nolcIdleTimeout: 60\n",
+			},
 		}
 
-		subResourceClient.Reset()
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ldap-" + directory.Name,
+				Namespace: directory.Namespace,
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: ptr.To(int32(1)),
+			},
+			Status: appsv1.StatefulSetStatus{
+				ReadyReplicas: 1,
+			},
+		}
 
 		r.Client = fake.NewClientBuilder().
 			WithScheme(scheme).
-			WithObjects(directory, directoryCertificate, adminPassword).
-			WithStatusSubresource(directory).
-			WithInterceptorFuncs(failOnStatefulSets).
+			WithObjects(patchedDirectory, directoryCertificate, adminPassword, idleTimeout, sts, directoryPod).
+			WithStatusSubresource(patchedDirectory, sts).
 			Build()
 
-		_, err := r.Reconcile(ctx, reconcile.Request{
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+		r.ConfigAgentClient = configagent.NewFakeClient(&m)
+
+		// The fake config agent applies whatever config was last rendered.
+		var agentStatus configagent.Status
+		m.On("CreateOrUpdateEntry", mock.Anything).Return(false, nil)
+		m.On("GetStatus", "10.0.0.1:8082").Return(&agentStatus, nil)
+
+		req := reconcile.Request{
 			NamespacedName: types.NamespacedName{
 				Name:      directory.Name,
 				Namespace: directory.Namespace,
 			},
-		})
+		}
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.NotZero(t, resp.RequeueAfter)
+
+		config := renderedConfig(t, r.Client, patchedDirectory)
+		require.Len(t, config.Patches, 2)
+		assert.Equal(t, "size-limit", config.Patches[0].Name)
+		assert.Equal(t, patchedDirectory.Spec.ConfigPatches[0].LDIF, config.Patches[0].LDIF)
+		assert.Equal(t, "idle-timeout", config.Patches[1].Name)
+		assert.Equal(t, idleTimeout.Data["patch.ldif"], config.Patches[1].LDIF)
+
+		err = r.Client.Get(ctx, req.NamespacedName, patchedDirectory)
+		require.NoError(t, err)
+
+		require.Len(t, patchedDirectory.Status.ConfigPatches, 2)
+		for _, status := range patchedDirectory.Status.ConfigPatches {
+			assert.False(t, status.Applied)
+		}
+
+		assert.True(t, meta.IsStatusConditionFalse(patchedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeConfigPatched)))
+
+		agentStatus = appliedConfig(config)
+
+		resp, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		err = r.Client.Get(ctx, req.NamespacedName, patchedDirectory)
+		require.NoError(t, err)
+
+		require.Len(t, patchedDirectory.Status.ConfigPatches, 2)
+		for _, status := range patchedDirectory.Status.ConfigPatches {
+			assert.True(t, status.Applied)
+			assert.NotEmpty(t, status.Hash)
+		}
+
+		assert.True(t, meta.IsStatusConditionTrue(patchedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeConfigPatched)))
+
+		// Changing the content of a patch should wait for the agent to reapply it.
+		idleTimeout.Data["patch.ldif"] = "dn: cn=config\nchangetype: modify\nreplace: olcIdleTimeout\nolcIdleTimeout: 120\n"
+		err = r.Client.Update(ctx, idleTimeout)
+		require.NoError(t, err)
+
+		resp, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.NotZero(t, resp.RequeueAfter)
+
+		err = r.Client.Get(ctx, req.NamespacedName, patchedDirectory)
+		require.NoError(t, err)
+
+		require.Len(t, patchedDirectory.Status.ConfigPatches, 2)
+		assert.True(t, patchedDirectory.Status.ConfigPatches[0].Applied)
+		assert.False(t, patchedDirectory.Status.ConfigPatches[1].Applied)
+
+		config = renderedConfig(t, r.Client, patchedDirectory)
+		assert.Equal(t, idleTimeout.Data["patch.ldif"], config.Patches[1].LDIF)
+
+		agentStatus = appliedConfig(config)
+
+		resp, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		// Patches outside of cn=config should be rejected.
+		err = r.Client.Get(ctx, req.NamespacedName, patchedDirectory)
+		require.NoError(t, err)
+
+		patchedDirectory.Spec.ConfigPatches[0].LDIF = "dn: dc=example,dc=com\nchangetype: modify\nreplace: o\no: Evil Corp\n"
+		err = r.Client.Update(ctx, patchedDirectory)
+		require.NoError(t, err)
+
+		_, err = r.Reconcile(ctx, req)
 		require.Error(t, err)
 
-		require.Len(t, eventRecorder.Events, 1)
-		event := <-eventRecorder.Events
-		assert.Equal(t, "Warning Failed Failed to reconcile statefulset: failed to get object: bang", event)
+		config = renderedConfig(t, r.Client, patchedDirectory)
+		assert.Empty(t, config.Patches)
 
-		updatedDirectory := directory.DeepCopy()
-		err = subResourceClient.Get(ctx, directory, updatedDirectory)
+		err = r.Client.Get(ctx, req.NamespacedName, patchedDirectory)
 		require.NoError(t, err)
 
-		assert.Equal(t, ldapv1alpha1.LDAPDirectoryPhaseFailed, updatedDirectory.Status.Phase)
+		require.Len(t, patchedDirectory.Status.ConfigPatches, 2)
+		assert.False(t, patchedDirectory.Status.ConfigPatches[0].Applied)
+		assert.Contains(t, patchedDirectory.Status.ConfigPatches[0].Message, "not within cn=config")
+		assert.True(t, patchedDirectory.Status.ConfigPatches[1].Applied)
+
+		assert.True(t, meta.IsStatusConditionFalse(patchedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeConfigPatched)))
+	})
+
+	t.Run("Migration", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(10)
+		r.Recorder = eventRecorder
+
+		migratingDirectory := directory.DeepCopy()
+		migratingDirectory.Generation = 1
+		migratingDirectory.Spec.Migration = &ldapv1alpha1.LDAPDirectoryMigration{
+			Source: ldapv1alpha1.LDAPDirectoryMigrationSource{
+				URL:    "ldaps://legacy.example.com",
+				BindDN: "cn=replicator,dc=example,dc=com",
+				BindPasswordSecretRef: reference.LocalSecretReference{
+					Name: "legacy-password",
+				},
+			},
+		}
+
+		legacyPassword := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "legacy-password",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				"password": []byte(`pass"word`),
+			},
+		}
+
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ldap-" + directory.Name,
+				Namespace: directory.Namespace,
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: ptr.To(int32(1)),
+			},
+			Status: appsv1.StatefulSetStatus{
+				ReadyReplicas: 1,
+			},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(migratingDirectory, directoryCertificate, adminPassword, legacyPassword, sts, directoryPod).
+			WithStatusSubresource(migratingDirectory, sts).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+		r.ConfigAgentClient = configagent.NewFakeClient(&m)
+
+		m.On("GetStatus", "10.0.0.1:8082").Return(&configagent.Status{}, nil).Once()
+		m.On("GetSyncState", "dc=example,dc=com").Return(&ldap.SyncState{
+			ContextCSNs: []string{"20231018120010.000000Z#000000#000#000000"},
+			Entries:     10,
+		}, nil).Once()
+		m.On("GetSyncState", "dc=example,dc=com").Return(&ldap.SyncState{
+			ContextCSNs: []string{"20231018120000.000000Z#000000#000#000000"},
+			Entries:     8,
+		}, nil).Once()
+
+		req := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		}
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, 30*time.Second, resp.RequeueAfter)
+
+		// The root entry is replicated from the source.
+		m.AssertNotCalled(t, "CreateOrUpdateEntry", mock.Anything)
+
+		config := renderedConfig(t, r.Client, migratingDirectory)
+
+		records, err := ldif.Parse(strings.NewReader(config.Settings))
+		require.NoError(t, err)
+
+		require.Len(t, records, 1)
+		assert.Equal(t, "olcDatabase={1}mdb,cn=config", records[0].DN)
+		require.Len(t, records[0].Modifications, 2)
+		assert.Equal(t, []string{"{0}rid=001 provider=ldaps://legacy.example.com bindmethod=simple " +
+			`binddn="cn=replicator,dc=example,dc=com" credentials="pass\"word" searchbase="dc=example,dc=com" ` +
+			`type=refreshAndPersist retry="30 +" timeout=10 schemachecking=off tls_reqcert=demand`},
+			records[0].Modifications[0].Values)
+		assert.Equal(t, []string{"ldaps://legacy.example.com"}, records[0].Modifications[1].Values)
+
+		var updatedDirectory ldapv1alpha1.LDAPDirectory
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryPhaseMigrating, updatedDirectory.Status.Phase)
+		require.NotNil(t, updatedDirectory.Status.Migration)
+		assert.Equal(t, ptr.To(10), updatedDirectory.Status.Migration.SourceEntries)
+		assert.Equal(t, ptr.To(8), updatedDirectory.Status.Migration.Entries)
+		require.NotNil(t, updatedDirectory.Status.Migration.Lag)
+		assert.Equal(t, 10*time.Second, updatedDirectory.Status.Migration.Lag.Duration)
+
+		migrated := meta.FindStatusCondition(updatedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeMigrated))
+		require.NotNil(t, migrated)
+		assert.Equal(t, metav1.ConditionFalse, migrated.Status)
+		assert.Equal(t, "Replicated 8 of 10 entries (lag 10s)", migrated.Message)
+
+		// Cut over the migration.
+		updatedDirectory.Generation = 2
+		updatedDirectory.Spec.Migration.Cutover = true
+		err = r.Client.Update(ctx, &updatedDirectory)
+		require.NoError(t, err)
+
+		m.On("GetStatus", "10.0.0.1:8082").Return(&configagent.Status{
+			Generation: 2,
+		}, nil)
+
+		resp, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.True(t, resp.Requeue)
+
+		config = renderedConfig(t, r.Client, migratingDirectory)
+
+		records, err = ldif.Parse(strings.NewReader(config.Settings))
+		require.NoError(t, err)
+
+		require.Len(t, records, 1)
+		require.Len(t, records[0].Modifications, 2)
+		assert.Empty(t, records[0].Modifications[0].Values)
+		assert.Empty(t, records[0].Modifications[1].Values)
+
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedDirectory)
+		require.NoError(t, err)
+
+		assert.True(t, meta.IsStatusConditionTrue(updatedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeMigrated)))
+		assert.NotNil(t, updatedDirectory.Status.Migration.CutoverTime)
+
+		// Once cut over, the directory is reconciled as normal.
+		m.On("CreateOrUpdateEntry", mock.Anything).Return(false, nil)
+
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryPhaseReady, updatedDirectory.Status.Phase)
 	})
+
+	t.Run("Clone", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(10)
+		r.Recorder = eventRecorder
+
+		sourceDirectory := directory.DeepCopy()
+		sourceDirectory.Namespace = "production"
+		sourceDirectory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseReady
+		sourceDirectory.Annotations = map[string]string{
+			ldapv1alpha1.CloneNamespacesAnnotation: "staging, " + directory.Namespace,
+		}
+
+		sourceCertificate := directoryCertificate.DeepCopy()
+		sourceCertificate.Namespace = "production"
+
+		sourceAgentToken := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ldap-" + directory.Name + "-agent-token",
+				Namespace: "production",
+			},
+			Data: map[string][]byte{
+				"token": []byte("production"),
+			},
+		}
+
+		sourcePod := directoryPod.DeepCopy()
+		sourcePod.Namespace = "production"
+		sourcePod.Status.PodIP = "10.0.0.2"
+
+		clonedDirectory := directory.DeepCopy()
+		clonedDirectory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseReady
+		clonedDirectory.Spec.CloneFrom = &ldapv1alpha1.LDAPDirectoryClone{
+			DirectoryRef: ldapv1alpha1.LDAPDirectoryCloneReference{
+				Name:      directory.Name,
+				Namespace: "production",
+			},
+			Scrub: []ldapv1alpha1.LDAPDirectoryScrubRule{
+				{Attribute: "userPassword"},
+				{Attribute: "mail", Value: ptr.To("$(uid)@staging.example.com")},
+			},
+		}
+
+		sts := &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ldap-" + directory.Name,
+				Namespace: directory.Namespace,
+			},
+			Spec: appsv1.StatefulSetSpec{
+				Replicas: ptr.To(int32(1)),
+			},
+			Status: appsv1.StatefulSetStatus{
+				ReadyReplicas: 1,
+			},
+		}
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+		r.ConfigAgentClient = configagent.NewFakeClient(&m)
+
+		m.On("CreateOrUpdateEntry", mock.Anything).Return(false, nil)
+		m.On("Export", "10.0.0.2:8082", "production").Return([]ldif.Record{
+			{
+				DN:         "uid=demo,ou=users,dc=example,dc=com",
+				ChangeType: ldif.ChangeTypeAdd,
+				Attributes: []ldif.Attribute{
+					{Name: "objectClass", Values: []string{"inetOrgPerson"}},
+					{Name: "uid", Values: []string{"demo"}},
+					{Name: "mail", Values: []string{"demo@example.com", "demo@example.org"}},
+					{Name: "userPassword", Values: []string{"{SSHA}secret"}},
+					{Name: "entryUUID", Values: []string{"0b8e4e0c-1d52-103e-8d0c-6b1e0d6a1f0e"}},
+				},
+			},
+			{
+				DN:         "ou=users,dc=example,dc=com",
+				ChangeType: ldif.ChangeTypeAdd,
+				Attributes: []ldif.Attribute{
+					{Name: "objectClass", Values: []string{"organizationalUnit"}},
+					{Name: "ou", Values: []string{"users"}},
+				},
+			},
+		}, nil)
+		m.On("ApplyLDIF", mock.Anything).Return(2, nil)
+
+		req := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		}
+
+		// The source directory must allow clones from other namespaces.
+		unsharedSourceDirectory := sourceDirectory.DeepCopy()
+		unsharedSourceDirectory.Annotations = nil
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(clonedDirectory, directoryCertificate, adminPassword, sts, directoryPod,
+				unsharedSourceDirectory, sourceCertificate, sourceAgentToken, sourcePod).
+			WithStatusSubresource(clonedDirectory, unsharedSourceDirectory, sts).
+			Build()
+
+		_, err := r.Reconcile(ctx, req)
+		assert.ErrorContains(t, err, "source directory does not allow clones from namespace")
+
+		m.AssertNotCalled(t, "Export", mock.Anything, mock.Anything)
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(clonedDirectory, directoryCertificate, adminPassword, sts, directoryPod,
+				sourceDirectory, sourceCertificate, sourceAgentToken, sourcePod).
+			WithStatusSubresource(clonedDirectory, sourceDirectory, sts).
+			Build()
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		m.AssertCalled(t, "ApplyLDIF", []ldif.Record{
+			{
+				DN:         "ou=users,dc=example,dc=com",
+				ChangeType: ldif.ChangeTypeAdd,
+				Attributes: []ldif.Attribute{
+					{Name: "objectClass", Values: []string{"organizationalUnit"}},
+					{Name: "ou", Values: []string{"users"}},
+				},
+			},
+			{
+				DN:         "uid=demo,ou=users,dc=example,dc=com",
+				ChangeType: ldif.ChangeTypeAdd,
+				Attributes: []ldif.Attribute{
+					{Name: "objectClass", Values: []string{"inetOrgPerson"}},
+					{Name: "uid", Values: []string{"demo"}},
+					{Name: "mail", Values: []string{"demo@staging.example.com"}},
+				},
+			},
+		})
+
+		var updatedDirectory ldapv1alpha1.LDAPDirectory
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedDirectory)
+		require.NoError(t, err)
+
+		cloned := meta.FindStatusCondition(updatedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeCloned))
+		require.NotNil(t, cloned)
+		assert.Equal(t, metav1.ConditionTrue, cloned.Status)
+		assert.Equal(t, "Imported 2 of 2 entries from production/test", cloned.Message)
+
+		// The directory is only cloned once.
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		m.AssertNumberOfCalls(t, "Export", 1)
+	})
+
+	t.Run("Audit", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		auditDirectory := directory.DeepCopy()
+		auditDirectory.Spec.Audit = &ldapv1alpha1.LDAPDirectoryAudit{
+			MaxSize: ptr.To(resource.MustParse("1Mi")),
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(auditDirectory, directoryCertificate, adminPassword).
+			WithStatusSubresource(auditDirectory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		_, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		})
+		require.NoError(t, err)
+
+		var sts appsv1.StatefulSet
+		err = r.Client.Get(ctx, types.NamespacedName{
+			Name:      "ldap-" + directory.Name,
+			Namespace: directory.Namespace,
+		}, &sts)
+		require.NoError(t, err)
+
+		podSpec := sts.Spec.Template.Spec
+		require.Len(t, podSpec.Containers, 3)
+
+		sidecar := podSpec.Containers[1]
+		assert.Equal(t, "audit", sidecar.Name)
+		assert.Equal(t, directory.Spec.Image, sidecar.Image)
+		assert.Contains(t, sidecar.Command, "audit-tail")
+		assert.Contains(t, sidecar.Command, "--max-size=1048576")
+
+		assert.Contains(t, podSpec.InitContainers[0].Env, corev1.EnvVar{
+			Name:  "LDAP_AUDIT_LOG_FILE",
+			Value: "/var/log/ldap/audit.ldif",
+		})
+	})
+
+	t.Run("Databases", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		databasesDirectory := directory.DeepCopy()
+		databasesDirectory.Spec.Databases = []ldapv1alpha1.LDAPDirectoryDatabase{
+			{Name: "partners", Suffix: "dc=partners", Organization: "Partners"},
+			{Name: "corp", Suffix: "dc=corp", RootPasswordSecretRef: &reference.LocalSecretReference{
+				Name: adminPassword.Name,
+			}},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(databasesDirectory, directoryCertificate, adminPassword).
+			WithStatusSubresource(databasesDirectory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		_, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		})
+		require.NoError(t, err)
+
+		var databasePassword corev1.Secret
+		err = r.Client.Get(ctx, types.NamespacedName{
+			Name:      "ldap-" + directory.Name + ".partners-admin-password",
+			Namespace: directory.Namespace,
+		}, &databasePassword)
+		require.NoError(t, err)
+
+		assert.NotEmpty(t, databasePassword.Data["password"])
+
+		var sts appsv1.StatefulSet
+		err = r.Client.Get(ctx, types.NamespacedName{
+			Name:      "ldap-" + directory.Name,
+			Namespace: directory.Namespace,
+		}, &sts)
+		require.NoError(t, err)
+
+		env := sts.Spec.Template.Spec.InitContainers[0].Env
+
+		assert.Contains(t, env, corev1.EnvVar{
+			Name:  "LDAP_DATABASES",
+			Value: `[{"name":"partners","suffix":"dc=partners","organization":"Partners"},{"name":"corp","suffix":"dc=corp"}]`,
+		})
+
+		assert.Contains(t, env, corev1.EnvVar{
+			Name: "LDAP_DATABASE_PARTNERS_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: databasePassword.Name,
+					},
+					Key: "password",
+				},
+			},
+		})
+
+		assert.Contains(t, env, corev1.EnvVar{
+			Name: "LDAP_DATABASE_CORP_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: adminPassword.Name,
+					},
+					Key: "password",
+				},
+			},
+		})
+
+		// A secret generated for something else must never be reused.
+		foreignPassword := databasePassword.DeepCopy()
+		foreignPassword.ResourceVersion = ""
+		foreignPassword.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "ldap.gpu-ninja.com/v1alpha1",
+			Kind:       "LDAPDirectory",
+			Name:       "other",
+			UID:        "other-uid",
+			Controller: ptr.To(true),
+		}}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(databasesDirectory, directoryCertificate, adminPassword, foreignPassword).
+			WithStatusSubresource(databasesDirectory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		_, err = r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		})
+		assert.ErrorContains(t, err, "is controlled by LDAPDirectory \"other\"")
+	})
+
+	t.Run("Network Policy", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(3)
+		r.Recorder = eventRecorder
+		r.OperatorNamespace = "ldap-operator"
+		t.Cleanup(func() { r.OperatorNamespace = "" })
+
+		subResourceClient.Reset()
+
+		allowedPeer := networkingv1.NetworkPolicyPeer{
+			IPBlock: &networkingv1.IPBlock{
+				CIDR: "10.0.0.0/8",
+			},
+		}
+
+		restrictedDirectory := directory.DeepCopy()
+		restrictedDirectory.Spec.NetworkPolicy = &ldapv1alpha1.LDAPDirectoryNetworkPolicy{
+			From: []networkingv1.NetworkPolicyPeer{allowedPeer},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(restrictedDirectory, directoryCertificate, adminPassword).
+			WithStatusSubresource(restrictedDirectory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		_, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		})
+		require.NoError(t, err)
+
+		var networkPolicy networkingv1.NetworkPolicy
+		err = r.Client.Get(ctx, types.NamespacedName{
+			Name:      "ldap-" + directory.Name,
+			Namespace: directory.Namespace,
+		}, &networkPolicy)
+		require.NoError(t, err)
+
+		assert.Equal(t, "ldap", networkPolicy.Spec.PodSelector.MatchLabels["app.kubernetes.io/name"])
+		require.Len(t, networkPolicy.Spec.Ingress, 1)
+
+		ingress := networkPolicy.Spec.Ingress[0]
+		require.Len(t, ingress.Ports, 2)
+		assert.Equal(t, 636, ingress.Ports[0].Port.IntValue())
+		assert.Equal(t, 8082, ingress.Ports[1].Port.IntValue())
+
+		require.Len(t, ingress.From, 3)
+		assert.Equal(t, "ldap-operator", ingress.From[0].NamespaceSelector.MatchLabels["kubernetes.io/metadata.name"])
+		assert.Equal(t, allowedPeer, ingress.From[1])
+		assert.Equal(t, "ldap-export", ingress.From[2].PodSelector.MatchLabels["app.kubernetes.io/name"])
+
+		// Removing the network policy from the spec should delete it.
+		err = r.Client.Get(ctx, client.ObjectKeyFromObject(restrictedDirectory), restrictedDirectory)
+		require.NoError(t, err)
+
+		restrictedDirectory.Spec.NetworkPolicy = nil
+		err = r.Client.Update(ctx, restrictedDirectory)
+		require.NoError(t, err)
+
+		_, err = r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		})
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, client.ObjectKeyFromObject(&networkPolicy), &networkPolicy)
+		assert.True(t, apierrors.IsNotFound(err))
+
+		// Network policies that weren't created by the directory are left alone.
+		unownedNetworkPolicy := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ldap-" + directory.Name,
+				Namespace: directory.Namespace,
+			},
+		}
+
+		err = r.Client.Create(ctx, unownedNetworkPolicy)
+		require.NoError(t, err)
+
+		_, err = r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		})
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, client.ObjectKeyFromObject(unownedNetworkPolicy), unownedNetworkPolicy)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Load Balancer", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		balancedDirectory := directory.DeepCopy()
+		balancedDirectory.Spec.LoadBalancer = &ldapv1alpha1.LDAPDirectoryLoadBalancer{
+			Replicas: ptr.To(int32(3)),
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(balancedDirectory, directoryCertificate, adminPassword).
+			WithStatusSubresource(balancedDirectory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		_, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		})
+		require.NoError(t, err)
+
+		loadBalancerKey := types.NamespacedName{
+			Name:      "ldap-" + directory.Name + "-lloadd",
+			Namespace: directory.Namespace,
+		}
+
+		var cm corev1.ConfigMap
+		err = r.Client.Get(ctx, loadBalancerKey, &cm)
+		require.NoError(t, err)
+
+		assert.Contains(t, cm.Data["lloadd.conf"], "backend-server uri=ldaps://ldap-test-0.ldap.default.svc.cluster.local:636")
+		assert.Contains(t, cm.Data["lloadd.conf"], `binddn="cn=admin,dc=example,dc=com"`)
+
+		var deployment appsv1.Deployment
+		err = r.Client.Get(ctx, loadBalancerKey, &deployment)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(3), *deployment.Spec.Replicas)
+		assert.NotEmpty(t, deployment.Spec.Template.Annotations["ldap.gpu-ninja.com/config-hash"])
+
+		var svc corev1.Service
+		err = r.Client.Get(ctx, loadBalancerKey, &svc)
+		require.NoError(t, err)
+
+		var governingSvc corev1.Service
+		err = r.Client.Get(ctx, types.NamespacedName{
+			Name:      "ldap",
+			Namespace: directory.Namespace,
+		}, &governingSvc)
+		require.NoError(t, err)
+
+		assert.Equal(t, corev1.ClusterIPNone, governingSvc.Spec.ClusterIP)
+
+		// Removing the load balancer from the spec should delete it.
+		err = r.Client.Get(ctx, client.ObjectKeyFromObject(balancedDirectory), balancedDirectory)
+		require.NoError(t, err)
+
+		balancedDirectory.Spec.LoadBalancer = nil
+		err = r.Client.Update(ctx, balancedDirectory)
+		require.NoError(t, err)
+
+		_, err = r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		})
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, loadBalancerKey, &deployment)
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("Volume Expansion", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(20)
+		r.Recorder = eventRecorder
+
+		storageClass := &storagev1.StorageClass{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "standard",
+			},
+			Provisioner:          "rancher.io/local-path",
+			AllowVolumeExpansion: ptr.To(true),
+		}
+
+		expandingDirectory := directory.DeepCopy()
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(expandingDirectory, directoryCertificate, adminPassword, storageClass).
+			WithStatusSubresource(expandingDirectory).
+			Build()
+
+		req := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		}
+
+		_, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "data-ldap-test-0",
+				Namespace: directory.Namespace,
+				Labels: map[string]string{
+					"app.kubernetes.io/name":     "ldap",
+					"app.kubernetes.io/instance": directory.Name,
+				},
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				StorageClassName: ptr.To(storageClass.Name),
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse("1Gi"),
+					},
+				},
+			},
+			Status: corev1.PersistentVolumeClaimStatus{
+				Capacity: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse("1Gi"),
+				},
+			},
+		}
+
+		err = r.Client.Create(ctx, pvc)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, req.NamespacedName, expandingDirectory)
+		require.NoError(t, err)
+
+		expandingDirectory.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "data",
+				},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{
+						corev1.ReadWriteOnce,
+					},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{
+							corev1.ResourceStorage: resource.MustParse("2Gi"),
+						},
+					},
+				},
+			},
+		}
+
+		err = r.Client.Update(ctx, expandingDirectory)
+		require.NoError(t, err)
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.NotZero(t, resp.RequeueAfter)
+
+		err = r.Client.Get(ctx, client.ObjectKeyFromObject(pvc), pvc)
+		require.NoError(t, err)
+
+		assert.Equal(t, "2Gi", pvc.Spec.Resources.Requests.Storage().String())
+
+		stsKey := types.NamespacedName{
+			Name:      "ldap-" + directory.Name,
+			Namespace: directory.Namespace,
+		}
+
+		var sts appsv1.StatefulSet
+		err = r.Client.Get(ctx, stsKey, &sts)
+		require.True(t, apierrors.IsNotFound(err))
+
+		err = r.Client.Get(ctx, req.NamespacedName, expandingDirectory)
+		require.NoError(t, err)
+
+		assert.True(t, meta.IsStatusConditionTrue(expandingDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeResizing)))
+
+		// The statefulset should be recreated with the expanded volume claim templates.
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, stsKey, &sts)
+		require.NoError(t, err)
+
+		for _, volumeClaimTemplate := range sts.Spec.VolumeClaimTemplates {
+			if volumeClaimTemplate.Name == "data" {
+				assert.Equal(t, "2Gi", volumeClaimTemplate.Spec.Resources.Requests.Storage().String())
+			}
+		}
+
+		// Once the volume has been expanded, the resizing condition should be cleared.
+		pvc.Status.Capacity[corev1.ResourceStorage] = resource.MustParse("2Gi")
+		err = r.Client.Status().Update(ctx, pvc)
+		require.NoError(t, err)
+
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, req.NamespacedName, expandingDirectory)
+		require.NoError(t, err)
+
+		resizing := meta.FindStatusCondition(expandingDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeResizing))
+		require.NotNil(t, resizing)
+		assert.Equal(t, metav1.ConditionFalse, resizing.Status)
+		assert.Equal(t, "Resized", resizing.Reason)
+	})
+
+	t.Run("Upgrade", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(30)
+		r.Recorder = eventRecorder
+
+		upgradingDirectory := directory.DeepCopy()
+		upgradingDirectory.Spec.Databases = []ldapv1alpha1.LDAPDirectoryDatabase{
+			{Name: "partners", Suffix: "dc=partners"},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(upgradingDirectory, directoryCertificate, adminPassword).
+			WithStatusSubresource(upgradingDirectory, &batchv1.Job{}).
+			Build()
+
+		req := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		}
+
+		_, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, req.NamespacedName, upgradingDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, directory.Spec.Image, upgradingDirectory.Status.CurrentImage)
+
+		// completeJob marks the named upgrade job as finished, with the given result.
+		completeJob := func(name, result string, succeeded bool) {
+			var job batchv1.Job
+			err := r.Client.Get(ctx, types.NamespacedName{
+				Name:      "ldap-" + directory.Name + "-upgrade-" + name,
+				Namespace: directory.Namespace,
+			}, &job)
+			require.NoError(t, err)
+
+			exitCode := int32(0)
+			if succeeded {
+				job.Status.Succeeded = 1
+			} else {
+				job.Status.Failed = 1
+				exitCode = 1
+			}
+
+			err = r.Client.Status().Update(ctx, &job)
+			require.NoError(t, err)
+
+			// The fake client doesn't garbage collect the pods of previous jobs.
+			err = r.Client.DeleteAllOf(ctx, &corev1.Pod{}, client.InNamespace(job.Namespace),
+				client.MatchingLabels{"job-name": job.Name})
+			require.NoError(t, err)
+
+			err = r.Client.Create(ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      job.Name + "-abcde",
+					Namespace: job.Namespace,
+					Labels: map[string]string{
+						"job-name": job.Name,
+					},
+				},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{
+						{
+							Name: "upgrade",
+							State: corev1.ContainerState{
+								Terminated: &corev1.ContainerStateTerminated{
+									ExitCode: exitCode,
+									Message:  result,
+								},
+							},
+						},
+					},
+				},
+			})
+			require.NoError(t, err)
+		}
+
+		upgradingDirectory.Spec.Image = "ghcr.io/gpu-ninja/ldap-operator/openldap:next"
+		err = r.Client.Update(ctx, upgradingDirectory)
+		require.NoError(t, err)
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.NotZero(t, resp.RequeueAfter)
+
+		err = r.Client.Get(ctx, req.NamespacedName, upgradingDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryPhaseUpgrading, upgradingDirectory.Status.Phase)
+		require.NotNil(t, upgradingDirectory.Status.Upgrade)
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryUpgradeStepExport, upgradingDirectory.Status.Upgrade.Step)
+
+		stsKey := types.NamespacedName{
+			Name:      "ldap-" + directory.Name,
+			Namespace: directory.Namespace,
+		}
+
+		var sts appsv1.StatefulSet
+		err = r.Client.Get(ctx, stsKey, &sts)
+		require.NoError(t, err)
+
+		assert.Zero(t, *sts.Spec.Replicas)
+		assert.Equal(t, directory.Spec.Image, sts.Spec.Template.Spec.Containers[0].Image)
+
+		var exportJob batchv1.Job
+		err = r.Client.Get(ctx, types.NamespacedName{
+			Name:      "ldap-" + directory.Name + "-upgrade-export",
+			Namespace: directory.Namespace,
+		}, &exportJob)
+		require.NoError(t, err)
+
+		// The export should be run with the old image.
+		assert.Equal(t, directory.Spec.Image, exportJob.Spec.Template.Spec.Containers[0].Image)
+
+		// Every database should be exported.
+		assert.Contains(t, exportJob.Spec.Template.Spec.Containers[0].Command[2],
+			"slapcat -F /etc/ldap/slapd.d -b 'dc=partners' -l /staging/databases/partners.ldif")
+
+		completeJob("export", "42\npartners 3\n", true)
+
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, req.NamespacedName, upgradingDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryUpgradeStepImport, upgradingDirectory.Status.Upgrade.Step)
+		assert.Equal(t, ptr.To(42), upgradingDirectory.Status.Upgrade.ExportedEntries)
+		assert.Equal(t, map[string]int{"partners": 3}, upgradingDirectory.Status.Upgrade.ExportedDatabaseEntries)
+
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		var importJob batchv1.Job
+		err = r.Client.Get(ctx, types.NamespacedName{
+			Name:      "ldap-" + directory.Name + "-upgrade-import",
+			Namespace: directory.Namespace,
+		}, &importJob)
+		require.NoError(t, err)
+
+		// The import should be run with the new image.
+		assert.Equal(t, upgradingDirectory.Spec.Image, importJob.Spec.Template.Spec.Containers[0].Image)
+
+		assert.Contains(t, importJob.Spec.Template.Spec.Containers[0].Command[2],
+			"slapadd -F /etc/ldap/slapd.d -b 'dc=partners' -l /staging/databases/partners.ldif")
+
+		// A missing entry (in any database) should trigger a rollback.
+		completeJob("import", "42\npartners 2\n", true)
+
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, req.NamespacedName, upgradingDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryUpgradeStepRollback, upgradingDirectory.Status.Upgrade.Step)
+		assert.Equal(t, `Imported 2 entries into database "partners" but exported 3`, upgradingDirectory.Status.Upgrade.Message)
+
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		completeJob("rollback", "", true)
+
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, req.NamespacedName, upgradingDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryUpgradeStepRolledBack, upgradingDirectory.Status.Upgrade.Step)
+		assert.Equal(t, directory.Spec.Image, upgradingDirectory.Status.CurrentImage)
+		assert.True(t, meta.IsStatusConditionFalse(upgradingDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeUpgraded)))
+
+		// The directory should come back up with the old image.
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, stsKey, &sts)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(1), *sts.Spec.Replicas)
+		assert.Equal(t, directory.Spec.Image, sts.Spec.Template.Spec.Containers[0].Image)
+
+		err = r.Client.Get(ctx, client.ObjectKeyFromObject(&importJob), &importJob)
+		require.True(t, apierrors.IsNotFound(err))
+
+		// Try again, this time successfully.
+		err = r.Client.Get(ctx, req.NamespacedName, upgradingDirectory)
+		require.NoError(t, err)
+
+		upgradingDirectory.Spec.Image = "ghcr.io/gpu-ninja/ldap-operator/openldap:next-fixed"
+		err = r.Client.Update(ctx, upgradingDirectory)
+		require.NoError(t, err)
+
+		for _, step := range []string{"export", "import"} {
+			_, err = r.Reconcile(ctx, req)
+			require.NoError(t, err)
+
+			completeJob(step, "42\npartners 3\n", true)
+
+			_, err = r.Reconcile(ctx, req)
+			require.NoError(t, err)
+		}
+
+		err = r.Client.Get(ctx, req.NamespacedName, upgradingDirectory)
+		require.NoError(t, err)
+
+		require.NotNil(t, upgradingDirectory.Status.Upgrade)
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryUpgradeStepVerify, upgradingDirectory.Status.Upgrade.Step)
+		assert.Equal(t, upgradingDirectory.Spec.Image, upgradingDirectory.Status.CurrentImage)
+
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, stsKey, &sts)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(1), *sts.Spec.Replicas)
+		assert.Equal(t, upgradingDirectory.Spec.Image, sts.Spec.Template.Spec.Containers[0].Image)
+
+		// The staging volume (with the backup) is kept until the directory is ready.
+		stagingKey := types.NamespacedName{
+			Name:      "ldap-" + directory.Name + "-upgrade",
+			Namespace: directory.Namespace,
+		}
+
+		var stagingPVC corev1.PersistentVolumeClaim
+		err = r.Client.Get(ctx, stagingKey, &stagingPVC)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, req.NamespacedName, upgradingDirectory)
+		require.NoError(t, err)
+
+		upgradingDirectory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseReady
+		err = r.Client.Status().Update(ctx, upgradingDirectory)
+		require.NoError(t, err)
+
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, req.NamespacedName, upgradingDirectory)
+		require.NoError(t, err)
+
+		assert.Nil(t, upgradingDirectory.Status.Upgrade)
+		assert.True(t, meta.IsStatusConditionTrue(upgradingDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeUpgraded)))
+
+		err = r.Client.Get(ctx, stagingKey, &stagingPVC)
+		require.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("Upgrade Verify Failure", func(t *testing.T) {
+		req := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		}
+
+		verifyingDirectory := func(startTime time.Time) *ldapv1alpha1.LDAPDirectory {
+			verifyingDirectory := directory.DeepCopy()
+			verifyingDirectory.Spec.Image = "ghcr.io/gpu-ninja/ldap-operator/openldap:next"
+			verifyingDirectory.Status.CurrentImage = verifyingDirectory.Spec.Image
+			verifyingDirectory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhasePending
+			verifyingDirectory.Status.Upgrade = &ldapv1alpha1.LDAPDirectoryUpgradeStatus{
+				FromImage:       directory.Spec.Image,
+				ToImage:         verifyingDirectory.Spec.Image,
+				Step:            ldapv1alpha1.LDAPDirectoryUpgradeStepVerify,
+				VerifyStartTime: &metav1.Time{Time: startTime},
+			}
+
+			return verifyingDirectory
+		}
+
+		t.Run("Crash Loop", func(t *testing.T) {
+			eventRecorder := record.NewFakeRecorder(10)
+			r.Recorder = eventRecorder
+
+			upgradingDirectory := verifyingDirectory(time.Now())
+
+			crashLoopingPod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "ldap-" + directory.Name + "-0",
+					Namespace: directory.Namespace,
+				},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{
+						{
+							Name: "openldap",
+							State: corev1.ContainerState{
+								Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+							},
+						},
+					},
+				},
+			}
+
+			r.Client = fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(upgradingDirectory, directoryCertificate, adminPassword, crashLoopingPod).
+				WithStatusSubresource(upgradingDirectory).
+				Build()
+
+			resp, err := r.Reconcile(ctx, req)
+			require.NoError(t, err)
+			assert.NotZero(t, resp.RequeueAfter)
+
+			err = r.Client.Get(ctx, req.NamespacedName, upgradingDirectory)
+			require.NoError(t, err)
+
+			require.NotNil(t, upgradingDirectory.Status.Upgrade)
+			assert.Equal(t, ldapv1alpha1.LDAPDirectoryUpgradeStepRollback, upgradingDirectory.Status.Upgrade.Step)
+			assert.Contains(t, upgradingDirectory.Status.Upgrade.Message, "crash looping")
+			assert.Equal(t, directory.Spec.Image, upgradingDirectory.Status.CurrentImage)
+		})
+
+		t.Run("Timeout", func(t *testing.T) {
+			eventRecorder := record.NewFakeRecorder(10)
+			r.Recorder = eventRecorder
+
+			upgradingDirectory := verifyingDirectory(time.Now().Add(-time.Hour))
+
+			r.Client = fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(upgradingDirectory, directoryCertificate, adminPassword).
+				WithStatusSubresource(upgradingDirectory).
+				Build()
+
+			_, err := r.Reconcile(ctx, req)
+			require.NoError(t, err)
+
+			err = r.Client.Get(ctx, req.NamespacedName, upgradingDirectory)
+			require.NoError(t, err)
+
+			require.NotNil(t, upgradingDirectory.Status.Upgrade)
+			assert.Equal(t, ldapv1alpha1.LDAPDirectoryUpgradeStepRollback, upgradingDirectory.Status.Upgrade.Step)
+			assert.Contains(t, upgradingDirectory.Status.Upgrade.Message, "did not become ready")
+
+			// The backup is restored with the previous image.
+			_, err = r.Reconcile(ctx, req)
+			require.NoError(t, err)
+
+			var rollbackJob batchv1.Job
+			err = r.Client.Get(ctx, types.NamespacedName{
+				Name:      "ldap-" + directory.Name + "-upgrade-rollback",
+				Namespace: directory.Namespace,
+			}, &rollbackJob)
+			require.NoError(t, err)
+
+			assert.Equal(t, directory.Spec.Image, rollbackJob.Spec.Template.Spec.Containers[0].Image)
+		})
+	})
+
+	t.Run("External", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		externalDirectory := &ldapv1alpha1.LDAPDirectory{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "corporate",
+				Namespace: "default",
+			},
+			Spec: ldapv1alpha1.LDAPDirectorySpec{
+				External: &ldapv1alpha1.LDAPDirectoryExternal{
+					URLs:   []string{"ldaps://ldap.example.com"},
+					BaseDN: "dc=example,dc=com",
+					BindDN: "cn=admin,dc=example,dc=com",
+					BindPasswordSecretRef: reference.LocalSecretReference{
+						Name: "admin-password",
+					},
+				},
+			},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(externalDirectory, adminPassword).
+			WithStatusSubresource(externalDirectory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("Ping").Return(nil)
+
+		resp, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      externalDirectory.Name,
+				Namespace: externalDirectory.Namespace,
+			},
+		})
+		require.NoError(t, err)
+
+		// Connectivity should be rechecked periodically.
+		assert.NotZero(t, resp.RequeueAfter)
+
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Equal(t, "Normal Connected Successfully connected to external directory", event)
+
+		updatedDirectory := externalDirectory.DeepCopy()
+		err = subResourceClient.Get(ctx, externalDirectory, updatedDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryPhaseReady, updatedDirectory.Status.Phase)
+
+		var sts appsv1.StatefulSet
+		err = r.Client.Get(ctx, types.NamespacedName{
+			Name:      "ldap-" + externalDirectory.Name,
+			Namespace: externalDirectory.Namespace,
+		}, &sts)
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("Paused", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		pausedDirectory := directory.DeepCopy()
+		pausedDirectory.Annotations = map[string]string{
+			api.PausedAnnotation: "true",
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(pausedDirectory, directoryCertificate, adminPassword).
+			WithStatusSubresource(pausedDirectory).
+			Build()
+
+		req := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		}
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Equal(t, "Normal Paused Reconciliation is paused", event)
+
+		var sts appsv1.StatefulSet
+		err = r.Client.Get(ctx, types.NamespacedName{
+			Name:      "ldap-" + directory.Name,
+			Namespace: directory.Namespace,
+		}, &sts)
+		assert.True(t, apierrors.IsNotFound(err))
+
+		err = r.Client.Get(ctx, req.NamespacedName, pausedDirectory)
+		require.NoError(t, err)
+
+		assert.True(t, meta.IsStatusConditionTrue(pausedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypePaused)))
+
+		// Resume reconciliation.
+		delete(pausedDirectory.Annotations, api.PausedAnnotation)
+		err = r.Client.Update(ctx, pausedDirectory)
+		require.NoError(t, err)
+
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		err = r.Client.Get(ctx, req.NamespacedName, pausedDirectory)
+		require.NoError(t, err)
+
+		assert.True(t, meta.IsStatusConditionFalse(pausedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypePaused)))
+
+		err = r.Client.Get(ctx, types.NamespacedName{
+			Name:      "ldap-" + directory.Name,
+			Namespace: directory.Namespace,
+		}, &sts)
+		require.NoError(t, err)
+	})
+
+	t.Run("Suspend", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		suspendedDirectory := directory.DeepCopy()
+		suspendedDirectory.Spec.Suspend = true
+		suspendedDirectory.Spec.LoadBalancer = &ldapv1alpha1.LDAPDirectoryLoadBalancer{}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(suspendedDirectory, directoryCertificate, adminPassword).
+			WithStatusSubresource(suspendedDirectory).
+			Build()
+
+		req := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		}
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Equal(t, "Normal Suspended Directory has been scaled down", event)
+
+		stsKey := types.NamespacedName{
+			Name:      "ldap-" + directory.Name,
+			Namespace: directory.Namespace,
+		}
+
+		var sts appsv1.StatefulSet
+		err = r.Client.Get(ctx, stsKey, &sts)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(0), *sts.Spec.Replicas)
+
+		var deployment appsv1.Deployment
+		err = r.Client.Get(ctx, types.NamespacedName{
+			Name:      "ldap-" + directory.Name + "-lloadd",
+			Namespace: directory.Namespace,
+		}, &deployment)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(0), *deployment.Spec.Replicas)
+
+		err = r.Client.Get(ctx, req.NamespacedName, suspendedDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryPhaseSuspended, suspendedDirectory.Status.Phase)
+		assert.True(t, meta.IsStatusConditionTrue(suspendedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeSuspended)))
+
+		// Suspending is only recorded once.
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		assert.Len(t, eventRecorder.Events, 0)
+
+		// Resume the directory.
+		suspendedDirectory.Spec.Suspend = false
+		err = r.Client.Update(ctx, suspendedDirectory)
+		require.NoError(t, err)
+
+		resp, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.NotZero(t, resp.RequeueAfter)
+
+		require.Len(t, eventRecorder.Events, 2)
+		event = <-eventRecorder.Events
+		assert.Equal(t, "Normal Resumed Directory is being scaled up", event)
+
+		err = r.Client.Get(ctx, stsKey, &sts)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(1), *sts.Spec.Replicas)
+
+		err = r.Client.Get(ctx, req.NamespacedName, suspendedDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryPhasePending, suspendedDirectory.Status.Phase)
+		assert.True(t, meta.IsStatusConditionFalse(suspendedDirectory.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectoryConditionTypeSuspended)))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		deletingDirectory := directory.DeepCopy()
+		deletingDirectory.DeletionTimestamp = &metav1.Time{Time: metav1.Now().Add(-1 * time.Second)}
+		deletingDirectory.Finalizers = []string{controller.FinalizerName}
+
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		r.Client = withDirectoryRefIndexes(fake.NewClientBuilder().WithScheme(scheme)).
+			WithObjects(deletingDirectory, directoryCertificate, adminPassword).
+			WithStatusSubresource(deletingDirectory).
+			Build()
+
+		resp, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		})
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		assert.Len(t, eventRecorder.Events, 0)
+	})
+
+	t.Run("Deletion Policy", func(t *testing.T) {
+		user := &ldapv1alpha1.LDAPUser{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "test-user",
+				Namespace:  directory.Namespace,
+				Finalizers: []string{controller.FinalizerName},
+			},
+			Spec: ldapv1alpha1.LDAPUserSpec{
+				LDAPObjectSpec: api.LDAPObjectSpec{
+					DirectoryRef: api.LocalLDAPDirectoryReference{
+						Name: directory.Name,
+					},
+				},
+				Username: "test-user",
+			},
+		}
+
+		// Belongs to a different directory.
+		otherUser := user.DeepCopy()
+		otherUser.Name = "other-user"
+		otherUser.Spec.DirectoryRef.Name = "other"
+
+		req := reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		}
+
+		setup := func(policy ldapv1alpha1.LDAPDirectoryDeletionPolicy) *ldapv1alpha1.LDAPDirectory {
+			deletingDirectory := directory.DeepCopy()
+			deletingDirectory.DeletionTimestamp = &metav1.Time{Time: metav1.Now().Add(-1 * time.Second)}
+			deletingDirectory.Finalizers = []string{controller.FinalizerName}
+			deletingDirectory.Spec.DeletionPolicy = policy
+
+			r.Client = withDirectoryRefIndexes(fake.NewClientBuilder().WithScheme(scheme)).
+				WithObjects(deletingDirectory, directoryCertificate, adminPassword, user.DeepCopy(), otherUser.DeepCopy()).
+				WithStatusSubresource(deletingDirectory).
+				Build()
+
+			return deletingDirectory
+		}
+
+		t.Run("Block", func(t *testing.T) {
+			eventRecorder := record.NewFakeRecorder(2)
+			r.Recorder = eventRecorder
+
+			deletingDirectory := setup(ldapv1alpha1.LDAPDirectoryDeletionPolicyBlock)
+
+			resp, err := r.Reconcile(ctx, req)
+			require.NoError(t, err)
+			assert.NotZero(t, resp.RequeueAfter)
+
+			require.Len(t, eventRecorder.Events, 1)
+			event := <-eventRecorder.Events
+			assert.Equal(t, "Warning DeletionBlocked Deletion is blocked by 1 objects that reference the directory", event)
+
+			err = r.Client.Get(ctx, req.NamespacedName, deletingDirectory)
+			require.NoError(t, err)
+
+			assert.Contains(t, deletingDirectory.Finalizers, controller.FinalizerName)
+			assert.True(t, meta.IsStatusConditionTrue(deletingDirectory.Status.Conditions,
+				string(ldapv1alpha1.LDAPDirectoryConditionTypeDeletionBlocked)))
+
+			// Once the user has been deleted, the directory can be deleted.
+			err = r.Client.Delete(ctx, user.DeepCopy())
+			require.NoError(t, err)
+
+			var deletingUser ldapv1alpha1.LDAPUser
+			err = r.Client.Get(ctx, client.ObjectKeyFromObject(user), &deletingUser)
+			require.NoError(t, err)
+
+			deletingUser.Finalizers = nil
+			err = r.Client.Update(ctx, &deletingUser)
+			require.NoError(t, err)
+
+			resp, err = r.Reconcile(ctx, req)
+			require.NoError(t, err)
+			assert.Zero(t, resp)
+
+			err = r.Client.Get(ctx, req.NamespacedName, deletingDirectory)
+			require.True(t, apierrors.IsNotFound(err))
+		})
+
+		t.Run("Cascade", func(t *testing.T) {
+			r.Recorder = record.NewFakeRecorder(2)
+
+			setup(ldapv1alpha1.LDAPDirectoryDeletionPolicyCascade)
+
+			resp, err := r.Reconcile(ctx, req)
+			require.NoError(t, err)
+			assert.NotZero(t, resp.RequeueAfter)
+
+			// The user should be deleted (but held by its finalizer).
+			var deletingUser ldapv1alpha1.LDAPUser
+			err = r.Client.Get(ctx, client.ObjectKeyFromObject(user), &deletingUser)
+			require.NoError(t, err)
+
+			assert.False(t, deletingUser.DeletionTimestamp.IsZero())
+
+			err = r.Client.Get(ctx, client.ObjectKeyFromObject(otherUser), &deletingUser)
+			require.NoError(t, err)
+
+			assert.True(t, deletingUser.DeletionTimestamp.IsZero())
+		})
+
+		t.Run("Orphan", func(t *testing.T) {
+			r.Recorder = record.NewFakeRecorder(2)
+
+			deletingDirectory := setup(ldapv1alpha1.LDAPDirectoryDeletionPolicyOrphan)
+
+			resp, err := r.Reconcile(ctx, req)
+			require.NoError(t, err)
+			assert.Zero(t, resp)
+
+			var orphanedUser ldapv1alpha1.LDAPUser
+			err = r.Client.Get(ctx, client.ObjectKeyFromObject(user), &orphanedUser)
+			require.NoError(t, err)
+
+			assert.Empty(t, orphanedUser.Finalizers)
+
+			err = r.Client.Get(ctx, req.NamespacedName, deletingDirectory)
+			require.True(t, apierrors.IsNotFound(err))
+		})
+	})
+
+	t.Run("References Not Resolvable", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(directory). // note the missing secrets
+			WithStatusSubresource(directory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		resp, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		})
+		require.NoError(t, err)
+		assert.NotZero(t, resp.RequeueAfter)
+
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Equal(t, "Warning NotReady Not all references are resolvable", event)
+
+		updatedDirectory := directory.DeepCopy()
+		err = subResourceClient.Get(ctx, directory, updatedDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryPhasePending, updatedDirectory.Status.Phase)
+		assert.Len(t, updatedDirectory.Status.Conditions, 1)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		failOnStatefulSets := interceptorFuncs
+		failOnStatefulSets.Get = func(ctx context.Context, client client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, ok := obj.(*appsv1.StatefulSet); ok {
+				return fmt.Errorf("bang")
+			}
+
+			return client.Get(ctx, key, obj, opts...)
+		}
+
+		subResourceClient.Reset()
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(directory, directoryCertificate, adminPassword).
+			WithStatusSubresource(directory).
+			WithInterceptorFuncs(failOnStatefulSets).
+			Build()
+
+		_, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      directory.Name,
+				Namespace: directory.Namespace,
+			},
+		})
+		require.Error(t, err)
+
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Equal(t, "Warning Failed Failed to reconcile statefulset: failed to get statefulset: bang", event)
+
+		updatedDirectory := directory.DeepCopy()
+		err = subResourceClient.Get(ctx, directory, updatedDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectoryPhaseFailed, updatedDirectory.Status.Phase)
+	})
+}
+
+func withDirectoryRefIndexes(builder *fake.ClientBuilder) *fake.ClientBuilder {
+	return builder.
+		WithIndex(&ldapv1alpha1.LDAPUser{}, api.DirectoryRefIndexKey, api.DirectoryRefIndexer).
+		WithIndex(&ldapv1alpha1.LDAPGroup{}, api.DirectoryRefIndexKey, api.DirectoryRefIndexer).
+		WithIndex(&ldapv1alpha1.LDAPOrganizationalUnit{}, api.DirectoryRefIndexKey, api.DirectoryRefIndexer)
+}
+
+// renderedConfig returns the configuration rendered for the config agent of a directory.
+func renderedConfig(t *testing.T, c client.Client, directory *ldapv1alpha1.LDAPDirectory) *configagent.Config {
+	var secret corev1.Secret
+	err := c.Get(context.Background(), types.NamespacedName{
+		Name:      "ldap-" + directory.Name + "-config",
+		Namespace: directory.Namespace,
+	}, &secret)
+	require.NoError(t, err)
+
+	var config configagent.Config
+	err = json.Unmarshal(secret.Data[configagent.ConfigFile], &config)
+	require.NoError(t, err)
+
+	return &config
+}
+
+// appliedConfig returns the status of a config agent that has applied the given configuration.
+func appliedConfig(config *configagent.Config) configagent.Status {
+	status := configagent.Status{
+		Generation:   config.Generation,
+		SettingsHash: configagent.Hash(config.Settings),
+	}
+
+	now := metav1.Now()
+	for _, patch := range config.Patches {
+		status.Patches = append(status.Patches, ldapv1alpha1.LDAPDirectoryConfigPatchStatus{
+			Name:            patch.Name,
+			Hash:            configagent.Hash(patch.LDIF),
+			Applied:         true,
+			LastAppliedTime: &now,
+		})
+	}
+
+	return status
 }
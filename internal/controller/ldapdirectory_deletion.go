@@ -0,0 +1,150 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gpu-ninja/ldap-operator/api"
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// reconcileDeletionPolicy applies the deletion policy of the directory to the
+// objects that reference it. Returns true if deletion of the directory should
+// be held until the objects are gone.
+func (r *LDAPDirectoryReconciler) reconcileDeletionPolicy(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) (bool, error) {
+	logger := zaplogr.FromContext(ctx)
+
+	objs, err := r.directoryObjects(ctx, directory)
+	if err != nil {
+		return false, err
+	}
+
+	if len(objs) == 0 {
+		return false, nil
+	}
+
+	switch directory.Spec.DeletionPolicy {
+	case ldapv1alpha1.LDAPDirectoryDeletionPolicyCascade:
+		logger.Info("Deleting directory objects", zap.Int("count", len(objs)))
+
+		for _, obj := range objs {
+			if !obj.GetDeletionTimestamp().IsZero() {
+				continue
+			}
+
+			if err := r.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+				return false, fmt.Errorf("failed to delete %s: %w", obj.GetName(), err)
+			}
+		}
+
+		// The objects remove their entries from the directory, so it must
+		// remain available until they are gone.
+		return true, nil
+	case ldapv1alpha1.LDAPDirectoryDeletionPolicyOrphan:
+		logger.Info("Orphaning directory objects", zap.Int("count", len(objs)))
+
+		for _, obj := range objs {
+			if !controllerutil.ContainsFinalizer(obj, FinalizerName) {
+				continue
+			}
+
+			_, err := controllerutil.CreateOrPatch(ctx, r.Client, obj, func() error {
+				controllerutil.RemoveFinalizer(obj, FinalizerName)
+
+				return nil
+			})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return false, fmt.Errorf("failed to remove finalizer from %s: %w", obj.GetName(), err)
+			}
+		}
+
+		return false, nil
+	default:
+		logger.Info("Deletion blocked by directory objects", zap.Int("count", len(objs)))
+
+		message := fmt.Sprintf("Deletion is blocked by %d objects that reference the directory", len(objs))
+
+		r.Recorder.Event(directory, corev1.EventTypeWarning, "DeletionBlocked", message)
+
+		return true, r.setCondition(ctx, directory, metav1.Condition{
+			Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeDeletionBlocked),
+			Status:  metav1.ConditionTrue,
+			Reason:  "ObjectsExist",
+			Message: message,
+		})
+	}
+}
+
+// directoryObjects returns all the LDAP objects that reference the directory.
+func (r *LDAPDirectoryReconciler) directoryObjects(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) ([]api.LDAPObject, error) {
+	listOpts := []client.ListOption{
+		client.InNamespace(directory.Namespace),
+		client.MatchingFields{api.DirectoryRefIndexKey: directory.Name},
+	}
+
+	var users ldapv1alpha1.LDAPUserList
+	if err := r.List(ctx, &users, listOpts...); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	var groups ldapv1alpha1.LDAPGroupList
+	if err := r.List(ctx, &groups, listOpts...); err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+
+	var organizationalUnits ldapv1alpha1.LDAPOrganizationalUnitList
+	if err := r.List(ctx, &organizationalUnits, listOpts...); err != nil {
+		return nil, fmt.Errorf("failed to list organizational units: %w", err)
+	}
+
+	var objs []api.LDAPObject
+	for i := range users.Items {
+		objs = append(objs, &users.Items[i])
+	}
+	for i := range groups.Items {
+		objs = append(objs, &groups.Items[i])
+	}
+	for i := range organizationalUnits.Items {
+		objs = append(objs, &organizationalUnits.Items[i])
+	}
+
+	return objs, nil
+}
+
+// indexDirectoryObjects registers the field index used to find the objects of a directory.
+func indexDirectoryObjects(ctx context.Context, indexer client.FieldIndexer) error {
+	for _, obj := range []client.Object{
+		&ldapv1alpha1.LDAPUser{},
+		&ldapv1alpha1.LDAPGroup{},
+		&ldapv1alpha1.LDAPOrganizationalUnit{},
+	} {
+		if err := indexer.IndexField(ctx, obj, api.DirectoryRefIndexKey, api.DirectoryRefIndexer); err != nil {
+			return fmt.Errorf("failed to index %T: %w", obj, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,377 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/operator-utils/k8sutils"
+	"github.com/gpu-ninja/operator-utils/updater"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// governingServiceName is the name of the headless service that gives
+	// directory pods stable hostnames (shared by all directories in a namespace).
+	governingServiceName = "ldap"
+	// configHashAnnotation is used to roll pods when their configuration changes.
+	configHashAnnotation = "ldap.gpu-ninja.com/config-hash"
+)
+
+// lloaddCommand substitutes the admin password into the lloadd configuration,
+// escaped as a double quoted slapd.conf value (the password is user provided,
+// and may contain quotes or backslashes), and then starts lloadd.
+const lloaddCommand = `perl -pe 'BEGIN { ($password = $ENV{LDAP_ADMIN_PASSWORD}) =~ s/(["\\])/\\$1/g } s/\@LDAP_ADMIN_PASSWORD\@/$password/g' /etc/ldap/lloadd/lloadd.conf > /run/lloadd/lloadd.conf` +
+	` && exec slapd -u openldap -g openldap -d 0 -h 'ldapi://%2Frun%2Flloadd%2Fldapi' -f /run/lloadd/lloadd.conf`
+
+// reconcileLoadBalancer creates or updates the lloadd load balancer tier of
+// the directory, or removes it if it is no longer required.
+func (r *LDAPDirectoryReconciler) reconcileLoadBalancer(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, sts *appsv1.StatefulSet) error {
+	objectMeta := metav1.ObjectMeta{
+		Name:      "ldap-" + directory.Name + "-lloadd",
+		Namespace: directory.Namespace,
+	}
+
+	if directory.Spec.LoadBalancer == nil {
+		for _, obj := range []client.Object{
+			&appsv1.Deployment{ObjectMeta: objectMeta},
+			&corev1.Service{ObjectMeta: objectMeta},
+			&corev1.ConfigMap{ObjectMeta: objectMeta},
+		} {
+			if err := r.deleteControlledObject(ctx, directory, obj); err != nil {
+				return fmt.Errorf("failed to delete load balancer %T: %w", obj, err)
+			}
+		}
+
+		return nil
+	}
+
+	if err := r.reconcileGoverningService(ctx, directory); err != nil {
+		return fmt.Errorf("failed to reconcile governing service: %w", err)
+	}
+
+	cm, err := r.loadBalancerConfigMapTemplate(directory, sts)
+	if err != nil {
+		return fmt.Errorf("failed to generate load balancer configmap template: %w", err)
+	}
+
+	if _, err := updater.CreateOrUpdateFromTemplate(ctx, r.Client, cm); err != nil {
+		return fmt.Errorf("failed to reconcile load balancer configmap: %w", err)
+	}
+
+	deployment, err := r.loadBalancerDeploymentTemplate(directory, cm)
+	if err != nil {
+		return fmt.Errorf("failed to generate load balancer deployment template: %w", err)
+	}
+
+	if _, err := updater.CreateOrUpdateFromTemplate(ctx, r.Client, deployment); err != nil {
+		return fmt.Errorf("failed to reconcile load balancer deployment: %w", err)
+	}
+
+	svc, err := r.loadBalancerServiceTemplate(directory)
+	if err != nil {
+		return fmt.Errorf("failed to generate load balancer service template: %w", err)
+	}
+
+	if _, err := updater.CreateOrUpdateFromTemplate(ctx, r.Client, svc); err != nil {
+		return fmt.Errorf("failed to reconcile load balancer service: %w", err)
+	}
+
+	return nil
+}
+
+// reconcileGoverningService ensures the headless service referenced by the
+// directory statefulsets exists. As the service is shared, every directory
+// using it is added as an owner so that it is only garbage collected once
+// all of them have been deleted.
+func (r *LDAPDirectoryReconciler) reconcileGoverningService(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) error {
+	svc := corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      governingServiceName,
+			Namespace: directory.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, &svc, func() error {
+		if svc.Labels == nil {
+			svc.Labels = make(map[string]string)
+		}
+		svc.Labels["app.kubernetes.io/managed-by"] = "ldap-operator"
+
+		svc.Spec.ClusterIP = corev1.ClusterIPNone
+		svc.Spec.PublishNotReadyAddresses = true
+		svc.Spec.Selector = map[string]string{
+			"app.kubernetes.io/name": "ldap",
+		}
+		svc.Spec.Ports = []corev1.ServicePort{
+			{
+				Port:       636,
+				TargetPort: intstr.FromInt(636),
+				Name:       "ldaps",
+				Protocol:   corev1.ProtocolTCP,
+			},
+		}
+
+		return controllerutil.SetOwnerReference(directory, &svc, r.Scheme)
+	})
+
+	return err
+}
+
+func (r *LDAPDirectoryReconciler) loadBalancerConfigMapTemplate(directory *ldapv1alpha1.LDAPDirectory, sts *appsv1.StatefulSet) (*corev1.ConfigMap, error) {
+	baseDN, err := directory.GetDistinguishedName(context.Background(), r.Client, r.Scheme)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get distinguished name: %w", err)
+	}
+
+	var conf strings.Builder
+
+	conf.WriteString("# Generated by ldap-operator, do not edit.\n")
+	conf.WriteString("modulepath /usr/lib/ldap\n")
+	conf.WriteString("moduleload lloadd.so\n")
+	conf.WriteString("TLSCertificateFile /etc/ldap/certs/tls.crt\n")
+	conf.WriteString("TLSCertificateKeyFile /etc/ldap/certs/tls.key\n")
+	conf.WriteString("TLSCACertificateFile /etc/ldap/certs/ca.crt\n")
+	conf.WriteString("\n")
+	conf.WriteString("backend lload\n")
+	conf.WriteString("listen ldaps:///\n")
+	// The admin password is substituted when the container starts (see
+	// lloaddCommand).
+	fmt.Fprintf(&conf, "bindconf bindmethod=simple binddn=\"cn=admin,%s\" credentials=\"@LDAP_ADMIN_PASSWORD@\" tls_cacert=/etc/ldap/certs/ca.crt\n", baseDN)
+	// Operations are performed on behalf of clients using the proxied
+	// authorization control, so that access control is unchanged.
+	conf.WriteString("feature proxyauthz\n")
+
+	// Every pod of the statefulset is a backend. Directories are currently
+	// served by a single pod, so (until they can be scaled out) the load
+	// balancer only pools and multiplexes client connections.
+	replicas := int32(1)
+	if sts.Spec.Replicas != nil {
+		replicas = *sts.Spec.Replicas
+	}
+
+	for i := int32(0); i < replicas; i++ {
+		fmt.Fprintf(&conf, "backend-server uri=ldaps://%s-%d.%s.%s.svc.%s:636 numconns=10 bindconns=5 retry=5000 max-pending-ops=50 conn-max-pending=10\n",
+			sts.Name, i, sts.Spec.ServiceName, directory.Namespace, k8sutils.GetClusterDomain())
+	}
+
+	cm := corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ldap-" + directory.Name + "-lloadd",
+			Namespace: directory.Namespace,
+			Labels:    make(map[string]string),
+		},
+		Data: map[string]string{
+			"lloadd.conf": conf.String(),
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(directory, &cm, r.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to set controller reference: %w", err)
+	}
+
+	setLoadBalancerLabels(directory, &cm.ObjectMeta)
+
+	return &cm, nil
+}
+
+func (r *LDAPDirectoryReconciler) loadBalancerDeploymentTemplate(directory *ldapv1alpha1.LDAPDirectory, cm *corev1.ConfigMap) (*appsv1.Deployment, error) {
+	replicas := int32(ldapv1alpha1.DefaultLoadBalancerReplicas)
+	if directory.Spec.LoadBalancer.Replicas != nil {
+		replicas = *directory.Spec.LoadBalancer.Replicas
+	}
+
+	if directory.Spec.Suspend {
+		replicas = 0
+	}
+
+	selectorLabels := map[string]string{
+		"app.kubernetes.io/name":     "lloadd",
+		"app.kubernetes.io/instance": directory.Name,
+	}
+
+	deployment := appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ldap-" + directory.Name + "-lloadd",
+			Namespace: directory.Namespace,
+			Labels:    make(map[string]string),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To(replicas),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: selectorLabels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: selectorLabels,
+					Annotations: map[string]string{
+						// Restart the load balancer when the backends change.
+						configHashAnnotation: updater.HashObject(cm),
+					},
+				},
+				Spec: corev1.PodSpec{
+					TerminationGracePeriodSeconds: ptr.To(int64(10)),
+					SecurityContext: &corev1.PodSecurityContext{
+						// The default Debian OpenLDAP group.
+						FSGroup: ptr.To(int64(101)),
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "lloadd",
+							Image: directoryImage(directory),
+							Command: []string{
+								"/bin/sh", "-c", lloaddCommand,
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name: "LDAP_ADMIN_PASSWORD",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: fmt.Sprintf("ldap-%s-admin-password", directory.Name),
+											},
+											Key: "password",
+										},
+									},
+								},
+							},
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "ldaps",
+									ContainerPort: 636,
+									Protocol:      corev1.ProtocolTCP,
+								},
+							},
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									TCPSocket: &corev1.TCPSocketAction{
+										Port: intstr.IntOrString{IntVal: 636},
+									},
+								},
+								InitialDelaySeconds: 5,
+								PeriodSeconds:       10,
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "config",
+									MountPath: "/etc/ldap/lloadd",
+								},
+								{
+									Name:      "run",
+									MountPath: "/run/lloadd",
+								},
+								{
+									Name:      "certs",
+									MountPath: "/etc/ldap/certs",
+								},
+							},
+							Resources: directory.Spec.LoadBalancer.Resources,
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "config",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: cm.Name,
+									},
+								},
+							},
+						},
+						{
+							Name: "run",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+						{
+							Name: "certs",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{
+									SecretName:  directory.Spec.CertificateSecretRef.Name,
+									DefaultMode: ptr.To(int32(0o400)),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(directory, &deployment, r.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to set controller reference: %w", err)
+	}
+
+	setLoadBalancerLabels(directory, &deployment.ObjectMeta)
+
+	return &deployment, nil
+}
+
+func (r *LDAPDirectoryReconciler) loadBalancerServiceTemplate(directory *ldapv1alpha1.LDAPDirectory) (*corev1.Service, error) {
+	svc := corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ldap-" + directory.Name + "-lloadd",
+			Namespace: directory.Namespace,
+			Labels:    make(map[string]string),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{
+				"app.kubernetes.io/name":     "lloadd",
+				"app.kubernetes.io/instance": directory.Name,
+			},
+			Ports: []corev1.ServicePort{
+				{
+					Port:       636,
+					TargetPort: intstr.FromInt(636),
+					Name:       "ldaps",
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(directory, &svc, r.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to set controller reference: %w", err)
+	}
+
+	setLoadBalancerLabels(directory, &svc.ObjectMeta)
+
+	return &svc, nil
+}
+
+func setLoadBalancerLabels(directory *ldapv1alpha1.LDAPDirectory, objectMeta *metav1.ObjectMeta) {
+	for k, v := range directory.ObjectMeta.Labels {
+		objectMeta.Labels[k] = v
+	}
+
+	objectMeta.Labels["app.kubernetes.io/name"] = "directory"
+	objectMeta.Labels["app.kubernetes.io/instance"] = directory.Name
+	objectMeta.Labels["app.kubernetes.io/component"] = "load-balancer"
+	objectMeta.Labels["app.kubernetes.io/managed-by"] = "ldap-operator"
+}
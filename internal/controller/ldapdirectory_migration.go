@@ -0,0 +1,351 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+	"github.com/gpu-ninja/operator-utils/updater"
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// migrationCACertFile is where the CA bundle of the migration source is
+	// mounted in the directory container.
+	migrationCACertFile = "/etc/ldap/migration/ca.crt"
+	// migrationPollInterval is how often the replication state of a migration is checked.
+	migrationPollInterval = 30 * time.Second
+)
+
+// isMigrating returns whether the directory is a syncrepl consumer of its
+// migration source (ie. it has not yet been cut over).
+func isMigrating(directory *ldapv1alpha1.LDAPDirectory) bool {
+	if directory.Spec.Migration == nil {
+		return false
+	}
+
+	return !meta.IsStatusConditionTrue(directory.Status.Conditions, string(ldapv1alpha1.LDAPDirectoryConditionTypeMigrated))
+}
+
+// reconcileMigration configures the directory as a syncrepl consumer of the
+// migration source, and records the replication state. Once a cutover is
+// requested, and the consumer configuration has been removed, the directory
+// is marked as migrated.
+func (r *LDAPDirectoryReconciler) reconcileMigration(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) (ctrl.Result, error) {
+	logger := zaplogr.FromContext(ctx)
+
+	if directory.Status.Phase != ldapv1alpha1.LDAPDirectoryPhaseMigrating {
+		r.Recorder.Event(directory, corev1.EventTypeNormal,
+			"Migrating", "Replicating entries from the migration source")
+
+		if err := r.markMigrating(ctx, directory); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	configSynced, err := r.reconcileConfig(ctx, directory)
+	if err != nil {
+		r.Recorder.Eventf(directory, corev1.EventTypeWarning,
+			"Failed", "Failed to reconcile config: %s", err)
+
+		return ctrl.Result{}, fmt.Errorf("failed to reconcile config: %w", err)
+	}
+
+	if directory.Spec.Migration.Cutover {
+		if !configSynced {
+			logger.Info("Waiting for config agent to remove the syncrepl consumer")
+
+			return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+		}
+
+		logger.Info("Migration cut over")
+
+		r.Recorder.Event(directory, corev1.EventTypeNormal,
+			"CutOver", "Migration has been cut over, the directory is writable")
+
+		key := client.ObjectKeyFromObject(directory)
+		err := updater.UpdateStatus(ctx, r.Client, key, directory, func() error {
+			if directory.Status.Migration == nil {
+				directory.Status.Migration = &ldapv1alpha1.LDAPDirectoryMigrationStatus{}
+			}
+
+			directory.Status.Migration.CutoverTime = ptr.To(metav1.Now())
+
+			meta.SetStatusCondition(&directory.Status.Conditions, metav1.Condition{
+				Type:               string(ldapv1alpha1.LDAPDirectoryConditionTypeMigrated),
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: directory.ObjectMeta.Generation,
+				Reason:             "CutOver",
+				Message:            "Migration has been cut over",
+			})
+
+			return nil
+		})
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to mark migration as cut over: %w", err)
+		}
+
+		// Continue with the rest of the reconciliation (eg. marking the directory as ready).
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	status, err := r.migrationSyncStatus(ctx, directory)
+	if err != nil {
+		logger.Warn("Failed to check replication state", zap.Error(err))
+
+		status = &ldapv1alpha1.LDAPDirectoryMigrationStatus{
+			LastCheckedTime: ptr.To(metav1.Now()),
+			Message:         err.Error(),
+		}
+		if directory.Status.Migration != nil {
+			status.SourceEntries = directory.Status.Migration.SourceEntries
+			status.Entries = directory.Status.Migration.Entries
+			status.SourceContextCSN = directory.Status.Migration.SourceContextCSN
+			status.ContextCSN = directory.Status.Migration.ContextCSN
+			status.Lag = directory.Status.Migration.Lag
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeMigrated),
+		Status:  metav1.ConditionFalse,
+		Reason:  "Syncing",
+		Message: migrationMessage(status),
+	}
+
+	if status.Message != "" {
+		condition.Reason = "Failed"
+	}
+
+	key := client.ObjectKeyFromObject(directory)
+	err = updater.UpdateStatus(ctx, r.Client, key, directory, func() error {
+		directory.Status.Migration = status
+
+		condition.ObservedGeneration = directory.ObjectMeta.Generation
+		meta.SetStatusCondition(&directory.Status.Conditions, condition)
+
+		return nil
+	})
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to update migration status: %w", err)
+	}
+
+	return ctrl.Result{RequeueAfter: migrationPollInterval}, nil
+}
+
+// migrationSyncStatus compares the replication state of the migration source
+// with that of the directory.
+func (r *LDAPDirectoryReconciler) migrationSyncStatus(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) (*ldapv1alpha1.LDAPDirectoryMigrationStatus, error) {
+	searchBase, err := migrationSearchBase(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceClient, err := r.LDAPClientBuilder.WithDirectory(directory).BuildMigrationSource(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration source client: %w", err)
+	}
+
+	sourceState, err := sourceClient.GetSyncState(searchBase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replication state of migration source: %w", err)
+	}
+
+	ldapClient, err := r.LDAPClientBuilder.WithDirectory(directory).Build(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory client: %w", err)
+	}
+
+	state, err := ldapClient.GetSyncState(searchBase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replication state of directory: %w", err)
+	}
+
+	sourceLatest, sourceCSN, err := sourceState.LatestChange()
+	if err != nil {
+		return nil, err
+	}
+
+	latest, csn, err := state.LatestChange()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ldapv1alpha1.LDAPDirectoryMigrationStatus{
+		SourceEntries:    ptr.To(sourceState.Entries),
+		Entries:          ptr.To(state.Entries),
+		SourceContextCSN: sourceCSN,
+		ContextCSN:       csn,
+		LastCheckedTime:  ptr.To(metav1.Now()),
+	}
+
+	// The lag is unknown until the initial refresh has completed.
+	if csn != "" {
+		lag := sourceLatest.Sub(latest)
+		if lag < 0 {
+			lag = 0
+		}
+
+		status.Lag = &metav1.Duration{Duration: lag}
+	}
+
+	return status, nil
+}
+
+// migrationMessage summarizes the replication state of a migration.
+func migrationMessage(status *ldapv1alpha1.LDAPDirectoryMigrationStatus) string {
+	if status.Message != "" {
+		return "Failed to check replication state: " + status.Message
+	}
+
+	message := fmt.Sprintf("Replicated %d of %d entries", ptr.Deref(status.Entries, 0), ptr.Deref(status.SourceEntries, 0))
+	if status.Lag != nil {
+		message += fmt.Sprintf(" (lag %s)", status.Lag.Duration)
+	}
+
+	return message
+}
+
+// migrationSearchBase returns the base distinguished name of the replicated entries.
+func migrationSearchBase(directory *ldapv1alpha1.LDAPDirectory) (string, error) {
+	if directory.Spec.Migration.Source.SearchBase != "" {
+		return directory.Spec.Migration.Source.SearchBase, nil
+	}
+
+	return directory.GetDistinguishedName(context.Background(), nil, nil)
+}
+
+// migrationConfigRecords returns the cn=config modifications that configure
+// (or after a cutover, remove) the syncrepl consumer of the migration source.
+func (r *LDAPDirectoryReconciler) migrationConfigRecords(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) ([]ldif.Record, error) {
+	migration := directory.Spec.Migration
+
+	var syncrepl, updateRef []string
+	if !migration.Cutover {
+		bindPasswordSecret, ok, err := migration.Source.BindPasswordSecretRef.Resolve(ctx, r.Client, r.Scheme, directory)
+		if !ok && err == nil {
+			return nil, fmt.Errorf("referenced bind password secret not found")
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to resolve bind password secret reference: %w", err)
+		}
+
+		searchBase, err := migrationSearchBase(directory)
+		if err != nil {
+			return nil, err
+		}
+
+		params := []string{
+			"rid=001",
+			"provider=" + migration.Source.URL,
+			"bindmethod=simple",
+			"binddn=" + syncreplQuote(migration.Source.BindDN),
+			"credentials=" + syncreplQuote(string(bindPasswordSecret.(*corev1.Secret).Data["password"])),
+			"searchbase=" + syncreplQuote(searchBase),
+			"type=refreshAndPersist",
+			"retry=\"30 +\"",
+			"timeout=10",
+			"schemachecking=off",
+			"tls_reqcert=demand",
+		}
+
+		if migration.Source.CASecretRef != nil {
+			params = append(params, "tls_cacert="+migrationCACertFile)
+		}
+
+		syncrepl = []string{"{0}" + strings.Join(params, " ")}
+		// Writes are referred to the source until the directory is cut over.
+		updateRef = []string{migration.Source.URL}
+	}
+
+	// An empty replace removes the attribute (if it exists).
+	return []ldif.Record{
+		{
+			DN:         "olcDatabase={1}mdb,cn=config",
+			ChangeType: ldif.ChangeTypeModify,
+			Modifications: []ldif.Modification{
+				{
+					Attribute: ldif.Attribute{Name: "olcSyncrepl", Values: syncrepl},
+					Type:      ldif.ModificationTypeReplace,
+				},
+				{
+					Attribute: ldif.Attribute{Name: "olcUpdateRef", Values: updateRef},
+					Type:      ldif.ModificationTypeReplace,
+				},
+			},
+		},
+	}, nil
+}
+
+// syncreplQuote quotes a syncrepl parameter value.
+func syncreplQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+// addMigrationCAVolume mounts the CA bundle of the migration source in the
+// directory container (syncrepl connections are made by slapd).
+func addMigrationCAVolume(podSpec *corev1.PodSpec, directory *ldapv1alpha1.LDAPDirectory) {
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "migration-ca",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: directory.Spec.Migration.Source.CASecretRef.Name,
+				Items: []corev1.KeyToPath{
+					{Key: "ca.crt", Path: filepath.Base(migrationCACertFile)},
+				},
+			},
+		},
+	})
+
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == "openldap" {
+			podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, corev1.VolumeMount{
+				Name:      "migration-ca",
+				MountPath: filepath.Dir(migrationCACertFile),
+				ReadOnly:  true,
+			})
+		}
+	}
+}
+
+func (r *LDAPDirectoryReconciler) markMigrating(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) error {
+	key := client.ObjectKeyFromObject(directory)
+	err := updater.UpdateStatus(ctx, r.Client, key, directory, func() error {
+		directory.Status.ObservedGeneration = directory.ObjectMeta.Generation
+		directory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseMigrating
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark as migrating: %w", err)
+	}
+
+	return nil
+}
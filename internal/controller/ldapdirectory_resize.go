@@ -0,0 +1,233 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// reconcileVolumeExpansion expands the persistent volume claims of the directory
+// when the storage requests of its volume claim templates have been increased.
+// As statefulset volume claim templates are immutable, the statefulset is then
+// deleted (orphaning its pods) so that it can be recreated from the template.
+// Returns true if the statefulset is being recreated.
+func (r *LDAPDirectoryReconciler) reconcileVolumeExpansion(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, sts *appsv1.StatefulSet) (bool, error) {
+	logger := zaplogr.FromContext(ctx)
+
+	var existingSts appsv1.StatefulSet
+	if err := r.Get(ctx, client.ObjectKeyFromObject(sts), &existingSts); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to get statefulset: %w", err)
+	}
+
+	if !existingSts.GetDeletionTimestamp().IsZero() {
+		logger.Info("Waiting for statefulset to be deleted")
+
+		return true, nil
+	}
+
+	var expanded []corev1.PersistentVolumeClaim
+	for _, volumeClaimTemplate := range sts.Spec.VolumeClaimTemplates {
+		for _, existingVolumeClaimTemplate := range existingSts.Spec.VolumeClaimTemplates {
+			if existingVolumeClaimTemplate.Name != volumeClaimTemplate.Name {
+				continue
+			}
+
+			storage := volumeClaimTemplate.Spec.Resources.Requests[corev1.ResourceStorage]
+			existingStorage := existingVolumeClaimTemplate.Spec.Resources.Requests[corev1.ResourceStorage]
+			if storage.Cmp(existingStorage) > 0 {
+				expanded = append(expanded, volumeClaimTemplate)
+			}
+		}
+	}
+
+	if len(expanded) == 0 {
+		return false, r.checkVolumeExpansion(ctx, directory, &existingSts)
+	}
+
+	replicas := int32(1)
+	if existingSts.Spec.Replicas != nil {
+		replicas = *existingSts.Spec.Replicas
+	}
+
+	// A suspended directory keeps the volume claims of its replica.
+	if replicas == 0 {
+		replicas = 1
+	}
+
+	for _, volumeClaimTemplate := range expanded {
+		storage := volumeClaimTemplate.Spec.Resources.Requests[corev1.ResourceStorage]
+
+		for i := int32(0); i < replicas; i++ {
+			var pvc corev1.PersistentVolumeClaim
+			key := types.NamespacedName{
+				Name:      fmt.Sprintf("%s-%s-%d", volumeClaimTemplate.Name, existingSts.Name, i),
+				Namespace: existingSts.Namespace,
+			}
+
+			if err := r.Get(ctx, key, &pvc); err != nil {
+				if apierrors.IsNotFound(err) {
+					// Will be created (with the new size) by the statefulset.
+					continue
+				}
+
+				return false, fmt.Errorf("failed to get persistent volume claim: %w", err)
+			}
+
+			if err := r.expandPersistentVolumeClaim(ctx, &pvc, storage); err != nil {
+				if err := r.setCondition(ctx, directory, metav1.Condition{
+					Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeResizing),
+					Status:  metav1.ConditionFalse,
+					Reason:  "Failed",
+					Message: err.Error(),
+				}); err != nil {
+					return false, err
+				}
+
+				return false, err
+			}
+		}
+	}
+
+	logger.Info("Recreating statefulset with expanded volume claim templates")
+
+	r.Recorder.Event(directory, corev1.EventTypeNormal,
+		"Resizing", "Expanding persistent volume claims")
+
+	if err := r.setCondition(ctx, directory, metav1.Condition{
+		Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeResizing),
+		Status:  metav1.ConditionTrue,
+		Reason:  "Resizing",
+		Message: "Expanding persistent volume claims",
+	}); err != nil {
+		return false, err
+	}
+
+	// Orphan the pods (and persistent volume claims) so the directory keeps running.
+	if err := r.Delete(ctx, &existingSts, client.PropagationPolicy(metav1.DeletePropagationOrphan)); err != nil && !apierrors.IsNotFound(err) {
+		return false, fmt.Errorf("failed to delete statefulset: %w", err)
+	}
+
+	return true, nil
+}
+
+// expandPersistentVolumeClaim increases the storage request of a persistent
+// volume claim, if its storage class allows volume expansion.
+func (r *LDAPDirectoryReconciler) expandPersistentVolumeClaim(ctx context.Context, pvc *corev1.PersistentVolumeClaim, storage resource.Quantity) error {
+	existingStorage := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if existingStorage.Cmp(storage) >= 0 {
+		return nil
+	}
+
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return fmt.Errorf("persistent volume claim %q has no storage class", pvc.Name)
+	}
+
+	var storageClass storagev1.StorageClass
+	if err := r.Get(ctx, client.ObjectKey{Name: *pvc.Spec.StorageClassName}, &storageClass); err != nil {
+		return fmt.Errorf("failed to get storage class: %w", err)
+	}
+
+	if storageClass.AllowVolumeExpansion == nil || !*storageClass.AllowVolumeExpansion {
+		return fmt.Errorf("storage class %q does not allow volume expansion", storageClass.Name)
+	}
+
+	zaplogr.FromContext(ctx).Info("Expanding persistent volume claim",
+		zap.String("pvc", pvc.Name), zap.String("storage", storage.String()))
+
+	patch := client.MergeFrom(pvc.DeepCopy())
+	if pvc.Spec.Resources.Requests == nil {
+		pvc.Spec.Resources.Requests = corev1.ResourceList{}
+	}
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = storage
+
+	if err := r.Patch(ctx, pvc, patch); err != nil {
+		return fmt.Errorf("failed to expand persistent volume claim: %w", err)
+	}
+
+	return nil
+}
+
+// checkVolumeExpansion clears the resizing condition once the capacity of
+// every persistent volume claim of the directory matches its storage request.
+func (r *LDAPDirectoryReconciler) checkVolumeExpansion(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, sts *appsv1.StatefulSet) error {
+	if !meta.IsStatusConditionTrue(directory.Status.Conditions, string(ldapv1alpha1.LDAPDirectoryConditionTypeResizing)) {
+		return nil
+	}
+
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := r.List(ctx, &pvcs, client.InNamespace(sts.Namespace),
+		client.MatchingLabels(sts.Spec.Selector.MatchLabels)); err != nil {
+		return fmt.Errorf("failed to list persistent volume claims: %w", err)
+	}
+
+	for _, pvc := range pvcs.Items {
+		storage := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		capacity := pvc.Status.Capacity[corev1.ResourceStorage]
+		if capacity.Cmp(storage) < 0 {
+			zaplogr.FromContext(ctx).Info("Waiting for persistent volume claim to be expanded", zap.String("pvc", pvc.Name))
+
+			return nil
+		}
+	}
+
+	r.Recorder.Event(directory, corev1.EventTypeNormal,
+		"Resized", "Successfully expanded persistent volume claims")
+
+	return r.setCondition(ctx, directory, metav1.Condition{
+		Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeResizing),
+		Status:  metav1.ConditionFalse,
+		Reason:  "Resized",
+		Message: "Successfully expanded persistent volume claims",
+	})
+}
+
+// persistentVolumeClaimToDirectory maps persistent volume claims (created from
+// the statefulset volume claim templates) to their directory.
+func persistentVolumeClaimToDirectory(ctx context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	if labels["app.kubernetes.io/name"] != "ldap" || labels["app.kubernetes.io/instance"] == "" {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{
+			NamespacedName: types.NamespacedName{
+				Name:      labels["app.kubernetes.io/instance"],
+				Namespace: obj.GetNamespace(),
+			},
+		},
+	}
+}
@@ -0,0 +1,707 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/operator-utils/updater"
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// upgradeStagingDir is where the staging volume is mounted in upgrade jobs.
+	upgradeStagingDir = "/staging"
+	// upgradeContainerName is the name of the container in upgrade jobs.
+	upgradeContainerName = "upgrade"
+	// upgradeVerifyTimeout is how long the directory has to become ready with
+	// the new image, before the upgrade is rolled back.
+	upgradeVerifyTimeout = 10 * time.Minute
+)
+
+// upgradeExportScript returns a script that exports the configuration and
+// data of the directory (including every additional database) as LDIF, backs
+// up the raw databases (for rollback), and reports the number of exported
+// entries (see parseUpgradeEntries).
+func upgradeExportScript(databases []ldapv1alpha1.LDAPDirectoryDatabase) string {
+	var script strings.Builder
+
+	script.WriteString(`set -eu
+find /staging -mindepth 1 -delete
+mkdir -p /staging/databases
+slapcat -F /etc/ldap/slapd.d -n 0 -l /staging/config.ldif
+slapcat -F /etc/ldap/slapd.d -n 1 -l /staging/data.ldif
+`)
+
+	for _, database := range databases {
+		fmt.Fprintf(&script, "slapcat -F /etc/ldap/slapd.d -b %s -l /staging/databases/%s.ldif\n",
+			shellQuote(database.Suffix), database.Name)
+	}
+
+	script.WriteString(`mkdir -p /staging/backup
+cp -a /etc/ldap/slapd.d /staging/backup/config
+cp -a /var/lib/ldap /staging/backup/data
+grep -c '^dn:' /staging/data.ldif > /dev/termination-log || true
+`)
+
+	for _, database := range databases {
+		fmt.Fprintf(&script, "echo \"%s $(grep -c '^dn:' /staging/databases/%s.ldif || true)\" >> /dev/termination-log\n",
+			database.Name, database.Name)
+	}
+
+	return script.String()
+}
+
+// upgradeImportScript returns a script that replaces the configuration and
+// data of the directory (including every additional database) with the
+// exported LDIF, and reports the number of imported entries.
+func upgradeImportScript(databases []ldapv1alpha1.LDAPDirectoryDatabase) string {
+	var script strings.Builder
+
+	script.WriteString(`set -eu
+find /etc/ldap/slapd.d /var/lib/ldap -mindepth 1 -delete
+mkdir -p ` + accessLogDir + `
+`)
+
+	for _, database := range databases {
+		fmt.Fprintf(&script, "mkdir -p /var/lib/ldap/%s\n", database.Name)
+	}
+
+	script.WriteString(`slapadd -F /etc/ldap/slapd.d -n 0 -l /staging/config.ldif
+slapadd -F /etc/ldap/slapd.d -n 1 -l /staging/data.ldif
+`)
+
+	for _, database := range databases {
+		fmt.Fprintf(&script, "slapadd -F /etc/ldap/slapd.d -b %s -l /staging/databases/%s.ldif\n",
+			shellQuote(database.Suffix), database.Name)
+	}
+
+	script.WriteString(`chown -R openldap:openldap /etc/ldap/slapd.d /var/lib/ldap
+slapcat -F /etc/ldap/slapd.d -n 1 | grep -c '^dn:' > /dev/termination-log || true
+`)
+
+	for _, database := range databases {
+		fmt.Fprintf(&script, "echo \"%s $(slapcat -F /etc/ldap/slapd.d -b %s | grep -c '^dn:' || true)\" >> /dev/termination-log\n",
+			database.Name, shellQuote(database.Suffix))
+	}
+
+	return script.String()
+}
+
+// parseUpgradeEntries parses the number of entries reported by an export or
+// import job. The first line is the number of entries in the main database,
+// followed by a "<name> <entries>" line for each additional database.
+func parseUpgradeEntries(message string) (int, map[string]int, error) {
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+
+	entries, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var databaseEntries map[string]int
+	for _, line := range lines[1:] {
+		name, n, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			return 0, nil, fmt.Errorf("malformed line: %q", line)
+		}
+
+		count, err := strconv.Atoi(n)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if databaseEntries == nil {
+			databaseEntries = make(map[string]int)
+		}
+		databaseEntries[name] = count
+	}
+
+	return entries, databaseEntries, nil
+}
+
+// exportedDatabases returns the additional databases that were exported, as
+// databases added part way through an upgrade won't have been.
+func exportedDatabases(directory *ldapv1alpha1.LDAPDirectory) []ldapv1alpha1.LDAPDirectoryDatabase {
+	var databases []ldapv1alpha1.LDAPDirectoryDatabase
+	for _, database := range directory.Spec.Databases {
+		if _, ok := directory.Status.Upgrade.ExportedDatabaseEntries[database.Name]; ok {
+			databases = append(databases, database)
+		}
+	}
+
+	return databases
+}
+
+// shellQuote quotes a value so it can be safely used as a single word in a
+// shell script.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// upgradeRollbackScript restores the configuration and data of the directory
+// from the backup taken during export.
+const upgradeRollbackScript = `set -eu
+find /etc/ldap/slapd.d /var/lib/ldap -mindepth 1 -delete
+cp -a /staging/backup/config/. /etc/ldap/slapd.d/
+cp -a /staging/backup/data/. /var/lib/ldap/
+`
+
+// directoryImage returns the image the directory should be run with, this
+// only follows spec.image once an upgrade has completed.
+func directoryImage(directory *ldapv1alpha1.LDAPDirectory) string {
+	if directory.Status.CurrentImage != "" {
+		return directory.Status.CurrentImage
+	}
+
+	return directory.Spec.Image
+}
+
+// reconcileUpgrade migrates the contents of the directory to a new image by
+// exporting them with the current image and importing them with the new image.
+// The statefulset is scaled down for the duration of the upgrade.
+// Returns true while an upgrade is in progress.
+func (r *LDAPDirectoryReconciler) reconcileUpgrade(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, sts *appsv1.StatefulSet) (bool, error) {
+	logger := zaplogr.FromContext(ctx)
+
+	if directory.Status.CurrentImage == "" {
+		return false, r.updateUpgradeStatus(ctx, directory, func() {
+			directory.Status.CurrentImage = directory.Spec.Image
+		})
+	}
+
+	upgrade := directory.Status.Upgrade
+
+	if upgrade != nil && upgrade.Step == ldapv1alpha1.LDAPDirectoryUpgradeStepVerify && directory.Status.CurrentImage == directory.Spec.Image {
+		// The backup is kept until the directory is ready with the new image.
+		if directory.Status.Phase != ldapv1alpha1.LDAPDirectoryPhaseReady {
+			message, err := r.upgradeVerifyFailure(ctx, directory)
+			if err != nil {
+				return false, err
+			}
+
+			if message == "" {
+				logger.Info("Waiting for upgraded directory to become ready")
+
+				return false, nil
+			}
+
+			r.Recorder.Eventf(directory, corev1.EventTypeWarning,
+				"Failed", "%s, rolling back", message)
+
+			// The backup is restored with (and the directory restarted on) the previous image.
+			return true, r.updateUpgradeStatus(ctx, directory, func() {
+				directory.Status.CurrentImage = upgrade.FromImage
+				directory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseUpgrading
+				directory.Status.Upgrade.Step = ldapv1alpha1.LDAPDirectoryUpgradeStepRollback
+				directory.Status.Upgrade.Message = message
+			})
+		}
+
+		if err := r.cleanupUpgrade(ctx, directory, sts); err != nil {
+			return false, err
+		}
+
+		r.Recorder.Eventf(directory, corev1.EventTypeNormal,
+			"Upgraded", "Successfully upgraded to %s", upgrade.ToImage)
+
+		if err := r.updateUpgradeStatus(ctx, directory, func() {
+			directory.Status.Upgrade = nil
+		}); err != nil {
+			return false, err
+		}
+
+		return false, r.setCondition(ctx, directory, metav1.Condition{
+			Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeUpgraded),
+			Status:  metav1.ConditionTrue,
+			Reason:  "Upgraded",
+			Message: fmt.Sprintf("Upgraded to %s", upgrade.ToImage),
+		})
+	}
+
+	if directory.Status.CurrentImage == directory.Spec.Image {
+		if upgrade != nil {
+			// The image was reverted (eg. after a failed upgrade).
+			if err := r.cleanupUpgrade(ctx, directory, sts); err != nil {
+				return false, err
+			}
+
+			return false, r.updateUpgradeStatus(ctx, directory, func() {
+				directory.Status.Upgrade = nil
+			})
+		}
+
+		return false, nil
+	}
+
+	if upgrade != nil && upgrade.ToImage == directory.Spec.Image && upgrade.Step == ldapv1alpha1.LDAPDirectoryUpgradeStepRolledBack {
+		return false, nil
+	}
+
+	if upgrade == nil || upgrade.ToImage != directory.Spec.Image || upgrade.Step == ldapv1alpha1.LDAPDirectoryUpgradeStepRolledBack {
+		logger.Info("Starting upgrade",
+			zap.String("from", directory.Status.CurrentImage), zap.String("to", directory.Spec.Image))
+
+		r.Recorder.Eventf(directory, corev1.EventTypeNormal,
+			"Upgrading", "Upgrading from %s to %s", directory.Status.CurrentImage, directory.Spec.Image)
+
+		// Remove any leftovers of a previous upgrade.
+		if err := r.cleanupUpgrade(ctx, directory, sts); err != nil {
+			return false, err
+		}
+
+		if err := r.updateUpgradeStatus(ctx, directory, func() {
+			directory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseUpgrading
+			directory.Status.Upgrade = &ldapv1alpha1.LDAPDirectoryUpgradeStatus{
+				FromImage: directory.Status.CurrentImage,
+				ToImage:   directory.Spec.Image,
+				Step:      ldapv1alpha1.LDAPDirectoryUpgradeStepExport,
+			}
+		}); err != nil {
+			return false, err
+		}
+
+		upgrade = directory.Status.Upgrade
+	}
+
+	// The volumes of the directory can only be mounted by one pod at a time.
+	sts.Spec.Replicas = ptr.To(int32(0))
+	if _, err := updater.CreateOrUpdateFromTemplate(ctx, r.Client, sts); err != nil {
+		return false, fmt.Errorf("failed to scale down statefulset: %w", err)
+	}
+
+	var existingSts appsv1.StatefulSet
+	if err := r.Get(ctx, client.ObjectKeyFromObject(sts), &existingSts); err != nil {
+		return false, fmt.Errorf("failed to get statefulset: %w", err)
+	}
+
+	if existingSts.Status.Replicas > 0 {
+		logger.Info("Waiting for statefulset to scale down")
+
+		return true, nil
+	}
+
+	if err := r.reconcileUpgradeStagingVolume(ctx, directory); err != nil {
+		return false, err
+	}
+
+	switch upgrade.Step {
+	case ldapv1alpha1.LDAPDirectoryUpgradeStepExport:
+		job, result, err := r.runUpgradeJob(ctx, directory, sts, "export", upgrade.FromImage,
+			upgradeExportScript(directory.Spec.Databases))
+		if err != nil || job == nil {
+			return true, err
+		}
+
+		if job.Status.Failed > 0 {
+			// Nothing has been changed yet, so there is nothing to roll back.
+			return true, r.failUpgrade(ctx, directory, sts, ldapv1alpha1.LDAPDirectoryUpgradeStepRolledBack,
+				"Failed to export directory")
+		}
+
+		entries, databaseEntries, err := parseUpgradeEntries(result)
+		if err != nil {
+			return true, fmt.Errorf("failed to parse export job result: %w", err)
+		}
+
+		logger.Info("Exported directory", zap.Int("entries", entries))
+
+		return true, r.updateUpgradeStatus(ctx, directory, func() {
+			directory.Status.Upgrade.Step = ldapv1alpha1.LDAPDirectoryUpgradeStepImport
+			directory.Status.Upgrade.ExportedEntries = ptr.To(entries)
+			directory.Status.Upgrade.ExportedDatabaseEntries = databaseEntries
+		})
+	case ldapv1alpha1.LDAPDirectoryUpgradeStepImport:
+		job, result, err := r.runUpgradeJob(ctx, directory, sts, "import", upgrade.ToImage,
+			upgradeImportScript(exportedDatabases(directory)))
+		if err != nil || job == nil {
+			return true, err
+		}
+
+		if job.Status.Failed > 0 {
+			return true, r.failUpgrade(ctx, directory, sts, ldapv1alpha1.LDAPDirectoryUpgradeStepRollback,
+				"Failed to import directory")
+		}
+
+		entries, databaseEntries, err := parseUpgradeEntries(result)
+		if err != nil {
+			return true, fmt.Errorf("failed to parse import job result: %w", err)
+		}
+
+		if upgrade.ExportedEntries == nil || entries != *upgrade.ExportedEntries {
+			return true, r.failUpgrade(ctx, directory, sts, ldapv1alpha1.LDAPDirectoryUpgradeStepRollback,
+				fmt.Sprintf("Imported %d entries but exported %d", entries, ptr.Deref(upgrade.ExportedEntries, 0)))
+		}
+
+		for _, database := range exportedDatabases(directory) {
+			exported := upgrade.ExportedDatabaseEntries[database.Name]
+			if imported := databaseEntries[database.Name]; imported != exported {
+				return true, r.failUpgrade(ctx, directory, sts, ldapv1alpha1.LDAPDirectoryUpgradeStepRollback,
+					fmt.Sprintf("Imported %d entries into database %q but exported %d", imported, database.Name, exported))
+			}
+		}
+
+		logger.Info("Imported directory", zap.Int("entries", entries))
+
+		// The staging volume holds the only backup of the directory, so it is
+		// kept until the directory is ready with the new image.
+		if err := r.cleanupUpgradeJobs(ctx, directory); err != nil {
+			return false, err
+		}
+
+		// Requeue so the statefulset is recreated with the new image.
+		return true, r.updateUpgradeStatus(ctx, directory, func() {
+			now := metav1.Now()
+
+			directory.Status.CurrentImage = upgrade.ToImage
+			directory.Status.Upgrade.Step = ldapv1alpha1.LDAPDirectoryUpgradeStepVerify
+			directory.Status.Upgrade.VerifyStartTime = &now
+			directory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhasePending
+		})
+	case ldapv1alpha1.LDAPDirectoryUpgradeStepRollback:
+		job, _, err := r.runUpgradeJob(ctx, directory, sts, "rollback", upgrade.FromImage, upgradeRollbackScript)
+		if err != nil || job == nil {
+			return true, err
+		}
+
+		if job.Status.Failed > 0 {
+			// The backup is kept on the staging volume for manual recovery.
+			return true, fmt.Errorf("failed to roll back upgrade, manual recovery is required")
+		}
+
+		logger.Info("Rolled back upgrade")
+
+		return true, r.failUpgrade(ctx, directory, sts, ldapv1alpha1.LDAPDirectoryUpgradeStepRolledBack, upgrade.Message)
+	default:
+		return false, fmt.Errorf("unknown upgrade step: %s", upgrade.Step)
+	}
+}
+
+// upgradeVerifyFailure returns why the directory has failed to become ready
+// with the new image, or an empty string if it may still become ready.
+func (r *LDAPDirectoryReconciler) upgradeVerifyFailure(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) (string, error) {
+	var pod corev1.Pod
+	err := r.Get(ctx, client.ObjectKey{Name: "ldap-" + directory.Name + "-0", Namespace: directory.Namespace}, &pod)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("failed to get directory pod: %w", err)
+	}
+
+	containerStatuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+	for _, status := range containerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason == "CrashLoopBackOff" {
+			return fmt.Sprintf("Container %q is crash looping with the new image", status.Name), nil
+		}
+	}
+
+	startTime := directory.Status.Upgrade.VerifyStartTime
+	if startTime != nil && time.Since(startTime.Time) > upgradeVerifyTimeout {
+		return fmt.Sprintf("Directory did not become ready with the new image within %s", upgradeVerifyTimeout), nil
+	}
+
+	return "", nil
+}
+
+// failUpgrade moves the upgrade to a rollback step.
+func (r *LDAPDirectoryReconciler) failUpgrade(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, sts *appsv1.StatefulSet, step ldapv1alpha1.LDAPDirectoryUpgradeStep, message string) error {
+	if step != ldapv1alpha1.LDAPDirectoryUpgradeStepRolledBack {
+		r.Recorder.Eventf(directory, corev1.EventTypeWarning,
+			"Failed", "%s, rolling back", message)
+
+		return r.updateUpgradeStatus(ctx, directory, func() {
+			directory.Status.Upgrade.Step = step
+			directory.Status.Upgrade.Message = message
+		})
+	}
+
+	if err := r.cleanupUpgrade(ctx, directory, sts); err != nil {
+		return err
+	}
+
+	r.Recorder.Eventf(directory, corev1.EventTypeWarning,
+		"RolledBack", "Upgrade to %s rolled back: %s", directory.Status.Upgrade.ToImage, message)
+
+	if err := r.updateUpgradeStatus(ctx, directory, func() {
+		directory.Status.Upgrade.Step = step
+		directory.Status.Upgrade.Message = message
+		directory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhasePending
+	}); err != nil {
+		return err
+	}
+
+	return r.setCondition(ctx, directory, metav1.Condition{
+		Type:    string(ldapv1alpha1.LDAPDirectoryConditionTypeUpgraded),
+		Status:  metav1.ConditionFalse,
+		Reason:  "RolledBack",
+		Message: message,
+	})
+}
+
+// runUpgradeJob creates the named upgrade job (if it doesn't exist), and
+// returns it once it has finished along with the result reported by the job
+// (eg. the number of exported entries).
+func (r *LDAPDirectoryReconciler) runUpgradeJob(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, sts *appsv1.StatefulSet, name, image, script string) (*batchv1.Job, string, error) {
+	logger := zaplogr.FromContext(ctx).With(zap.String("job", name))
+
+	job := r.upgradeJobTemplate(directory, sts, name, image, script)
+	if err := controllerutil.SetControllerReference(directory, job, r.Scheme); err != nil {
+		return nil, "", fmt.Errorf("failed to set controller reference: %w", err)
+	}
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(job), job); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, "", fmt.Errorf("failed to get %s job: %w", name, err)
+		}
+
+		logger.Info("Creating upgrade job")
+
+		if err := r.Create(ctx, job); err != nil {
+			return nil, "", fmt.Errorf("failed to create %s job: %w", name, err)
+		}
+
+		return nil, "", nil
+	}
+
+	if job.Status.Failed > 0 {
+		return job, "", nil
+	}
+
+	if job.Status.Succeeded == 0 {
+		logger.Info("Waiting for upgrade job to complete")
+
+		return nil, "", nil
+	}
+
+	if name == "rollback" {
+		return job, "", nil
+	}
+
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(job.Namespace),
+		client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return nil, "", fmt.Errorf("failed to list %s job pods: %w", name, err)
+	}
+
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name != upgradeContainerName || status.State.Terminated == nil || status.State.Terminated.ExitCode != 0 {
+				continue
+			}
+
+			return job, status.State.Terminated.Message, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("failed to find %s job result", name)
+}
+
+func (r *LDAPDirectoryReconciler) upgradeJobTemplate(directory *ldapv1alpha1.LDAPDirectory, sts *appsv1.StatefulSet, name, image, script string) *batchv1.Job {
+	// The volumes of the first (and only) statefulset pod.
+	claimName := func(volumeClaimTemplateName string) string {
+		return fmt.Sprintf("%s-%s-0", volumeClaimTemplateName, sts.Name)
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      upgradeResourceName(directory) + "-" + name,
+			Namespace: directory.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       "directory",
+				"app.kubernetes.io/instance":   directory.Name,
+				"app.kubernetes.io/component":  "upgrade",
+				"app.kubernetes.io/managed-by": "ldap-operator",
+			},
+		},
+		Spec: batchv1.JobSpec{
+			// Steps are not safe to retry.
+			BackoffLimit: ptr.To(int32(0)),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					SecurityContext: &corev1.PodSecurityContext{
+						// The default Debian OpenLDAP group.
+						FSGroup: ptr.To(int64(101)),
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    upgradeContainerName,
+							Image:   image,
+							Command: []string{"/bin/sh", "-c", script},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "config",
+									MountPath: "/etc/ldap/slapd.d",
+								},
+								{
+									Name:      "data",
+									MountPath: "/var/lib/ldap",
+								},
+								{
+									Name:      "staging",
+									MountPath: upgradeStagingDir,
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "config",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: claimName("config"),
+								},
+							},
+						},
+						{
+							Name: "data",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: claimName("data"),
+								},
+							},
+						},
+						{
+							Name: "staging",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: upgradeResourceName(directory),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// reconcileUpgradeStagingVolume creates the volume that holds the exported
+// LDIF and the backup of the directory. It is sized to hold two copies of the
+// data volume, and one of the config volume.
+func (r *LDAPDirectoryReconciler) reconcileUpgradeStagingVolume(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) error {
+	var storage resource.Quantity
+	var storageClassName *string
+	for _, volumeClaimTemplate := range directory.GetVolumeClaimTemplates() {
+		request := volumeClaimTemplate.Spec.Resources.Requests[corev1.ResourceStorage]
+
+		switch volumeClaimTemplate.Name {
+		case "data":
+			storage.Add(request)
+			storage.Add(request)
+			storageClassName = volumeClaimTemplate.Spec.StorageClassName
+		case "config":
+			storage.Add(request)
+		}
+	}
+
+	pvc := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      upgradeResourceName(directory),
+			Namespace: directory.Namespace,
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, &pvc, func() error {
+		// The spec of a persistent volume claim is immutable after creation.
+		if pvc.CreationTimestamp.IsZero() {
+			pvc.Spec = corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{
+					corev1.ReadWriteOnce,
+				},
+				StorageClassName: storageClassName,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: storage,
+					},
+				},
+			}
+		}
+
+		return controllerutil.SetControllerReference(directory, &pvc, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reconcile upgrade staging volume: %w", err)
+	}
+
+	return nil
+}
+
+// cleanupUpgrade removes the upgrade jobs and staging volume.
+func (r *LDAPDirectoryReconciler) cleanupUpgrade(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, sts *appsv1.StatefulSet) error {
+	if err := r.cleanupUpgradeJobs(ctx, directory); err != nil {
+		return err
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:      upgradeResourceName(directory),
+		Namespace: directory.Namespace,
+	}}
+
+	if err := r.Delete(ctx, pvc); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s: %w", pvc.Name, err)
+	}
+
+	return nil
+}
+
+// cleanupUpgradeJobs removes the upgrade jobs (and their pods).
+func (r *LDAPDirectoryReconciler) cleanupUpgradeJobs(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory) error {
+	for _, name := range []string{"export", "import", "rollback"} {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+			Name:      upgradeResourceName(directory) + "-" + name,
+			Namespace: directory.Namespace,
+		}}
+
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s: %w", job.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *LDAPDirectoryReconciler) updateUpgradeStatus(ctx context.Context, directory *ldapv1alpha1.LDAPDirectory, f func()) error {
+	key := client.ObjectKeyFromObject(directory)
+	err := updater.UpdateStatus(ctx, r.Client, key, directory, func() error {
+		f()
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update upgrade status: %w", err)
+	}
+
+	return nil
+}
+
+func upgradeResourceName(directory *ldapv1alpha1.LDAPDirectory) string {
+	return "ldap-" + directory.Name + "-upgrade"
+}
@@ -0,0 +1,562 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/configagent"
+	"github.com/gpu-ninja/operator-utils/updater"
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+//+kubebuilder:rbac:groups=ldap.gpu-ninja.com,resources=ldapdirectorysnapshots,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=ldap.gpu-ninja.com,resources=ldapdirectorysnapshots/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=ldap.gpu-ninja.com,resources=ldapdirectorysnapshots/finalizers,verbs=update
+//+kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create
+
+const (
+	// snapshotFreezeTimeout is how long a directory is held read-only waiting for
+	// its volumes to be snapshotted, before the snapshot is failed.
+	snapshotFreezeTimeout = 5 * time.Minute
+	// frozenByAnnotation is set on a directory to the name of the snapshot that
+	// has frozen it. It is claimed with an optimistic lock, so that only one
+	// snapshot of a directory freezes (and unfreezes) it at a time.
+	frozenByAnnotation = "ldap.gpu-ninja.com/frozen-by"
+)
+
+// snapshotVolumes are the volume claim templates of a directory that are snapshotted.
+var snapshotVolumes = []string{"config", "data"}
+
+// volumeSnapshotGVK is the kind of CSI volume snapshots. Snapshots are
+// managed as unstructured objects, so that the operator does not require the
+// snapshot CRDs to be installed (unless snapshots are used).
+var volumeSnapshotGVK = schema.GroupVersionKind{
+	Group:   "snapshot.storage.k8s.io",
+	Version: "v1",
+	Kind:    "VolumeSnapshot",
+}
+
+// LDAPDirectorySnapshotReconciler takes CSI volume snapshots of the volumes
+// of a directory. So that the snapshots are crash-consistent, the databases
+// of the directory are read-only (frozen) until the volumes have been snapshotted.
+type LDAPDirectorySnapshotReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	// ConfigAgentClient is used to freeze the directory, through its config agent sidecar.
+	ConfigAgentClient configagent.Client
+}
+
+func (r *LDAPDirectorySnapshotReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := zaplogr.FromContext(ctx)
+
+	var snapshot ldapv1alpha1.LDAPDirectorySnapshot
+	if err := r.Get(ctx, req.NamespacedName, &snapshot); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	if !snapshot.GetDeletionTimestamp().IsZero() {
+		logger.Info("Deleting")
+
+		// Don't leave the directory read-only.
+		if err := r.unfreeze(ctx, &snapshot); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if controllerutil.ContainsFinalizer(&snapshot, FinalizerName) {
+			logger.Info("Removing Finalizer")
+
+			_, err := controllerutil.CreateOrPatch(ctx, r.Client, &snapshot, func() error {
+				controllerutil.RemoveFinalizer(&snapshot, FinalizerName)
+
+				return nil
+			})
+			if err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to remove finalizer: %w", err)
+			}
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	if snapshot.Status.Phase == ldapv1alpha1.LDAPDirectorySnapshotPhaseReady ||
+		snapshot.Status.Phase == ldapv1alpha1.LDAPDirectorySnapshotPhaseFailed {
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(&snapshot, FinalizerName) {
+		logger.Info("Adding Finalizer")
+
+		_, err := controllerutil.CreateOrPatch(ctx, r.Client, &snapshot, func() error {
+			controllerutil.AddFinalizer(&snapshot, FinalizerName)
+
+			return nil
+		})
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to add finalizer: %w", err)
+		}
+	}
+
+	ok, err := snapshot.ResolveReferences(ctx, r.Client, r.Scheme)
+	if !ok && err == nil {
+		logger.Info("Not all references are resolvable, requeuing")
+
+		r.Recorder.Event(&snapshot, corev1.EventTypeWarning,
+			"NotReady", "Not all references are resolvable")
+
+		if err := r.markPending(ctx, &snapshot); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+	} else if err != nil {
+		r.Recorder.Eventf(&snapshot, corev1.EventTypeWarning,
+			"Failed", "Failed to resolve references: %s", err)
+
+		return ctrl.Result{}, fmt.Errorf("failed to resolve references: %w", err)
+	}
+
+	directoryObj, _, err := snapshot.Spec.DirectoryRef.Resolve(ctx, r.Client, r.Scheme, &snapshot)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to resolve directory reference: %w", err)
+	}
+	directory := directoryObj.(*ldapv1alpha1.LDAPDirectory)
+
+	if directory.Spec.External != nil {
+		return r.fail(ctx, &snapshot, fmt.Errorf("external directories cannot be snapshotted"))
+	}
+
+	if len(snapshot.Status.VolumeSnapshots) == 0 {
+		// The volumes of a suspended directory are already consistent.
+		suspended := directory.Status.Phase == ldapv1alpha1.LDAPDirectoryPhaseSuspended
+
+		if !suspended && directory.Status.Phase != ldapv1alpha1.LDAPDirectoryPhaseReady {
+			logger.Info("Referenced directory not ready",
+				zap.String("namespace", directory.Namespace),
+				zap.String("name", directory.Name))
+
+			r.Recorder.Event(&snapshot, corev1.EventTypeWarning,
+				"NotReady", "Referenced directory is not ready")
+
+			if err := r.markPending(ctx, &snapshot); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+		}
+
+		if !suspended {
+			locked, err := r.lockDirectory(ctx, &snapshot, directory)
+			if err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to lock directory: %w", err)
+			}
+
+			if !locked {
+				logger.Info("Referenced directory is being snapshotted, requeuing")
+
+				r.Recorder.Event(&snapshot, corev1.EventTypeWarning,
+					"NotReady", "Referenced directory is being snapshotted")
+
+				if err := r.markPending(ctx, &snapshot); err != nil {
+					return ctrl.Result{}, err
+				}
+
+				return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+			}
+
+			if err := r.freeze(ctx, &snapshot, directory); err != nil {
+				r.Recorder.Eventf(&snapshot, corev1.EventTypeWarning,
+					"Failed", "Failed to freeze directory: %s", err)
+
+				return ctrl.Result{}, fmt.Errorf("failed to freeze directory: %w", err)
+			}
+		}
+
+		logger.Info("Creating volume snapshots")
+
+		volumeSnapshots, err := r.createVolumeSnapshots(ctx, &snapshot, directory)
+		if err != nil {
+			r.Recorder.Eventf(&snapshot, corev1.EventTypeWarning,
+				"Failed", "Failed to create volume snapshots: %s", err)
+
+			return ctrl.Result{}, fmt.Errorf("failed to create volume snapshots: %w", err)
+		}
+
+		r.Recorder.Eventf(&snapshot, corev1.EventTypeNormal,
+			"Snapshotting", "Snapshotting volumes of directory %s", directory.Name)
+
+		key := client.ObjectKeyFromObject(&snapshot)
+		err = updater.UpdateStatus(ctx, r.Client, key, &snapshot, func() error {
+			now := metav1.Now()
+
+			snapshot.Status.Phase = ldapv1alpha1.LDAPDirectorySnapshotPhaseInProgress
+			snapshot.Status.VolumeSnapshots = volumeSnapshots
+			snapshot.Status.StartTime = &now
+
+			return nil
+		})
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update status: %w", err)
+		}
+	}
+
+	taken, ready, err := r.checkVolumeSnapshots(ctx, &snapshot)
+	if err != nil {
+		return r.fail(ctx, &snapshot, err)
+	}
+
+	frozen := meta.FindStatusCondition(snapshot.Status.Conditions, string(ldapv1alpha1.LDAPDirectorySnapshotConditionTypeFrozen))
+	if frozen != nil && frozen.Status == metav1.ConditionTrue {
+		if !taken {
+			if time.Since(frozen.LastTransitionTime.Time) > snapshotFreezeTimeout {
+				return r.fail(ctx, &snapshot,
+					fmt.Errorf("volumes were not snapshotted within %s", snapshotFreezeTimeout))
+			}
+
+			logger.Info("Waiting for volume snapshots to be taken")
+
+			return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+		}
+
+		logger.Info("Volume snapshots taken, unfreezing directory")
+
+		if err := r.unfreeze(ctx, &snapshot); err != nil {
+			r.Recorder.Eventf(&snapshot, corev1.EventTypeWarning,
+				"Failed", "Failed to unfreeze directory: %s", err)
+
+			return ctrl.Result{}, fmt.Errorf("failed to unfreeze directory: %w", err)
+		}
+	}
+
+	if !ready {
+		logger.Info("Waiting for volume snapshots to become ready")
+
+		return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+	}
+
+	r.Recorder.Event(&snapshot, corev1.EventTypeNormal,
+		"Created", "Successfully created")
+
+	key := client.ObjectKeyFromObject(&snapshot)
+	err = updater.UpdateStatus(ctx, r.Client, key, &snapshot, func() error {
+		now := metav1.Now()
+
+		snapshot.Status.Phase = ldapv1alpha1.LDAPDirectorySnapshotPhaseReady
+		snapshot.Status.CompletionTime = &now
+
+		return nil
+	})
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to mark as ready: %w", err)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *LDAPDirectorySnapshotReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Volume snapshots are polled, as watching them would require the snapshot CRDs.
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ldapv1alpha1.LDAPDirectorySnapshot{}).
+		Complete(r)
+}
+
+// createVolumeSnapshots creates a volume snapshot of each of the volumes of
+// the directory (owned by the snapshot).
+func (r *LDAPDirectorySnapshotReconciler) createVolumeSnapshots(ctx context.Context, snapshot *ldapv1alpha1.LDAPDirectorySnapshot, directory *ldapv1alpha1.LDAPDirectory) ([]ldapv1alpha1.LDAPDirectoryVolumeSnapshotStatus, error) {
+	statuses := make([]ldapv1alpha1.LDAPDirectoryVolumeSnapshotStatus, 0, len(snapshotVolumes))
+	for _, volume := range snapshotVolumes {
+		spec := map[string]any{
+			"source": map[string]any{
+				"persistentVolumeClaimName": fmt.Sprintf("%s-ldap-%s-0", volume, directory.Name),
+			},
+		}
+
+		if snapshot.Spec.VolumeSnapshotClassName != nil {
+			spec["volumeSnapshotClassName"] = *snapshot.Spec.VolumeSnapshotClassName
+		}
+
+		volumeSnapshot := &unstructured.Unstructured{
+			Object: map[string]any{
+				"spec": spec,
+			},
+		}
+		volumeSnapshot.SetGroupVersionKind(volumeSnapshotGVK)
+		volumeSnapshot.SetName(snapshot.Name + "-" + volume)
+		volumeSnapshot.SetNamespace(snapshot.Namespace)
+		volumeSnapshot.SetLabels(map[string]string{
+			"app.kubernetes.io/name":       "directory",
+			"app.kubernetes.io/instance":   directory.Name,
+			"app.kubernetes.io/managed-by": "ldap-operator",
+		})
+
+		if err := controllerutil.SetOwnerReference(snapshot, volumeSnapshot, r.Scheme); err != nil {
+			return nil, fmt.Errorf("failed to set owner reference: %w", err)
+		}
+
+		if err := r.Create(ctx, volumeSnapshot); err != nil && !apierrors.IsAlreadyExists(err) {
+			return nil, fmt.Errorf("failed to create volume snapshot of %q: %w", volume, err)
+		}
+
+		statuses = append(statuses, ldapv1alpha1.LDAPDirectoryVolumeSnapshotStatus{
+			Volume: volume,
+			Name:   volumeSnapshot.GetName(),
+		})
+	}
+
+	return statuses, nil
+}
+
+// checkVolumeSnapshots returns whether every volume snapshot has been taken
+// (ie. the directory can be unfrozen), and whether they are all ready to use.
+// An error is returned if any of the volume snapshots have failed.
+func (r *LDAPDirectorySnapshotReconciler) checkVolumeSnapshots(ctx context.Context, snapshot *ldapv1alpha1.LDAPDirectorySnapshot) (bool, bool, error) {
+	taken, ready := true, true
+
+	statuses := make([]ldapv1alpha1.LDAPDirectoryVolumeSnapshotStatus, len(snapshot.Status.VolumeSnapshots))
+	for i, status := range snapshot.Status.VolumeSnapshots {
+		volumeSnapshot := &unstructured.Unstructured{}
+		volumeSnapshot.SetGroupVersionKind(volumeSnapshotGVK)
+
+		err := r.Get(ctx, client.ObjectKey{Name: status.Name, Namespace: snapshot.Namespace}, volumeSnapshot)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return false, false, fmt.Errorf("volume snapshot %q not found", status.Name)
+			}
+
+			return false, false, fmt.Errorf("failed to get volume snapshot %q: %w", status.Name, err)
+		}
+
+		if message, ok, _ := unstructured.NestedString(volumeSnapshot.Object, "status", "error", "message"); ok {
+			return false, false, fmt.Errorf("volume snapshot %q failed: %s", status.Name, message)
+		}
+
+		// The snapshot has been cut once it has a creation time.
+		creationTime, _, _ := unstructured.NestedString(volumeSnapshot.Object, "status", "creationTime")
+		readyToUse, _, _ := unstructured.NestedBool(volumeSnapshot.Object, "status", "readyToUse")
+
+		taken = taken && (creationTime != "" || readyToUse)
+		ready = ready && readyToUse
+
+		status.ReadyToUse = readyToUse
+		statuses[i] = status
+	}
+
+	if !reflect.DeepEqual(statuses, snapshot.Status.VolumeSnapshots) {
+		key := client.ObjectKeyFromObject(snapshot)
+		err := updater.UpdateStatus(ctx, r.Client, key, snapshot, func() error {
+			snapshot.Status.VolumeSnapshots = statuses
+
+			return nil
+		})
+		if err != nil {
+			return false, false, fmt.Errorf("failed to update status: %w", err)
+		}
+	}
+
+	return taken, ready, nil
+}
+
+// freeze makes the databases of the directory read-only. The frozen condition
+// is recorded first, so that the directory is always unfrozen.
+func (r *LDAPDirectorySnapshotReconciler) freeze(ctx context.Context, snapshot *ldapv1alpha1.LDAPDirectorySnapshot, directory *ldapv1alpha1.LDAPDirectory) error {
+	if !meta.IsStatusConditionTrue(snapshot.Status.Conditions, string(ldapv1alpha1.LDAPDirectorySnapshotConditionTypeFrozen)) {
+		if err := r.setCondition(ctx, snapshot, metav1.Condition{
+			Type:    string(ldapv1alpha1.LDAPDirectorySnapshotConditionTypeFrozen),
+			Status:  metav1.ConditionTrue,
+			Reason:  "Frozen",
+			Message: "Directory is read-only while its volumes are snapshotted",
+		}); err != nil {
+			return err
+		}
+	}
+
+	endpoint, err := configAgentEndpoint(ctx, r.Client, r.Scheme, directory)
+	if err != nil {
+		return err
+	}
+
+	if endpoint == nil {
+		return fmt.Errorf("directory pod is not running")
+	}
+
+	return r.ConfigAgentClient.SetReadOnly(ctx, endpoint, true)
+}
+
+// unfreeze makes the databases of the directory writable again (if they were
+// frozen by the snapshot), and releases the lock on the directory.
+func (r *LDAPDirectorySnapshotReconciler) unfreeze(ctx context.Context, snapshot *ldapv1alpha1.LDAPDirectorySnapshot) error {
+	frozen := meta.IsStatusConditionTrue(snapshot.Status.Conditions, string(ldapv1alpha1.LDAPDirectorySnapshotConditionTypeFrozen))
+
+	var directory ldapv1alpha1.LDAPDirectory
+	err := r.Get(ctx, client.ObjectKey{Name: snapshot.Spec.DirectoryRef.Name, Namespace: snapshot.Namespace}, &directory)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get directory: %w", err)
+	}
+
+	// Directories are unfrozen when they are started, so there is nothing to
+	// do if the directory (or its pod) is gone.
+	if err == nil {
+		if frozen {
+			endpoint, err := configAgentEndpoint(ctx, r.Client, r.Scheme, &directory)
+			if err != nil {
+				return err
+			}
+
+			if endpoint != nil {
+				if err := r.ConfigAgentClient.SetReadOnly(ctx, endpoint, false); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := r.unlockDirectory(ctx, snapshot, &directory); err != nil {
+			return fmt.Errorf("failed to unlock directory: %w", err)
+		}
+	}
+
+	if !frozen {
+		return nil
+	}
+
+	return r.setCondition(ctx, snapshot, metav1.Condition{
+		Type:    string(ldapv1alpha1.LDAPDirectorySnapshotConditionTypeFrozen),
+		Status:  metav1.ConditionFalse,
+		Reason:  "Unfrozen",
+		Message: "Directory is writable",
+	})
+}
+
+// lockDirectory claims the directory for the snapshot, returning false if
+// another snapshot of the directory is in progress. A lock held by a snapshot
+// that no longer exists is taken over.
+func (r *LDAPDirectorySnapshotReconciler) lockDirectory(ctx context.Context, snapshot *ldapv1alpha1.LDAPDirectorySnapshot, directory *ldapv1alpha1.LDAPDirectory) (bool, error) {
+	holder := directory.Annotations[frozenByAnnotation]
+	if holder == snapshot.Name {
+		return true, nil
+	}
+
+	if holder != "" {
+		var holderSnapshot ldapv1alpha1.LDAPDirectorySnapshot
+		err := r.Get(ctx, client.ObjectKey{Name: holder, Namespace: snapshot.Namespace}, &holderSnapshot)
+		if err == nil {
+			return false, nil
+		} else if !apierrors.IsNotFound(err) {
+			return false, fmt.Errorf("failed to get snapshot %q: %w", holder, err)
+		}
+	}
+
+	patch := client.MergeFromWithOptions(directory.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	metav1.SetMetaDataAnnotation(&directory.ObjectMeta, frozenByAnnotation, snapshot.Name)
+
+	if err := r.Patch(ctx, directory, patch); err != nil {
+		// Another snapshot claimed the directory first.
+		if apierrors.IsConflict(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// unlockDirectory releases the directory, if it is held by the snapshot.
+func (r *LDAPDirectorySnapshotReconciler) unlockDirectory(ctx context.Context, snapshot *ldapv1alpha1.LDAPDirectorySnapshot, directory *ldapv1alpha1.LDAPDirectory) error {
+	if directory.Annotations[frozenByAnnotation] != snapshot.Name {
+		return nil
+	}
+
+	patch := client.MergeFromWithOptions(directory.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	delete(directory.Annotations, frozenByAnnotation)
+
+	return r.Patch(ctx, directory, patch)
+}
+
+// fail unfreezes the directory and marks the snapshot as failed, failed
+// snapshots are not retried.
+func (r *LDAPDirectorySnapshotReconciler) fail(ctx context.Context, snapshot *ldapv1alpha1.LDAPDirectorySnapshot, err error) (ctrl.Result, error) {
+	r.Recorder.Eventf(snapshot, corev1.EventTypeWarning,
+		"Failed", "Failed to snapshot directory: %s", err)
+
+	if err := r.unfreeze(ctx, snapshot); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to unfreeze directory: %w", err)
+	}
+
+	key := client.ObjectKeyFromObject(snapshot)
+	updateErr := updater.UpdateStatus(ctx, r.Client, key, snapshot, func() error {
+		snapshot.Status.Phase = ldapv1alpha1.LDAPDirectorySnapshotPhaseFailed
+		snapshot.Status.Message = err.Error()
+
+		return nil
+	})
+	if updateErr != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to mark as failed: %w", updateErr)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *LDAPDirectorySnapshotReconciler) markPending(ctx context.Context, snapshot *ldapv1alpha1.LDAPDirectorySnapshot) error {
+	key := client.ObjectKeyFromObject(snapshot)
+	err := updater.UpdateStatus(ctx, r.Client, key, snapshot, func() error {
+		snapshot.Status.Phase = ldapv1alpha1.LDAPDirectorySnapshotPhasePending
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark as pending: %w", err)
+	}
+
+	return nil
+}
+
+func (r *LDAPDirectorySnapshotReconciler) setCondition(ctx context.Context, snapshot *ldapv1alpha1.LDAPDirectorySnapshot, condition metav1.Condition) error {
+	key := client.ObjectKeyFromObject(snapshot)
+	err := updater.UpdateStatus(ctx, r.Client, key, snapshot, func() error {
+		condition.ObservedGeneration = snapshot.Generation
+		meta.SetStatusCondition(&snapshot.Status.Conditions, condition)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set %s condition: %w", condition.Type, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,374 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gpu-ninja/ldap-operator/api"
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/configagent"
+	"github.com/gpu-ninja/ldap-operator/internal/controller"
+	"github.com/gpu-ninja/operator-utils/reference"
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestLDAPDirectorySnapshotReconciler(t *testing.T) {
+	ctrl.SetLogger(zaplogr.New(zaptest.NewLogger(t)))
+
+	scheme := runtime.NewScheme()
+
+	err := corev1.AddToScheme(scheme)
+	require.NoError(t, err)
+
+	err = ldapv1alpha1.AddToScheme(scheme)
+	require.NoError(t, err)
+
+	directory := &ldapv1alpha1.LDAPDirectory{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+		},
+		Spec: ldapv1alpha1.LDAPDirectorySpec{
+			Image:  "ghcr.io/gpu-ninja/ldap-operator/openldap:latest",
+			Domain: "example.com",
+			CertificateSecretRef: &reference.LocalSecretReference{
+				Name: "demo-tls",
+			},
+		},
+		Status: ldapv1alpha1.LDAPDirectoryStatus{
+			Phase: ldapv1alpha1.LDAPDirectoryPhaseReady,
+		},
+	}
+
+	directoryCertificate := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "demo-tls",
+			Namespace: "default",
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			"ca.crt":  []byte(""),
+			"tls.crt": []byte(""),
+			"tls.key": []byte(""),
+		},
+	}
+
+	agentToken := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ldap-test-agent-token",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{
+			"token": []byte("token"),
+		},
+	}
+
+	directoryPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ldap-test-0",
+			Namespace: "default",
+		},
+		Status: corev1.PodStatus{
+			PodIP: "10.0.0.1",
+		},
+	}
+
+	snapshot := &ldapv1alpha1.LDAPDirectorySnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "nightly",
+			Namespace: "default",
+		},
+		Spec: ldapv1alpha1.LDAPDirectorySnapshotSpec{
+			DirectoryRef: api.LocalLDAPDirectoryReference{
+				Name: directory.Name,
+			},
+		},
+	}
+
+	volumeSnapshotGVK := schema.GroupVersionKind{
+		Group:   "snapshot.storage.k8s.io",
+		Version: "v1",
+		Kind:    "VolumeSnapshot",
+	}
+
+	getVolumeSnapshot := func(t *testing.T, c client.Client, name string) *unstructured.Unstructured {
+		volumeSnapshot := &unstructured.Unstructured{}
+		volumeSnapshot.SetGroupVersionKind(volumeSnapshotGVK)
+
+		err := c.Get(context.Background(), types.NamespacedName{Name: name, Namespace: "default"}, volumeSnapshot)
+		require.NoError(t, err)
+
+		return volumeSnapshot
+	}
+
+	setVolumeSnapshotStatus := func(t *testing.T, c client.Client, name string, status map[string]any) {
+		volumeSnapshot := getVolumeSnapshot(t, c, name)
+		volumeSnapshot.Object["status"] = status
+
+		err := c.Update(context.Background(), volumeSnapshot)
+		require.NoError(t, err)
+	}
+
+	r := &controller.LDAPDirectorySnapshotReconciler{
+		Scheme: scheme,
+	}
+
+	ctx := context.Background()
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      snapshot.Name,
+			Namespace: snapshot.Namespace,
+		},
+	}
+
+	t.Run("Snapshot", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(4)
+		r.Recorder = eventRecorder
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(directory, directoryCertificate, agentToken, directoryPod, snapshot.DeepCopy()).
+			WithStatusSubresource(directory, snapshot).
+			Build()
+
+		var m mock.Mock
+		r.ConfigAgentClient = configagent.NewFakeClient(&m)
+
+		m.On("SetReadOnly", "10.0.0.1:8082", "token", true).Return(nil)
+		m.On("SetReadOnly", "10.0.0.1:8082", "token", false).Return(nil)
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.NotZero(t, resp.RequeueAfter)
+
+		m.AssertCalled(t, "SetReadOnly", "10.0.0.1:8082", "token", true)
+		m.AssertNotCalled(t, "SetReadOnly", "10.0.0.1:8082", "token", false)
+
+		volumeSnapshot := getVolumeSnapshot(t, r.Client, "nightly-data")
+		claimName, _, _ := unstructured.NestedString(volumeSnapshot.Object, "spec", "source", "persistentVolumeClaimName")
+		assert.Equal(t, "data-ldap-test-0", claimName)
+		require.Len(t, volumeSnapshot.GetOwnerReferences(), 1)
+		assert.Equal(t, "nightly", volumeSnapshot.GetOwnerReferences()[0].Name)
+
+		var updatedSnapshot ldapv1alpha1.LDAPDirectorySnapshot
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedSnapshot)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectorySnapshotPhaseInProgress, updatedSnapshot.Status.Phase)
+		assert.True(t, meta.IsStatusConditionTrue(updatedSnapshot.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectorySnapshotConditionTypeFrozen)))
+		assert.Equal(t, []ldapv1alpha1.LDAPDirectoryVolumeSnapshotStatus{
+			{Volume: "config", Name: "nightly-config"},
+			{Volume: "data", Name: "nightly-data"},
+		}, updatedSnapshot.Status.VolumeSnapshots)
+
+		var updatedDirectory ldapv1alpha1.LDAPDirectory
+		err = r.Client.Get(ctx, client.ObjectKeyFromObject(directory), &updatedDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, "nightly", updatedDirectory.Annotations["ldap.gpu-ninja.com/frozen-by"])
+
+		// The directory is unfrozen once the snapshots have been taken.
+		for _, name := range []string{"nightly-config", "nightly-data"} {
+			setVolumeSnapshotStatus(t, r.Client, name, map[string]any{
+				"creationTime": "2023-10-11T12:00:00Z",
+				"readyToUse":   false,
+			})
+		}
+
+		resp, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.NotZero(t, resp.RequeueAfter)
+
+		m.AssertCalled(t, "SetReadOnly", "10.0.0.1:8082", "token", false)
+
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedSnapshot)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectorySnapshotPhaseInProgress, updatedSnapshot.Status.Phase)
+		assert.True(t, meta.IsStatusConditionFalse(updatedSnapshot.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectorySnapshotConditionTypeFrozen)))
+
+		err = r.Client.Get(ctx, client.ObjectKeyFromObject(directory), &updatedDirectory)
+		require.NoError(t, err)
+
+		assert.NotContains(t, updatedDirectory.Annotations, "ldap.gpu-ninja.com/frozen-by")
+
+		// And ready once the snapshots are ready to use.
+		for _, name := range []string{"nightly-config", "nightly-data"} {
+			setVolumeSnapshotStatus(t, r.Client, name, map[string]any{
+				"creationTime": "2023-10-11T12:00:00Z",
+				"readyToUse":   true,
+			})
+		}
+
+		resp, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedSnapshot)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectorySnapshotPhaseReady, updatedSnapshot.Status.Phase)
+		assert.NotNil(t, updatedSnapshot.Status.CompletionTime)
+		for _, volumeSnapshot := range updatedSnapshot.Status.VolumeSnapshots {
+			assert.True(t, volumeSnapshot.ReadyToUse)
+		}
+
+		m.AssertNumberOfCalls(t, "SetReadOnly", 2)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(4)
+		r.Recorder = eventRecorder
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(directory, directoryCertificate, agentToken, directoryPod, snapshot.DeepCopy()).
+			WithStatusSubresource(directory, snapshot).
+			Build()
+
+		var m mock.Mock
+		r.ConfigAgentClient = configagent.NewFakeClient(&m)
+
+		m.On("SetReadOnly", "10.0.0.1:8082", "token", mock.Anything).Return(nil)
+
+		_, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		setVolumeSnapshotStatus(t, r.Client, "nightly-data", map[string]any{
+			"error": map[string]any{
+				"message": "snapshot controller failed to update",
+			},
+		})
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		m.AssertCalled(t, "SetReadOnly", "10.0.0.1:8082", "token", false)
+
+		var updatedSnapshot ldapv1alpha1.LDAPDirectorySnapshot
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedSnapshot)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectorySnapshotPhaseFailed, updatedSnapshot.Status.Phase)
+		assert.Contains(t, updatedSnapshot.Status.Message, "snapshot controller failed to update")
+		assert.True(t, meta.IsStatusConditionFalse(updatedSnapshot.Status.Conditions,
+			string(ldapv1alpha1.LDAPDirectorySnapshotConditionTypeFrozen)))
+	})
+
+	t.Run("Concurrent Snapshots", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(4)
+		r.Recorder = eventRecorder
+
+		lockedDirectory := directory.DeepCopy()
+		lockedDirectory.Annotations = map[string]string{
+			"ldap.gpu-ninja.com/frozen-by": "hourly",
+		}
+
+		hourlySnapshot := snapshot.DeepCopy()
+		hourlySnapshot.Name = "hourly"
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(lockedDirectory, directoryCertificate, agentToken, directoryPod, hourlySnapshot, snapshot.DeepCopy()).
+			WithStatusSubresource(lockedDirectory, snapshot).
+			Build()
+
+		var m mock.Mock
+		r.ConfigAgentClient = configagent.NewFakeClient(&m)
+
+		m.On("SetReadOnly", "10.0.0.1:8082", "token", true).Return(nil)
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.NotZero(t, resp.RequeueAfter)
+
+		// The directory is frozen by another snapshot.
+		m.AssertNotCalled(t, "SetReadOnly", mock.Anything, mock.Anything, mock.Anything)
+
+		var updatedSnapshot ldapv1alpha1.LDAPDirectorySnapshot
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedSnapshot)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPDirectorySnapshotPhasePending, updatedSnapshot.Status.Phase)
+		assert.Empty(t, updatedSnapshot.Status.VolumeSnapshots)
+
+		// Once the other snapshot is gone, its lock is taken over.
+		err = r.Client.Delete(ctx, hourlySnapshot)
+		require.NoError(t, err)
+
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		m.AssertCalled(t, "SetReadOnly", "10.0.0.1:8082", "token", true)
+
+		var updatedDirectory ldapv1alpha1.LDAPDirectory
+		err = r.Client.Get(ctx, client.ObjectKeyFromObject(directory), &updatedDirectory)
+		require.NoError(t, err)
+
+		assert.Equal(t, "nightly", updatedDirectory.Annotations["ldap.gpu-ninja.com/frozen-by"])
+	})
+
+	t.Run("Suspended", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(4)
+		r.Recorder = eventRecorder
+
+		suspendedDirectory := directory.DeepCopy()
+		suspendedDirectory.Spec.Suspend = true
+		suspendedDirectory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseSuspended
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(suspendedDirectory, directoryCertificate, agentToken, snapshot.DeepCopy()).
+			WithStatusSubresource(suspendedDirectory, snapshot).
+			Build()
+
+		var m mock.Mock
+		r.ConfigAgentClient = configagent.NewFakeClient(&m)
+
+		_, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		// The volumes of a suspended directory don't need to be frozen.
+		m.AssertNotCalled(t, "SetReadOnly", mock.Anything, mock.Anything, mock.Anything)
+
+		getVolumeSnapshot(t, r.Client, "nightly-config")
+		getVolumeSnapshot(t, r.Client, "nightly-data")
+	})
+}
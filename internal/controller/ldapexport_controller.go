@@ -0,0 +1,620 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gpu-ninja/ldap-operator/api"
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/export"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	"github.com/gpu-ninja/operator-utils/updater"
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+//+kubebuilder:rbac:groups=ldap.gpu-ninja.com,resources=ldapexports,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=ldap.gpu-ninja.com,resources=ldapexports/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+
+const (
+	// defaultExportKey is the key exports are stored under in config maps and secrets.
+	defaultExportKey = "export.ldif"
+	// maxObjectExportSize is the size of the largest export that can be written
+	// to a config map or secret (leaving room for the rest of the object).
+	maxObjectExportSize = 1000 * 1024
+	exportContainerName = "export"
+	exportMountPath     = "/export"
+)
+
+// LDAPExportReconciler exports entries of a directory as LDIF. Exports to
+// config maps and secrets are made by the operator, and exports to persistent
+// volume claims by a job.
+type LDAPExportReconciler struct {
+	client.Client
+	Scheme            *runtime.Scheme
+	Recorder          record.EventRecorder
+	LDAPClientBuilder ldap.ClientBuilder
+}
+
+func (r *LDAPExportReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := zaplogr.FromContext(ctx)
+
+	var ldapExport ldapv1alpha1.LDAPExport
+	if err := r.Get(ctx, req.NamespacedName, &ldapExport); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+
+		return ctrl.Result{}, err
+	}
+
+	if ldapExport.Status.Phase == ldapv1alpha1.LDAPExportPhaseComplete ||
+		ldapExport.Status.Phase == ldapv1alpha1.LDAPExportPhaseFailed {
+		return ctrl.Result{}, nil
+	}
+
+	ok, err := ldapExport.ResolveReferences(ctx, r.Client, r.Scheme)
+	if !ok && err == nil {
+		logger.Info("Not all references are resolvable, requeuing")
+
+		r.Recorder.Event(&ldapExport, corev1.EventTypeWarning,
+			"NotReady", "Not all references are resolvable")
+
+		if err := r.markPending(ctx, &ldapExport); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+	} else if err != nil {
+		r.Recorder.Eventf(&ldapExport, corev1.EventTypeWarning,
+			"Failed", "Failed to resolve references: %s", err)
+
+		return ctrl.Result{}, fmt.Errorf("failed to resolve references: %w", err)
+	}
+
+	directoryObj, _, err := ldapExport.Spec.DirectoryRef.Resolve(ctx, r.Client, r.Scheme, &ldapExport)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to resolve directory reference: %w", err)
+	}
+	directory := directoryObj.(*ldapv1alpha1.LDAPDirectory)
+
+	// Exports that are already running don't depend on the directory
+	// remaining ready (the job will fail if it can't be exported).
+	if ldapExport.Status.Phase != ldapv1alpha1.LDAPExportPhaseRunning &&
+		directory.Status.Phase != ldapv1alpha1.LDAPDirectoryPhaseReady {
+		logger.Info("Referenced directory not ready",
+			zap.String("namespace", directory.Namespace),
+			zap.String("name", directory.Name))
+
+		r.Recorder.Event(&ldapExport, corev1.EventTypeWarning,
+			"NotReady", "Referenced directory is not ready")
+
+		if err := r.markPending(ctx, &ldapExport); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+	}
+
+	opts, ready, err := r.exportOptions(ctx, &ldapExport, directory)
+	if err != nil {
+		return r.fail(ctx, &ldapExport, err)
+	}
+
+	if !ready {
+		logger.Info("Referenced object not ready")
+
+		r.Recorder.Event(&ldapExport, corev1.EventTypeWarning,
+			"NotReady", "Referenced object is not ready")
+
+		if err := r.markPending(ctx, &ldapExport); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+	}
+
+	if ldapExport.Spec.Output.PersistentVolumeClaim != nil {
+		return r.reconcileJob(ctx, &ldapExport, directory, opts)
+	}
+
+	// Config maps are readable by anyone that can read the namespace.
+	if ldapExport.Spec.Output.ConfigMap != nil && exportsPasswords(&ldapExport.Spec) {
+		return r.fail(ctx, &ldapExport,
+			fmt.Errorf("exports to a config map must exclude (or scrub) the userPassword attribute, use a secret"))
+	}
+
+	available, err := r.outputAvailable(ctx, &ldapExport)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !available {
+		return r.fail(ctx, &ldapExport, fmt.Errorf("output object already exists and was not created by the export"))
+	}
+
+	logger.Info("Exporting entries", zap.String("baseDN", opts.BaseDN))
+
+	ldapClient, err := r.LDAPClientBuilder.WithDirectory(directory).Build(ctx)
+	if err != nil {
+		r.Recorder.Eventf(&ldapExport, corev1.EventTypeWarning,
+			"Failed", "Failed to create directory client: %s", err)
+
+		return ctrl.Result{}, fmt.Errorf("failed to create directory client: %w", err)
+	}
+
+	var buf bytes.Buffer
+	entries, err := export.Export(&buf, ldapClient, opts)
+	if err != nil {
+		return r.fail(ctx, &ldapExport, err)
+	}
+
+	if buf.Len() > maxObjectExportSize {
+		return r.fail(ctx, &ldapExport,
+			fmt.Errorf("export is too large (%d bytes) for a config map or secret, use a persistent volume claim", buf.Len()))
+	}
+
+	if err := r.writeObject(ctx, &ldapExport, buf.Bytes()); err != nil {
+		r.Recorder.Eventf(&ldapExport, corev1.EventTypeWarning,
+			"Failed", "Failed to write export: %s", err)
+
+		return ctrl.Result{}, fmt.Errorf("failed to write export: %w", err)
+	}
+
+	return ctrl.Result{}, r.markComplete(ctx, &ldapExport, entries)
+}
+
+func (r *LDAPExportReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&ldapv1alpha1.LDAPExport{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
+
+// exportOptions returns the options of the export, and whether the
+// referenced object (if any) has been created in the directory.
+func (r *LDAPExportReconciler) exportOptions(ctx context.Context, ldapExport *ldapv1alpha1.LDAPExport, directory *ldapv1alpha1.LDAPDirectory) (*export.Options, bool, error) {
+	baseDN := ldapExport.Spec.BaseDN
+
+	if ldapExport.Spec.ObjectRef != nil {
+		obj, _, err := ldapExport.Spec.ObjectRef.Resolve(ctx, r.Client, r.Scheme, ldapExport)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to resolve object reference: %w", err)
+		}
+
+		ldapObj, ok := obj.(api.LDAPObject)
+		if !ok {
+			return nil, false, fmt.Errorf("referenced object is not an ldap object")
+		}
+
+		if ldapObj.GetLDAPObjectSpec().DirectoryRef.Name != directory.Name {
+			return nil, false, fmt.Errorf("referenced object belongs to a different directory")
+		}
+
+		if ldapObj.GetPhase() != api.PhaseReady {
+			return nil, false, nil
+		}
+
+		baseDN, err = ldapObj.GetDistinguishedName(ctx, r.Client, r.Scheme)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get distinguished name of referenced object: %w", err)
+		}
+	} else if baseDN == "" {
+		var err error
+		baseDN, err = directory.GetDistinguishedName(ctx, r.Client, r.Scheme)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get distinguished name of directory: %w", err)
+		}
+	}
+
+	return &export.Options{
+		BaseDN:     baseDN,
+		Filter:     ldapExport.Spec.Filter,
+		Attributes: ldapExport.Spec.Attributes,
+		Scrub:      ldapExport.Spec.Scrub,
+	}, true, nil
+}
+
+// outputAvailable returns whether the output config map or secret of the
+// export can be written. Exports only write to objects they create, so that
+// existing config maps and secrets are never overwritten (or exposed by
+// exporting to them).
+func (r *LDAPExportReconciler) outputAvailable(ctx context.Context, ldapExport *ldapv1alpha1.LDAPExport) (bool, error) {
+	obj, err := r.outputObject(ldapExport)
+	if err != nil {
+		return false, err
+	}
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+
+		return false, fmt.Errorf("failed to get output object: %w", err)
+	}
+
+	return metav1.IsControlledBy(obj, ldapExport), nil
+}
+
+// writeObject stores the LDIF in the output config map or secret, creating it.
+// The object only exists already if a previous attempt at writing the export
+// failed to mark it as complete.
+func (r *LDAPExportReconciler) writeObject(ctx context.Context, ldapExport *ldapv1alpha1.LDAPExport, data []byte) error {
+	obj, err := r.outputObject(ldapExport)
+	if err != nil {
+		return err
+	}
+
+	key := defaultExportKey
+	switch obj := obj.(type) {
+	case *corev1.ConfigMap:
+		if ldapExport.Spec.Output.ConfigMap.Key != "" {
+			key = ldapExport.Spec.Output.ConfigMap.Key
+		}
+
+		obj.Data = map[string]string{key: string(data)}
+	case *corev1.Secret:
+		if ldapExport.Spec.Output.Secret.Key != "" {
+			key = ldapExport.Spec.Output.Secret.Key
+		}
+
+		obj.Data = map[string][]byte{key: data}
+	}
+
+	existing := obj.DeepCopyObject().(client.Object)
+	if err := r.Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get output object: %w", err)
+		}
+
+		return r.Create(ctx, obj)
+	}
+
+	if !metav1.IsControlledBy(existing, ldapExport) {
+		return fmt.Errorf("output object %q already exists and was not created by the export", obj.GetName())
+	}
+
+	obj.SetResourceVersion(existing.GetResourceVersion())
+
+	return r.Update(ctx, obj)
+}
+
+// outputObject returns the (unpopulated) output config map or secret of the
+// export, controlled by the export.
+func (r *LDAPExportReconciler) outputObject(ldapExport *ldapv1alpha1.LDAPExport) (client.Object, error) {
+	var obj client.Object
+	if output := ldapExport.Spec.Output.ConfigMap; output != nil {
+		obj = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: output.Name, Namespace: ldapExport.Namespace}}
+	} else {
+		obj = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: ldapExport.Spec.Output.Secret.Name, Namespace: ldapExport.Namespace}}
+	}
+
+	if err := controllerutil.SetControllerReference(ldapExport, obj, r.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to set owner reference on output object: %w", err)
+	}
+
+	return obj, nil
+}
+
+// exportsPasswords returns whether the userPassword attribute is exported
+// (ie. it is neither excluded from the exported attributes, nor scrubbed).
+func exportsPasswords(spec *ldapv1alpha1.LDAPExportSpec) bool {
+	for _, rule := range spec.Scrub {
+		if strings.EqualFold(rule.Attribute, "userPassword") {
+			return false
+		}
+	}
+
+	if len(spec.Attributes) == 0 {
+		return true
+	}
+
+	for _, attr := range spec.Attributes {
+		if attr == "*" || strings.EqualFold(attr, "userPassword") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reconcileJob runs the job that exports the entries to the output persistent
+// volume claim, and marks the export as complete once it has succeeded.
+func (r *LDAPExportReconciler) reconcileJob(ctx context.Context, ldapExport *ldapv1alpha1.LDAPExport, directory *ldapv1alpha1.LDAPDirectory, opts *export.Options) (ctrl.Result, error) {
+	logger := zaplogr.FromContext(ctx)
+
+	if directory.Spec.External != nil {
+		return r.fail(ctx, ldapExport,
+			fmt.Errorf("exports of external directories can only be written to a config map or secret"))
+	}
+
+	job, err := r.jobTemplate(ctx, ldapExport, directory, opts)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(job), job); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, fmt.Errorf("failed to get export job: %w", err)
+		}
+
+		logger.Info("Creating export job")
+
+		if err := r.Create(ctx, job); err != nil {
+			r.Recorder.Eventf(ldapExport, corev1.EventTypeWarning,
+				"Failed", "Failed to create export job: %s", err)
+
+			return ctrl.Result{}, fmt.Errorf("failed to create export job: %w", err)
+		}
+
+		r.Recorder.Eventf(ldapExport, corev1.EventTypeNormal,
+			"Exporting", "Exporting entries of directory %s", directory.Name)
+
+		key := client.ObjectKeyFromObject(ldapExport)
+		err = updater.UpdateStatus(ctx, r.Client, key, ldapExport, func() error {
+			now := metav1.Now()
+
+			ldapExport.Status.Phase = ldapv1alpha1.LDAPExportPhaseRunning
+			ldapExport.Status.StartTime = &now
+
+			return nil
+		})
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update status: %w", err)
+		}
+
+		return ctrl.Result{}, nil
+	}
+
+	if job.Status.Failed == 0 && job.Status.Succeeded == 0 {
+		logger.Info("Waiting for export job to complete")
+
+		return ctrl.Result{}, nil
+	}
+
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(job.Namespace),
+		client.MatchingLabels{"job-name": job.Name}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to list export job pods: %w", err)
+	}
+
+	// The termination message is the number of exported entries, or the tail
+	// of the logs of the job if it failed.
+	var message string
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == exportContainerName && status.State.Terminated != nil {
+				message = strings.TrimSpace(status.State.Terminated.Message)
+			}
+		}
+	}
+
+	if job.Status.Failed > 0 {
+		if message == "" {
+			message = "unknown error"
+		}
+
+		return r.fail(ctx, ldapExport, fmt.Errorf("export job failed: %s", message))
+	}
+
+	entries, err := strconv.Atoi(message)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to parse export job result: %w", err)
+	}
+
+	return ctrl.Result{}, r.markComplete(ctx, ldapExport, entries)
+}
+
+func (r *LDAPExportReconciler) jobTemplate(ctx context.Context, ldapExport *ldapv1alpha1.LDAPExport, directory *ldapv1alpha1.LDAPDirectory, opts *export.Options) (*batchv1.Job, error) {
+	if directory.Spec.CertificateSecretRef == nil {
+		return nil, fmt.Errorf("directory has no certificate secret reference")
+	}
+
+	directoryDN, err := directory.GetDistinguishedName(ctx, r.Client, r.Scheme)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get distinguished name of directory: %w", err)
+	}
+
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal export options: %w", err)
+	}
+
+	output := ldapExport.Spec.Output.PersistentVolumeClaim
+
+	outputPath := output.Path
+	if outputPath == "" {
+		outputPath = ldapExport.Name + ".ldif"
+	}
+
+	labels := map[string]string{
+		"app.kubernetes.io/name":       "ldap-export",
+		"app.kubernetes.io/instance":   directory.Name,
+		"app.kubernetes.io/managed-by": "ldap-operator",
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ldap-export-" + ldapExport.Name,
+			Namespace: ldapExport.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			// Failed exports are not retried.
+			BackoffLimit: ptr.To(int32(0)),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:  exportContainerName,
+							Image: directoryImage(directory),
+							Command: []string{
+								"/usr/local/bin/ldap-operator",
+								"export",
+								"--url=" + ldap.DirectoryAddress(directory),
+								"--bind-dn=cn=admin," + directoryDN,
+								"--ca-file=/etc/ldap/certs/ca.crt",
+								"--output=" + path.Join(exportMountPath, outputPath),
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name: "LDAP_BIND_PASSWORD",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: fmt.Sprintf("ldap-%s-admin-password", directory.Name),
+											},
+											Key: "password",
+										},
+									},
+								},
+								{
+									Name:  "LDAP_EXPORT",
+									Value: string(optsJSON),
+								},
+							},
+							// Failures are reported with the tail of the logs.
+							TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "certs",
+									MountPath: "/etc/ldap/certs",
+									ReadOnly:  true,
+								},
+								{
+									Name:      "export",
+									MountPath: exportMountPath,
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "certs",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{
+									SecretName: directory.Spec.CertificateSecretRef.Name,
+									Items: []corev1.KeyToPath{
+										{
+											Key:  "ca.crt",
+											Path: "ca.crt",
+										},
+									},
+								},
+							},
+						},
+						{
+							Name: "export",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: output.ClaimName,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(ldapExport, job, r.Scheme); err != nil {
+		return nil, fmt.Errorf("failed to set controller reference: %w", err)
+	}
+
+	return job, nil
+}
+
+// fail marks the export as failed, failed exports are not retried.
+func (r *LDAPExportReconciler) fail(ctx context.Context, ldapExport *ldapv1alpha1.LDAPExport, err error) (ctrl.Result, error) {
+	r.Recorder.Eventf(ldapExport, corev1.EventTypeWarning,
+		"Failed", "Failed to export directory: %s", err)
+
+	key := client.ObjectKeyFromObject(ldapExport)
+	updateErr := updater.UpdateStatus(ctx, r.Client, key, ldapExport, func() error {
+		ldapExport.Status.Phase = ldapv1alpha1.LDAPExportPhaseFailed
+		ldapExport.Status.Message = err.Error()
+
+		return nil
+	})
+	if updateErr != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to mark as failed: %w", updateErr)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *LDAPExportReconciler) markComplete(ctx context.Context, ldapExport *ldapv1alpha1.LDAPExport, entries int) error {
+	r.Recorder.Eventf(ldapExport, corev1.EventTypeNormal,
+		"Exported", "Successfully exported %d entries", entries)
+
+	key := client.ObjectKeyFromObject(ldapExport)
+	err := updater.UpdateStatus(ctx, r.Client, key, ldapExport, func() error {
+		now := metav1.Now()
+
+		ldapExport.Status.Phase = ldapv1alpha1.LDAPExportPhaseComplete
+		ldapExport.Status.Entries = entries
+		if ldapExport.Status.StartTime == nil {
+			ldapExport.Status.StartTime = &now
+		}
+		ldapExport.Status.CompletionTime = &now
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark as complete: %w", err)
+	}
+
+	return nil
+}
+
+func (r *LDAPExportReconciler) markPending(ctx context.Context, ldapExport *ldapv1alpha1.LDAPExport) error {
+	key := client.ObjectKeyFromObject(ldapExport)
+	err := updater.UpdateStatus(ctx, r.Client, key, ldapExport, func() error {
+		ldapExport.Status.Phase = ldapv1alpha1.LDAPExportPhasePending
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark as pending: %w", err)
+	}
+
+	return nil
+}
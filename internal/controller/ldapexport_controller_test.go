@@ -0,0 +1,589 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gpu-ninja/ldap-operator/api"
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/controller"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+	"github.com/gpu-ninja/operator-utils/reference"
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestLDAPExportReconciler(t *testing.T) {
+	ctrl.SetLogger(zaplogr.New(zaptest.NewLogger(t)))
+
+	scheme := runtime.NewScheme()
+
+	err := corev1.AddToScheme(scheme)
+	require.NoError(t, err)
+
+	err = batchv1.AddToScheme(scheme)
+	require.NoError(t, err)
+
+	err = ldapv1alpha1.AddToScheme(scheme)
+	require.NoError(t, err)
+
+	directory := &ldapv1alpha1.LDAPDirectory{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+		},
+		Spec: ldapv1alpha1.LDAPDirectorySpec{
+			Image:  "ghcr.io/gpu-ninja/ldap-operator/openldap:latest",
+			Domain: "example.com",
+			CertificateSecretRef: &reference.LocalSecretReference{
+				Name: "demo-tls",
+			},
+		},
+		Status: ldapv1alpha1.LDAPDirectoryStatus{
+			Phase: ldapv1alpha1.LDAPDirectoryPhaseReady,
+		},
+	}
+
+	ou := &ldapv1alpha1.LDAPOrganizationalUnit{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "users",
+			Namespace: "default",
+		},
+		Spec: ldapv1alpha1.LDAPOrganizationalUnitSpec{
+			LDAPObjectSpec: api.LDAPObjectSpec{
+				DirectoryRef: api.LocalLDAPDirectoryReference{
+					Name: directory.Name,
+				},
+			},
+			Name: "users",
+		},
+		Status: api.SimpleStatus{
+			Phase: api.PhaseReady,
+		},
+	}
+
+	records := []ldif.Record{
+		{
+			DN:         "uid=demo,ou=users,dc=example,dc=com",
+			ChangeType: ldif.ChangeTypeAdd,
+			Attributes: []ldif.Attribute{
+				{Name: "uid", Values: []string{"demo"}},
+				{Name: "userPassword", Values: []string{"{ARGON2}secret"}},
+			},
+		},
+	}
+
+	r := &controller.LDAPExportReconciler{
+		Scheme: scheme,
+	}
+
+	ctx := context.Background()
+
+	req := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "audit",
+			Namespace: "default",
+		},
+	}
+
+	t.Run("Config Map", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		ldapExport := &ldapv1alpha1.LDAPExport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "audit",
+				Namespace: "default",
+			},
+			Spec: ldapv1alpha1.LDAPExportSpec{
+				DirectoryRef: api.LocalLDAPDirectoryReference{
+					Name: directory.Name,
+				},
+				ObjectRef: &reference.LocalObjectReference{
+					Name: ou.Name,
+					Kind: "LDAPOrganizationalUnit",
+				},
+				Filter:     "(objectClass=inetOrgPerson)",
+				Attributes: []string{"uid", "userPassword"},
+				Scrub: []ldapv1alpha1.LDAPDirectoryScrubRule{
+					{Attribute: "userPassword"},
+				},
+				Output: ldapv1alpha1.LDAPExportOutput{
+					ConfigMap: &ldapv1alpha1.LDAPExportObjectOutput{
+						Name: "audit",
+					},
+				},
+			},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(directory, ou, ldapExport).
+			WithStatusSubresource(directory, ou, ldapExport).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("Search", "ou=users,dc=example,dc=com", "(objectClass=inetOrgPerson)", []string{"uid", "userPassword"}).
+			Return(records, nil)
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		m.AssertExpectations(t)
+
+		var configMap corev1.ConfigMap
+		err = r.Client.Get(ctx, types.NamespacedName{Name: "audit", Namespace: "default"}, &configMap)
+		require.NoError(t, err)
+
+		assert.Equal(t, "dn: uid=demo,ou=users,dc=example,dc=com\nuid: demo\n", configMap.Data["export.ldif"])
+		require.Len(t, configMap.OwnerReferences, 1)
+		assert.Equal(t, "audit", configMap.OwnerReferences[0].Name)
+		assert.True(t, *configMap.OwnerReferences[0].Controller)
+
+		var updatedExport ldapv1alpha1.LDAPExport
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedExport)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPExportPhaseComplete, updatedExport.Status.Phase)
+		assert.Equal(t, 1, updatedExport.Status.Entries)
+		assert.NotNil(t, updatedExport.Status.CompletionTime)
+
+		require.Len(t, eventRecorder.Events, 1)
+		assert.Equal(t, "Normal Exported Successfully exported 1 entries", <-eventRecorder.Events)
+
+		// Completed exports are not repeated.
+		_, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		m.AssertNumberOfCalls(t, "Search", 1)
+	})
+
+	t.Run("Existing Object", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		ldapExport := &ldapv1alpha1.LDAPExport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "audit",
+				Namespace: "default",
+			},
+			Spec: ldapv1alpha1.LDAPExportSpec{
+				DirectoryRef: api.LocalLDAPDirectoryReference{
+					Name: directory.Name,
+				},
+				Output: ldapv1alpha1.LDAPExportOutput{
+					Secret: &ldapv1alpha1.LDAPExportObjectOutput{
+						Name: "ldap-demo-admin-password",
+					},
+				},
+			},
+		}
+
+		// Existing objects are never overwritten.
+		existingSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ldap-demo-admin-password",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				"password": []byte("password"),
+			},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(directory, ldapExport, existingSecret).
+			WithStatusSubresource(directory, ldapExport).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		m.AssertNotCalled(t, "Search", mock.Anything, mock.Anything, mock.Anything)
+
+		var updatedExport ldapv1alpha1.LDAPExport
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedExport)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPExportPhaseFailed, updatedExport.Status.Phase)
+		assert.Contains(t, updatedExport.Status.Message, "already exists")
+
+		var secret corev1.Secret
+		err = r.Client.Get(ctx, types.NamespacedName{Name: "ldap-demo-admin-password", Namespace: "default"}, &secret)
+		require.NoError(t, err)
+
+		assert.Equal(t, existingSecret.Data, secret.Data)
+		assert.Empty(t, secret.OwnerReferences)
+	})
+
+	t.Run("Config Map With Passwords", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		ldapExport := &ldapv1alpha1.LDAPExport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "audit",
+				Namespace: "default",
+			},
+			Spec: ldapv1alpha1.LDAPExportSpec{
+				DirectoryRef: api.LocalLDAPDirectoryReference{
+					Name: directory.Name,
+				},
+				Attributes: []string{"uid", "userPassword"},
+				Output: ldapv1alpha1.LDAPExportOutput{
+					ConfigMap: &ldapv1alpha1.LDAPExportObjectOutput{
+						Name: "audit",
+					},
+				},
+			},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(directory, ldapExport).
+			WithStatusSubresource(directory, ldapExport).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		m.AssertNotCalled(t, "Search", mock.Anything, mock.Anything, mock.Anything)
+
+		var updatedExport ldapv1alpha1.LDAPExport
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedExport)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPExportPhaseFailed, updatedExport.Status.Phase)
+		assert.Contains(t, updatedExport.Status.Message, "userPassword")
+
+		var configMap corev1.ConfigMap
+		err = r.Client.Get(ctx, types.NamespacedName{Name: "audit", Namespace: "default"}, &configMap)
+		assert.Error(t, err)
+	})
+
+	t.Run("Too Large", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		ldapExport := &ldapv1alpha1.LDAPExport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "audit",
+				Namespace: "default",
+			},
+			Spec: ldapv1alpha1.LDAPExportSpec{
+				DirectoryRef: api.LocalLDAPDirectoryReference{
+					Name: directory.Name,
+				},
+				Output: ldapv1alpha1.LDAPExportOutput{
+					Secret: &ldapv1alpha1.LDAPExportObjectOutput{
+						Name: "audit",
+					},
+				},
+			},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(directory, ldapExport).
+			WithStatusSubresource(directory, ldapExport).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("Search", "dc=example,dc=com", "(objectClass=*)", []string(nil)).
+			Return([]ldif.Record{
+				{
+					DN:         "uid=demo,ou=users,dc=example,dc=com",
+					ChangeType: ldif.ChangeTypeAdd,
+					Attributes: []ldif.Attribute{
+						{Name: "description", Values: []string{strings.Repeat("a", 2*1024*1024)}},
+					},
+				},
+			}, nil)
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		var updatedExport ldapv1alpha1.LDAPExport
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedExport)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPExportPhaseFailed, updatedExport.Status.Phase)
+		assert.Contains(t, updatedExport.Status.Message, "use a persistent volume claim")
+
+		var secret corev1.Secret
+		err = r.Client.Get(ctx, types.NamespacedName{Name: "audit", Namespace: "default"}, &secret)
+		assert.Error(t, err)
+	})
+
+	t.Run("Persistent Volume Claim", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		ldapExport := &ldapv1alpha1.LDAPExport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "audit",
+				Namespace: "default",
+			},
+			Spec: ldapv1alpha1.LDAPExportSpec{
+				DirectoryRef: api.LocalLDAPDirectoryReference{
+					Name: directory.Name,
+				},
+				BaseDN: "ou=users,dc=example,dc=com",
+				Output: ldapv1alpha1.LDAPExportOutput{
+					PersistentVolumeClaim: &ldapv1alpha1.LDAPExportVolumeOutput{
+						ClaimName: "exports",
+						Path:      "audit/users.ldif",
+					},
+				},
+			},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(directory, ldapExport).
+			WithStatusSubresource(directory, ldapExport, &batchv1.Job{}).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		// Exports to volumes are made by a job.
+		m.AssertNotCalled(t, "Search", mock.Anything, mock.Anything, mock.Anything)
+
+		var job batchv1.Job
+		err = r.Client.Get(ctx, types.NamespacedName{Name: "ldap-export-audit", Namespace: "default"}, &job)
+		require.NoError(t, err)
+
+		container := job.Spec.Template.Spec.Containers[0]
+		assert.Equal(t, directory.Spec.Image, container.Image)
+		assert.Contains(t, container.Command, "--bind-dn=cn=admin,dc=example,dc=com")
+		assert.Contains(t, container.Command, "--output=/export/audit/users.ldif")
+		assert.Contains(t, container.Env, corev1.EnvVar{
+			Name:  "LDAP_EXPORT",
+			Value: `{"baseDN":"ou=users,dc=example,dc=com"}`,
+		})
+		assert.Equal(t, "exports", job.Spec.Template.Spec.Volumes[1].PersistentVolumeClaim.ClaimName)
+
+		var updatedExport ldapv1alpha1.LDAPExport
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedExport)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPExportPhaseRunning, updatedExport.Status.Phase)
+		assert.NotNil(t, updatedExport.Status.StartTime)
+
+		// The job reports the number of exported entries.
+		job.Status.Succeeded = 1
+		err = r.Client.Status().Update(ctx, &job)
+		require.NoError(t, err)
+
+		err = r.Client.Create(ctx, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ldap-export-audit-abcde",
+				Namespace: "default",
+				Labels: map[string]string{
+					"job-name": job.Name,
+				},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "export",
+						State: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{
+								Message: "42",
+							},
+						},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		resp, err = r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedExport)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPExportPhaseComplete, updatedExport.Status.Phase)
+		assert.Equal(t, 42, updatedExport.Status.Entries)
+
+		require.Len(t, eventRecorder.Events, 2)
+		assert.Equal(t, "Normal Exporting Exporting entries of directory test", <-eventRecorder.Events)
+		assert.Equal(t, "Normal Exported Successfully exported 42 entries", <-eventRecorder.Events)
+	})
+
+	t.Run("Job Failed", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		ldapExport := &ldapv1alpha1.LDAPExport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "audit",
+				Namespace: "default",
+			},
+			Spec: ldapv1alpha1.LDAPExportSpec{
+				DirectoryRef: api.LocalLDAPDirectoryReference{
+					Name: directory.Name,
+				},
+				Output: ldapv1alpha1.LDAPExportOutput{
+					PersistentVolumeClaim: &ldapv1alpha1.LDAPExportVolumeOutput{
+						ClaimName: "exports",
+					},
+				},
+			},
+			Status: ldapv1alpha1.LDAPExportStatus{
+				Phase: ldapv1alpha1.LDAPExportPhaseRunning,
+			},
+		}
+
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ldap-export-audit",
+				Namespace: "default",
+			},
+			Status: batchv1.JobStatus{
+				Failed: 1,
+			},
+		}
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ldap-export-audit-abcde",
+				Namespace: "default",
+				Labels: map[string]string{
+					"job-name": job.Name,
+				},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "export",
+						State: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{
+								ExitCode: 1,
+								Message:  "export: failed to search directory: LDAP Result Code 32 \"No Such Object\"\n",
+							},
+						},
+					},
+				},
+			},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(directory, ldapExport, job, pod).
+			WithStatusSubresource(directory, ldapExport, job).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		resp, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		var updatedExport ldapv1alpha1.LDAPExport
+		err = r.Client.Get(ctx, client.ObjectKeyFromObject(ldapExport), &updatedExport)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPExportPhaseFailed, updatedExport.Status.Phase)
+		assert.Equal(t, "export job failed: export: failed to search directory: LDAP Result Code 32 \"No Such Object\"", updatedExport.Status.Message)
+	})
+
+	t.Run("External Directory", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		externalDirectory := directory.DeepCopy()
+		externalDirectory.Spec.External = &ldapv1alpha1.LDAPDirectoryExternal{
+			URLs:   []string{"ldaps://ldap.example.com"},
+			BaseDN: "dc=example,dc=com",
+			BindDN: "cn=operator,dc=example,dc=com",
+		}
+
+		ldapExport := &ldapv1alpha1.LDAPExport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "audit",
+				Namespace: "default",
+			},
+			Spec: ldapv1alpha1.LDAPExportSpec{
+				DirectoryRef: api.LocalLDAPDirectoryReference{
+					Name: directory.Name,
+				},
+				Output: ldapv1alpha1.LDAPExportOutput{
+					PersistentVolumeClaim: &ldapv1alpha1.LDAPExportVolumeOutput{
+						ClaimName: "exports",
+					},
+				},
+			},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(externalDirectory, ldapExport).
+			WithStatusSubresource(externalDirectory, ldapExport).
+			Build()
+
+		_, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+
+		var updatedExport ldapv1alpha1.LDAPExport
+		err = r.Client.Get(ctx, req.NamespacedName, &updatedExport)
+		require.NoError(t, err)
+
+		assert.Equal(t, ldapv1alpha1.LDAPExportPhaseFailed, updatedExport.Status.Phase)
+		assert.Contains(t, updatedExport.Status.Message, "external directories")
+	})
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"time"
 
 	"github.com/gpu-ninja/ldap-operator/api"
 	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
@@ -31,12 +32,15 @@ import (
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 // LDAPGroups
@@ -60,6 +64,9 @@ type LDAPObjectReconciler[T api.LDAPObject, E ldap.Entry] struct {
 	Recorder          record.EventRecorder
 	LDAPClientBuilder ldap.ClientBuilder
 	MapToEntry        mapper.Mapper[T, E]
+	// ResyncPeriod is how often entries are compared with the directory when
+	// an object doesn't specify its own resync period. Zero disables resyncs.
+	ResyncPeriod time.Duration
 }
 
 func (r *LDAPObjectReconciler[T, E]) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -76,6 +83,12 @@ func (r *LDAPObjectReconciler[T, E]) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{}, err
 	}
 
+	if api.IsPaused(obj) {
+		logger.Info("Reconciliation is paused")
+
+		return ctrl.Result{}, r.setPaused(ctx, obj, true, "Reconciliation is paused")
+	}
+
 	if !controllerutil.ContainsFinalizer(obj, FinalizerName) {
 		logger.Info("Adding Finalizer")
 
@@ -112,7 +125,13 @@ func (r *LDAPObjectReconciler[T, E]) Reconcile(ctx context.Context, req ctrl.Req
 		r.Recorder.Event(obj, corev1.EventTypeWarning,
 			"NotReady", "Not all references are resolvable")
 
-		if err := r.markPending(ctx, obj); err != nil {
+		if err := r.markPending(ctx, obj, "ReferencesNotResolvable", "Not all references are resolvable",
+			metav1.Condition{
+				Type:    api.ConditionTypeReferencesResolved,
+				Status:  metav1.ConditionFalse,
+				Reason:  "NotResolvable",
+				Message: "Not all references are resolvable",
+			}); err != nil {
 			return ctrl.Result{}, err
 		}
 
@@ -122,7 +141,13 @@ func (r *LDAPObjectReconciler[T, E]) Reconcile(ctx context.Context, req ctrl.Req
 			"Failed", "Failed to resolve references: %s", err)
 
 		r.markFailed(ctx, obj,
-			fmt.Errorf("failed to resolve references: %w", err))
+			fmt.Errorf("failed to resolve references: %w", err),
+			metav1.Condition{
+				Type:    api.ConditionTypeReferencesResolved,
+				Status:  metav1.ConditionFalse,
+				Reason:  "Failed",
+				Message: err.Error(),
+			})
 
 		return ctrl.Result{}, fmt.Errorf("failed to resolve references: %w", err)
 	}
@@ -142,6 +167,40 @@ func (r *LDAPObjectReconciler[T, E]) Reconcile(ctx context.Context, req ctrl.Req
 	}
 	directory := directoryObj.(*ldapv1alpha1.LDAPDirectory)
 
+	if directory.Status.Phase == ldapv1alpha1.LDAPDirectoryPhaseSuspended {
+		logger.Info("Referenced directory is suspended",
+			zap.String("namespace", directory.Namespace),
+			zap.String("name", directory.Name))
+
+		if !obj.GetDeletionTimestamp().IsZero() {
+			// The entry can't be deleted until the directory is resumed, which
+			// may never happen, so don't block deletion.
+			logger.Info("Skipping deletion of LDAP entry")
+
+			r.Recorder.Event(obj, corev1.EventTypeWarning,
+				"NotDeleted", "Referenced directory is suspended, the entry has not been deleted")
+
+			_, err := controllerutil.CreateOrPatch(ctx, r.Client, obj, func() error {
+				controllerutil.RemoveFinalizer(obj, FinalizerName)
+
+				return nil
+			})
+			if err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to remove finalizer: %w", err)
+			}
+
+			return ctrl.Result{}, nil
+		}
+
+		// Suspension is expected to last a while, so don't warn about it, and
+		// check back less often.
+		if err := r.markPending(ctx, obj, "DirectorySuspended", "Referenced directory is suspended"); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{RequeueAfter: suspendedRetryInterval}, nil
+	}
+
 	if directory.Status.Phase != ldapv1alpha1.LDAPDirectoryPhaseReady {
 		logger.Info("Referenced directory not ready",
 			zap.String("namespace", directory.Namespace),
@@ -150,13 +209,28 @@ func (r *LDAPObjectReconciler[T, E]) Reconcile(ctx context.Context, req ctrl.Req
 		r.Recorder.Event(obj, corev1.EventTypeWarning,
 			"NotReady", "Referenced directory is not ready")
 
-		if err := r.markPending(ctx, obj); err != nil {
+		if err := r.markPending(ctx, obj, "DirectoryNotReady", "Referenced directory is not ready"); err != nil {
 			return ctrl.Result{}, err
 		}
 
 		return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
 	}
 
+	if api.IsPaused(directory) {
+		logger.Info("Reconciliation of the referenced directory is paused")
+
+		// Watching the directory would require an index, so poll for it to be resumed.
+		if err := r.setPaused(ctx, obj, true, "Reconciliation of the referenced directory is paused"); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{RequeueAfter: reconcileRetryInterval}, nil
+	}
+
+	if err := r.setPaused(ctx, obj, false, "Reconciliation has resumed"); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	var parent runtime.Object
 	if objSpec.ParentRef != nil {
 		parent, _, err = objSpec.ParentRef.Resolve(ctx, r.Client, r.Scheme, obj)
@@ -195,7 +269,7 @@ func (r *LDAPObjectReconciler[T, E]) Reconcile(ctx context.Context, req ctrl.Req
 			r.Recorder.Event(obj, corev1.EventTypeWarning,
 				"NotReady", "Referenced parent object is not ready")
 
-			if err := r.markPending(ctx, obj); err != nil {
+			if err := r.markPending(ctx, obj, "ParentNotReady", "Referenced parent object is not ready"); err != nil {
 				return ctrl.Result{}, err
 			}
 
@@ -268,7 +342,11 @@ func (r *LDAPObjectReconciler[T, E]) Reconcile(ctx context.Context, req ctrl.Req
 		return ctrl.Result{}, nil
 	}
 
-	created, err := ldapClient.CreateOrUpdateEntry(entry)
+	// Once the current spec has been applied, resyncs only look for drift.
+	synced := obj.GetPhase() == api.PhaseReady && obj.GetStatus().ObservedGeneration == obj.GetGeneration()
+	dryRun := synced && objSpec.DriftPolicy == api.DriftPolicyReport
+
+	diff, err := ldapClient.SyncEntry(entry, dryRun)
 	if err != nil {
 		logger.Error("Failed to create or update LDAP entry", zap.Error(err))
 
@@ -276,26 +354,74 @@ func (r *LDAPObjectReconciler[T, E]) Reconcile(ctx context.Context, req ctrl.Req
 			"Failed", "Failed to create or update ldap entry: %s", err)
 
 		r.markFailed(ctx, obj,
-			fmt.Errorf("failed to create or update ldap entry: %w", err))
+			fmt.Errorf("failed to create or update ldap entry: %w", err),
+			metav1.Condition{
+				Type:    api.ConditionTypeSynced,
+				Status:  metav1.ConditionFalse,
+				Reason:  "SyncFailed",
+				Message: err.Error(),
+			})
 
 		return ctrl.Result{}, nil
 	}
 
-	if created {
+	var conditions []metav1.Condition
+	if synced {
+		if drifted := r.driftedCondition(obj, diff, dryRun); drifted != nil {
+			conditions = append(conditions, *drifted)
+		}
+
+		if dryRun && !diff.IsEmpty() {
+			conditions = append(conditions, metav1.Condition{
+				Type:    api.ConditionTypeSynced,
+				Status:  metav1.ConditionFalse,
+				Reason:  "Drifted",
+				Message: fmt.Sprintf("Entry has drifted: %s", diff),
+			})
+		}
+
+		// A reported entry that has been deleted from the directory is not
+		// ready, but the phase is left alone so that resyncs stay dry runs.
+		if dryRun && diff.Missing {
+			conditions = append(conditions, metav1.Condition{
+				Type:    api.ConditionTypeReady,
+				Status:  metav1.ConditionFalse,
+				Reason:  "EntryMissing",
+				Message: "Entry has been deleted from the directory",
+			})
+		}
+	} else if diff.Missing {
 		r.Recorder.Event(obj, corev1.EventTypeNormal,
 			"Created", "Successfully created")
+	} else if !diff.IsEmpty() {
+		r.Recorder.Event(obj, corev1.EventTypeNormal,
+			"Updated", "Successfully updated")
+	}
 
-		if err := r.markReady(ctx, obj); err != nil {
-			return ctrl.Result{}, err
+	// The entry is recreated if it was deleted from the directory, in which
+	// case it'll have a new entryUUID. A reported deletion keeps the last
+	// known entryUUID.
+	entryUUID := obj.GetStatus().EntryUUID
+	if !dryRun && (entryUUID == "" || diff.Missing) {
+		entryUUID, err = ldapClient.GetEntryUUID(dn)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to get entry uuid: %w", err)
 		}
 	}
 
-	return ctrl.Result{}, nil
+	if err := r.markReady(ctx, obj, dn, entryUUID, conditions...); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: r.resyncPeriod(obj)}, nil
 }
 
 func (r *LDAPObjectReconciler[T, E]) SetupWithManager(mgr ctrl.Manager) error {
+	// Every sync updates the status of the object, so status only changes
+	// must not trigger another reconcile.
 	return ctrl.NewControllerManagedBy(mgr).
-		For(r.newInstance()).
+		For(r.newInstance(), builder.WithPredicates(
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
 		Complete(r)
 }
 
@@ -304,13 +430,22 @@ func (r *LDAPObjectReconciler[T, E]) newInstance() T {
 	return reflect.New(reflect.TypeOf((*T)(nil)).Elem().Elem()).Interface().(T)
 }
 
-func (r *LDAPObjectReconciler[T, E]) markPending(ctx context.Context, obj T) error {
+func (r *LDAPObjectReconciler[T, E]) markPending(ctx context.Context, obj T, reason, message string, conditions ...metav1.Condition) error {
 	key := client.ObjectKeyFromObject(obj)
 	err := updater.UpdateStatus(ctx, r.Client, key, obj, func() error {
-		obj.SetStatus(api.SimpleStatus{
-			Phase:              api.PhasePending,
-			ObservedGeneration: obj.GetGeneration(),
-		})
+		status := obj.GetStatus().DeepCopy()
+		status.Phase = api.PhasePending
+		status.ObservedGeneration = obj.GetGeneration()
+		status.Message = message
+
+		setStatusConditions(status, obj.GetGeneration(), append([]metav1.Condition{{
+			Type:    api.ConditionTypeReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: message,
+		}}, conditions...)...)
+
+		obj.SetStatus(*status)
 
 		return nil
 	})
@@ -321,13 +456,41 @@ func (r *LDAPObjectReconciler[T, E]) markPending(ctx context.Context, obj T) err
 	return nil
 }
 
-func (r *LDAPObjectReconciler[T, E]) markReady(ctx context.Context, obj T) error {
+func (r *LDAPObjectReconciler[T, E]) markReady(ctx context.Context, obj T, dn, entryUUID string, conditions ...metav1.Condition) error {
 	key := client.ObjectKeyFromObject(obj)
 	err := updater.UpdateStatus(ctx, r.Client, key, obj, func() error {
-		obj.SetStatus(api.SimpleStatus{
-			Phase:              api.PhaseReady,
-			ObservedGeneration: obj.GetGeneration(),
-		})
+		now := metav1.Now()
+
+		status := obj.GetStatus().DeepCopy()
+		status.Phase = api.PhaseReady
+		status.ObservedGeneration = obj.GetGeneration()
+		status.Message = ""
+		status.DistinguishedName = dn
+		status.EntryUUID = entryUUID
+		status.LastSyncTime = &now
+
+		setStatusConditions(status, obj.GetGeneration(), append([]metav1.Condition{
+			{
+				Type:    api.ConditionTypeReady,
+				Status:  metav1.ConditionTrue,
+				Reason:  "Reconciled",
+				Message: "Entry is up to date",
+			},
+			{
+				Type:    api.ConditionTypeReferencesResolved,
+				Status:  metav1.ConditionTrue,
+				Reason:  "Resolved",
+				Message: "All references are resolvable",
+			},
+			{
+				Type:    api.ConditionTypeSynced,
+				Status:  metav1.ConditionTrue,
+				Reason:  "Synced",
+				Message: "Entry matches the object",
+			},
+		}, conditions...)...)
+
+		obj.SetStatus(*status)
 
 		return nil
 	})
@@ -338,16 +501,24 @@ func (r *LDAPObjectReconciler[T, E]) markReady(ctx context.Context, obj T) error
 	return nil
 }
 
-func (r *LDAPObjectReconciler[T, E]) markFailed(ctx context.Context, obj T, err error) {
+func (r *LDAPObjectReconciler[T, E]) markFailed(ctx context.Context, obj T, err error, conditions ...metav1.Condition) {
 	logger := zaplogr.FromContext(ctx)
 
 	key := client.ObjectKeyFromObject(obj)
 	updateErr := updater.UpdateStatus(ctx, r.Client, key, obj, func() error {
-		obj.SetStatus(api.SimpleStatus{
-			Phase:              api.PhaseFailed,
-			ObservedGeneration: obj.GetGeneration(),
-			Message:            err.Error(),
-		})
+		status := obj.GetStatus().DeepCopy()
+		status.Phase = api.PhaseFailed
+		status.ObservedGeneration = obj.GetGeneration()
+		status.Message = err.Error()
+
+		setStatusConditions(status, obj.GetGeneration(), append([]metav1.Condition{{
+			Type:    api.ConditionTypeReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Failed",
+			Message: err.Error(),
+		}}, conditions...)...)
+
+		obj.SetStatus(*status)
 
 		return nil
 	})
@@ -356,6 +527,107 @@ func (r *LDAPObjectReconciler[T, E]) markFailed(ctx context.Context, obj T, err
 	}
 }
 
+// setStatusConditions sets conditions on the status, later conditions take
+// precedence over earlier conditions of the same type.
+func setStatusConditions(status *api.SimpleStatus, generation int64, conditions ...metav1.Condition) {
+	for _, condition := range conditions {
+		condition.ObservedGeneration = generation
+		meta.SetStatusCondition(&status.Conditions, condition)
+	}
+}
+
+// setPaused records whether reconciliation of the object is paused, the
+// condition is only updated when it changes.
+func (r *LDAPObjectReconciler[T, E]) setPaused(ctx context.Context, obj T, paused bool, message string) error {
+	existing := meta.FindStatusCondition(obj.GetStatus().Conditions, api.ConditionTypePaused)
+	if !paused && (existing == nil || existing.Status == metav1.ConditionFalse) {
+		return nil
+	}
+
+	condition := metav1.Condition{
+		Type:               api.ConditionTypePaused,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: obj.GetGeneration(),
+		Reason:             "Paused",
+		Message:            message,
+	}
+
+	if !paused {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Resumed"
+	}
+
+	if existing != nil && existing.Status == condition.Status && existing.Message == condition.Message {
+		return nil
+	}
+
+	r.Recorder.Event(obj, corev1.EventTypeNormal, condition.Reason, message)
+
+	key := client.ObjectKeyFromObject(obj)
+	err := updater.UpdateStatus(ctx, r.Client, key, obj, func() error {
+		meta.SetStatusCondition(&obj.GetStatus().Conditions, condition)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set paused condition: %w", err)
+	}
+
+	return nil
+}
+
+// driftedCondition returns the drifted condition to set after the entry has
+// been resynced, or nil if the condition hasn't changed.
+func (r *LDAPObjectReconciler[T, E]) driftedCondition(obj T, diff *ldap.EntryDiff, dryRun bool) *metav1.Condition {
+	existing := meta.FindStatusCondition(obj.GetStatus().Conditions, api.ConditionTypeDrifted)
+	if diff.IsEmpty() && (existing == nil || existing.Status == metav1.ConditionFalse) {
+		return nil
+	}
+
+	condition := metav1.Condition{
+		Type:    api.ConditionTypeDrifted,
+		Status:  metav1.ConditionFalse,
+		Reason:  "InSync",
+		Message: "Entry matches the directory",
+	}
+
+	if !diff.IsEmpty() {
+		condition.Status = metav1.ConditionTrue
+		if dryRun {
+			condition.Reason = "Detected"
+			condition.Message = fmt.Sprintf("Detected drift of the entry: %s", diff)
+		} else {
+			condition.Reason = "Corrected"
+			condition.Message = fmt.Sprintf("Corrected drift of the entry: %s", diff)
+		}
+	}
+
+	// A correction is always worth an event, even if the last resync also
+	// corrected the same drift.
+	if existing != nil && existing.Status == condition.Status && existing.Message == condition.Message &&
+		condition.Reason != "Corrected" {
+		return nil
+	}
+
+	if diff.IsEmpty() {
+		r.Recorder.Event(obj, corev1.EventTypeNormal, condition.Reason, condition.Message)
+	} else {
+		r.Recorder.Event(obj, corev1.EventTypeWarning, "Drifted", condition.Message)
+	}
+
+	return &condition
+}
+
+// resyncPeriod returns how long to wait before comparing the entry with the
+// directory again, zero disables resyncs.
+func (r *LDAPObjectReconciler[T, E]) resyncPeriod(obj T) time.Duration {
+	if resyncPeriod := obj.GetLDAPObjectSpec().ResyncPeriod; resyncPeriod != nil {
+		return resyncPeriod.Duration
+	}
+
+	return r.ResyncPeriod
+}
+
 func (r *LDAPObjectReconciler[T, E]) setOwner(ctx context.Context, obj T, owner runtime.Object) error {
 	_, err := controllerutil.CreateOrPatch(ctx, r.Client, obj, func() error {
 		return controllerutil.SetControllerReference(owner.(metav1.Object), obj, r.Scheme)
@@ -37,6 +37,8 @@ import (
 	"go.uber.org/zap/zaptest"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -122,7 +124,7 @@ func TestLDAPObjectReconciler(t *testing.T) {
 		},
 		Spec: ldapv1alpha1.LDAPDirectorySpec{
 			Domain: "example.com",
-			CertificateSecretRef: reference.LocalSecretReference{
+			CertificateSecretRef: &reference.LocalSecretReference{
 				Name: "certificate",
 			},
 		},
@@ -162,7 +164,8 @@ func TestLDAPObjectReconciler(t *testing.T) {
 		var m mock.Mock
 		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
 
-		m.On("CreateOrUpdateEntry", mock.Anything).Return(true, nil)
+		m.On("SyncEntry", mock.Anything, false).Return(&ldap.EntryDiff{Missing: true}, nil)
+		m.On("GetEntryUUID", "uid=test-user,ou=users,dc=example,dc=com").Return("6c7b6b4e-3b0a-4a1e-9d1e-0c4c1c1b9b1a", nil)
 
 		resp, err := r.Reconcile(ctx, reconcile.Request{
 			NamespacedName: types.NamespacedName{
@@ -182,6 +185,325 @@ func TestLDAPObjectReconciler(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, api.PhaseReady, updatedUser.Status.Phase)
+		assert.Equal(t, "uid=test-user,ou=users,dc=example,dc=com", updatedUser.Status.DistinguishedName)
+		assert.Equal(t, "6c7b6b4e-3b0a-4a1e-9d1e-0c4c1c1b9b1a", updatedUser.Status.EntryUUID)
+		assert.NotNil(t, updatedUser.Status.LastSyncTime)
+
+		for _, conditionType := range []string{api.ConditionTypeReady, api.ConditionTypeSynced, api.ConditionTypeReferencesResolved} {
+			assert.True(t, meta.IsStatusConditionTrue(updatedUser.Status.Conditions, conditionType), conditionType)
+		}
+	})
+
+	t.Run("Adopt Existing Entry", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(user, userPassword, orgUnit, directory).
+			WithStatusSubresource(user, orgUnit, directory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("SyncEntry", mock.Anything, false).Return(&ldap.EntryDiff{}, nil)
+		m.On("GetEntryUUID", mock.Anything).Return("6c7b6b4e-3b0a-4a1e-9d1e-0c4c1c1b9b1a", nil)
+
+		resp, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      user.Name,
+				Namespace: user.Namespace,
+			},
+		})
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		assert.Len(t, eventRecorder.Events, 0)
+
+		updatedUser := user.DeepCopy()
+		err = subResourceClient.Get(ctx, user, updatedUser)
+		require.NoError(t, err)
+
+		assert.Equal(t, api.PhaseReady, updatedUser.Status.Phase)
+		assert.Equal(t, "6c7b6b4e-3b0a-4a1e-9d1e-0c4c1c1b9b1a", updatedUser.Status.EntryUUID)
+		assert.True(t, meta.IsStatusConditionTrue(updatedUser.Status.Conditions, api.ConditionTypeReady))
+	})
+
+	t.Run("Recover From Failure", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		failedUser := user.DeepCopy()
+		failedUser.Generation = 2
+		failedUser.Status = api.SimpleStatus{
+			Phase:              api.PhaseFailed,
+			ObservedGeneration: 1,
+			Message:            "failed to create or update ldap entry: bang",
+			DistinguishedName:  "uid=test-user,ou=users,dc=example,dc=com",
+			EntryUUID:          "6c7b6b4e-3b0a-4a1e-9d1e-0c4c1c1b9b1a",
+			Conditions: []metav1.Condition{
+				{
+					Type:   api.ConditionTypeReady,
+					Status: metav1.ConditionFalse,
+					Reason: "Failed",
+				},
+			},
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(failedUser, userPassword, orgUnit, directory).
+			WithStatusSubresource(failedUser, orgUnit, directory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("SyncEntry", mock.Anything, false).Return(&ldap.EntryDiff{Attributes: []string{"cn"}}, nil)
+
+		resp, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      user.Name,
+				Namespace: user.Namespace,
+			},
+		})
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Equal(t, "Normal Updated Successfully updated", event)
+
+		m.AssertNotCalled(t, "GetEntryUUID", mock.Anything)
+
+		updatedUser := user.DeepCopy()
+		err = subResourceClient.Get(ctx, user, updatedUser)
+		require.NoError(t, err)
+
+		assert.Equal(t, api.PhaseReady, updatedUser.Status.Phase)
+		assert.Equal(t, int64(2), updatedUser.Status.ObservedGeneration)
+		assert.Empty(t, updatedUser.Status.Message)
+
+		ready := meta.FindStatusCondition(updatedUser.Status.Conditions, api.ConditionTypeReady)
+		require.NotNil(t, ready)
+		assert.Equal(t, metav1.ConditionTrue, ready.Status)
+		assert.Equal(t, int64(2), ready.ObservedGeneration)
+	})
+
+	t.Run("Drift Corrected", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		readyUser := user.DeepCopy()
+		readyUser.Generation = 1
+		readyUser.Status = api.SimpleStatus{
+			Phase:              api.PhaseReady,
+			ObservedGeneration: 1,
+			DistinguishedName:  "uid=test-user,ou=users,dc=example,dc=com",
+			EntryUUID:          "6c7b6b4e-3b0a-4a1e-9d1e-0c4c1c1b9b1a",
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(readyUser, userPassword, orgUnit, directory).
+			WithStatusSubresource(readyUser, orgUnit, directory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("SyncEntry", mock.Anything, false).Return(&ldap.EntryDiff{Attributes: []string{"mail"}}, nil)
+
+		r.ResyncPeriod = 10 * time.Minute
+		t.Cleanup(func() {
+			r.ResyncPeriod = 0
+		})
+
+		resp, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      user.Name,
+				Namespace: user.Namespace,
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 10*time.Minute, resp.RequeueAfter)
+
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Equal(t, "Warning Drifted Corrected drift of the entry: attributes differ: mail", event)
+
+		updatedUser := user.DeepCopy()
+		err = subResourceClient.Get(ctx, user, updatedUser)
+		require.NoError(t, err)
+
+		drifted := meta.FindStatusCondition(updatedUser.Status.Conditions, api.ConditionTypeDrifted)
+		require.NotNil(t, drifted)
+		assert.Equal(t, metav1.ConditionTrue, drifted.Status)
+		assert.Equal(t, "Corrected", drifted.Reason)
+	})
+
+	t.Run("Drift Report", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		readyUser := user.DeepCopy()
+		readyUser.Generation = 1
+		readyUser.Spec.DriftPolicy = api.DriftPolicyReport
+		readyUser.Spec.ResyncPeriod = &metav1.Duration{Duration: time.Minute}
+		readyUser.Status = api.SimpleStatus{
+			Phase:              api.PhaseReady,
+			ObservedGeneration: 1,
+			DistinguishedName:  "uid=test-user,ou=users,dc=example,dc=com",
+			EntryUUID:          "6c7b6b4e-3b0a-4a1e-9d1e-0c4c1c1b9b1a",
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(readyUser, userPassword, orgUnit, directory).
+			WithStatusSubresource(readyUser, orgUnit, directory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("SyncEntry", mock.Anything, true).Return(&ldap.EntryDiff{Attributes: []string{"userPassword"}}, nil)
+
+		resp, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      user.Name,
+				Namespace: user.Namespace,
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, resp.RequeueAfter)
+
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Equal(t, "Warning Drifted Detected drift of the entry: attributes differ: userPassword", event)
+
+		m.AssertNotCalled(t, "SyncEntry", mock.Anything, false)
+
+		updatedUser := user.DeepCopy()
+		err = subResourceClient.Get(ctx, user, updatedUser)
+		require.NoError(t, err)
+
+		drifted := meta.FindStatusCondition(updatedUser.Status.Conditions, api.ConditionTypeDrifted)
+		require.NotNil(t, drifted)
+		assert.Equal(t, metav1.ConditionTrue, drifted.Status)
+		assert.Equal(t, "Detected", drifted.Reason)
+
+		assert.Equal(t, api.PhaseReady, updatedUser.Status.Phase)
+		assert.True(t, meta.IsStatusConditionTrue(updatedUser.Status.Conditions, api.ConditionTypeReady))
+		assert.True(t, meta.IsStatusConditionFalse(updatedUser.Status.Conditions, api.ConditionTypeSynced))
+	})
+
+	t.Run("Drift Report Missing", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		readyUser := user.DeepCopy()
+		readyUser.Generation = 1
+		readyUser.Spec.DriftPolicy = api.DriftPolicyReport
+		readyUser.Status = api.SimpleStatus{
+			Phase:              api.PhaseReady,
+			ObservedGeneration: 1,
+			DistinguishedName:  "uid=test-user,ou=users,dc=example,dc=com",
+			EntryUUID:          "6c7b6b4e-3b0a-4a1e-9d1e-0c4c1c1b9b1a",
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(readyUser, userPassword, orgUnit, directory).
+			WithStatusSubresource(readyUser, orgUnit, directory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		m.On("SyncEntry", mock.Anything, true).Return(&ldap.EntryDiff{Missing: true}, nil)
+
+		_, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      user.Name,
+				Namespace: user.Namespace,
+			},
+		})
+		require.NoError(t, err)
+
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Equal(t, "Warning Drifted Detected drift of the entry: entry is missing", event)
+
+		m.AssertNotCalled(t, "SyncEntry", mock.Anything, false)
+		m.AssertNotCalled(t, "GetEntryUUID", mock.Anything)
+
+		updatedUser := user.DeepCopy()
+		err = subResourceClient.Get(ctx, user, updatedUser)
+		require.NoError(t, err)
+
+		assert.True(t, meta.IsStatusConditionTrue(updatedUser.Status.Conditions, api.ConditionTypeDrifted))
+		assert.True(t, meta.IsStatusConditionFalse(updatedUser.Status.Conditions, api.ConditionTypeReady))
+		assert.True(t, meta.IsStatusConditionFalse(updatedUser.Status.Conditions, api.ConditionTypeSynced))
+		assert.Equal(t, "6c7b6b4e-3b0a-4a1e-9d1e-0c4c1c1b9b1a", updatedUser.Status.EntryUUID)
+	})
+
+	t.Run("Paused", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		pausedDirectory := directory.DeepCopy()
+		pausedDirectory.Annotations = map[string]string{
+			api.PausedAnnotation: "true",
+		}
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(user, userPassword, orgUnit, pausedDirectory).
+			WithStatusSubresource(user, orgUnit, pausedDirectory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		resp, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      user.Name,
+				Namespace: user.Namespace,
+			},
+		})
+		require.NoError(t, err)
+		assert.NotZero(t, resp.RequeueAfter)
+
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Equal(t, "Normal Paused Reconciliation of the referenced directory is paused", event)
+
+		m.AssertNotCalled(t, "SyncEntry", mock.Anything, mock.Anything)
+
+		updatedUser := user.DeepCopy()
+		err = subResourceClient.Get(ctx, user, updatedUser)
+		require.NoError(t, err)
+
+		assert.True(t, meta.IsStatusConditionTrue(updatedUser.Status.Conditions, api.ConditionTypePaused))
 	})
 
 	t.Run("Delete", func(t *testing.T) {
@@ -251,6 +573,8 @@ func TestLDAPObjectReconciler(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, api.PhasePending, updatedUser.Status.Phase)
+		assert.True(t, meta.IsStatusConditionFalse(updatedUser.Status.Conditions, api.ConditionTypeReady))
+		assert.True(t, meta.IsStatusConditionFalse(updatedUser.Status.Conditions, api.ConditionTypeReferencesResolved))
 	})
 
 	t.Run("Directory Not Ready", func(t *testing.T) {
@@ -289,6 +613,85 @@ func TestLDAPObjectReconciler(t *testing.T) {
 		assert.Equal(t, api.PhasePending, updatedUser.Status.Phase)
 	})
 
+	t.Run("Directory Suspended", func(t *testing.T) {
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		suspendedDirectory := directory.DeepCopy()
+		suspendedDirectory.Spec.Suspend = true
+		suspendedDirectory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseSuspended
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(user, userPassword, orgUnit, suspendedDirectory).
+			WithStatusSubresource(user, orgUnit, suspendedDirectory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		resp, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      user.Name,
+				Namespace: user.Namespace,
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, resp.RequeueAfter)
+
+		assert.Len(t, eventRecorder.Events, 0)
+
+		updatedUser := user.DeepCopy()
+		err = subResourceClient.Get(ctx, user, updatedUser)
+		require.NoError(t, err)
+
+		assert.Equal(t, api.PhasePending, updatedUser.Status.Phase)
+	})
+
+	t.Run("Delete With Directory Suspended", func(t *testing.T) {
+		deletingUser := user.DeepCopy()
+		deletingUser.DeletionTimestamp = &metav1.Time{Time: metav1.Now().Add(-1 * time.Second)}
+		deletingUser.Finalizers = []string{controller.FinalizerName}
+
+		eventRecorder := record.NewFakeRecorder(2)
+		r.Recorder = eventRecorder
+
+		subResourceClient.Reset()
+
+		suspendedDirectory := directory.DeepCopy()
+		suspendedDirectory.Spec.Suspend = true
+		suspendedDirectory.Status.Phase = ldapv1alpha1.LDAPDirectoryPhaseSuspended
+
+		r.Client = fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(deletingUser, userPassword, orgUnit, suspendedDirectory).
+			WithStatusSubresource(deletingUser, orgUnit, suspendedDirectory).
+			WithInterceptorFuncs(interceptorFuncs).
+			Build()
+
+		var m mock.Mock
+		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
+
+		resp, err := r.Reconcile(ctx, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      user.Name,
+				Namespace: user.Namespace,
+			},
+		})
+		require.NoError(t, err)
+		assert.Zero(t, resp)
+
+		require.Len(t, eventRecorder.Events, 1)
+		event := <-eventRecorder.Events
+		assert.Equal(t, "Warning NotDeleted Referenced directory is suspended, the entry has not been deleted", event)
+
+		m.AssertNotCalled(t, "DeleteEntry", mock.Anything, mock.Anything)
+
+		// The finalizer is removed, so the object is gone.
+		err = r.Client.Get(ctx, client.ObjectKeyFromObject(user), &ldapv1alpha1.LDAPUser{})
+		assert.True(t, apierrors.IsNotFound(err))
+	})
+
 	t.Run("Parent Not Ready", func(t *testing.T) {
 		eventRecorder := record.NewFakeRecorder(2)
 		r.Recorder = eventRecorder
@@ -341,7 +744,7 @@ func TestLDAPObjectReconciler(t *testing.T) {
 		var m mock.Mock
 		r.LDAPClientBuilder = ldap.NewFakeClientBuilder(&m)
 
-		m.On("CreateOrUpdateEntry", mock.Anything).Return(false, fmt.Errorf("bang"))
+		m.On("SyncEntry", mock.Anything, false).Return((*ldap.EntryDiff)(nil), fmt.Errorf("bang"))
 
 		resp, err := r.Reconcile(ctx, reconcile.Request{
 			NamespacedName: types.NamespacedName{
@@ -361,5 +764,7 @@ func TestLDAPObjectReconciler(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, api.PhaseFailed, updateduser.Status.Phase)
+		assert.True(t, meta.IsStatusConditionFalse(updateduser.Status.Conditions, api.ConditionTypeReady))
+		assert.True(t, meta.IsStatusConditionFalse(updateduser.Status.Conditions, api.ConditionTypeSynced))
 	})
 }
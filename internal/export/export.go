@@ -0,0 +1,119 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package export exports the entries of a directory as LDIF.
+package export
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+)
+
+// DefaultFilter matches every entry.
+const DefaultFilter = "(objectClass=*)"
+
+// scrubReferencePattern matches $(attribute) references in scrub rule values.
+var scrubReferencePattern = regexp.MustCompile(`\$\(([A-Za-z][A-Za-z0-9-]*)\)`)
+
+// Options selects the entries (and attributes) that are exported, and how
+// they are scrubbed.
+type Options struct {
+	// BaseDN is the root of the exported subtree.
+	BaseDN string `json:"baseDN"`
+	// Filter selects the exported entries, defaults to DefaultFilter.
+	Filter string `json:"filter,omitempty"`
+	// Attributes are the exported attributes, every user attribute if empty.
+	Attributes []string `json:"attributes,omitempty"`
+	// Scrub are rules that are applied to every exported entry.
+	Scrub []ldapv1alpha1.LDAPDirectoryScrubRule `json:"scrub,omitempty"`
+}
+
+// Export searches the directory (with paged searches), and writes the
+// scrubbed entries to w as LDIF. It returns the number of exported entries.
+func Export(w io.Writer, client ldap.Client, opts *Options) (int, error) {
+	filter := opts.Filter
+	if filter == "" {
+		filter = DefaultFilter
+	}
+
+	records, err := client.Search(opts.BaseDN, filter, opts.Attributes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to search directory: %w", err)
+	}
+
+	for i := range records {
+		records[i] = Scrub(records[i], opts.Scrub)
+	}
+
+	if _, err := w.Write(ldif.Marshal(records)); err != nil {
+		return 0, fmt.Errorf("failed to write ldif: %w", err)
+	}
+
+	return len(records), nil
+}
+
+// Scrub applies the scrub rules to the attributes of an entry. References in
+// the values of rules are resolved against the entry before it was scrubbed.
+func Scrub(record ldif.Record, rules []ldapv1alpha1.LDAPDirectoryScrubRule) ldif.Record {
+	if len(rules) == 0 {
+		return record
+	}
+
+	attributes := make([]ldif.Attribute, 0, len(record.Attributes))
+	for _, attr := range record.Attributes {
+		if rule := findScrubRule(rules, attr.Name); rule != nil {
+			if rule.Value == nil {
+				continue
+			}
+
+			value := scrubReferencePattern.ReplaceAllStringFunc(*rule.Value, func(ref string) string {
+				name := scrubReferencePattern.FindStringSubmatch(ref)[1]
+				if values := record.GetAttributeValues(name); len(values) > 0 {
+					return values[0]
+				}
+
+				return ""
+			})
+
+			attr = ldif.Attribute{Name: attr.Name, Values: []string{value}}
+		}
+
+		attributes = append(attributes, attr)
+	}
+
+	return ldif.Record{
+		DN:         record.DN,
+		ChangeType: record.ChangeType,
+		Attributes: attributes,
+	}
+}
+
+func findScrubRule(rules []ldapv1alpha1.LDAPDirectoryScrubRule, attribute string) *ldapv1alpha1.LDAPDirectoryScrubRule {
+	for i := range rules {
+		if strings.EqualFold(rules[i].Attribute, attribute) {
+			return &rules[i]
+		}
+	}
+
+	return nil
+}
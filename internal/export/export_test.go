@@ -0,0 +1,104 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/export"
+	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+)
+
+func TestExport(t *testing.T) {
+	records := []ldif.Record{
+		{
+			DN:         "ou=users,dc=example,dc=com",
+			ChangeType: ldif.ChangeTypeAdd,
+			Attributes: []ldif.Attribute{
+				{Name: "objectClass", Values: []string{"top", "organizationalUnit"}},
+				{Name: "ou", Values: []string{"users"}},
+			},
+		},
+		{
+			DN:         "uid=demo,ou=users,dc=example,dc=com",
+			ChangeType: ldif.ChangeTypeAdd,
+			Attributes: []ldif.Attribute{
+				{Name: "uid", Values: []string{"demo"}},
+				{Name: "mail", Values: []string{"demo@example.com"}},
+				{Name: "userPassword", Values: []string{"{ARGON2}secret"}},
+			},
+		},
+	}
+
+	t.Run("Export", func(t *testing.T) {
+		var m mock.Mock
+		client, err := ldap.NewFakeClientBuilder(&m).Build(context.Background())
+		require.NoError(t, err)
+
+		m.On("Search", "ou=users,dc=example,dc=com", export.DefaultFilter, []string(nil)).
+			Return(records, nil)
+
+		var buf bytes.Buffer
+		n, err := export.Export(&buf, client, &export.Options{
+			BaseDN: "ou=users,dc=example,dc=com",
+			Scrub: []ldapv1alpha1.LDAPDirectoryScrubRule{
+				{Attribute: "userPassword"},
+				{Attribute: "mail", Value: ptr.To("$(uid)@staging.example.com")},
+			},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, n)
+		assert.Equal(t, `dn: ou=users,dc=example,dc=com
+objectClass: top
+objectClass: organizationalUnit
+ou: users
+
+dn: uid=demo,ou=users,dc=example,dc=com
+uid: demo
+mail: demo@staging.example.com
+`, buf.String())
+	})
+
+	t.Run("Search Failed", func(t *testing.T) {
+		var m mock.Mock
+		client, err := ldap.NewFakeClientBuilder(&m).Build(context.Background())
+		require.NoError(t, err)
+
+		m.On("Search", "dc=example,dc=com", "(uid=demo)", []string{"uid"}).
+			Return([]ldif.Record(nil), errors.New("no such object"))
+
+		var buf bytes.Buffer
+		_, err = export.Export(&buf, client, &export.Options{
+			BaseDN:     "dc=example,dc=com",
+			Filter:     "(uid=demo)",
+			Attributes: []string{"uid"},
+		})
+		assert.ErrorContains(t, err, "no such object")
+		assert.Zero(t, buf.Len())
+	})
+}
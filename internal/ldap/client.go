@@ -20,27 +20,44 @@ package ldap
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
+// ErrNotFound is returned when an entry does not exist.
+var ErrNotFound = errors.New("entry not found")
+
 // Client is an goldap directory client.
 type Client interface {
 	Ping() error
 	GetEntry(dn string, entry any) error
 	CreateOrUpdateEntry(entry any) (created bool, err error)
+	// SyncEntry compares an entry with the directory and, unless dryRun is
+	// set, creates or updates it to match. It returns how the entry differed.
+	SyncEntry(entry any, dryRun bool) (*EntryDiff, error)
+	// GetEntryUUID returns the entryUUID of an entry.
+	GetEntryUUID(dn string) (string, error)
 	DeleteEntry(dn string, cascading bool) error
+	ApplyLDIF(records []ldif.Record) (applied int, err error)
+	// GetChanges returns (at most limit) changes recorded after, and up to
+	// before (if not empty), the given change IDs.
+	GetChanges(after, before string, limit int) ([]Change, error)
+	GetSyncState(searchBase string) (*SyncState, error)
+	Search(baseDN, filter string, attributes []string) ([]ldif.Record, error)
 }
 
 type clientImpl struct {
-	directoryAddress string
-	caBundle         *x509.CertPool
-	adminUsername    string
-	adminPassword    string
-	baseDN           string
+	directoryAddresses []string
+	caBundle           *x509.CertPool
+	adminUsername      string
+	adminPassword      string
+	baseDN             string
 }
 
 // Ping checks if the directory is available and responding to requests.
@@ -69,6 +86,13 @@ func (c *clientImpl) Ping() error {
 
 func (c *clientImpl) GetEntry(dn string, entry any) error {
 	switch entry := entry.(type) {
+	case *Organization:
+		o, err := c.getOrganization(dn)
+		if err != nil {
+			return err
+		}
+
+		*entry = *o
 	case *OrganizationalUnit:
 		ou, err := c.getOrganizationalUnit(dn)
 		if err != nil {
@@ -98,16 +122,55 @@ func (c *clientImpl) GetEntry(dn string, entry any) error {
 }
 
 func (c *clientImpl) CreateOrUpdateEntry(entry any) (bool, error) {
+	diff, err := c.SyncEntry(entry, false)
+	if err != nil {
+		return false, err
+	}
+
+	return diff.Missing, nil
+}
+
+func (c *clientImpl) SyncEntry(entry any, dryRun bool) (*EntryDiff, error) {
 	switch entry := entry.(type) {
+	case *Organization:
+		return c.createOrUpdateOrganization(entry, dryRun)
 	case *OrganizationalUnit:
-		return c.createOrUpdateOrganizationalUnit(entry)
+		return c.createOrUpdateOrganizationalUnit(entry, dryRun)
 	case *Group:
-		return c.createOrUpdateGroup(entry)
+		return c.createOrUpdateGroup(entry, dryRun)
 	case *User:
-		return c.createOrUpdateUser(entry)
+		return c.createOrUpdateUser(entry, dryRun)
 	default:
-		return false, fmt.Errorf("unsupported entry type: %T", entry)
+		return nil, fmt.Errorf("unsupported entry type: %T", entry)
+	}
+}
+
+// GetEntryUUID returns the entryUUID operational attribute of an entry.
+func (c *clientImpl) GetEntryUUID(dn string) (string, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return "", err
 	}
+	defer conn.Close()
+
+	searchRequest := goldap.NewSearchRequest(
+		dn,
+		goldap.ScopeBaseObject, goldap.NeverDerefAliases, 1, 0, false,
+		"(objectClass=*)",
+		[]string{"entryUUID"},
+		nil,
+	)
+
+	searchResult, err := conn.Search(searchRequest)
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+		return "", fmt.Errorf("failed to search for entry: %w", err)
+	}
+
+	if len(searchResult.Entries) == 0 {
+		return "", fmt.Errorf("entry %q: %w", dn, ErrNotFound)
+	}
+
+	return searchResult.Entries[0].GetAttributeValue("entryUUID"), nil
 }
 
 // DeleteEntry deletes an entry from the directory (if it exists).
@@ -151,6 +214,200 @@ func (c *clientImpl) DeleteEntry(dn string, cascading bool) error {
 	return nil
 }
 
+// ApplyLDIF applies a list of LDIF records to the directory. Entries that
+// already exist, deletions of entries that do not, and modifications that have
+// already been made are skipped so that the same records can be safely
+// applied more than once.
+func (c *clientImpl) ApplyLDIF(records []ldif.Record) (int, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	return applyRecords(conn, records)
+}
+
+// GetChanges returns successful write operations recorded in the accesslog
+// database (cn=accesslog) that started after the given reqStart timestamp,
+// and up to the before timestamp (if not empty), oldest first. If after is
+// empty, the oldest recorded changes are returned.
+func (c *clientImpl) GetChanges(after, before string, limit int) ([]Change, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	filter := "(objectClass=auditWriteObject)(reqResult=0)"
+	if after != "" {
+		filter += fmt.Sprintf("(reqStart>=%s)", goldap.EscapeFilter(after))
+	}
+	if before != "" {
+		filter += fmt.Sprintf("(reqStart<=%s)", goldap.EscapeFilter(before))
+	}
+
+	// The change at the cursor is also matched (the filter is inclusive).
+	sizeLimit := 0
+	if limit > 0 {
+		sizeLimit = limit + 1
+	}
+
+	// Entries are returned in the order they were added to the accesslog (ie.
+	// oldest first), so the size limit returns the oldest changes.
+	searchRequest := goldap.NewSearchRequest(
+		AccessLogDN,
+		goldap.ScopeSingleLevel, goldap.NeverDerefAliases, sizeLimit, 0, false,
+		"(&"+filter+")",
+		[]string{"reqStart", "reqType", "reqDN", "reqAuthzID", "reqMod", "reqNewRDN", "reqNewSuperior"},
+		nil,
+	)
+
+	sr, err := conn.Search(searchRequest)
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return nil, err
+	}
+
+	var changes []Change
+	for _, entry := range sr.Entries {
+		reqStart := entry.GetAttributeValue("reqStart")
+		// The filter is inclusive, the change at the cursor has already been seen.
+		if reqStart == after {
+			continue
+		}
+
+		changes = append(changes, Change{
+			ID:          reqStart,
+			Type:        entry.GetAttributeValue("reqType"),
+			DN:          entry.GetAttributeValue("reqDN"),
+			Modifier:    entry.GetAttributeValue("reqAuthzID"),
+			Mods:        entry.GetAttributeValues("reqMod"),
+			NewRDN:      entry.GetAttributeValue("reqNewRDN"),
+			NewSuperior: entry.GetAttributeValue("reqNewSuperior"),
+		})
+	}
+
+	// reqStart is a fixed width generalized time so sorts lexically.
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].ID < changes[j].ID
+	})
+
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+	}
+
+	return changes, nil
+}
+
+func (c *clientImpl) getOrganization(dn string) (*Organization, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	searchRequest := goldap.NewSearchRequest(
+		dn,
+		goldap.ScopeBaseObject, goldap.NeverDerefAliases, 1, 0, false,
+		"(objectClass=organization)",
+		[]string{"dn", "dc", "o"},
+		nil,
+	)
+
+	searchResult, err := conn.Search(searchRequest)
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+		return nil, fmt.Errorf("failed to search for organization: %w", err)
+	}
+
+	if len(searchResult.Entries) == 0 {
+		return nil, fmt.Errorf("organization %q: %w", dn, ErrNotFound)
+	}
+
+	return &Organization{
+		DistinguishedName: searchResult.Entries[0].DN,
+		DomainComponent:   searchResult.Entries[0].GetAttributeValue("dc"),
+		Name:              searchResult.Entries[0].GetAttributeValue("o"),
+	}, nil
+}
+
+func (c *clientImpl) createOrUpdateOrganization(o *Organization, dryRun bool) (*EntryDiff, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	searchRequest := goldap.NewSearchRequest(
+		o.DistinguishedName,
+		goldap.ScopeBaseObject, goldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"dn", "objectClass", "dc", "o"},
+		nil,
+	)
+
+	searchResult, err := conn.Search(searchRequest)
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+		return nil, fmt.Errorf("failed to search for organization: %w", err)
+	}
+
+	// If the organization does not exist, create it.
+	if len(searchResult.Entries) == 0 {
+		addRequest := goldap.NewAddRequest(o.DistinguishedName, nil)
+		addRequest.Attribute("objectClass", []string{"top", "dcObject", "organization"})
+		addRequest.Attribute("dc", []string{o.DomainComponent})
+		addRequest.Attribute("o", []string{o.Name})
+
+		if dryRun {
+			return &EntryDiff{Missing: true}, nil
+		}
+
+		if err := conn.Add(addRequest); err != nil {
+			return nil, fmt.Errorf("failed to create organization: %w", err)
+		}
+
+		return &EntryDiff{Missing: true}, nil
+	}
+
+	entry := searchResult.Entries[0]
+
+	modifyRequest := goldap.NewModifyRequest(o.DistinguishedName, nil)
+
+	existingObjectClasses := sets.New(entry.GetAttributeValues("objectClass")...)
+	var missingObjectClasses []string
+	for _, objectClass := range []string{"dcObject", "organization"} {
+		if !existingObjectClasses.Has(objectClass) {
+			missingObjectClasses = append(missingObjectClasses, objectClass)
+		}
+	}
+	if len(missingObjectClasses) > 0 {
+		modifyRequest.Add("objectClass", missingObjectClasses)
+	}
+
+	if entry.GetAttributeValue("o") != o.Name {
+		modifyRequest.Replace("o", []string{o.Name})
+	}
+
+	diff := &EntryDiff{Attributes: changedAttributes(modifyRequest)}
+
+	if len(modifyRequest.Changes) > 0 && !dryRun {
+		if err := conn.Modify(modifyRequest); err != nil {
+			return nil, fmt.Errorf("failed to update organization: %w", err)
+		}
+	}
+
+	return diff, nil
+}
+
+// changedAttributes returns the names of the attributes a modify request changes.
+func changedAttributes(modifyRequest *goldap.ModifyRequest) []string {
+	var attributes []string
+	for _, change := range modifyRequest.Changes {
+		attributes = append(attributes, change.Modification.Type)
+	}
+
+	return attributes
+}
+
 func (c *clientImpl) getOrganizationalUnit(dn string) (*OrganizationalUnit, error) {
 	conn, err := c.connect()
 	if err != nil {
@@ -167,10 +424,14 @@ func (c *clientImpl) getOrganizationalUnit(dn string) (*OrganizationalUnit, erro
 	)
 
 	searchResult, err := conn.Search(searchRequest)
-	if err != nil {
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
 		return nil, fmt.Errorf("failed to search for organizational unit: %w", err)
 	}
 
+	if len(searchResult.Entries) == 0 {
+		return nil, fmt.Errorf("organizational unit %q: %w", dn, ErrNotFound)
+	}
+
 	return &OrganizationalUnit{
 		DistinguishedName: searchResult.Entries[0].DN,
 		Name:              searchResult.Entries[0].GetAttributeValue("ou"),
@@ -178,10 +439,10 @@ func (c *clientImpl) getOrganizationalUnit(dn string) (*OrganizationalUnit, erro
 	}, nil
 }
 
-func (c *clientImpl) createOrUpdateOrganizationalUnit(ou *OrganizationalUnit) (bool, error) {
+func (c *clientImpl) createOrUpdateOrganizationalUnit(ou *OrganizationalUnit, dryRun bool) (*EntryDiff, error) {
 	conn, err := c.connect()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	defer conn.Close()
 
@@ -195,7 +456,7 @@ func (c *clientImpl) createOrUpdateOrganizationalUnit(ou *OrganizationalUnit) (b
 
 	searchResult, err := conn.Search(searchRequest)
 	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
-		return false, fmt.Errorf("failed to search for organizational unit: %w", err)
+		return nil, fmt.Errorf("failed to search for organizational unit: %w", err)
 	}
 
 	// If the organizational unit does not exist, create it.
@@ -207,11 +468,15 @@ func (c *clientImpl) createOrUpdateOrganizationalUnit(ou *OrganizationalUnit) (b
 			addRequest.Attribute("description", []string{ou.Description})
 		}
 
+		if dryRun {
+			return &EntryDiff{Missing: true}, nil
+		}
+
 		if err := conn.Add(addRequest); err != nil {
-			return false, fmt.Errorf("failed to create organizational unit: %w", err)
+			return nil, fmt.Errorf("failed to create organizational unit: %w", err)
 		}
 
-		return true, nil
+		return &EntryDiff{Missing: true}, nil
 	}
 
 	entry := searchResult.Entries[0]
@@ -221,13 +486,15 @@ func (c *clientImpl) createOrUpdateOrganizationalUnit(ou *OrganizationalUnit) (b
 	existingDescription := entry.GetAttributeValue("description")
 	optionalAttributeModifications(modifyRequest, "description", existingDescription, ou.Description)
 
-	if len(modifyRequest.Changes) > 0 {
+	diff := &EntryDiff{Attributes: changedAttributes(modifyRequest)}
+
+	if len(modifyRequest.Changes) > 0 && !dryRun {
 		if err := conn.Modify(modifyRequest); err != nil {
-			return false, fmt.Errorf("failed to update organizational unit: %w", err)
+			return nil, fmt.Errorf("failed to update organizational unit: %w", err)
 		}
 	}
 
-	return false, nil
+	return diff, nil
 }
 
 func (c *clientImpl) getGroup(dn string) (*Group, error) {
@@ -246,10 +513,14 @@ func (c *clientImpl) getGroup(dn string) (*Group, error) {
 	)
 
 	searchResult, err := conn.Search(searchRequest)
-	if err != nil {
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
 		return nil, fmt.Errorf("failed to search for group: %w", err)
 	}
 
+	if len(searchResult.Entries) == 0 {
+		return nil, fmt.Errorf("group %q: %w", dn, ErrNotFound)
+	}
+
 	return &Group{
 		DistinguishedName: searchResult.Entries[0].DN,
 		Name:              searchResult.Entries[0].GetAttributeValue("cn"),
@@ -258,10 +529,10 @@ func (c *clientImpl) getGroup(dn string) (*Group, error) {
 	}, nil
 }
 
-func (c *clientImpl) createOrUpdateGroup(group *Group) (bool, error) {
+func (c *clientImpl) createOrUpdateGroup(group *Group, dryRun bool) (*EntryDiff, error) {
 	conn, err := c.connect()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	defer conn.Close()
 
@@ -275,7 +546,7 @@ func (c *clientImpl) createOrUpdateGroup(group *Group) (bool, error) {
 
 	searchResult, err := conn.Search(searchRequest)
 	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
-		return false, fmt.Errorf("failed to search for group: %w", err)
+		return nil, fmt.Errorf("failed to search for group: %w", err)
 	}
 
 	// If the group does not exist, create it.
@@ -288,11 +559,15 @@ func (c *clientImpl) createOrUpdateGroup(group *Group) (bool, error) {
 			addRequest.Attribute("description", []string{group.Description})
 		}
 
+		if dryRun {
+			return &EntryDiff{Missing: true}, nil
+		}
+
 		if err := conn.Add(addRequest); err != nil {
-			return false, fmt.Errorf("failed to create group: %w", err)
+			return nil, fmt.Errorf("failed to create group: %w", err)
 		}
 
-		return true, nil
+		return &EntryDiff{Missing: true}, nil
 	}
 
 	entry := searchResult.Entries[0]
@@ -307,13 +582,15 @@ func (c *clientImpl) createOrUpdateGroup(group *Group) (bool, error) {
 		modifyRequest.Replace("member", group.Members)
 	}
 
-	if len(modifyRequest.Changes) > 0 {
+	diff := &EntryDiff{Attributes: changedAttributes(modifyRequest)}
+
+	if len(modifyRequest.Changes) > 0 && !dryRun {
 		if err := conn.Modify(modifyRequest); err != nil {
-			return false, fmt.Errorf("failed to update group: %w", err)
+			return nil, fmt.Errorf("failed to update group: %w", err)
 		}
 	}
 
-	return false, nil
+	return diff, nil
 }
 
 func (c *clientImpl) getUser(dn string) (*User, error) {
@@ -332,10 +609,14 @@ func (c *clientImpl) getUser(dn string) (*User, error) {
 	)
 
 	searchResult, err := conn.Search(searchRequest)
-	if err != nil {
+	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
 		return nil, fmt.Errorf("failed to search for user: %w", err)
 	}
 
+	if len(searchResult.Entries) == 0 {
+		return nil, fmt.Errorf("user %q: %w", dn, ErrNotFound)
+	}
+
 	return &User{
 		DistinguishedName: searchResult.Entries[0].DN,
 		Username:          searchResult.Entries[0].GetAttributeValue("uid"),
@@ -346,10 +627,10 @@ func (c *clientImpl) getUser(dn string) (*User, error) {
 	}, nil
 }
 
-func (c *clientImpl) createOrUpdateUser(user *User) (bool, error) {
+func (c *clientImpl) createOrUpdateUser(user *User, dryRun bool) (*EntryDiff, error) {
 	conn, err := c.connect()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	defer conn.Close()
 
@@ -363,7 +644,7 @@ func (c *clientImpl) createOrUpdateUser(user *User) (bool, error) {
 
 	searchResult, err := conn.Search(searchRequest)
 	if err != nil && !goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
-		return false, fmt.Errorf("failed to search for user: %w", err)
+		return nil, fmt.Errorf("failed to search for user: %w", err)
 	}
 
 	// If the user does not exist, create it.
@@ -378,18 +659,22 @@ func (c *clientImpl) createOrUpdateUser(user *User) (bool, error) {
 			addRequest.Attribute("mail", []string{user.Email})
 		}
 
+		if dryRun {
+			return &EntryDiff{Missing: true}, nil
+		}
+
 		if err := conn.Add(addRequest); err != nil {
-			return false, fmt.Errorf("failed to create user: %w", err)
+			return nil, fmt.Errorf("failed to create user: %w", err)
 		}
 
 		if user.Password != "" {
 			passwordModifyRequest := goldap.NewPasswordModifyRequest(user.DistinguishedName, "", user.Password)
 			if _, err := conn.PasswordModify(passwordModifyRequest); err != nil {
-				return false, fmt.Errorf("failed to set user password: %w", err)
+				return nil, fmt.Errorf("failed to set user password: %w", err)
 			}
 		}
 
-		return true, nil
+		return &EntryDiff{Missing: true}, nil
 	}
 
 	entry := searchResult.Entries[0]
@@ -409,15 +694,17 @@ func (c *clientImpl) createOrUpdateUser(user *User) (bool, error) {
 	existingEmail := entry.GetAttributeValue("mail")
 	optionalAttributeModifications(modifyRequest, "mail", existingEmail, user.Email)
 
-	if len(modifyRequest.Changes) > 0 {
+	diff := &EntryDiff{Attributes: changedAttributes(modifyRequest)}
+
+	if len(modifyRequest.Changes) > 0 && !dryRun {
 		if err := conn.Modify(modifyRequest); err != nil {
-			return false, fmt.Errorf("failed to update user: %w", err)
+			return nil, fmt.Errorf("failed to update user: %w", err)
 		}
 	}
 
 	connUser, err := c.connect()
 	if err != nil {
-		return false, fmt.Errorf("failed to connect to verify password: %w", err)
+		return nil, fmt.Errorf("failed to connect to verify password: %w", err)
 	}
 	defer connUser.Close()
 
@@ -426,26 +713,110 @@ func (c *clientImpl) createOrUpdateUser(user *User) (bool, error) {
 		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
 			passwordChanged = true
 		} else {
-			return false, fmt.Errorf("failed to verify password: %w", err)
+			return nil, fmt.Errorf("failed to verify password: %w", err)
 		}
 	}
 
 	if passwordChanged {
+		diff.Attributes = append(diff.Attributes, "userPassword")
+	}
+
+	if passwordChanged && !dryRun {
 		passwordModifyRequest := goldap.NewPasswordModifyRequest(user.DistinguishedName, "", user.Password)
 		if _, err := conn.PasswordModify(passwordModifyRequest); err != nil {
-			return false, fmt.Errorf("failed to set user password: %w", err)
+			return nil, fmt.Errorf("failed to set user password: %w", err)
+		}
+	}
+
+	return diff, nil
+}
+
+// GetSyncState returns the replication state of the subtree rooted at searchBase.
+func (c *clientImpl) GetSyncState(searchBase string) (*SyncState, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	sr, err := conn.Search(goldap.NewSearchRequest(
+		searchBase,
+		goldap.ScopeBaseObject, goldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"contextCSN"},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var state SyncState
+	if len(sr.Entries) > 0 {
+		state.ContextCSNs = sr.Entries[0].GetAttributeValues("contextCSN")
+	}
+
+	// Only the number of entries is needed, so no attributes are requested.
+	sr, err = conn.SearchWithPaging(goldap.NewSearchRequest(
+		searchBase,
+		goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"1.1"},
+		nil,
+	), 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	state.Entries = len(sr.Entries)
+
+	return &state, nil
+}
+
+// Search returns the entries of the subtree rooted at baseDN that match the
+// filter, as LDIF content records. If no attributes are given, every user
+// attribute of the entries is returned.
+func (c *clientImpl) Search(baseDN, filter string, attributes []string) ([]ldif.Record, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	sr, err := conn.SearchWithPaging(goldap.NewSearchRequest(
+		baseDN,
+		goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false,
+		filter,
+		attributes,
+		nil,
+	), 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]ldif.Record, 0, len(sr.Entries))
+	for _, entry := range sr.Entries {
+		record := ldif.Record{
+			DN:         entry.DN,
+			ChangeType: ldif.ChangeTypeAdd,
 		}
+
+		for _, attr := range entry.Attributes {
+			record.Attributes = append(record.Attributes, ldif.Attribute{
+				Name:   attr.Name,
+				Values: attr.Values,
+			})
+		}
+
+		records = append(records, record)
 	}
 
-	return false, nil
+	return records, nil
 }
 
 func (c *clientImpl) connect() (*goldap.Conn, error) {
-	conn, err := goldap.DialURL(c.directoryAddress, goldap.DialWithTLSConfig(&tls.Config{
-		RootCAs: c.caBundle,
-	}))
+	conn, err := c.dial()
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to ldap directory: %w", err)
+		return nil, err
 	}
 
 	conn.SetTimeout(5 * time.Second)
@@ -457,6 +828,132 @@ func (c *clientImpl) connect() (*goldap.Conn, error) {
 	return conn, nil
 }
 
+// dial connects to the first reachable directory address.
+func (c *clientImpl) dial() (*goldap.Conn, error) {
+	var errs []error
+	for _, address := range c.directoryAddresses {
+		conn, err := goldap.DialURL(address, goldap.DialWithTLSConfig(&tls.Config{
+			RootCAs: c.caBundle,
+		}))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", address, err))
+			continue
+		}
+
+		return conn, nil
+	}
+
+	return nil, fmt.Errorf("failed to connect to ldap directory: %w", errors.Join(errs...))
+}
+
+func applyRecords(conn *goldap.Conn, records []ldif.Record) (int, error) {
+	var applied int
+	for _, record := range records {
+		switch record.ChangeType {
+		case ldif.ChangeTypeAdd:
+			addRequest := goldap.NewAddRequest(record.DN, nil)
+			for _, attr := range record.Attributes {
+				addRequest.Attribute(attr.Name, attr.Values)
+			}
+
+			if err := conn.Add(addRequest); err != nil {
+				if goldap.IsErrorWithCode(err, goldap.LDAPResultEntryAlreadyExists) {
+					continue
+				}
+
+				return applied, fmt.Errorf("failed to add entry %q: %w", record.DN, err)
+			}
+		case ldif.ChangeTypeModify:
+			modifyRequest := goldap.NewModifyRequest(record.DN, nil)
+			for _, mod := range record.Modifications {
+				addModification(modifyRequest, mod.Type, mod.Name, mod.Values)
+			}
+
+			if err := conn.Modify(modifyRequest); err != nil {
+				if !isAlreadyApplied(err) {
+					return applied, fmt.Errorf("failed to modify entry %q: %w", record.DN, err)
+				}
+
+				// Some of the modifications have already been applied, as a
+				// modify is atomic each modification is retried on its own.
+				modified, err := applyModifications(conn, record)
+				if err != nil {
+					return applied, fmt.Errorf("failed to modify entry %q: %w", record.DN, err)
+				}
+
+				if !modified {
+					continue
+				}
+			}
+		case ldif.ChangeTypeDelete:
+			if err := conn.Del(goldap.NewDelRequest(record.DN, nil)); err != nil {
+				if goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+					continue
+				}
+
+				return applied, fmt.Errorf("failed to delete entry %q: %w", record.DN, err)
+			}
+		default:
+			return applied, fmt.Errorf("unsupported changetype %q for entry %q", record.ChangeType, record.DN)
+		}
+
+		applied++
+	}
+
+	return applied, nil
+}
+
+// applyModifications applies each modification (and each value added or
+// deleted) of a record separately, skipping those that have already been
+// applied. Returns whether the entry was modified.
+func applyModifications(conn *goldap.Conn, record ldif.Record) (bool, error) {
+	var modified bool
+	for _, mod := range record.Modifications {
+		values := [][]string{mod.Values}
+		if mod.Type != ldif.ModificationTypeReplace && len(mod.Values) > 1 {
+			values = nil
+			for _, value := range mod.Values {
+				values = append(values, []string{value})
+			}
+		}
+
+		for _, v := range values {
+			modifyRequest := goldap.NewModifyRequest(record.DN, nil)
+			addModification(modifyRequest, mod.Type, mod.Name, v)
+
+			if err := conn.Modify(modifyRequest); err != nil {
+				if isAlreadyApplied(err) {
+					continue
+				}
+
+				return modified, err
+			}
+
+			modified = true
+		}
+	}
+
+	return modified, nil
+}
+
+func addModification(modifyRequest *goldap.ModifyRequest, modType ldif.ModificationType, name string, values []string) {
+	switch modType {
+	case ldif.ModificationTypeAdd:
+		modifyRequest.Add(name, values)
+	case ldif.ModificationTypeReplace:
+		modifyRequest.Replace(name, values)
+	case ldif.ModificationTypeDelete:
+		modifyRequest.Delete(name, values)
+	}
+}
+
+// isAlreadyApplied returns whether a modify failed because a value being
+// added already exists, or a value being deleted does not.
+func isAlreadyApplied(err error) bool {
+	return goldap.IsErrorWithCode(err, goldap.LDAPResultAttributeOrValueExists) ||
+		goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchAttribute)
+}
+
 func optionalAttributeModifications(modifyRequest *goldap.ModifyRequest, attributeName string, existing, desired string) {
 	if desired == "" {
 		if existing != "" {
@@ -21,10 +21,10 @@ import (
 	"context"
 	"crypto/x509"
 	"fmt"
-	"strings"
 
 	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
 	"github.com/gpu-ninja/operator-utils/k8sutils"
+	"github.com/gpu-ninja/operator-utils/reference"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -36,6 +36,8 @@ type ClientBuilder interface {
 	WithScheme(scheme *runtime.Scheme) ClientBuilder
 	WithDirectory(directory *ldapv1alpha1.LDAPDirectory) ClientBuilder
 	Build(ctx context.Context) (Client, error)
+	// BuildMigrationSource builds a client for the migration source of the directory.
+	BuildMigrationSource(ctx context.Context) (Client, error)
 }
 
 type clientBuilderImpl struct {
@@ -44,6 +46,19 @@ type clientBuilderImpl struct {
 	directory *ldapv1alpha1.LDAPDirectory
 }
 
+// NewClient returns a client for the directory at the given addresses, that
+// binds as bindDN (eg. for use outside of the operator). If caBundle is nil,
+// the system trust store is used.
+func NewClient(addresses []string, caBundle *x509.CertPool, bindDN, bindPassword, baseDN string) Client {
+	return &clientImpl{
+		directoryAddresses: addresses,
+		caBundle:           caBundle,
+		adminUsername:      bindDN,
+		adminPassword:      bindPassword,
+		baseDN:             baseDN,
+	}
+}
+
 func NewClientBuilder() ClientBuilder {
 	return &clientBuilderImpl{}
 }
@@ -73,6 +88,10 @@ func (b *clientBuilderImpl) WithDirectory(directory *ldapv1alpha1.LDAPDirectory)
 }
 
 func (b *clientBuilderImpl) Build(ctx context.Context) (Client, error) {
+	if b.directory.Spec.External != nil {
+		return b.buildExternal(ctx)
+	}
+
 	adminPasswordSecret := corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      fmt.Sprintf("ldap-%s-admin-password", b.directory.Name),
@@ -86,6 +105,10 @@ func (b *clientBuilderImpl) Build(ctx context.Context) (Client, error) {
 	}
 
 	// Get the CA certificate.
+	if b.directory.Spec.CertificateSecretRef == nil {
+		return nil, fmt.Errorf("directory has no certificate secret reference")
+	}
+
 	certificateSecret, ok, err := b.directory.Spec.CertificateSecretRef.Resolve(ctx, b.client, b.scheme, b.directory)
 	if !ok && err == nil {
 		return nil, fmt.Errorf("referenced certificate secret not found")
@@ -98,18 +121,107 @@ func (b *clientBuilderImpl) Build(ctx context.Context) (Client, error) {
 		return nil, fmt.Errorf("failed to construct ca bundle")
 	}
 
-	directoryAddress := fmt.Sprintf("ldaps://ldap-%s.%s.svc.%s", b.directory.Name, b.directory.Namespace, k8sutils.GetClusterDomain())
-	if b.directory.Spec.AddressOverride != "" {
-		directoryAddress = b.directory.Spec.AddressOverride
+	baseDN, err := b.directory.GetDistinguishedName(ctx, b.client, b.scheme)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get base distinguished name: %w", err)
 	}
 
-	baseDN := "dc=" + strings.ReplaceAll(b.directory.Spec.Domain, ".", ",dc=")
+	return &clientImpl{
+		directoryAddresses: []string{DirectoryAddress(b.directory)},
+		caBundle:           caBundle,
+		adminUsername:      "cn=admin," + baseDN,
+		adminPassword:      string(adminPasswordSecret.Data["password"]),
+		baseDN:             baseDN,
+	}, nil
+}
+
+// DirectoryAddress returns the ldaps:// address of a managed directory.
+func DirectoryAddress(directory *ldapv1alpha1.LDAPDirectory) string {
+	if directory.Spec.AddressOverride != "" {
+		return directory.Spec.AddressOverride
+	}
+
+	return fmt.Sprintf("ldaps://ldap-%s.%s.svc.%s", directory.Name, directory.Namespace, k8sutils.GetClusterDomain())
+}
+
+func (b *clientBuilderImpl) buildExternal(ctx context.Context) (Client, error) {
+	external := b.directory.Spec.External
+
+	bindPasswordSecret, ok, err := external.BindPasswordSecretRef.Resolve(ctx, b.client, b.scheme, b.directory)
+	if !ok && err == nil {
+		return nil, fmt.Errorf("referenced bind password secret not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to resolve bind password secret reference: %w", err)
+	}
+
+	caBundle, err := b.resolveCABundle(ctx, external.CASecretRef)
+	if err != nil {
+		return nil, err
+	}
 
 	return &clientImpl{
-		directoryAddress: directoryAddress,
-		caBundle:         caBundle,
-		adminUsername:    "cn=admin," + baseDN,
-		adminPassword:    string(adminPasswordSecret.Data["password"]),
-		baseDN:           baseDN,
+		directoryAddresses: external.URLs,
+		caBundle:           caBundle,
+		adminUsername:      external.BindDN,
+		adminPassword:      string(bindPasswordSecret.(*corev1.Secret).Data["password"]),
+		baseDN:             external.BaseDN,
 	}, nil
 }
+
+func (b *clientBuilderImpl) BuildMigrationSource(ctx context.Context) (Client, error) {
+	if b.directory.Spec.Migration == nil {
+		return nil, fmt.Errorf("directory has no migration source")
+	}
+
+	source := b.directory.Spec.Migration.Source
+
+	bindPasswordSecret, ok, err := source.BindPasswordSecretRef.Resolve(ctx, b.client, b.scheme, b.directory)
+	if !ok && err == nil {
+		return nil, fmt.Errorf("referenced bind password secret not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to resolve bind password secret reference: %w", err)
+	}
+
+	caBundle, err := b.resolveCABundle(ctx, source.CASecretRef)
+	if err != nil {
+		return nil, err
+	}
+
+	baseDN := source.SearchBase
+	if baseDN == "" {
+		baseDN, err = b.directory.GetDistinguishedName(ctx, b.client, b.scheme)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get base distinguished name: %w", err)
+		}
+	}
+
+	return &clientImpl{
+		directoryAddresses: []string{source.URL},
+		caBundle:           caBundle,
+		adminUsername:      source.BindDN,
+		adminPassword:      string(bindPasswordSecret.(*corev1.Secret).Data["password"]),
+		baseDN:             baseDN,
+	}, nil
+}
+
+// resolveCABundle returns the CA bundle stored in the referenced secret,
+// or nil (the system trust store) if there is no reference.
+func (b *clientBuilderImpl) resolveCABundle(ctx context.Context, ref *reference.LocalSecretReference) (*x509.CertPool, error) {
+	if ref == nil {
+		return nil, nil
+	}
+
+	caSecret, ok, err := ref.Resolve(ctx, b.client, b.scheme, b.directory)
+	if !ok && err == nil {
+		return nil, fmt.Errorf("referenced ca secret not found")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to resolve ca secret reference: %w", err)
+	}
+
+	caBundle := x509.NewCertPool()
+	if ok := caBundle.AppendCertsFromPEM(caSecret.(*corev1.Secret).Data["ca.crt"]); !ok {
+		return nil, fmt.Errorf("failed to construct ca bundle")
+	}
+
+	return caBundle, nil
+}
@@ -27,6 +27,7 @@ import (
 
 	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
 	"github.com/gpu-ninja/ldap-operator/internal/ldap"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
 	"github.com/gpu-ninja/operator-utils/name"
 	"github.com/gpu-ninja/operator-utils/reference"
 	"github.com/stretchr/testify/assert"
@@ -77,7 +78,7 @@ func TestClient(t *testing.T) {
 		Image:      image,
 		Mounts:     mounts,
 		WaitingFor: wait.ForExit(),
-		Cmd:        []string{"/bootstrap.sh"},
+		Cmd:        []string{"ldap-operator bootstrap"},
 	}
 
 	// Bootstrap the database.
@@ -118,7 +119,7 @@ func TestClient(t *testing.T) {
 		},
 		Spec: ldapv1alpha1.LDAPDirectorySpec{
 			Domain: "example.com",
-			CertificateSecretRef: reference.LocalSecretReference{
+			CertificateSecretRef: &reference.LocalSecretReference{
 				Name: "directory-cert",
 			},
 		},
@@ -213,7 +214,7 @@ func TestClient(t *testing.T) {
 		assert.NoError(t, err)
 
 		err = ldapClient.GetEntry(dn, &ou)
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ldap.ErrNotFound)
 	})
 
 	t.Run("Groups", func(t *testing.T) {
@@ -259,7 +260,7 @@ func TestClient(t *testing.T) {
 		assert.NoError(t, err)
 
 		err = ldapClient.GetEntry(dn, &group)
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ldap.ErrNotFound)
 	})
 
 	t.Run("Users", func(t *testing.T) {
@@ -311,6 +312,135 @@ func TestClient(t *testing.T) {
 		assert.NoError(t, err)
 
 		err = ldapClient.GetEntry(dn, &user)
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ldap.ErrNotFound)
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		username := name.Generate("drift")
+		dn := fmt.Sprintf("uid=%s,%s", username, baseDN)
+
+		user := &ldap.User{
+			DistinguishedName: dn,
+			Username:          username,
+			Name:              "John Doe",
+			Surname:           "Doe",
+			Email:             "john@example.com",
+			Password:          "changeme",
+		}
+
+		diff, err := ldapClient.SyncEntry(user, true)
+		require.NoError(t, err)
+		assert.True(t, diff.Missing)
+
+		err = ldapClient.GetEntry(dn, &ldap.User{})
+		assert.ErrorIs(t, err, ldap.ErrNotFound)
+
+		diff, err = ldapClient.SyncEntry(user, false)
+		require.NoError(t, err)
+		assert.True(t, diff.Missing)
+
+		diff, err = ldapClient.SyncEntry(user, false)
+		require.NoError(t, err)
+		assert.True(t, diff.IsEmpty())
+
+		entryUUID, err := ldapClient.GetEntryUUID(dn)
+		require.NoError(t, err)
+		assert.Len(t, entryUUID, 36)
+
+		drifted := *user
+		drifted.Email = "jane@example.com"
+		drifted.Password = "changed"
+
+		diff, err = ldapClient.SyncEntry(&drifted, true)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"mail", "userPassword"}, diff.Attributes)
+
+		var existing ldap.User
+		err = ldapClient.GetEntry(dn, &existing)
+		require.NoError(t, err)
+		assert.Equal(t, "john@example.com", existing.Email)
+
+		diff, err = ldapClient.SyncEntry(&drifted, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"mail", "userPassword"}, diff.Attributes)
+
+		diff, err = ldapClient.SyncEntry(&drifted, false)
+		require.NoError(t, err)
+		assert.True(t, diff.IsEmpty())
+
+		err = ldapClient.DeleteEntry(dn, false)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		organizationalUnitName := name.Generate("people")
+		dn := fmt.Sprintf("ou=%s,%s", organizationalUnitName, baseDN)
+
+		_, err := ldapClient.CreateOrUpdateEntry(&ldap.OrganizationalUnit{
+			DistinguishedName: dn,
+			Name:              organizationalUnitName,
+		})
+		require.NoError(t, err)
+
+		username := name.Generate("user")
+		_, err = ldapClient.CreateOrUpdateEntry(&ldap.User{
+			DistinguishedName: fmt.Sprintf("uid=%s,%s", username, dn),
+			Username:          username,
+			Name:              "Jane Doe",
+			Surname:           "Doe",
+			Email:             "jane@example.com",
+		})
+		require.NoError(t, err)
+
+		records, err := ldapClient.Search(dn, "(objectClass=inetOrgPerson)", []string{"uid", "mail"})
+		require.NoError(t, err)
+
+		require.Len(t, records, 1)
+		assert.Equal(t, fmt.Sprintf("uid=%s,%s", username, dn), records[0].DN)
+		assert.Equal(t, []string{username}, records[0].GetAttributeValues("uid"))
+		assert.Equal(t, []string{"jane@example.com"}, records[0].GetAttributeValues("mail"))
+		assert.Nil(t, records[0].GetAttributeValues("cn"))
+
+		err = ldapClient.DeleteEntry(dn, true)
+		assert.NoError(t, err)
+	})
+	t.Run("Apply LDIF", func(t *testing.T) {
+		groupName := name.Generate("editors")
+		dn := fmt.Sprintf("cn=%s,%s", groupName, baseDN)
+
+		records, err := ldif.Parse(strings.NewReader(fmt.Sprintf(`dn: %[1]s
+objectClass: groupOfNames
+cn: %[2]s
+member: cn=admin,%[3]s
+
+dn: %[1]s
+changetype: modify
+add: member
+member: cn=admin,%[3]s
+member: cn=other,%[3]s
+-
+delete: description
+-
+`, dn, groupName, baseDN)))
+		require.NoError(t, err)
+
+		// The modify adds a member that already exists, and deletes a missing attribute.
+		applied, err := ldapClient.ApplyLDIF(records)
+		require.NoError(t, err)
+		assert.Equal(t, 2, applied)
+
+		// Applying the records again should be a no-op.
+		applied, err = ldapClient.ApplyLDIF(records)
+		require.NoError(t, err)
+		assert.Zero(t, applied)
+
+		var group ldap.Group
+		err = ldapClient.GetEntry(dn, &group)
+		require.NoError(t, err)
+
+		assert.ElementsMatch(t, []string{"cn=admin," + baseDN, "cn=other," + baseDN}, group.Members)
+
+		err = ldapClient.DeleteEntry(dn, false)
+		assert.NoError(t, err)
 	})
 }
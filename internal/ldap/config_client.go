@@ -0,0 +1,137 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ldap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+)
+
+// DefaultConfigAddress is the ldapi:/// socket of a directory pod
+// (/var/run/slapd/ldapi).
+const DefaultConfigAddress = "ldapi:///"
+
+// ConfigClient applies changes to the cn=config database of a local directory.
+type ConfigClient interface {
+	ApplyConfigLDIF(records []ldif.Record) (applied int, err error)
+	// WritableDatabases returns the DNs of the mdb databases of the directory
+	// that are not read-only.
+	WritableDatabases() ([]string, error)
+	// SetReadOnly puts the given databases into (or out of) read-only mode,
+	// eg. to quiesce writes while the volumes of the directory are snapshotted.
+	SetReadOnly(dns []string, readOnly bool) error
+}
+
+type configClientImpl struct {
+	address string
+}
+
+// NewConfigClient returns a client that connects to the directory over the
+// given ldapi:/// address, and authenticates with SASL EXTERNAL (ie. as the
+// uid and gid of the calling process).
+func NewConfigClient(address string) ConfigClient {
+	return &configClientImpl{
+		address: address,
+	}
+}
+
+// ApplyConfigLDIF applies a list of LDIF records to the cn=config database,
+// with the same semantics as Client.ApplyLDIF.
+func (c *configClientImpl) ApplyConfigLDIF(records []ldif.Record) (int, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	return applyRecords(conn, records)
+}
+
+func (c *configClientImpl) WritableDatabases() ([]string, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	res, err := conn.Search(goldap.NewSearchRequest(
+		"cn=config", goldap.ScopeSingleLevel, goldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=olcMdbConfig)", []string{"olcReadOnly"}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for databases: %w", err)
+	}
+
+	var dns []string
+	for _, entry := range res.Entries {
+		if !strings.EqualFold(entry.GetAttributeValue("olcReadOnly"), "TRUE") {
+			dns = append(dns, entry.DN)
+		}
+	}
+
+	return dns, nil
+}
+
+func (c *configClientImpl) SetReadOnly(dns []string, readOnly bool) error {
+	conn, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	value := "FALSE"
+	if readOnly {
+		value = "TRUE"
+	}
+
+	for _, dn := range dns {
+		modifyRequest := goldap.NewModifyRequest(dn, nil)
+		modifyRequest.Replace("olcReadOnly", []string{value})
+
+		if err := conn.Modify(modifyRequest); err != nil {
+			// The database may have been removed since it was frozen.
+			if goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+				continue
+			}
+
+			return fmt.Errorf("failed to set read-only mode of %q: %w", dn, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *configClientImpl) connect() (*goldap.Conn, error) {
+	conn, err := goldap.DialURL(c.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap directory: %w", err)
+	}
+
+	conn.SetTimeout(5 * time.Second)
+
+	if err := conn.ExternalBind(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to bind to cn=config: %w", err)
+	}
+
+	return conn, nil
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 
 	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
 	"github.com/stretchr/testify/mock"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -54,6 +55,12 @@ func (b *fakeClientBuilder) Build(_ context.Context) (Client, error) {
 	}, nil
 }
 
+func (b *fakeClientBuilder) BuildMigrationSource(_ context.Context) (Client, error) {
+	return &fakeClient{
+		Mock: b.m,
+	}, nil
+}
+
 type fakeClient struct {
 	*mock.Mock
 }
@@ -73,7 +80,37 @@ func (c *fakeClient) CreateOrUpdateEntry(entry any) (bool, error) {
 	return args.Bool(0), args.Error(1)
 }
 
+func (c *fakeClient) SyncEntry(entry any, dryRun bool) (*EntryDiff, error) {
+	args := c.Called(entry, dryRun)
+	return args.Get(0).(*EntryDiff), args.Error(1)
+}
+
+func (c *fakeClient) GetEntryUUID(dn string) (string, error) {
+	args := c.Called(dn)
+	return args.String(0), args.Error(1)
+}
+
 func (c *fakeClient) DeleteEntry(dn string, cascading bool) error {
 	args := c.Called(dn, cascading)
 	return args.Error(0)
 }
+
+func (c *fakeClient) ApplyLDIF(records []ldif.Record) (int, error) {
+	args := c.Called(records)
+	return args.Int(0), args.Error(1)
+}
+
+func (c *fakeClient) GetChanges(after, before string, limit int) ([]Change, error) {
+	args := c.Called(after, before, limit)
+	return args.Get(0).([]Change), args.Error(1)
+}
+
+func (c *fakeClient) GetSyncState(searchBase string) (*SyncState, error) {
+	args := c.Called(searchBase)
+	return args.Get(0).(*SyncState), args.Error(1)
+}
+
+func (c *fakeClient) Search(baseDN, filter string, attributes []string) ([]ldif.Record, error) {
+	args := c.Called(baseDN, filter, attributes)
+	return args.Get(0).([]ldif.Record), args.Error(1)
+}
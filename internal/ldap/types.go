@@ -17,8 +17,28 @@
 
 package ldap
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AccessLogDN is the suffix of the accesslog database.
+const AccessLogDN = "cn=accesslog"
+
 type Entry interface {
-	*OrganizationalUnit | *Group | *User
+	*Organization | *OrganizationalUnit | *Group | *User
+}
+
+// Organization represents the root entry of the directory, created when the
+// directory is bootstrapped. It is both a dcObject and an organization.
+type Organization struct {
+	// DistinguishedName is the base distinguished name of the directory.
+	DistinguishedName string
+	// DomainComponent is the leftmost domain component of the distinguished name.
+	DomainComponent string
+	// Name is the name of the organization.
+	Name string
 }
 
 // OrganizationalUnit represents an organizational unit in the directory.
@@ -65,3 +85,79 @@ type User struct {
 	// Password is an optional password for this user.
 	Password string
 }
+
+// EntryDiff is how an entry in the directory differs from its desired state.
+type EntryDiff struct {
+	// Missing is true if the entry does not exist.
+	Missing bool
+	// Attributes are the names of the attributes whose values differ.
+	Attributes []string
+}
+
+// IsEmpty returns true if the entry matches its desired state.
+func (d *EntryDiff) IsEmpty() bool {
+	return !d.Missing && len(d.Attributes) == 0
+}
+
+func (d *EntryDiff) String() string {
+	if d.Missing {
+		return "entry is missing"
+	}
+
+	return "attributes differ: " + strings.Join(d.Attributes, ", ")
+}
+
+// ChangeIDLayout is the layout of change IDs (accesslog reqStart timestamps).
+const ChangeIDLayout = "20060102150405.000000Z"
+
+// Change is a successful write operation recorded by the accesslog overlay.
+type Change struct {
+	// ID is the start time of the operation (reqStart), it is unique and
+	// ordered so is used as a cursor.
+	ID string
+	// Type is the type of operation (add, modify, delete, modrdn).
+	Type string
+	// DN is the distinguished name of the target entry.
+	DN string
+	// Modifier is the distinguished name of the client that made the change.
+	Modifier string
+	// Mods are the attribute modifications, in the accesslog reqMod format
+	// (eg. "member:+ uid=demo,ou=users,dc=example,dc=com").
+	Mods []string
+	// NewRDN is the new relative distinguished name (modrdn only).
+	NewRDN string
+	// NewSuperior is the new parent distinguished name (modrdn only).
+	NewSuperior string
+}
+
+// SyncState is the replication state of a subtree of the directory.
+type SyncState struct {
+	// ContextCSNs are the context change sequence numbers of the subtree
+	// (one per server id), as maintained by the syncprov overlay / syncrepl.
+	ContextCSNs []string
+	// Entries is the number of entries in the subtree (including the base).
+	Entries int
+}
+
+// LatestChange returns the time of the most recent change sequence number,
+// or the zero time if there are none.
+func (s *SyncState) LatestChange() (time.Time, string, error) {
+	var latest time.Time
+	var latestCSN string
+	for _, csn := range s.ContextCSNs {
+		// eg. 20231018123456.123456Z#000000#000#000000
+		timestamp, _, _ := strings.Cut(csn, "#")
+
+		t, err := time.Parse("20060102150405.999999Z", timestamp)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid change sequence number %q: %w", csn, err)
+		}
+
+		if t.After(latest) {
+			latest = t
+			latestCSN = csn
+		}
+	}
+
+	return latest, latestCSN, nil
+}
@@ -0,0 +1,377 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ldif implements a minimal parser and encoder for the LDAP Data
+// Interchange Format (RFC 2849).
+package ldif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ChangeType is the type of change described by a record.
+type ChangeType string
+
+const (
+	// ChangeTypeAdd adds a new entry to the directory.
+	ChangeTypeAdd ChangeType = "add"
+	// ChangeTypeModify modifies the attributes of an existing entry.
+	ChangeTypeModify ChangeType = "modify"
+	// ChangeTypeDelete deletes an existing entry.
+	ChangeTypeDelete ChangeType = "delete"
+)
+
+// ModificationType is the type of a single attribute modification.
+type ModificationType string
+
+const (
+	ModificationTypeAdd     ModificationType = "add"
+	ModificationTypeReplace ModificationType = "replace"
+	ModificationTypeDelete  ModificationType = "delete"
+)
+
+// Attribute is an attribute and its values.
+type Attribute struct {
+	// Name is the name (type) of the attribute.
+	Name string
+	// Values are the values of the attribute.
+	Values []string
+}
+
+// Modification is a single attribute modification within a modify record.
+type Modification struct {
+	Attribute
+	// Type is the type of modification.
+	Type ModificationType
+}
+
+// Record is a single LDIF content or change record.
+type Record struct {
+	// DN is the distinguished name of the entry.
+	DN string
+	// ChangeType is the type of change, content records are treated as adds.
+	ChangeType ChangeType
+	// Attributes are the attributes of the entry (add records only).
+	Attributes []Attribute
+	// Modifications are the attribute modifications (modify records only).
+	Modifications []Modification
+}
+
+// GetAttributeValues returns the values of the named attribute (add records only).
+func (r *Record) GetAttributeValues(name string) []string {
+	for _, attr := range r.Attributes {
+		if strings.EqualFold(attr.Name, name) {
+			return attr.Values
+		}
+	}
+
+	return nil
+}
+
+// Parse parses a stream of LDIF records.
+func Parse(r io.Reader) ([]Record, error) {
+	blocks, err := readBlocks(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for _, block := range blocks {
+		if len(block) == 1 && strings.EqualFold(block[0].name, "version") {
+			continue
+		}
+
+		if len(block) > 0 && strings.EqualFold(block[0].name, "version") {
+			block = block[1:]
+		}
+
+		record, err := parseRecord(block)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, *record)
+	}
+
+	return records, nil
+}
+
+// Marshal encodes the given records as LDIF.
+func Marshal(records []Record) []byte {
+	var buf bytes.Buffer
+
+	for i, record := range records {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+
+		writeLine(&buf, "dn", record.DN)
+
+		switch record.ChangeType {
+		case ChangeTypeModify:
+			writeLine(&buf, "changetype", string(ChangeTypeModify))
+			for _, mod := range record.Modifications {
+				writeLine(&buf, string(mod.Type), mod.Name)
+				for _, value := range mod.Values {
+					writeLine(&buf, mod.Name, value)
+				}
+				buf.WriteString("-\n")
+			}
+		case ChangeTypeDelete:
+			writeLine(&buf, "changetype", string(ChangeTypeDelete))
+		default:
+			for _, attr := range record.Attributes {
+				for _, value := range attr.Values {
+					writeLine(&buf, attr.Name, value)
+				}
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+type line struct {
+	number int
+	name   string
+	value  string
+}
+
+// readBlocks splits the input into blank line separated blocks of unfolded,
+// decoded attribute lines.
+func readBlocks(r io.Reader) ([][]line, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var blocks [][]line
+	var block []line
+	var logical string
+	var logicalNumber, number int
+	var inComment bool
+
+	flush := func() error {
+		if logical == "" {
+			return nil
+		}
+
+		l, err := parseLine(logicalNumber, logical)
+		if err != nil {
+			return err
+		}
+
+		block = append(block, *l)
+		logical = ""
+
+		return nil
+	}
+
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+
+		// Continuation of the previous line.
+		if strings.HasPrefix(text, " ") {
+			if !inComment {
+				logical += text[1:]
+			}
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return nil, err
+		}
+
+		inComment = strings.HasPrefix(text, "#")
+		if inComment {
+			continue
+		}
+
+		if strings.TrimSpace(text) == "" {
+			if len(block) > 0 {
+				blocks = append(blocks, block)
+				block = nil
+			}
+			continue
+		}
+
+		logical = text
+		logicalNumber = number
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ldif: %w", err)
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+func parseLine(number int, text string) (*line, error) {
+	if text == "-" {
+		return &line{number: number, name: "-"}, nil
+	}
+
+	idx := strings.Index(text, ":")
+	if idx <= 0 {
+		return nil, fmt.Errorf("line %d: missing attribute separator", number)
+	}
+
+	name := text[:idx]
+	rest := text[idx+1:]
+
+	switch {
+	case strings.HasPrefix(rest, ":"):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid base64 value: %w", number, err)
+		}
+
+		return &line{number: number, name: name, value: string(decoded)}, nil
+	case strings.HasPrefix(rest, "<"):
+		return nil, fmt.Errorf("line %d: url values are not supported", number)
+	default:
+		return &line{number: number, name: name, value: strings.TrimLeft(rest, " ")}, nil
+	}
+}
+
+func parseRecord(block []line) (*Record, error) {
+	if !strings.EqualFold(block[0].name, "dn") {
+		return nil, fmt.Errorf("line %d: expected dn, got %q", block[0].number, block[0].name)
+	}
+
+	record := &Record{
+		DN:         block[0].value,
+		ChangeType: ChangeTypeAdd,
+	}
+
+	lines := block[1:]
+	if len(lines) > 0 && strings.EqualFold(lines[0].name, "changetype") {
+		record.ChangeType = ChangeType(strings.ToLower(lines[0].value))
+		lines = lines[1:]
+	}
+
+	switch record.ChangeType {
+	case ChangeTypeAdd:
+		for _, l := range lines {
+			if l.name == "-" {
+				return nil, fmt.Errorf("line %d: unexpected modification separator", l.number)
+			}
+
+			record.Attributes = appendValue(record.Attributes, l.name, l.value)
+		}
+	case ChangeTypeModify:
+		var mod *Modification
+		for _, l := range lines {
+			if l.name == "-" {
+				if mod == nil {
+					return nil, fmt.Errorf("line %d: unexpected modification separator", l.number)
+				}
+
+				record.Modifications = append(record.Modifications, *mod)
+				mod = nil
+				continue
+			}
+
+			if mod == nil {
+				modType := ModificationType(strings.ToLower(l.name))
+				if modType != ModificationTypeAdd && modType != ModificationTypeReplace && modType != ModificationTypeDelete {
+					return nil, fmt.Errorf("line %d: unsupported modification type %q", l.number, l.name)
+				}
+
+				mod = &Modification{
+					Attribute: Attribute{Name: l.value},
+					Type:      modType,
+				}
+				continue
+			}
+
+			if !strings.EqualFold(l.name, mod.Name) {
+				return nil, fmt.Errorf("line %d: expected attribute %q, got %q", l.number, mod.Name, l.name)
+			}
+
+			mod.Values = append(mod.Values, l.value)
+		}
+
+		// The trailing separator is optional on the last modification.
+		if mod != nil {
+			record.Modifications = append(record.Modifications, *mod)
+		}
+	case ChangeTypeDelete:
+		if len(lines) > 0 {
+			return nil, fmt.Errorf("line %d: unexpected content in delete record", lines[0].number)
+		}
+	default:
+		return nil, fmt.Errorf("line %d: unsupported changetype %q", block[0].number, record.ChangeType)
+	}
+
+	return record, nil
+}
+
+func appendValue(attrs []Attribute, name, value string) []Attribute {
+	for i := range attrs {
+		if strings.EqualFold(attrs[i].Name, name) {
+			attrs[i].Values = append(attrs[i].Values, value)
+			return attrs
+		}
+	}
+
+	return append(attrs, Attribute{Name: name, Values: []string{value}})
+}
+
+func writeLine(buf *bytes.Buffer, name, value string) {
+	if isSafeString(value) {
+		fmt.Fprintf(buf, "%s: %s\n", name, value)
+	} else {
+		fmt.Fprintf(buf, "%s:: %s\n", name, base64.StdEncoding.EncodeToString([]byte(value)))
+	}
+}
+
+// isSafeString reports whether a value can be written without base64 encoding.
+func isSafeString(value string) bool {
+	if value == "" {
+		return true
+	}
+
+	switch value[0] {
+	case ' ', ':', '<':
+		return false
+	}
+
+	if value[len(value)-1] == ' ' {
+		return false
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == 0 || c == '\n' || c == '\r' || c > 127 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,136 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ldif_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gpu-ninja/ldap-operator/internal/ldif"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Content Records", func(t *testing.T) {
+		records, err := ldif.Parse(strings.NewReader(`version: 1
+
+# The users organizational unit.
+dn: ou=users,dc=example,dc=com
+objectClass: top
+objectClass: organizationalUnit
+ou: users
+description: A very long description that has been folded
+  onto a second line
+
+dn: uid=demo,ou=users,dc=example,dc=com
+objectClass: inetOrgPerson
+uid: demo
+cn:: Sm9obiBEb2U=
+sn: Doe
+`))
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+
+		assert.Equal(t, "ou=users,dc=example,dc=com", records[0].DN)
+		assert.Equal(t, ldif.ChangeTypeAdd, records[0].ChangeType)
+		assert.Equal(t, []string{"top", "organizationalUnit"}, records[0].GetAttributeValues("objectClass"))
+		assert.Equal(t, []string{"A very long description that has been folded onto a second line"}, records[0].GetAttributeValues("description"))
+
+		assert.Equal(t, []string{"John Doe"}, records[1].GetAttributeValues("cn"))
+	})
+
+	t.Run("Change Records", func(t *testing.T) {
+		records, err := ldif.Parse(strings.NewReader(`dn: cn=config
+changetype: modify
+replace: olcLogLevel
+olcLogLevel: stats
+olcLogLevel: acl
+-
+delete: olcTLSCipherSuite
+
+dn: cn=old,dc=example,dc=com
+changetype: delete
+`))
+		require.NoError(t, err)
+		require.Len(t, records, 2)
+
+		assert.Equal(t, ldif.ChangeTypeModify, records[0].ChangeType)
+		require.Len(t, records[0].Modifications, 2)
+		assert.Equal(t, ldif.ModificationTypeReplace, records[0].Modifications[0].Type)
+		assert.Equal(t, "olcLogLevel", records[0].Modifications[0].Name)
+		assert.Equal(t, []string{"stats", "acl"}, records[0].Modifications[0].Values)
+		assert.Equal(t, ldif.ModificationTypeDelete, records[0].Modifications[1].Type)
+		assert.Empty(t, records[0].Modifications[1].Values)
+
+		assert.Equal(t, ldif.ChangeTypeDelete, records[1].ChangeType)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := ldif.Parse(strings.NewReader("objectClass: top\n"))
+		assert.Error(t, err)
+
+		_, err = ldif.Parse(strings.NewReader("dn: cn=config\nchangetype: modrdn\n"))
+		assert.Error(t, err)
+
+		_, err = ldif.Parse(strings.NewReader("dn: cn=config\nchangetype: modify\nreplace: olcLogLevel\nolcDebug: 1\n"))
+		assert.Error(t, err)
+	})
+}
+
+func TestMarshal(t *testing.T) {
+	records := []ldif.Record{
+		{
+			DN:         "uid=demo,dc=example,dc=com",
+			ChangeType: ldif.ChangeTypeAdd,
+			Attributes: []ldif.Attribute{
+				{Name: "objectClass", Values: []string{"top", "inetOrgPerson"}},
+				{Name: "cn", Values: []string{" leading space"}},
+			},
+		},
+		{
+			DN:         "cn=config",
+			ChangeType: ldif.ChangeTypeModify,
+			Modifications: []ldif.Modification{
+				{
+					Attribute: ldif.Attribute{Name: "olcLogLevel", Values: []string{"stats"}},
+					Type:      ldif.ModificationTypeReplace,
+				},
+			},
+		},
+	}
+
+	data := ldif.Marshal(records)
+
+	assert.Equal(t, `dn: uid=demo,dc=example,dc=com
+objectClass: top
+objectClass: inetOrgPerson
+cn:: IGxlYWRpbmcgc3BhY2U=
+
+dn: cn=config
+changetype: modify
+replace: olcLogLevel
+olcLogLevel: stats
+-
+`, string(data))
+
+	parsed, err := ldif.Parse(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, records, parsed)
+}
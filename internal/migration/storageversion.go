@@ -0,0 +1,155 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package migration rewrites stored custom resources in the current storage
+// version of their CRD, so that older versions can eventually be removed.
+package migration
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"go.uber.org/zap"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultRetryInterval is how long to wait before retrying a failed migration.
+const defaultRetryInterval = 10 * time.Second
+
+// Resource is a custom resource whose stored objects should be migrated.
+type Resource struct {
+	// CRDName is the name of the custom resource definition (eg. "ldapusers.ldap.gpu-ninja.com").
+	CRDName string
+	// NewList returns an empty list of the resource (in any served version).
+	NewList func() client.ObjectList
+}
+
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=get;update;patch
+
+// StorageVersionMigrator is a manager runnable that rewrites every object of
+// the given resources, and then removes all but the storage version from the
+// stored versions of their CRDs.
+type StorageVersionMigrator struct {
+	Client        client.Client
+	Resources     []Resource
+	RetryInterval time.Duration
+}
+
+// Start migrates the resources, retrying until successful (or cancelled).
+// Objects are converted by the conversion webhook, so the first attempts may
+// fail until the webhook server is reachable.
+func (m *StorageVersionMigrator) Start(ctx context.Context) error {
+	logger := zaplogr.FromContext(ctx)
+
+	retryInterval := m.RetryInterval
+	if retryInterval == 0 {
+		retryInterval = defaultRetryInterval
+	}
+
+	return wait.PollUntilContextCancel(ctx, retryInterval, true, func(ctx context.Context) (bool, error) {
+		if err := m.Migrate(ctx); err != nil {
+			logger.Warn("Failed to migrate storage version, will retry", zap.Error(err))
+
+			return false, nil
+		}
+
+		return true, nil
+	})
+}
+
+// NeedLeaderElection ensures only a single replica migrates objects.
+func (m *StorageVersionMigrator) NeedLeaderElection() bool {
+	return true
+}
+
+// Migrate migrates every resource once.
+func (m *StorageVersionMigrator) Migrate(ctx context.Context) error {
+	for _, resource := range m.Resources {
+		if err := m.migrate(ctx, resource); err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", resource.CRDName, err)
+		}
+	}
+
+	return nil
+}
+
+func (m *StorageVersionMigrator) migrate(ctx context.Context, resource Resource) error {
+	logger := zaplogr.FromContext(ctx).With(zap.String("crd", resource.CRDName))
+
+	var crd apiextensionsv1.CustomResourceDefinition
+	if err := m.Client.Get(ctx, client.ObjectKey{Name: resource.CRDName}, &crd); err != nil {
+		return fmt.Errorf("failed to get custom resource definition: %w", err)
+	}
+
+	var storageVersion string
+	for _, version := range crd.Spec.Versions {
+		if version.Storage {
+			storageVersion = version.Name
+			break
+		}
+	}
+
+	if storageVersion == "" {
+		return fmt.Errorf("no storage version found")
+	}
+
+	storedVersions := crd.Status.StoredVersions
+	if len(storedVersions) == 1 && storedVersions[0] == storageVersion {
+		return nil
+	}
+
+	logger.Info("Migrating stored objects",
+		zap.String("storageVersion", storageVersion), zap.Strings("storedVersions", storedVersions))
+
+	list := resource.NewList()
+	if err := m.Client.List(ctx, list); err != nil {
+		return fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	objs, err := meta.ExtractList(list)
+	if err != nil {
+		return fmt.Errorf("failed to extract objects: %w", err)
+	}
+
+	for _, obj := range objs {
+		o, ok := obj.(client.Object)
+		if !ok {
+			return fmt.Errorf("unexpected object type %T", obj)
+		}
+
+		// A no-op update is enough for the object to be written in the storage version.
+		// Conflicts mean the object has already been written since it was listed.
+		if err := m.Client.Update(ctx, o); err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+			return fmt.Errorf("failed to update %s/%s: %w", o.GetNamespace(), o.GetName(), err)
+		}
+	}
+
+	crd.Status.StoredVersions = []string{storageVersion}
+	if err := m.Client.Status().Update(ctx, &crd); err != nil {
+		return fmt.Errorf("failed to update stored versions: %w", err)
+	}
+
+	logger.Info("Migrated stored objects", zap.Int("count", len(objs)))
+
+	return nil
+}
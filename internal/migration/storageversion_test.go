@@ -0,0 +1,125 @@
+/* SPDX-License-Identifier: Apache-2.0
+ *
+ * Copyright 2023 Damian Peckett <damian@pecke.tt>.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package migration_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gpu-ninja/ldap-operator/api"
+	ldapv1alpha1 "github.com/gpu-ninja/ldap-operator/api/v1alpha1"
+	"github.com/gpu-ninja/ldap-operator/internal/migration"
+	"github.com/gpu-ninja/operator-utils/zaplogr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestStorageVersionMigrator(t *testing.T) {
+	ctrl.SetLogger(zaplogr.New(zaptest.NewLogger(t)))
+
+	scheme := runtime.NewScheme()
+
+	err := apiextensionsv1.AddToScheme(scheme)
+	require.NoError(t, err)
+
+	err = ldapv1alpha1.AddToScheme(scheme)
+	require.NoError(t, err)
+
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "ldapusers.ldap.gpu-ninja.com",
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1", Served: true},
+				{Name: "v1beta1", Served: true, Storage: true},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{
+			StoredVersions: []string{"v1alpha1", "v1beta1"},
+		},
+	}
+
+	user := &ldapv1alpha1.LDAPUser{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-user",
+			Namespace: "default",
+		},
+		Spec: ldapv1alpha1.LDAPUserSpec{
+			LDAPObjectSpec: api.LDAPObjectSpec{
+				DirectoryRef: api.LocalLDAPDirectoryReference{
+					Name: "test-directory",
+				},
+			},
+			Username: "test-user",
+		},
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(crd, user).
+		WithStatusSubresource(crd).
+		Build()
+
+	m := &migration.StorageVersionMigrator{
+		Client: c,
+		Resources: []migration.Resource{
+			{
+				CRDName: crd.Name,
+				NewList: func() client.ObjectList { return &ldapv1alpha1.LDAPUserList{} },
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	var existingUser ldapv1alpha1.LDAPUser
+	err = c.Get(ctx, client.ObjectKeyFromObject(user), &existingUser)
+	require.NoError(t, err)
+
+	err = m.Migrate(ctx)
+	require.NoError(t, err)
+
+	var updatedCRD apiextensionsv1.CustomResourceDefinition
+	err = c.Get(ctx, client.ObjectKeyFromObject(crd), &updatedCRD)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"v1beta1"}, updatedCRD.Status.StoredVersions)
+
+	var updatedUser ldapv1alpha1.LDAPUser
+	err = c.Get(ctx, client.ObjectKeyFromObject(user), &updatedUser)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, existingUser.ResourceVersion, updatedUser.ResourceVersion)
+
+	// Once migrated, nothing is rewritten.
+	err = m.Migrate(ctx)
+	require.NoError(t, err)
+
+	var unchangedUser ldapv1alpha1.LDAPUser
+	err = c.Get(ctx, client.ObjectKeyFromObject(user), &unchangedUser)
+	require.NoError(t, err)
+
+	assert.Equal(t, updatedUser.ResourceVersion, unchangedUser.ResourceVersion)
+}